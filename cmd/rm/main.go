@@ -1,88 +1,1055 @@
 package main
 
 import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/clean"
 	"github.com/user/safe-rm/internal/cli"
 	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/enforce"
+	"github.com/user/safe-rm/internal/inode"
+	"github.com/user/safe-rm/internal/janitor"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/proc"
 	"github.com/user/safe-rm/internal/protect"
 	"github.com/user/safe-rm/internal/restore"
+	"github.com/user/safe-rm/internal/throttle"
 	"github.com/user/safe-rm/internal/trash"
+	"github.com/user/safe-rm/internal/tui"
+	"github.com/user/safe-rm/internal/update"
+	"github.com/user/safe-rm/internal/usage"
 )
 
 func main() {
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "safe-rm: warning: failed to load config: %v\n", err)
-		cfg = config.Default()
+	// Select the error format first so that usage errors honor it too
+	if format := cli.ErrorFormatArg(os.Args[1:]); format != "" {
+		output.SetErrorFormat(format)
 	}
 
-	opts, err := cli.Parse(os.Args[1:])
+	var opts *cli.Options
+	var err error
+	if cli.UsesSubcommands(os.Args[0]) {
+		opts, err = cli.ParseSubcommand(os.Args[1:])
+	} else {
+		opts, err = cli.Parse(os.Args[1:])
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "safe-rm: %v\n", err)
+		output.Error(output.WithCode(output.CodeUsage, err))
 		os.Exit(1)
 	}
 
+	output.SetLevel(opts.Verbosity)
+	output.SetJSON(opts.JSON)
+
+	cfg, err := config.Load()
+	if err != nil {
+		output.Warning("failed to load config: %v", err)
+		cfg = config.Default()
+	}
+
 	// Handle --help and --version (already printed, just exit cleanly)
 	if opts.ExitClean {
 		return
 	}
 
+	// A per-invocation trash directory overrides config and environment
+	if opts.TrashDir != "" {
+		trashDir, err := filepath.Abs(config.ExpandHome(opts.TrashDir))
+		if err != nil {
+			output.Error(output.WithCode(output.CodeUsage, fmt.Errorf("invalid --trash-dir: %v", err)))
+			os.Exit(1)
+		}
+		cfg.TrashDir = trashDir
+	}
+
+	// Script mode never prompts, and errors are for programs to read
+	scriptMode = useScriptMode(cfg, opts)
+	if scriptMode && opts.ErrorFormat == "" {
+		output.SetErrorFormat("json")
+	}
+
+	if opts.Shred {
+		cfg.ShredOnEmpty = true
+	}
+	cfg.AssumeTrash = opts.AssumeTrash
+	if opts.Fallback != "" {
+		cfg.CrossDevice = opts.Fallback
+	}
+
+	for _, mapping := range opts.Maps {
+		from, to, _ := strings.Cut(mapping, "=")
+		from, errFrom := filepath.Abs(config.ExpandHome(from))
+		to, errTo := filepath.Abs(config.ExpandHome(to))
+		if errFrom != nil || errTo != nil {
+			output.Error(output.WithCode(output.CodeUsage, fmt.Errorf("invalid --map: %s", mapping)))
+			os.Exit(1)
+		}
+		cfg.AddRestoreMapping(from, to)
+	}
+
+	// An urgent manual run may use the disk at full speed
+	if opts.NoThrottle {
+		cfg.ThrottleRate = 0
+		cfg.ThrottleIOClass = ""
+		cfg.ThrottleNice = 0
+		cfg.AutopurgeMaxLoad = 0
+		cfg.AutopurgeRequireAC = false
+	}
+
+	switch {
+	case opts.AllNamespaces:
+		cfg.Namespace = ""
+	case opts.Namespace != "":
+		cfg.Namespace = opts.Namespace
+	}
+
+	// Tag everything trashed by this invocation unless SAFERM_SESSION groups it
+	if cfg.Session == "" {
+		cfg.Session = newSession()
+	}
+	if cfg.ProcessChain {
+		cfg.Process = proc.Describe()
+	}
+
 	// Handle special safe-rm subcommands
 	switch {
 	case opts.SafeList:
-		if err := restore.List(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "safe-rm: %v\n", err)
+		if err := restore.List(cfg, restore.ListOptions{AllRoots: opts.AllTrashes, TimeStyle: opts.TimeStyle, JSON: opts.JSON}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.RestoreArchive != "":
+		batch := batchOptions(opts, opts.SafeRestoreSession, opts.SafeRestore)
+		batch.ID = opts.SafeRestoreID
+		if batch.Session == "" && batch.Pattern == "" && batch.ID == "" {
+			output.Error(output.WithCode(output.CodeUsage,
+				fmt.Errorf("--restore-as-archive requires --safe-restore, --safe-restore-id or --safe-restore-session")))
+			os.Exit(1)
+		}
+		if err := restore.RestoreArchive(cfg, config.ExpandHome(opts.RestoreArchive), batch); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeUndo:
+		if err := restore.Undo(cfg, batchOptions(opts, "", "")); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeRestoreSession != "":
+		if err := restore.RestoreBatch(cfg, batchOptions(opts, opts.SafeRestoreSession, "")); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeRestore != "" && (restore.IsPattern(opts.SafeRestore) || deletedFilter(opts)):
+		if err := restore.RestoreBatch(cfg, batchOptions(opts, "", opts.SafeRestore)); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeRestoreID != "":
+		if err := restore.RestoreID(cfg, opts.SafeRestoreID, restore.RestoreOptions{AllRoots: opts.AllTrashes, Interactive: canPrompt()}); err != nil {
+			output.Error(err)
 			os.Exit(1)
 		}
 		return
 	case opts.SafeRestore != "":
-		if err := restore.Restore(cfg, opts.SafeRestore); err != nil {
-			fmt.Fprintf(os.Stderr, "safe-rm: %v\n", err)
+		if err := restore.Restore(cfg, config.ExpandHome(opts.SafeRestore), restore.RestoreOptions{AllRoots: opts.AllTrashes, Interactive: canPrompt()}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeInfo != "":
+		if err := restore.Info(cfg, opts.SafeInfo, restore.ListOptions{AllRoots: opts.AllTrashes, TimeStyle: opts.TimeStyle}); err != nil {
+			output.Error(err)
 			os.Exit(1)
 		}
 		return
 	case opts.SafePurge:
-		if err := restore.Purge(cfg, opts.PurgeDays); err != nil {
-			fmt.Fprintf(os.Stderr, "safe-rm: %v\n", err)
+		// Without --purge-days, items expire per their namespace's retention
+		if opts.PurgeDays == 0 && !cfg.RetentionEnabled() {
+			output.Printf("Retention is disabled (retention_days: %d); use --purge-days=N to purge.\n", cfg.RetentionDays)
+			return
+		}
+		lowerPriority(cfg)
+		if err := restore.Purge(cfg, opts.PurgeDays, restore.PurgeOptions{AllRoots: opts.AllTrashes, JSON: opts.JSON}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeHistory:
+		if err := restore.History(cfg, opts.HistoryPath, restore.ListOptions{TimeStyle: opts.TimeStyle}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeVerifyReceipts:
+		if err := restore.VerifyReceipts(cfg); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeAutopurge:
+		lowerPriority(cfg)
+		if err := restore.Autopurge(cfg, restore.PurgeOptions{AllRoots: opts.AllTrashes}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case len(opts.SafeCanary) > 0:
+		failed := false
+		for _, dir := range opts.SafeCanary {
+			canary, err := protect.InstallCanary(config.ExpandHome(dir))
+			if err != nil {
+				output.PathError(dir, err)
+				failed = true
+				continue
+			}
+			output.Printf("Installed canary: %s\n", canary)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	case opts.SafeCanaries:
+		if err := protect.ListCanaries(); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeEnforce:
+		// Inherited by the per-user autopurge processes
+		lowerPriority(cfg)
+		if err := enforce.Enforce(cfg); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafePin != "" || opts.SafeUnpin != "":
+		path, pinned := opts.SafePin, true
+		if path == "" {
+			path, pinned = opts.SafeUnpin, false
+		}
+		if err := restore.Pin(cfg, path, pinned, restore.RestoreOptions{AllRoots: opts.AllTrashes}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeAnnotate != "":
+		if err := restore.Annotate(cfg, config.ExpandHome(opts.SafeAnnotate), opts.Note, restore.RestoreOptions{AllRoots: opts.AllTrashes}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeRetag != "":
+		if err := restore.Retag(cfg, config.ExpandHome(opts.SafeRetag), opts.Tags, restore.RestoreOptions{AllRoots: opts.AllTrashes}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeForecast:
+		if err := restore.Forecast(cfg, opts.ForecastDays, restore.ListOptions{AllRoots: opts.AllTrashes, TimeStyle: opts.TimeStyle}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeSimulate:
+		if err := simulate(cfg, opts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeGrep != "":
+		grepOpts := restore.GrepOptions{AllRoots: opts.AllTrashes, MaxSize: opts.GrepMaxSize, Include: opts.GrepInclude}
+		if err := restore.Grep(cfg, opts.SafeGrep, grepOpts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeDestroyMatching != "":
+		destroyOpts := restore.DestroyOptions{
+			AllRoots: opts.AllTrashes,
+			Live:     opts.DestroyLive,
+			Token:    opts.ApprovalToken,
+			DryRun:   opts.DryRun,
+		}
+		if err := restore.DestroyMatching(cfg, opts.SafeDestroyMatching, destroyOpts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeUsers:
+		if err := restore.Users(cfg, restore.ListOptions{AllRoots: opts.AllTrashes, TimeStyle: opts.TimeStyle}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeDu:
+		if err := restore.DiskUsage(cfg, restore.ListOptions{AllRoots: opts.AllTrashes, JSON: opts.JSON}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeTrend:
+		if err := restore.Trend(cfg, opts.TrendDays); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeStats:
+		if err := usage.Show(cfg, opts.StatsPaths); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeHarden:
+		if err := hardenTrash(cfg, opts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeScan:
+		lowerPriority(cfg)
+		scanned, err := trash.ScanPending()
+		if err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		output.Verbosef("Scanned %d item(s).\n", scanned)
+		return
+	case opts.SafeSelfUpdate:
+		if err := selfUpdate(opts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeReindex:
+		if err := reindexTrash(cfg, opts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeMigrateHost != "":
+		if err := migrateHost(cfg, opts); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeBrowse:
+		if !stdinIsTerminal() {
+			output.Error(fmt.Errorf("--safe-browse needs a terminal"))
+			os.Exit(1)
+		}
+		if err := tui.Browse(cfg, restore.RestoreOptions{AllRoots: opts.AllTrashes}); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	case opts.SafeTrashRoots:
+		if err := manageTrashRoots(cfg, opts); err != nil {
+			output.Error(err)
 			os.Exit(1)
 		}
 		return
 	case opts.SafeEmpty:
 		if err := restore.Empty(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "safe-rm: %v\n", err)
+			output.Error(err)
 			os.Exit(1)
 		}
 		return
+	case opts.Resume != "":
+		if err := resumeSession(cfg, opts.Resume); err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// safe-rm clean removes the ignored files of a git work tree recursively
+	if opts.SafeClean {
+		paths, err := cleanArtifacts(opts)
+		if err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		if len(paths) == 0 {
+			return
+		}
+		opts.Files = paths
+		opts.Recursive = true
+	}
+
+	// safe-rm janitor removes the entries selected by a profile recursively,
+	// into the profile's namespace
+	if opts.SafeJanitor {
+		paths, err := janitorTargets(cfg, opts)
+		if err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		if len(paths) == 0 {
+			return
+		}
+		opts.Files = paths
+		opts.Recursive = true
+		cfg.Namespace = cfg.JanitorNamespace(opts.Profile)
+	}
+
+	// Files given by inode join the operands
+	exitCode := 0
+	if len(opts.Inodes) > 0 || opts.InodesFrom != "" {
+		paths, ok := resolveInodes(opts)
+		opts.Files = append(opts.Files, paths...)
+		if !ok {
+			exitCode = 1
+		}
+	}
+
+	// Pasted operands: file:// URIs, quotes, Windows line endings
+	if opts.LenientPaths {
+		var files []string
+		for _, arg := range opts.Files {
+			path, err := cli.LenientPath(arg)
+			if err != nil {
+				output.PathError(arg, output.WithCode(output.CodeUsage, err))
+				exitCode = 1
+				continue
+			}
+			if path != arg {
+				output.Debugf("operand %q interpreted as '%s'", arg, path)
+			}
+			files = append(files, path)
+		}
+		opts.Files = files
 	}
 
 	// No files specified
 	if len(opts.Files) == 0 {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+		if scriptMode {
+			// A glob the shell expanded to nothing (nullglob) is no reason to succeed
+			output.Error(output.WithCode(output.CodeUsage, fmt.Errorf("missing operand (script mode requires one, even with -f)")))
+			os.Exit(1)
+		}
 		if !opts.Force {
-			fmt.Fprintln(os.Stderr, "safe-rm: missing operand")
+			output.Error(output.WithCode(output.CodeUsage, fmt.Errorf("missing operand")))
 			os.Exit(1)
 		}
 		return
 	}
 
+	// The same file given twice (overlapping globs, brace expansion) is
+	// removed once instead of failing the second time
+	if !opts.Posix {
+		opts.Files = dedupeFiles(opts.Files)
+	}
+
+	// -I asks once, up front, before removing more than three files or
+	// removing recursively, instead of once per file like -i
+	if opts.InteractiveOnce && !opts.Force && (opts.Recursive || len(opts.Files) > 3) {
+		arguments := "arguments"
+		if len(opts.Files) == 1 {
+			arguments = "argument"
+		}
+		recursively := ""
+		if opts.Recursive {
+			recursively = " recursively"
+		}
+		ok, err := confirm("remove %d %s%s? ", len(opts.Files), arguments, recursively)
+		if err != nil {
+			output.Error(err)
+			os.Exit(1)
+		}
+		if !ok {
+			return
+		}
+	}
+
 	// Process each file/directory
-	exitCode := 0
+	stats := &runStats{start: time.Now()}
+	var notEmpty []string
 	for _, path := range opts.Files {
-		if err := processPath(cfg, opts, path); err != nil {
-			fmt.Fprintf(os.Stderr, "safe-rm: cannot remove '%s': %v\n", path, err)
+		before := stats.items
+		err := processPath(cfg, opts, path, stats)
+		if err != nil {
+			if output.Code(err) == output.CodeNotEmpty {
+				if !opts.Posix {
+					notEmpty = append(notEmpty, path)
+					continue
+				}
+				if opts.IgnoreFailOnNonEmpty {
+					stats.result(path, nil, false)
+					continue
+				}
+			}
+			output.PathError(path, err)
 			exitCode = 1
-			if !opts.Force {
+		}
+		stats.result(path, err, stats.items > before)
+	}
+
+	// With -d, a directory given before its contents ("rm -d a a/b") is empty
+	// once they are gone, so retry the deferred operands, innermost first
+	for i := len(notEmpty) - 1; i >= 0; i-- {
+		path := notEmpty[i]
+		before := stats.items
+		err := processPath(cfg, opts, path, stats)
+		if err != nil {
+			if opts.IgnoreFailOnNonEmpty && output.Code(err) == output.CodeNotEmpty {
+				stats.result(path, nil, false)
 				continue
 			}
+			output.PathError(path, err)
+			exitCode = 1
+		}
+		stats.result(path, err, stats.items > before)
+	}
+
+	if opts.VerboseErrors {
+		printResults(stats.results)
+	}
+	if opts.Report != "" {
+		if err := writeReport(opts.Report, stats.results); err != nil {
+			output.Error(fmt.Errorf("failed to write report: %v", err))
+			exitCode = 1
 		}
 	}
 
+	// The first removal of a day records the trash size for --safe-trend
+	if stats.items > 0 {
+		if err := restore.RecordDailySnapshot(cfg); err != nil {
+			output.Debugf("failed to record trash snapshot: %v", err)
+		}
+	}
+
+	// Measure trashed directories without making this invocation wait
+	if stats.items > 0 && cfg.BackgroundScan && len(trash.PendingScans()) > 0 {
+		if err := trash.StartBackgroundScan(); err != nil {
+			output.Debugf("failed to start background scan: %v", err)
+		}
+	}
+
+	if opts.SafeClean || opts.SafeJanitor {
+		output.Printf("Cleaned %d item(s), %s.\n", stats.items, output.FormatBytes(stats.bytes))
+	} else if stats.items > 0 && !opts.Posix {
+		output.Verbosef("%d item(s), %s (%s)\n", stats.items, output.FormatBytes(stats.bytes),
+			output.FormatThroughput(stats.bytes, time.Since(stats.start)))
+	}
+
 	os.Exit(exitCode)
 }
 
-func processPath(cfg *config.Config, opts *cli.Options, path string) error {
+// runStats accumulates totals for the end-of-run summary in verbose mode
+type runStats struct {
+	start   time.Time
+	items   int
+	bytes   int64
+	results []pathResult
+	trashed bool // This invocation was recorded as the last operation
+}
+
+// pathResult is the outcome for one operand, for --verbose-errors and --report
+type pathResult struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"` // "removed", "skipped" or "failed"
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// result records the outcome for an operand. Operands that neither failed
+// nor were removed (declined prompts, missing files with -f) are skipped.
+func (s *runStats) result(path string, err error, removed bool) {
+	r := pathResult{Path: path, Status: "skipped"}
+	switch {
+	case err != nil:
+		r.Status = "failed"
+		r.Code = output.Code(err)
+		r.Message = err.Error()
+	case removed:
+		r.Status = "removed"
+	}
+	s.results = append(s.results, r)
+}
+
+// printResults writes the per-operand status table to stderr
+func printResults(results []pathResult) {
+	fmt.Fprintf(output.Stderr, "\n%-8s %-18s %s\n", "STATUS", "CODE", "PATH")
+	for _, r := range results {
+		code := r.Code
+		if code == "" {
+			code = "-"
+		}
+		fmt.Fprintf(output.Stderr, "%-8s %-18s %s\n", r.Status, code, r.Path)
+	}
+}
+
+// writeReport writes the per-operand results to path, one JSON object per
+// line, so that batch jobs can retry exactly the failed paths
+func writeReport(path string, results []pathResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, r := range results {
+		if err := encoder.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// record adds a completed removal to the totals and the audit log
+func (s *runStats) record(cfg *config.Config, action, absPath, trashPath string, size int64, elapsed time.Duration) {
+	s.items++
+	s.bytes += size
+
+	entry := audit.Entry{
+		Action:     action,
+		Path:       absPath,
+		TrashPath:  trashPath,
+		Bytes:      size,
+		DurationMs: elapsed.Milliseconds(),
+	}
+	if err := audit.Record(cfg, entry); err != nil {
+		output.Warning("failed to write audit log: %v", err)
+	}
+	if action == audit.ActionTrash {
+		if err := trash.RecordRecent(absPath); err != nil {
+			output.Debugf("failed to record recently deleted path: %v", err)
+		}
+		if !s.trashed {
+			s.trashed = true
+			op := trash.Operation{Session: cfg.Session, Time: cfg.Now(), Command: commandLine()}
+			if err := trash.RecordOperation(op); err != nil {
+				output.Warning("failed to record the operation for --safe-undo: %v", err)
+			}
+		}
+	}
+}
+
+// commandLine returns the command line of this invocation, for display
+func commandLine() string {
+	args := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"") {
+			args[i] = strconv.Quote(arg)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// manageTrashRoots registers or forgets a trash root, then lists all known roots
+func manageTrashRoots(cfg *config.Config, opts *cli.Options) error {
+	if opts.RegisterRoot != "" {
+		if err := trash.RegisterRoot(opts.RegisterRoot); err != nil {
+			return fmt.Errorf("cannot register trash root: %v", err)
+		}
+	}
+	if opts.ForgetRoot != "" {
+		if err := trash.ForgetRoot(opts.ForgetRoot); err != nil {
+			return fmt.Errorf("cannot forget trash root: %v", err)
+		}
+	}
+	return restore.ListRoots(cfg)
+}
+
+// hardenTrash restricts permissions of the trash (or of all known roots)
+func hardenTrash(cfg *config.Config, opts *cli.Options) error {
+	roots := []string{cfg.GetTrashDir()}
+	if opts.AllTrashes {
+		roots = trash.Roots(cfg)
+	}
+
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		if err := trash.MarkRoot(cfg, root); err != nil {
+			return err
+		}
+		fixed, err := trash.Harden(root)
+		if err != nil {
+			return fmt.Errorf("failed to harden %s: %v", root, err)
+		}
+		output.Printf("Hardened %s (%d permission(s) fixed)\n", root, fixed)
+	}
+	return nil
+}
+
+// selfUpdate replaces the running binary with the latest release of the
+// selected channel, if it is newer
+func selfUpdate(opts *cli.Options) error {
+	channel := opts.Channel
+	if channel == "" {
+		channel = update.ChannelStable
+	}
+	release, err := update.Latest(channel)
+	if err != nil {
+		return err
+	}
+	if update.Compare(release.Version(), cli.Version) <= 0 {
+		output.Printf("safe-rm %s is up to date (latest %s release: %s)\n", cli.Version, channel, release.Version())
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the running binary: %v", err)
+	}
+	data, err := update.Download(release)
+	if err != nil {
+		return err
+	}
+	if err := update.Replace(exe, data); err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("cannot replace %s: %v (run the update as its owner, e.g. with sudo)", exe, err)
+		}
+		return fmt.Errorf("cannot replace %s: %v", exe, err)
+	}
+	output.Printf("Updated safe-rm %s -> %s (%s)\n", cli.Version, release.Version(), exe)
+	return nil
+}
+
+// reindexTrash rebuilds the index of the trash (or of all known roots)
+func reindexTrash(cfg *config.Config, opts *cli.Options) error {
+	roots := []string{cfg.GetTrashDir()}
+	if opts.AllTrashes {
+		roots = trash.Roots(cfg)
+	}
+
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) || !trash.Indexed(root) {
+			continue
+		}
+		if err := trash.MarkRoot(cfg, root); err != nil {
+			return err
+		}
+		indexed, err := trash.Reindex(root)
+		if err != nil {
+			return fmt.Errorf("failed to reindex %s: %v", root, err)
+		}
+		output.Printf("Indexed %s (%d item(s))\n", root, indexed)
+	}
+	return nil
+}
+
+// migrateHost moves the items trashed on one host to another in the trash,
+// or with --all-trashes in every known trash root
+func migrateHost(cfg *config.Config, opts *cli.Options) error {
+	oldHost, newHost, _ := strings.Cut(opts.SafeMigrateHost, "=")
+	roots := []string{cfg.GetTrashDir()}
+	if opts.AllTrashes {
+		roots = trash.Roots(cfg)
+	}
+
+	total := 0
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		if err := trash.MarkRoot(cfg, root); err != nil {
+			return err
+		}
+		migrated, err := trash.MigrateHost(cfg, root, oldHost, newHost)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %v", root, err)
+		}
+		if migrated > 0 {
+			output.Verbosef("Migrated %s (%d item(s))\n", root, migrated)
+		}
+		total += migrated
+	}
+	output.Printf("Migrated %d item(s) from host %s to %s\n", total, oldHost, newHost)
+	return nil
+}
+
+// dedupeFiles drops operands that name a directory entry already given,
+// warning once per duplicated entry. Entries are identified by their parent
+// directory's device and inode plus their name, so "a", "./a" and a path
+// through a symlinked directory match, while hard links (separate names
+// that each need removing) do not. Operands that cannot be resolved are
+// kept for processPath to report.
+func dedupeFiles(files []string) []string {
+	first := map[string]string{}
+	warned := map[string]bool{}
+	var unique []string
+	for _, path := range files {
+		key, ok := entryKey(path)
+		if !ok {
+			unique = append(unique, path)
+			continue
+		}
+		if original, seen := first[key]; seen {
+			if !warned[key] {
+				output.Warning("'%s' was given more than once (same file as '%s'); removing it once", path, original)
+				warned[key] = true
+			}
+			continue
+		}
+		first[key] = path
+		unique = append(unique, path)
+	}
+	return unique
+}
+
+// entryKey identifies the directory entry named by path
+func entryKey(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if _, err := os.Lstat(absPath); err != nil {
+		return "", false
+	}
+	parent, err := os.Stat(filepath.Dir(absPath))
+	if err != nil {
+		return "", false
+	}
+	stat, ok := parent.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d/%s", stat.Dev, stat.Ino, filepath.Base(absPath)), true
+}
+
+// resumeSession finishes the interrupted removals of a session
+func resumeSession(cfg *config.Config, session string) error {
+	stats := &runStats{start: time.Now()}
+	resumed, err := trash.Resume(cfg, session)
+	for _, item := range resumed {
+		size, _ := trash.Size(item.TrashPath)
+		stats.record(cfg, audit.ActionTrash, item.OriginalPath, item.TrashPath, size, time.Since(stats.start))
+		output.Printf("Resumed: %s (moved to trash: %s)\n", item.OriginalPath, item.TrashPath)
+	}
+	return err
+}
+
+// cleanArtifacts returns the ignored files to remove for safe-rm clean. With
+// --dry-run it lists them with their sizes instead and returns none.
+func cleanArtifacts(opts *cli.Options) ([]string, error) {
+	dir := opts.CleanDir
+	if dir == "" {
+		dir = "."
+	}
+	paths, err := clean.Artifacts(dir, clean.Options{Untracked: opts.Untracked, Excludes: opts.Excludes})
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		output.Printf("Nothing to clean.\n")
+		return nil, nil
+	}
+	if !opts.DryRun {
+		return paths, nil
+	}
+
+	var total int64
+	for _, path := range paths {
+		size, _ := trash.Size(path)
+		total += size
+		fmt.Printf("Would remove %s (%s)\n", path, output.FormatBytes(size))
+	}
+	fmt.Printf("%d item(s), %s would be moved to trash.\n", len(paths), output.FormatBytes(total))
+	return nil, nil
+}
+
+// janitorTargets returns the entries selected by the janitor profile in
+// opts.Profile. Without a profile it lists the configured profiles, and with
+// --dry-run it lists the entries with their sizes; both return none.
+func janitorTargets(cfg *config.Config, opts *cli.Options) ([]string, error) {
+	if opts.Profile == "" {
+		names := make([]string, 0, len(cfg.Janitor))
+		for name := range cfg.Janitor {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			profile := cfg.Janitor[name]
+			fmt.Printf("%-16s %s\n", name, strings.Join(profile.Paths, ", "))
+		}
+		return nil, nil
+	}
+
+	profile, ok := cfg.Janitor[opts.Profile]
+	if !ok {
+		return nil, output.WithCode(output.CodeUsage, fmt.Errorf("unknown janitor profile '%s'", opts.Profile))
+	}
+	matches, err := janitor.Find(profile)
+	if err != nil {
+		return nil, fmt.Errorf("janitor profile '%s': %v", opts.Profile, err)
+	}
+	if len(matches) == 0 {
+		output.Printf("Nothing to clean.\n")
+		return nil, nil
+	}
+
+	var paths []string
+	var total int64
+	for _, match := range matches {
+		paths = append(paths, match.Path)
+		total += match.Size
+		if opts.DryRun {
+			fmt.Printf("Would remove %s (%s, modified %s)\n", match.Path,
+				output.FormatBytes(match.Size), match.ModTime.Format("2006-01-02"))
+		}
+	}
+	if opts.DryRun {
+		fmt.Printf("%d item(s), %s would be moved to trash (namespace %s).\n",
+			len(paths), output.FormatBytes(total), cfg.JanitorNamespace(opts.Profile))
+		return nil, nil
+	}
+	return paths, nil
+}
+
+// simulate reports what removing each path listed in opts.SimulateFrom (or
+// stdin) would do under the current config and options
+func simulate(cfg *config.Config, opts *cli.Options) error {
+	in := os.Stdin
+	if opts.SimulateFrom != "" && opts.SimulateFrom != "-" {
+		f, err := os.Open(opts.SimulateFrom)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	simOpts := simulateOptions(cfg, opts)
+
+	fmt.Printf("%-14s %-40s %s\n", "ACTION", "PATH", "RULE")
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" || strings.HasPrefix(path, "#") {
+			continue
+		}
+		decision := protect.Simulate(cfg, path, simOpts)
+		fmt.Printf("%-14s %-40s %s\n", decision.Action, decision.Path, decision.Rule)
+	}
+	return scanner.Err()
+}
+
+// simulateOptions returns the rm options that influence a simulated removal
+func simulateOptions(cfg *config.Config, opts *cli.Options) protect.SimulateOptions {
+	return protect.SimulateOptions{
+		Recursive:       opts.Recursive,
+		RemoveEmptyDirs: opts.RemoveEmptyDirs,
+		Force:           opts.Force,
+		Permanent:       opts.Permanent,
+		Posix:           opts.Posix,
+		IgnoreMissing:   opts.IgnoreMissing || cfg.IgnoreMissing,
+	}
+}
+
+// observe records what safe-rm would do with path, for observe mode, where
+// the removal itself then happens exactly as with rm
+func observe(cfg *config.Config, opts *cli.Options, path string) {
+	decision := protect.Simulate(cfg, path, simulateOptions(cfg, opts))
+	switch decision.Action {
+	case protect.ActionBlock, protect.ActionConfirm, protect.ActionLogOnly:
+		output.Warning("observe mode: '%s' would be %s: %s", path, observed(decision.Action), decision.Rule)
+	default:
+		output.Debugf("observe mode: %s %s: %s", decision.Action, path, decision.Rule)
+	}
+
+	absPath, _ := filepath.Abs(path)
+	entry := audit.Entry{Action: audit.ActionObserve, Path: absPath, Decision: decision.Action, Rule: decision.Rule}
+	if err := audit.Record(cfg, entry); err != nil {
+		output.Warning("failed to write audit log: %v", err)
+	}
+}
+
+// observed describes a protected decision for observe mode warnings
+func observed(action string) string {
+	switch action {
+	case protect.ActionBlock:
+		return "blocked"
+	case protect.ActionConfirm:
+		return "confirmed first"
+	default:
+		return "removed with a warning"
+	}
+}
+
+// resolveInodes turns --inode and --inodes-from specs into paths, reporting
+// specs that cannot be resolved
+func resolveInodes(opts *cli.Options) ([]string, bool) {
+	var specs []inode.Spec
+	for _, value := range opts.Inodes {
+		spec, _ := inode.ParseSpec(value) // validated while parsing
+		specs = append(specs, spec)
+	}
+
+	if opts.InodesFrom != "" {
+		var r io.Reader = os.Stdin
+		if opts.InodesFrom != "-" {
+			f, err := os.Open(opts.InodesFrom)
+			if err != nil {
+				output.PathError(opts.InodesFrom, err)
+				return nil, false
+			}
+			defer f.Close()
+			r = f
+		}
+		read, err := inode.ReadSpecs(r)
+		if err != nil {
+			output.PathError(opts.InodesFrom, output.WithCode(output.CodeUsage, err))
+			return nil, false
+		}
+		specs = append(specs, read...)
+	}
+
+	var paths []string
+	ok := true
+	for _, spec := range specs {
+		path, err := inode.Resolve(spec)
+		if err != nil {
+			output.PathError(spec.String(), output.WithCode(output.CodeNotFound, err))
+			ok = false
+			continue
+		}
+		output.Debugf("inode %s resolved to %q", spec, path)
+		paths = append(paths, path)
+	}
+	return paths, ok
+}
+
+// newSession returns a random identifier for this invocation
+func newSession() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+func processPath(cfg *config.Config, opts *cli.Options, path string, stats *runStats) error {
+	// Observe mode records what would happen, then behaves exactly like rm
+	if cfg.Observe {
+		observe(cfg, opts, path)
+	}
+
 	// Get absolute path for protection checking
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -90,19 +1057,38 @@ func processPath(cfg *config.Config, opts *cli.Options, path string) error {
 	}
 
 	// Check file/directory existence
-	info, err := os.Lstat(absPath)
+	info, err := trash.Lstat(absPath)
 	if err != nil {
 		if os.IsNotExist(err) {
+			if scriptMode && restore.IsPattern(path) {
+				// The shell passes a glob that matched nothing on as is
+				return output.WithCode(output.CodeNotFound, fmt.Errorf("No such file or directory (the pattern matched nothing)"))
+			}
 			if opts.Force {
 				return nil // -f ignores nonexistent files
 			}
-			return fmt.Errorf("No such file or directory")
+			if opts.Idempotent {
+				if trashPath, ok := trash.RecentlyTrashed(cfg, absPath); ok {
+					output.Verbosef("'%s' already moved to trash: %s\n", path, trashPath)
+					return nil
+				}
+			}
+			if opts.IgnoreMissing || cfg.IgnoreMissing {
+				// Unlike -f, prompts and other checks stay in effect
+				output.Warning("'%s' does not exist, skipping", path)
+				return nil
+			}
+			return output.WithCode(output.CodeNotFound, fmt.Errorf("No such file or directory"))
 		}
 		return err
 	}
 
 	// Check if it's a directory without -r flag
 	if info.IsDir() && !opts.Recursive {
+		if scriptMode {
+			// Scripts state that they remove directories
+			return output.WithCode(output.CodeIsDir, fmt.Errorf("Is a directory (script mode requires -r)"))
+		}
 		if opts.RemoveEmptyDirs {
 			// -d flag: try to remove empty directory
 			entries, err := os.ReadDir(absPath)
@@ -110,57 +1096,385 @@ func processPath(cfg *config.Config, opts *cli.Options, path string) error {
 				return err
 			}
 			if len(entries) > 0 {
-				return fmt.Errorf("Directory not empty")
+				return output.WithCode(output.CodeNotEmpty, fmt.Errorf("Directory not empty"))
 			}
 		} else {
-			return fmt.Errorf("Is a directory")
+			return output.WithCode(output.CodeIsDir, fmt.Errorf("Is a directory"))
 		}
 	}
 
 	// Check protection rules
 	status := protect.Check(cfg, absPath, opts.Recursive)
+	if cfg.Observe && status.Rule != protect.RuleRoot && status.Rule != protect.RuleCanary {
+		// Like rm, observe mode still refuses the root directory, and
+		// canaries are never given up
+		if status.Protected {
+			countUsage(cfg, usage.EventBypass, status, absPath)
+		}
+		status = protect.Status{}
+	}
+	if status.Rule == protect.RuleCanary {
+		protect.CanaryAlert(cfg, absPath, status.Reason)
+	}
 	if status.Protected {
-		if cfg.ProtectedBehavior == "block" {
-			return fmt.Errorf("BLOCKED: %s\n  Reason: %s\n  This path is protected and cannot be removed.", absPath, status.Reason)
+		output.Debugf("protection check %s: protected (%s)", absPath, status.Reason)
+	} else {
+		output.Debugf("protection check %s: not protected", absPath)
+	}
+	if status.Protected && status.Action == protect.ActionLogOnly {
+		// log-only rules let the removal through, leaving a trace
+		output.Warning("removing protected path %s (%s)", absPath, status.Reason)
+		countUsage(cfg, usage.EventBypass, status, absPath)
+	} else if status.Protected {
+		// POSIX mode never prompts beyond what POSIX mandates, so protected
+		// paths that would ask for confirmation are blocked instead
+		if opts.Posix {
+			countUsage(cfg, usage.EventBlock, status, absPath)
+			return output.WithCode(output.CodeProtected, fmt.Errorf("Operation not permitted (%s)", status.Reason))
+		}
+		if status.Action == protect.ActionBlock {
+			countUsage(cfg, usage.EventBlock, status, absPath)
+			return output.WithCode(output.CodeProtected, fmt.Errorf("BLOCKED: %s\n  Reason: %s\n  This path is protected and cannot be removed.", absPath, status.Reason))
 		}
 
 		// Require confirmation
-		if !opts.Force {
+		if scriptMode {
+			countUsage(cfg, usage.EventBlock, status, absPath)
+			return output.WithCode(output.CodeProtected, fmt.Errorf("BLOCKED: %s is protected (%s). Script mode cannot confirm it.", absPath, status.Reason))
+		} else if !opts.Force {
 			fmt.Fprintf(os.Stderr, "WARNING: You are about to remove a protected path!\n")
 			fmt.Fprintf(os.Stderr, "  Path: %s\n", absPath)
 			fmt.Fprintf(os.Stderr, "  Reason: %s\n", status.Reason)
-			fmt.Fprintf(os.Stderr, "Type 'yes I am sure' to confirm: ")
-
-			var response string
-			fmt.Scanln(&response)
-			if response != "yes I am sure" {
-				return fmt.Errorf("aborted by user")
+			if prompt("Type 'yes I am sure' to confirm: ") != "yes I am sure" {
+				countUsage(cfg, usage.EventAbort, status, absPath)
+				return output.WithCode(output.CodeAborted, fmt.Errorf("aborted by user"))
 			}
+			countUsage(cfg, usage.EventConfirm, status, absPath)
 		} else {
 			// Even with -f, block protected paths unless explicitly confirmed
-			return fmt.Errorf("BLOCKED: %s is protected (%s). Use interactive mode to confirm.", absPath, status.Reason)
+			countUsage(cfg, usage.EventBlock, status, absPath)
+			return output.WithCode(output.CodeProtected, fmt.Errorf("BLOCKED: %s is protected (%s). Use interactive mode to confirm.", absPath, status.Reason))
 		}
 	}
 
+	// POSIX requires confirmation for write-protected files when stdin is a terminal
+	if opts.Posix && !opts.Force && !opts.Interactive && isWriteProtected(info) && stdinIsTerminal() {
+		if ok, err := confirm("rm: remove write-protected file '%s'? ", path); !ok {
+			return err
+		}
+	}
+
+	// Hidden state directories (.git, .venv, ...) usually mean a live project
+	var markers []string
+	if cfg.ConfirmProjects && !cfg.Observe && info.IsDir() && opts.Recursive && !opts.Force && !opts.Posix {
+		markers = protect.FindProjectMarkers(absPath)
+	}
+
 	// Interactive mode (-i)
 	if opts.Interactive && !opts.Force {
-		fmt.Fprintf(os.Stderr, "remove '%s'? ", path)
-		var response string
-		fmt.Scanln(&response)
-		if response != "y" && response != "yes" {
-			return nil
+		var ok bool
+		var err error
+		if len(markers) > 0 {
+			ok, err = confirm("remove directory '%s' (contains %s)? ", path, strings.Join(markers, ", "))
+		} else if info.IsDir() {
+			ok, err = confirm("remove directory '%s'? ", path)
+		} else {
+			ok, err = confirm("remove '%s'? ", path)
+		}
+		if !ok {
+			return err
 		}
 	}
 
+	// Live projects are confirmed even without -i, like very large files
+	if len(markers) > 0 && !opts.Interactive {
+		fmt.Fprintf(os.Stderr, "directory '%s' contains %s, which usually means a live project\n", path, strings.Join(markers, ", "))
+		if ok, err := confirm("remove directory '%s'? ", path); !ok {
+			return err
+		}
+	}
+
+	// Very large files are confirmed even without -i; -f skips the prompt
+	if isLargeFile(cfg, info) && !cfg.Observe && !opts.Force && !opts.Interactive && !opts.Posix {
+		if ok, err := confirm("remove large file '%s' (%s)? ", path, output.FormatBytes(info.Size())); !ok {
+			return err
+		}
+	}
+
+	// --one-file-system leaves the mount points below a directory in place
+	if opts.OneFileSystem && opts.Recursive && info.IsDir() {
+		if mounts := protect.MountsBelow(absPath); len(mounts) > 0 {
+			return removeAround(cfg, opts, absPath, mounts, stats)
+		}
+	}
+	return removePath(cfg, opts, path, absPath, info, stats)
+}
+
+// removeAround removes the contents of dir except the mount points below
+// it, which are skipped with a warning along with the directories holding
+// them, as rm --one-file-system does
+func removeAround(cfg *config.Config, opts *cli.Options, dir string, mounts []string, stats *runStats) error {
+	skipped, failed, err := removeBelow(cfg, opts, dir, mounts, stats)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		return fmt.Errorf("Directory not empty (skipped %d mount point(s) below it)", skipped)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) below it could not be removed", failed)
+	}
+	return nil
+}
+
+// removeBelow removes the contents of dir for removeAround, returning the
+// number of mount points skipped and of items that failed
+func removeBelow(cfg *config.Config, opts *cli.Options, dir string, mounts []string, stats *runStats) (int, int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	skipped, failed := 0, 0
+	for _, entry := range entries {
+		child := filepath.Join(dir, entry.Name())
+		var below []string
+		isMount := false
+		for _, mount := range mounts {
+			if mount == child {
+				isMount = true
+			} else if strings.HasPrefix(mount, child+"/") {
+				below = append(below, mount)
+			}
+		}
+
+		switch {
+		case isMount:
+			output.Warning("skipping '%s', since it's on a different device", child)
+			skipped++
+		case len(below) > 0:
+			s, f, err := removeBelow(cfg, opts, child, below, stats)
+			if err != nil {
+				output.PathError(child, err)
+				f++
+			}
+			skipped += s
+			failed += f
+		default:
+			info, err := trash.Lstat(child)
+			if err == nil {
+				err = removePath(cfg, opts, child, child, info, stats)
+			}
+			if err != nil {
+				output.PathError(child, err)
+				failed++
+			}
+		}
+	}
+
+	return skipped, failed, nil
+}
+
+// removePath moves a file or directory that passed every check to the
+// trash, or deletes it with --permanent and in observe mode
+func removePath(cfg *config.Config, opts *cli.Options, path, absPath string, info os.FileInfo, stats *runStats) error {
+	// Sizes are only needed for the summaries and the audit log; skip the
+	// walk otherwise
+	var size int64
+	if output.Level() >= output.LevelVerbose || opts.SafeClean || opts.SafeJanitor || cfg.AuditLog {
+		size, _ = trash.Size(absPath)
+	}
+	start := time.Now()
+
+	// Explicit permanent deletion bypasses the trash (but not protection);
+	// observe mode never uses the trash
+	if opts.Permanent || cfg.Observe {
+		return removePermanently(cfg, path, absPath, info, size, start, stats)
+	}
+
 	// Move to trash instead of permanent deletion
 	trashPath, err := trash.Move(cfg, absPath)
+	if err != nil && trashPath != "" {
+		// Trashed, but what remains of the source still has to be removed
+		stats.record(cfg, audit.ActionTrash, absPath, trashPath, size, time.Since(start))
+		return fmt.Errorf("moved to trash as %s, but the removal is incomplete: %w", trashPath, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to move to trash: %v", err)
+		// Mounts excluded from per-mount trashes may be set to delete directly
+		if errors.Is(err, trash.ErrDeleteDirectly) {
+			output.Debugf("%v", err)
+			return removePermanently(cfg, path, absPath, info, size, start, stats)
+		}
+		var unavailable *trash.UnavailableError
+		var quota *trash.QuotaError
+		if errors.As(err, &unavailable) || errors.As(err, &quota) {
+			return output.WithCode(output.CodeTrashUnavailable, fmt.Errorf("failed to move to trash: %w", err))
+		}
+		return fmt.Errorf("failed to move to trash: %w", err)
 	}
+	stats.record(cfg, audit.ActionTrash, absPath, trashPath, size, time.Since(start))
 
-	if opts.Verbose {
-		fmt.Printf("removed '%s' (moved to trash: %s)\n", path, trashPath)
+	if output.JSON() {
+		if output.Level() >= output.LevelVerbose {
+			record := trash.Record{OriginalPath: absPath, DeletedAt: start, Size: size, TrashPath: trashPath}
+			if meta, err := trash.GetMetadata(trashPath); err == nil {
+				record = trash.NewRecord(meta, trashPath)
+				record.Size, record.Pending = size, false
+			}
+			record.Action = audit.ActionTrash
+			output.Object(record)
+		}
+		return nil
+	}
+
+	kind := ""
+	if info.IsDir() {
+		kind = "directory "
+	}
+	if opts.Posix {
+		output.Verbosef("removed %s'%s'\n", kind, path)
+	} else {
+		output.Verbosef("removed %s'%s' (moved to trash: %s)\n", kind, path, trashPath)
 	}
 
 	return nil
 }
+
+// removePermanently deletes a file or directory without moving it to the
+// trash and records it
+func removePermanently(cfg *config.Config, path, absPath string, info os.FileInfo, size int64, start time.Time, stats *runStats) error {
+	if err := os.RemoveAll(absPath); err != nil {
+		return err
+	}
+	stats.record(cfg, audit.ActionPermanent, absPath, "", size, time.Since(start))
+	if output.JSON() {
+		if output.Level() >= output.LevelVerbose {
+			output.Object(trash.Record{OriginalPath: absPath, DeletedAt: start, Size: size, Action: audit.ActionPermanent})
+		}
+		return nil
+	}
+	if info.IsDir() {
+		output.Verbosef("removed directory '%s'\n", path)
+	} else {
+		output.Verbosef("removed '%s'\n", path)
+	}
+	return nil
+}
+
+// countUsage counts a protection rule hit in the local usage statistics
+func countUsage(cfg *config.Config, event string, status protect.Status, path string) {
+	if err := usage.Record(cfg, event, status.Rule, path); err != nil {
+		output.Warning("failed to update usage statistics: %v", err)
+	}
+}
+
+// isLargeFile reports whether info is a regular file above size_confirm_threshold
+func isLargeFile(cfg *config.Config, info os.FileInfo) bool {
+	return cfg.SizeConfirmThreshold > 0 && info.Mode().IsRegular() && info.Size() > int64(cfg.SizeConfirmThreshold)
+}
+
+// isWriteProtected reports whether a non-symlink file has no write permission bits
+func isWriteProtected(info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return false
+	}
+	return info.Mode().Perm()&0222 == 0
+}
+
+// lowerPriority moves background work (purging, scanning) to the
+// configured I/O class and CPU niceness, throttle_ionice and throttle_nice
+func lowerPriority(cfg *config.Config) {
+	if err := throttle.SetIOClass(cfg.ThrottleIOClass); err != nil {
+		output.Warning("failed to set I/O class: %v", err)
+	}
+	if err := throttle.SetNice(cfg.ThrottleNice); err != nil {
+		output.Warning("failed to set niceness: %v", err)
+	}
+}
+
+// batchOptions returns the options of a batch restore of a session or glob
+func batchOptions(opts *cli.Options, session, pattern string) restore.BatchOptions {
+	batch := restore.BatchOptions{
+		AllRoots:     opts.AllTrashes,
+		Session:      session,
+		Pattern:      pattern,
+		Conflict:     opts.Conflict,
+		Interactive:  canPrompt(),
+		DeletedAfter: opts.DeletedAfter,
+	}
+	// The later of --deleted-after and --deleted-within wins
+	if opts.DeletedWithin > 0 {
+		if since := time.Now().Add(-opts.DeletedWithin); since.After(batch.DeletedAfter) {
+			batch.DeletedAfter = since
+		}
+	}
+	return batch
+}
+
+// deletedFilter reports whether restores are limited by deletion time
+func deletedFilter(opts *cli.Options) bool {
+	return !opts.DeletedAfter.IsZero() || opts.DeletedWithin > 0
+}
+
+// stdin reads the answers to prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt writes a question to stderr and returns the line typed in answer,
+// without surrounding spaces
+func prompt(format string, args ...any) string {
+	fmt.Fprintf(os.Stderr, format, args...)
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// confirm asks a yes/no question; only "y" or "yes" agree. Script mode
+// never asks: the question fails with errNoPrompt instead of being declined.
+func confirm(format string, args ...any) (bool, error) {
+	if scriptMode {
+		return false, errNoPrompt
+	}
+	response := prompt(format, args...)
+	return response == "y" || response == "yes", nil
+}
+
+// scriptMode is set when safe-rm runs in script mode
+var scriptMode bool
+
+// errNoPrompt fails whatever needs a confirmation in script mode
+var errNoPrompt = output.WithCode(output.CodeAborted, errors.New("confirmation required, but script mode never prompts"))
+
+// useScriptMode reports whether script mode is enabled, by --script-mode
+// and --no-script-mode or else by script_mode
+func useScriptMode(cfg *config.Config, opts *cli.Options) bool {
+	switch {
+	case opts.ScriptMode:
+		return true
+	case opts.NoScriptMode:
+		return false
+	}
+	switch cfg.ScriptMode {
+	case "", "off":
+		return false
+	case "on":
+		return true
+	case "auto":
+		return !stdinIsTerminal()
+	default:
+		output.Warning("unknown script_mode '%s', using 'off'", cfg.ScriptMode)
+		return false
+	}
+}
+
+// canPrompt reports whether restores may ask questions
+func canPrompt() bool {
+	return stdinIsTerminal() && !scriptMode
+}
+
+// stdinIsTerminal reports whether standard input is attached to a terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,39 @@
+# bash completion for safe-rm
+#
+# Completes --safe-restore, --safe-info and --safe-pin arguments (and the
+# restore, info and pin subcommands of safe-rm) from the recently deleted
+# paths file, without reading the trash. Everything else completes as files.
+#
+# Install: copy to ~/.local/share/bash-completion/completions/safe-rm (make
+# install does this), or source it from ~/.bashrc. zsh users can source it
+# after "autoload -U bashcompinit && bashcompinit".
+
+_safe_rm_deleted() {
+    local recent="${XDG_STATE_HOME:-$HOME/.local/state}/safe-rm/recent"
+    [[ -r $recent ]] && awk '!seen[$0]++' "$recent"
+}
+
+_safe_rm() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local opt=""
+
+    # COMP_WORDBREAKS splits --safe-restore=PATH at the "="
+    if [[ $cur == "=" ]]; then
+        opt=$prev
+        cur=""
+    elif [[ $prev == "=" && $COMP_CWORD -ge 2 ]]; then
+        opt=${COMP_WORDS[COMP_CWORD-2]}
+    elif [[ ${COMP_WORDS[0]##*/} == safe-rm && $COMP_CWORD -eq 2 ]]; then
+        opt=${COMP_WORDS[1]}
+    fi
+
+    case $opt in
+    --safe-restore | --safe-info | --safe-pin | restore | info | pin)
+        local IFS=$'\n'
+        compopt -o filenames 2>/dev/null
+        COMPREPLY=($(compgen -W "$(_safe_rm_deleted)" -- "$cur"))
+        ;;
+    esac
+}
+
+complete -o default -o bashdefault -F _safe_rm safe-rm rm
@@ -0,0 +1,9 @@
+// Package integration holds end-to-end tests that build the rm binary and
+// run it against temporary roots. They are only built with the integration
+// tag:
+//
+//	go test -tags=integration ./integration/
+//
+// Scenarios that need privileges (mounting a second filesystem) are skipped
+// when not run as root.
+package integration
@@ -0,0 +1,222 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// binary is the rm binary built for the tests
+var binary string
+
+func TestMain(m *testing.M) {
+	buildDir, err := os.MkdirTemp("", "saferm-integration-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	binary = filepath.Join(buildDir, "rm")
+	build := exec.Command("go", "build", "-o", binary, "../cmd/rm")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build rm: %v\n", err)
+		os.RemoveAll(buildDir)
+		os.Exit(1)
+	}
+	// The safe-rm name selects the subcommand interface
+	if err := os.Symlink("rm", filepath.Join(buildDir, "safe-rm")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(buildDir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(buildDir)
+	os.Exit(code)
+}
+
+// env is an isolated root for one scenario: a home directory with its own
+// trash, state and configuration
+type env struct {
+	t     *testing.T
+	root  string
+	home  string
+	trash string
+}
+
+// result is the outcome of one invocation
+type result struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// newEnv creates a temporary root, removed when the test ends
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	root, err := os.MkdirTemp("", "saferm-integration-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Restored or trashed items may have been made read-only
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		os.RemoveAll(root)
+	})
+
+	e := &env{t: t, root: root, home: filepath.Join(root, "home"), trash: filepath.Join(root, "trash")}
+	e.mkdir("home")
+	return e
+}
+
+// path returns the absolute path of a file in the root
+func (e *env) path(rel string) string {
+	return filepath.Join(e.root, rel)
+}
+
+// mkdir creates a directory in the root
+func (e *env) mkdir(rel string) string {
+	e.t.Helper()
+	path := e.path(rel)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	return path
+}
+
+// write creates a file in the root, and its parent directories
+func (e *env) write(rel, content string) string {
+	e.t.Helper()
+	path := e.path(rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+	return path
+}
+
+// config writes the configuration file read by every later invocation
+func (e *env) config(yaml string) {
+	e.t.Helper()
+	e.write("home/.config/safe-rm/config.yml", yaml)
+}
+
+// environ is the environment of an invocation: nothing of the caller's
+// safe-rm setup leaks in
+func (e *env) environ() []string {
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + e.home,
+		"XDG_CONFIG_HOME=" + filepath.Join(e.home, ".config"),
+		"XDG_STATE_HOME=" + filepath.Join(e.home, ".local", "state"),
+		"SAFERM_TRASH=" + e.trash,
+	}
+}
+
+// command prepares an invocation of rm, or of safe-rm when name says so
+func (e *env) command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(filepath.Join(filepath.Dir(binary), name), args...)
+	cmd.Dir = e.root
+	cmd.Env = e.environ()
+	return cmd
+}
+
+// run invokes rm with args and stdin
+func (e *env) run(stdin string, args ...string) result {
+	return e.runAs("rm", stdin, args...)
+}
+
+// runAs invokes the binary under name with args and stdin
+func (e *env) runAs(name, stdin string, args ...string) result {
+	e.t.Helper()
+	cmd := e.command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		e.t.Fatalf("running %s %v: %v", name, args, err)
+	}
+	return result{stdout: stdout.String(), stderr: stderr.String(), code: code}
+}
+
+// mustRun invokes rm and fails the test unless it succeeds
+func (e *env) mustRun(args ...string) result {
+	e.t.Helper()
+	r := e.run("", args...)
+	if r.code != 0 {
+		e.t.Fatalf("rm %v exited with %d:\n%s%s", args, r.code, r.stdout, r.stderr)
+	}
+	return r
+}
+
+// exists reports whether a path exists, without following symlinks
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// read returns the content of a file, failing the test if it is missing
+func (e *env) read(path string) string {
+	e.t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return string(data)
+}
+
+// trashed returns the metadata files in the trash, keyed by original path
+func (e *env) trashed() map[string]string {
+	e.t.Helper()
+	items := map[string]string{}
+	filepath.Walk(e.trash, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !strings.HasSuffix(path, ".saferm-meta") {
+			return nil
+		}
+		var meta struct {
+			OriginalPath string `json:"original_path"`
+		}
+		data, _ := os.ReadFile(path)
+		if json.Unmarshal(data, &meta) == nil {
+			items[meta.OriginalPath] = path
+		}
+		return nil
+	})
+	return items
+}
+
+// age moves the deletion time of a trashed item into the past
+func (e *env) age(metaPath string, by time.Duration) {
+	e.t.Helper()
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(e.read(metaPath)), &meta); err != nil {
+		e.t.Fatal(err)
+	}
+	meta["deleted_at"] = time.Now().Add(-by).Format(time.RFC3339)
+	data, _ := json.Marshal(meta)
+	if err := os.WriteFile(metaPath, data, 0600); err != nil {
+		e.t.Fatal(err)
+	}
+	// The trash index does not see metadata edited behind its back
+	e.mustRun("--safe-reindex")
+}
@@ -0,0 +1,52 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// mountTmpfs mounts an empty tmpfs on dir for the duration of the test
+func (e *env) mountTmpfs(dir string) {
+	e.t.Helper()
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+		e.t.Skipf("cannot mount a tmpfs (needs root): %v", err)
+	}
+	e.t.Cleanup(func() { syscall.Unmount(dir, syscall.MNT_DETACH) })
+}
+
+func TestOneFileSystem(t *testing.T) {
+	e := newEnv(t)
+	e.write("data/file.txt", "file\n")
+	e.write("data/sub/nested.txt", "nested\n")
+	mount := e.mkdir("data/sub/mnt")
+	e.mountTmpfs(mount)
+	inMount := e.write("data/sub/mnt/other-fs.txt", "other\n")
+
+	// A mount point is protected like a system directory
+	if r := e.run("", "-rf", mount); r.code == 0 || !strings.Contains(r.stderr, "Mount point is protected") {
+		t.Errorf("removing a mount point should be blocked:\n%s", r.stderr)
+	}
+
+	// --one-file-system removes everything else and leaves the mount point
+	r := e.run("", "-rf", "--one-file-system", e.path("data"))
+	if r.code == 0 {
+		t.Error("skipping a mount point should fail like rm")
+	}
+	if !strings.Contains(r.stderr, "skipping '"+mount+"', since it's on a different device") {
+		t.Errorf("the skipped mount point should be reported:\n%s", r.stderr)
+	}
+	if !exists(inMount) {
+		t.Error("the file on the other filesystem should be untouched")
+	}
+	for _, gone := range []string{"data/file.txt", "data/sub/nested.txt"} {
+		if exists(e.path(gone)) {
+			t.Errorf("%s should be in the trash", gone)
+		}
+	}
+	if _, ok := e.trashed()[e.path("data/sub/nested.txt")]; !ok {
+		t.Errorf("data/sub/nested.txt should be in the trash, found %v", e.trashed())
+	}
+}
@@ -0,0 +1,141 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPTY opens a pseudo-terminal pair, returning the controlling side and
+// the terminal to give a child as stdin, stdout and stderr
+func openPTY() (*os.File, *os.File, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(ptmx, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(ptmx, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	return ptmx, tty, nil
+}
+
+// ioctl performs an ioctl with a pointer argument
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// session is rm running on a terminal, driven like a user would
+type session struct {
+	t      *testing.T
+	ptmx   *os.File
+	output chan string
+	seen   strings.Builder
+	wait   func() error
+}
+
+// runTTY starts rm with a terminal as stdin, stdout and stderr
+func (e *env) runTTY(args ...string) *session {
+	e.t.Helper()
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		e.t.Skipf("no pseudo-terminal available: %v", err)
+	}
+	cmd := e.command("rm", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		e.t.Fatal(err)
+	}
+	tty.Close()
+
+	s := &session{t: e.t, ptmx: ptmx, output: make(chan string), wait: cmd.Wait}
+	go func() {
+		reader := bufio.NewReader(ptmx)
+		buf := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				s.output <- string(buf[:n])
+			}
+			if err != nil {
+				close(s.output)
+				return
+			}
+		}
+	}()
+	e.t.Cleanup(func() { ptmx.Close() })
+	return s
+}
+
+// expect waits until the terminal shows text
+func (s *session) expect(text string) {
+	s.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for !strings.Contains(s.seen.String(), text) {
+		select {
+		case chunk, ok := <-s.output:
+			if !ok {
+				s.t.Fatalf("terminal closed before %q appeared; output:\n%s", text, s.seen.String())
+			}
+			s.seen.WriteString(chunk)
+		case <-timeout:
+			s.t.Fatalf("timed out waiting for %q; output:\n%s", text, s.seen.String())
+		}
+	}
+}
+
+// send types a line
+func (s *session) send(line string) {
+	s.t.Helper()
+	if _, err := s.ptmx.Write([]byte(line + "\n")); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// press types keys without a newline
+func (s *session) press(keys string) {
+	s.t.Helper()
+	if _, err := s.ptmx.Write([]byte(keys)); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// finish waits for rm to exit and returns its exit code
+func (s *session) finish() int {
+	s.t.Helper()
+	go func() {
+		for range s.output {
+		}
+	}()
+	err := s.wait()
+	if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return 0
+}
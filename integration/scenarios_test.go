@@ -0,0 +1,399 @@
+//go:build integration
+
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRecursiveDeleteAndRestore(t *testing.T) {
+	e := newEnv(t)
+	e.write("project/src/main.go", "package main\n")
+	e.write("project/README", "readme\n")
+	project := e.path("project")
+
+	if r := e.run("", "project"); r.code == 0 {
+		t.Error("removing a directory without -r should fail")
+	}
+	e.mustRun("-r", "project")
+	if exists(project) {
+		t.Fatal("project should be gone after rm -r")
+	}
+	if _, ok := e.trashed()[project]; !ok {
+		t.Fatalf("project should be in the trash, found %v", e.trashed())
+	}
+
+	if r := e.mustRun("--safe-list"); !strings.Contains(r.stdout, project) {
+		t.Errorf("--safe-list should show %s:\n%s", project, r.stdout)
+	}
+	e.mustRun("--safe-restore=" + project)
+	if got := e.read(filepath.Join(project, "src", "main.go")); got != "package main\n" {
+		t.Errorf("restored content = %q", got)
+	}
+	if len(e.trashed()) != 0 {
+		t.Errorf("trash should be empty after the restore, found %v", e.trashed())
+	}
+}
+
+func TestSubcommandInterface(t *testing.T) {
+	e := newEnv(t)
+	file := e.write("notes.txt", "notes\n")
+
+	if r := e.runAs("safe-rm", "", "trash", file); r.code != 0 {
+		t.Fatalf("safe-rm trash failed:\n%s", r.stderr)
+	}
+	if r := e.runAs("safe-rm", "", "restore", file); r.code != 0 {
+		t.Fatalf("safe-rm restore failed:\n%s", r.stderr)
+	}
+	if !exists(file) {
+		t.Error("file should be restored")
+	}
+}
+
+func TestProtectedPaths(t *testing.T) {
+	e := newEnv(t)
+	e.write("repo/.git/HEAD", "ref: refs/heads/main\n")
+	e.write("secrets/key.pem", "key\n")
+	e.config("protected_paths:\n  - " + e.path("secrets") + "/**\n")
+
+	tests := []struct {
+		name string
+		args []string
+		path string
+	}{
+		{"git directory", []string{"-rf", e.path("repo/.git")}, "repo/.git"},
+		{"protected_paths", []string{"-f", e.path("secrets/key.pem")}, "secrets/key.pem"},
+		{"root", []string{"-rf", "/"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := e.run("", append([]string{"--errors=json"}, tt.args...)...)
+			if r.code == 0 {
+				t.Fatal("removal of a protected path should fail")
+			}
+			if !strings.Contains(r.stderr, `"PROTECTED"`) {
+				t.Errorf("error should carry the PROTECTED code:\n%s", r.stderr)
+			}
+			if tt.path != "" && !exists(e.path(tt.path)) {
+				t.Errorf("%s should still exist", tt.path)
+			}
+		})
+	}
+
+	// protected_behavior: block refuses even an interactive confirmation
+	e.config("protected_behavior: block\nprotected_paths:\n  - " + e.path("secrets") + "/**\n")
+	r := e.run("yes I am sure\n", e.path("secrets/key.pem"))
+	if r.code == 0 || !strings.Contains(r.stderr, "BLOCKED") {
+		t.Errorf("protected_behavior block should refuse:\n%s", r.stderr)
+	}
+	if !exists(e.path("secrets/key.pem")) {
+		t.Error("blocked file should still exist")
+	}
+}
+
+func TestPurgeRetention(t *testing.T) {
+	e := newEnv(t)
+	e.config("retention_days: 7\n")
+	old := e.write("old.txt", "old\n")
+	recent := e.write("recent.txt", "recent\n")
+	e.mustRun(old, recent)
+
+	items := e.trashed()
+	e.age(items[old], 10*24*time.Hour)
+	e.mustRun("--safe-purge")
+
+	items = e.trashed()
+	if _, ok := items[old]; ok {
+		t.Error("item older than retention_days should be purged")
+	}
+	if _, ok := items[recent]; !ok {
+		t.Error("recent item should be kept")
+	}
+
+	// Pinned items survive even an explicit age
+	e.mustRun("--safe-pin=" + recent)
+	e.age(items[recent], 30*24*time.Hour)
+	e.mustRun("--safe-purge", "--purge-days=1")
+	if _, ok := e.trashed()[recent]; !ok {
+		t.Error("pinned item should survive purge")
+	}
+}
+
+func TestCrossDeviceMove(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting a second filesystem needs root")
+	}
+	e := newEnv(t)
+	mnt := e.mkdir("mnt")
+	if err := syscall.Mount("tmpfs", mnt, "tmpfs", 0, "size=16m"); err != nil {
+		t.Skipf("cannot mount tmpfs: %v", err)
+	}
+	defer syscall.Unmount(mnt, syscall.MNT_DETACH)
+
+	file := e.write("mnt/data/report.csv", "a,b\n1,2\n")
+	e.mustRun(file)
+	if exists(file) {
+		t.Fatal("file on another filesystem should be copied to the trash and removed")
+	}
+	if _, ok := e.trashed()[file]; !ok {
+		t.Fatal("file should be in the trash")
+	}
+	e.mustRun("--safe-restore=" + file)
+	if got := e.read(file); got != "a,b\n1,2\n" {
+		t.Errorf("restored across filesystems = %q", got)
+	}
+
+	// --fallback=fail refuses instead of copying
+	if r := e.run("", "--fallback=fail", file); r.code == 0 {
+		t.Error("--fallback=fail should refuse a cross-device removal")
+	}
+	if !exists(file) {
+		t.Error("file should be left in place with --fallback=fail")
+	}
+
+	// --fallback=mount renames it into a trash on the tmpfs instead
+	e.mustRun("--fallback=mount", file)
+	if r := e.mustRun("--safe-list"); !strings.Contains(r.stdout, filepath.Join(mnt, ".safe-rm-trash-0")+"/") {
+		t.Fatalf("file should be listed in the trash of its mount:\n%s", r.stdout)
+	}
+	e.mustRun("--safe-restore=" + file)
+	if got := e.read(file); got != "a,b\n1,2\n" {
+		t.Errorf("restored from the trash of the mount = %q", got)
+	}
+}
+
+func TestInteractivePrompts(t *testing.T) {
+	e := newEnv(t)
+	keep := e.write("keep.txt", "keep\n")
+	remove := e.write("remove.txt", "remove\n")
+
+	s := e.runTTY("-i", keep, remove)
+	s.expect("remove '" + keep + "'?")
+	s.send("n")
+	s.expect("remove '" + remove + "'?")
+	s.send("y")
+	if code := s.finish(); code != 0 {
+		t.Errorf("rm -i exited with %d", code)
+	}
+	if !exists(keep) {
+		t.Error("file answered 'n' should be kept")
+	}
+	if exists(remove) {
+		t.Error("file answered 'y' should be removed")
+	}
+}
+
+func TestInteractiveOnce(t *testing.T) {
+	e := newEnv(t)
+	var files []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files = append(files, e.write(name, name+"\n"))
+	}
+	e.write("dir/file", "file\n")
+
+	tests := []struct {
+		name   string
+		args   []string
+		answer string
+		prompt string
+		gone   bool
+	}{
+		{"four files declined", append([]string{"-I"}, files...), "n\n", "remove 4 arguments? ", false},
+		{"recursive declined", []string{"--interactive=once", "-r", e.path("dir")}, "no\n", "remove 1 argument recursively? ", false},
+		{"four files accepted", append([]string{"-I"}, files...), "y\n", "remove 4 arguments? ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := e.run(tt.answer, tt.args...)
+			if r.code != 0 {
+				t.Fatalf("rm exited with %d:\n%s", r.code, r.stderr)
+			}
+			if r.stderr != tt.prompt {
+				t.Errorf("stderr = %q, want the single prompt %q", r.stderr, tt.prompt)
+			}
+			if gone := !exists(tt.args[len(tt.args)-1]); gone != tt.gone {
+				t.Errorf("removed = %v, want %v", gone, tt.gone)
+			}
+		})
+	}
+
+	// Three files are removed without asking, and never turns prompts off
+	few := []string{e.write("x", "x\n"), e.write("y", "y\n"), e.write("z", "z\n")}
+	if r := e.mustRun(append([]string{"-I"}, few...)...); r.stderr != "" || exists(few[0]) {
+		t.Errorf("-I with three files should not prompt:\n%s", r.stderr)
+	}
+	if r := e.mustRun("-i", "--interactive=never", e.path("dir")+"/file"); r.stderr != "" {
+		t.Errorf("--interactive=never should not prompt:\n%s", r.stderr)
+	}
+	if r := e.run("", "--interactive=sometimes", e.path("dir")); r.code == 0 || !strings.Contains(r.stderr, "Valid arguments are") {
+		t.Errorf("an invalid WHEN should be rejected:\n%s", r.stderr)
+	}
+}
+
+func TestProtectedPathConfirmation(t *testing.T) {
+	e := newEnv(t)
+	key := e.write("secrets/key.pem", "key\n")
+	e.config("protected_behavior: confirm\nprotected_paths:\n  - " + e.path("secrets") + "/**\n")
+
+	// The confirmation phrase is read as a whole line
+	if r := e.run("yes\n", key); r.code == 0 || !exists(key) {
+		t.Fatalf("a partial confirmation should abort:\n%s", r.stderr)
+	}
+	if r := e.run("yes I am sure\n", key); r.code != 0 || exists(key) {
+		t.Errorf("the confirmation phrase should remove the file:\n%s", r.stderr)
+	}
+}
+
+func TestPosixWriteProtectedPrompt(t *testing.T) {
+	e := newEnv(t)
+	file := e.write("readonly.txt", "data\n")
+	if err := os.Chmod(file, 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	// POSIX only asks when stdin is a terminal
+	if r := e.run("", "--posix", file); r.code != 0 || exists(file) {
+		t.Fatalf("without a terminal the file should be removed silently:\n%s", r.stderr)
+	}
+
+	file = e.write("readonly.txt", "data\n")
+	os.Chmod(file, 0444)
+	s := e.runTTY("--posix", file)
+	s.expect("remove write-protected file")
+	s.send("n")
+	s.finish()
+	if !exists(file) {
+		t.Error("write-protected file answered 'n' should be kept")
+	}
+}
+
+func TestScriptMode(t *testing.T) {
+	e := newEnv(t)
+	file := e.write("file.txt", "data\n")
+	empty := e.mkdir("empty")
+	key := e.write("secrets/key.pem", "key\n")
+	e.config("protected_paths:\n  - " + e.path("secrets") + "/**\n")
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		code  string
+		keep  string
+	}{
+		{"glob matched nothing", "", []string{"-f", e.path("*.tmp")}, `"ENOENT"`, ""},
+		{"missing operand", "", []string{"-f"}, `"USAGE"`, ""},
+		{"directory without -r", "", []string{"-d", empty}, `"EISDIR"`, empty},
+		{"no prompts", "y\n", []string{"-i", file}, `"ABORTED"`, file},
+		{"protected path", "yes I am sure\n", []string{key}, `"PROTECTED"`, key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := e.run(tt.stdin, append([]string{"--script-mode"}, tt.args...)...)
+			if r.code == 0 {
+				t.Fatal("script mode should fail")
+			}
+			if !strings.HasPrefix(r.stderr, "{") || !strings.Contains(r.stderr, tt.code) {
+				t.Errorf("error should be JSON with the %s code:\n%s", tt.code, r.stderr)
+			}
+			if tt.keep != "" && !exists(tt.keep) {
+				t.Errorf("%s should still exist", tt.keep)
+			}
+		})
+	}
+
+	// script_mode: auto applies without a terminal, unless turned off
+	e.config("script_mode: auto\n")
+	if r := e.run("", "-d", empty); r.code == 0 || !exists(empty) {
+		t.Errorf("script_mode auto should require -r without a terminal:\n%s", r.stderr)
+	}
+	if r := e.mustRun("--no-script-mode", "-d", empty); exists(empty) {
+		t.Errorf("--no-script-mode should allow -d:\n%s", r.stderr)
+	}
+	if r := e.mustRun("-r", file); exists(file) {
+		t.Errorf("script mode should still remove files:\n%s", r.stderr)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	e := newEnv(t)
+	keep := e.write("notes/keep.txt", "keep\n")
+	restored := e.write("notes/restore-me.txt", "restore\n")
+	deleted := e.write("scratch.txt", "scratch\n")
+	e.mustRun(keep, restored, deleted)
+
+	s := e.runTTY("--safe-browse")
+	s.expect("3 item(s), 3 shown")
+
+	// Filter down to one item and restore it
+	s.press("/restore-me\r")
+	s.expect("3 item(s), 1 shown")
+	s.press("r")
+	s.expect("Restored 1 item(s).")
+
+	// Clear the filter, select the scratch file and delete it for good
+	s.press("\x1b/scratch\r ")
+	s.expect("1 selected")
+	s.press("D")
+	s.expect("Permanently delete 1 item(s)?")
+	s.press("y")
+	s.expect("Deleted 1 item(s).")
+	s.press("q")
+	if code := s.finish(); code != 0 {
+		t.Errorf("--safe-browse exited with %d", code)
+	}
+
+	if got := e.read(restored); got != "restore\n" {
+		t.Errorf("restored content = %q", got)
+	}
+	trashed := e.trashed()
+	if _, ok := trashed[keep]; !ok || len(trashed) != 1 {
+		t.Errorf("only %s should be left in the trash, found %v", keep, trashed)
+	}
+	if exists(deleted) {
+		t.Error("the deleted item should not have been restored")
+	}
+
+	if r := e.run("", "--safe-browse"); r.code == 0 || !strings.Contains(r.stderr, "needs a terminal") {
+		t.Errorf("--safe-browse without a terminal should fail:\n%s", r.stderr)
+	}
+}
+
+func TestMistypedTrash(t *testing.T) {
+	e := newEnv(t)
+	// SAFERM_TRASH points at a directory of real data holding something
+	// that looks like a trashed item
+	e.trash = e.mkdir("projects")
+	e.write("projects/app/main.go", "package main\n")
+	e.write("projects/app/main.go.saferm-meta", `{"version": 1, "original_path": "/app/main.go"}`)
+
+	for _, args := range [][]string{{"--safe-empty"}, {"--safe-purge", "--purge-days=1"}, {"--safe-list"}, {e.write("file", "file\n")}} {
+		r := e.run("yes I am sure\n", args...)
+		if r.code == 0 || !strings.Contains(r.stderr, "does not look like a safe-rm trash") {
+			t.Errorf("rm %v should be refused:\n%s%s", args, r.stdout, r.stderr)
+		}
+	}
+	if !exists(e.path("projects/app/main.go")) {
+		t.Fatal("the mistyped trash was emptied")
+	}
+
+	// --assume-trash adopts the directory once; it stays accepted
+	e.mustRun("--safe-list", "--assume-trash")
+	if !exists(e.path("projects/.saferm-format")) || !exists(e.path("projects/README.safe-rm")) {
+		t.Error("--assume-trash should mark the trash")
+	}
+	e.mustRun(e.path("file"))
+
+	// A new trash is marked as it is created
+	e.trash = e.path("new-trash")
+	e.mustRun(e.write("other", "other\n"))
+	if !exists(e.path("new-trash/.saferm-format")) {
+		t.Error("a new trash should be marked")
+	}
+}
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionTrash     = "trash"
+	ActionPermanent = "permanent"
+	ActionRestore   = "restore"
+	ActionPurge     = "purge"
+	ActionEmpty     = "empty"
+	ActionArchive   = "archive" // Purged into an archive pack
+	ActionEvict     = "evict"   // Purged to make room under max_trash_size
+	ActionObserve   = "observe" // What safe-rm would have done, in observe mode
+	ActionCanary    = "canary"  // Blocked removal that would have deleted a canary file
+	ActionDestroy   = "destroy" // Shredded by --safe-destroy-matching
+)
+
+// Entry is a single audit log record
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Path       string    `json:"path"`
+	TrashPath  string    `json:"trash_path,omitempty"`
+	Bytes      int64     `json:"bytes,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	User       string    `json:"user"`
+	Hostname   string    `json:"hostname"`
+	Process    string    `json:"process,omitempty"`  // Parent process chain, when process_chain is enabled
+	Decision   string    `json:"decision,omitempty"` // Observe mode: the action safe-rm would have taken
+	Rule       string    `json:"rule,omitempty"`     // Observe mode and canaries: the rule deciding it
+	Receipt    *Receipt  `json:"receipt,omitempty"`  // Purges with purge_receipts, and destructions: signed proof of destruction
+}
+
+// rotatedLogs is how many rotated audit logs are kept, as audit.log.1
+// (the newest) to audit.log.5
+const rotatedLogs = 5
+
+// Path returns the location of the audit log
+func Path() string {
+	return filepath.Join(config.StateDir(), "audit.log")
+}
+
+// rotatedPath returns the location of the nth rotated audit log
+func rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", Path(), n)
+}
+
+// Record appends an entry to the audit log if auditing is enabled, or if it
+// carries a receipt, which is signed here. Time, User, Hostname and Process
+// are filled in when empty.
+func Record(cfg *config.Config, entry Entry) error {
+	if !cfg.AuditLog && entry.Receipt == nil {
+		return nil
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.User == "" {
+		entry.User = currentUser()
+	}
+	if entry.Hostname == "" {
+		entry.Hostname, _ = os.Hostname()
+	}
+	if entry.Process == "" {
+		entry.Process = cfg.Process
+	}
+	if entry.Receipt != nil {
+		if err := entry.Receipt.sign(cfg, entry.Time, entry.User); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return err
+	}
+	f, err := openLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// openLog opens the audit log for appending and locks it, rotating it
+// first once it has grown beyond audit_log_max_size. Concurrent writers
+// serialize on the lock; one that waited on a log rotated meanwhile opens
+// the new one.
+func openLog(cfg *config.Config) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(Path()); err != nil || !os.SameFile(info, current) {
+			f.Close()
+			continue
+		}
+		if cfg.AuditLogMaxSize <= 0 || info.Size() < int64(cfg.AuditLogMaxSize) {
+			return f, nil
+		}
+
+		err = rotate()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rotate shifts the audit log to audit.log.1, and each rotated log one
+// further, dropping the oldest
+func rotate() error {
+	for n := rotatedLogs; n > 1; n-- {
+		if err := os.Rename(rotatedPath(n-1), rotatedPath(n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(Path(), rotatedPath(1))
+}
+
+// Read returns all entries in the audit log and the rotated logs still
+// kept, oldest first. Malformed lines are skipped; a missing log yields no
+// entries.
+func Read() ([]Entry, error) {
+	var entries []Entry
+	for n := rotatedLogs; n >= 0; n-- {
+		path := Path()
+		if n > 0 {
+			path = rotatedPath(n)
+		}
+		if err := readLog(path, &entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// readLog appends the entries of the audit log at path to entries
+func readLog(path string, entries *[]Entry) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		*entries = append(*entries, entry)
+	}
+	return scanner.Err()
+}
+
+// currentUser returns the name of the user running safe-rm
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+func TestRecord(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	cfg := &config.Config{AuditLog: true}
+
+	entries := []Entry{
+		{Action: ActionTrash, Path: "/home/user/a.txt", TrashPath: "/trash/host/home/user/a.txt", Bytes: 42, DurationMs: 3},
+		{Action: ActionRestore, Path: "/home/user/a.txt", DurationMs: 1},
+	}
+	for _, entry := range entries {
+		if err := Record(cfg, entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(Path())
+	if err != nil {
+		t.Fatalf("audit log should exist: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log has %d lines, want 2", len(lines))
+	}
+
+	var got Entry
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid audit record %q: %v", lines[0], err)
+	}
+	if got.Action != ActionTrash || got.Bytes != 42 || got.DurationMs != 3 {
+		t.Errorf("audit record = %+v", got)
+	}
+	if got.Time.IsZero() || got.Hostname == "" {
+		t.Errorf("Record() should fill in time and hostname, got %+v", got)
+	}
+
+	info, err := os.Stat(Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestRecordDisabled(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	if err := Record(&config.Config{AuditLog: false}, Entry{Action: ActionTrash, Path: "/x"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, err := os.Stat(Path()); !os.IsNotExist(err) {
+		t.Error("audit log should not be written when disabled")
+	}
+}
+
+func TestRead(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	entries, err := Read()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Read() without log = %v, %v, want no entries", entries, err)
+	}
+
+	cfg := &config.Config{AuditLog: true}
+	Record(cfg, Entry{Action: ActionTrash, Path: "/a"})
+	f, _ := os.OpenFile(Path(), os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString("not json\n")
+	f.Close()
+	Record(cfg, Entry{Action: ActionPurge, Path: "/a"})
+
+	entries, err = Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != ActionTrash || entries[1].Action != ActionPurge {
+		t.Errorf("Read() = %+v, want trash then purge (malformed line skipped)", entries)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	// Every entry is larger than the limit, so each write rotates
+	cfg := &config.Config{AuditLog: true, AuditLogMaxSize: 1}
+	const written = rotatedLogs + 3
+	for i := 0; i < written; i++ {
+		if err := Record(cfg, Entry{Action: ActionTrash, Path: fmt.Sprintf("/%d", i)}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	// The oldest logs are dropped; what is kept reads in order
+	if _, err := os.Stat(rotatedPath(rotatedLogs + 1)); !os.IsNotExist(err) {
+		t.Errorf("more than %d rotated logs kept", rotatedLogs)
+	}
+	entries, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(entries) != rotatedLogs+1 {
+		t.Fatalf("Read() = %d entries, want %d", len(entries), rotatedLogs+1)
+	}
+	for i, entry := range entries {
+		if want := fmt.Sprintf("/%d", written-rotatedLogs-1+i); entry.Path != want {
+			t.Errorf("entry %d = %s, want %s", i, entry.Path, want)
+		}
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	item := filepath.Join(tempDir, "item")
+	if err := os.MkdirAll(filepath.Join(item, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(item, "sub", "data"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := NewReceipt("/home/user/item", item, MethodShred)
+	if err != nil {
+		t.Fatalf("NewReceipt() error = %v", err)
+	}
+	if receipt.Size != int64(len("secret")) || len(receipt.SHA256) != 64 {
+		t.Errorf("NewReceipt() = %+v", receipt)
+	}
+
+	// Renaming an entry changes the checksum
+	if err := os.Rename(filepath.Join(item, "sub", "data"), filepath.Join(item, "sub", "other")); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _, _ := Checksum(item); sum == receipt.SHA256 {
+		t.Error("Checksum() should change when an entry is renamed")
+	}
+
+	// Receipts are recorded and signed even with the audit log disabled
+	if err := Record(&config.Config{}, Entry{Action: ActionPurge, Path: "/home/user/item", Receipt: receipt}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	entries, err := Read()
+	if err != nil || len(entries) != 1 || entries[0].Receipt == nil {
+		t.Fatalf("Read() = %+v, %v, want one entry with a receipt", entries, err)
+	}
+	got := entries[0].Receipt
+	if err := got.Verify(); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if got.Operator == "" || !got.Time.Equal(entries[0].Time) {
+		t.Errorf("receipt should carry the operator and time of its entry, got %+v", got)
+	}
+	publicKey, err := ReceiptPublicKey(&config.Config{})
+	if err != nil || publicKey != got.PublicKey {
+		t.Errorf("ReceiptPublicKey() = %s, %v, want %s", publicKey, err, got.PublicKey)
+	}
+	if info, err := os.Stat(filepath.Join(tempDir, "safe-rm", receiptKeyFile)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("receipt key = %v, %v, want mode 0600", info, err)
+	}
+
+	got.Size++
+	if err := got.Verify(); err == nil {
+		t.Error("Verify() should fail once the receipt is altered")
+	}
+}
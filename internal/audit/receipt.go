@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// How a receipted item was destroyed
+const (
+	MethodDelete = "delete" // Unlinked
+	MethodShred  = "shred"  // Overwritten, then unlinked
+)
+
+// receiptKeyFile holds the Ed25519 seed signing purge receipts
+const receiptKeyFile = "receipt.key"
+
+// Receipt proves that an item existed, with its checksum and size, and that
+// it was destroyed, when and by whom (purge_receipts). It is signed with
+// the key in ReceiptKeyPath, whose public half each receipt carries; check
+// it against the published public key.
+type Receipt struct {
+	Path      string    `json:"path"`   // Original path of the item
+	SHA256    string    `json:"sha256"` // Checksum of its contents (see Checksum)
+	Size      int64     `json:"size"`   // Bytes in its regular files
+	Time      time.Time `json:"time"`   // When it was destroyed
+	Operator  string    `json:"operator"`
+	Method    string    `json:"method"`     // MethodDelete or MethodShred
+	PublicKey string    `json:"public_key"` // Hex Ed25519 public key
+	Signature string    `json:"signature"`  // Hex Ed25519 signature of the other fields
+}
+
+// NewReceipt checksums the trashed item at trashPath, originally at path,
+// before it is destroyed with method. The receipt is completed and signed
+// when its entry is recorded.
+func NewReceipt(path, trashPath, method string) (*Receipt, error) {
+	sum, size, err := Checksum(trashPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{Path: path, SHA256: sum, Size: size, Method: method}, nil
+}
+
+// Checksum returns the SHA-256 of a file, or of a directory tree: every
+// entry in lexical order as its relative path, type and contents (the
+// target of symlinks), so any change to names or data changes it. It also
+// returns the bytes in regular files.
+func Checksum(root string) (string, int64, error) {
+	h := sha256.New()
+	var size int64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		fmt.Fprintf(h, "%s\x00%s\x00", rel, info.Mode().Type())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			size += n
+		}
+		h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// sign completes the receipt with its time and operator and signs it
+func (r *Receipt) sign(cfg *config.Config, t time.Time, operator string) error {
+	key, err := receiptKey(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot sign purge receipt: %v", err)
+	}
+	r.Time, r.Operator = t, operator
+	r.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	r.Signature = ""
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// Verify checks the signature of the receipt against its public key
+func (r *Receipt) Verify() error {
+	public, err := hex.DecodeString(r.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	signature, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	unsigned := *r
+	unsigned.Signature = ""
+	payload, err := json.Marshal(&unsigned)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, payload, signature) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// ReceiptKeyPath returns the location of the key signing purge receipts:
+// receipt_key, or receipt.key in the state directory
+func ReceiptKeyPath(cfg *config.Config) string {
+	if cfg.ReceiptKey != "" {
+		return config.ExpandHome(cfg.ReceiptKey)
+	}
+	return filepath.Join(config.StateDir(), receiptKeyFile)
+}
+
+// ReceiptPublicKey returns the hex public key receipts are signed with,
+// creating the key on first use
+func ReceiptPublicKey(cfg *config.Config) (string, error) {
+	key, err := receiptKey(cfg)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// receiptKey returns the key signing purge receipts, creating it on first
+// use. The file holds the hex seed and is only readable by its owner.
+func receiptKey(cfg *config.Config) (ed25519.PrivateKey, error) {
+	path := ReceiptKeyPath(cfg)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(string(trimNewline(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s is not a receipt key", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// Publish the complete key with a link, which fails if a concurrent
+	// invocation got there first; then both use the same key
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, path); err != nil {
+		if os.IsExist(err) {
+			return receiptKey(cfg)
+		}
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// trimNewline drops a trailing newline
+func trimNewline(data []byte) []byte {
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		return data[:n-1]
+	}
+	return data
+}
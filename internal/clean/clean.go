@@ -0,0 +1,111 @@
+package clean
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options select what Artifacts returns
+type Options struct {
+	Untracked bool     // Also untracked files that are not ignored (like git clean -x)
+	Excludes  []string // Glob patterns for paths to keep, matched against the relative path and the name
+}
+
+// Artifacts returns the absolute paths of the ignored files and directories
+// below dir, which must be inside a git work tree; the same set as
+// "git clean -ndX". Ignored directories are returned as a whole.
+func Artifacts(dir string, opts Options) ([]string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := git(absDir, "rev-parse", "--show-toplevel"); err != nil {
+		return nil, fmt.Errorf("%s is not inside a git work tree", absDir)
+	}
+
+	args := []string{"ls-files", "-z", "--others", "--exclude-standard", "--directory"}
+	if !opts.Untracked {
+		args = append(args, "--ignored")
+	}
+	out, err := git(absDir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, rel := range strings.Split(string(out), "\x00") {
+		rel = strings.TrimSuffix(rel, "/")
+		if rel == "" || excluded(rel, opts.Excludes) {
+			continue
+		}
+		paths = append(paths, filepath.Join(absDir, rel))
+	}
+	if opts.Untracked {
+		// The untracked listing omits ignored files; add them
+		ignored, err := Artifacts(absDir, Options{Excludes: opts.Excludes})
+		if err != nil {
+			return nil, err
+		}
+		paths = outermost(append(paths, ignored...))
+	}
+	return paths, nil
+}
+
+// outermost drops paths located below another path in the list, which
+// would be gone once their parent is removed
+func outermost(paths []string) []string {
+	listed := map[string]bool{}
+	for _, path := range paths {
+		listed[path] = true
+	}
+
+	var kept []string
+	for _, path := range paths {
+		nested := false
+		for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if listed[dir] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, path)
+		}
+	}
+	sort.Strings(kept)
+	return kept
+}
+
+// excluded reports whether rel (relative to the cleaned directory) matches
+// one of the exclude patterns, by path or by name
+func excluded(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// git runs a git command in dir and returns its standard output
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package clean
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupRepo creates a git work tree with tracked, untracked and ignored files
+func setupRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tempDir, err := os.MkdirTemp("", "saferm-clean-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "init", "-q", tempDir).CombinedOutput(); err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	files := map[string]string{
+		".gitignore":       "build/\n*.o\n.env\n",
+		"main.c":           "int main() {}",
+		"main.o":           "obj",
+		".env":             "SECRET=1",
+		"build/app":        "bin",
+		"build/lib/x.a":    "lib",
+		"notes.txt":        "untracked",
+		"scratch/main.o":   "obj",
+		"scratch/todo.txt": "untracked",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("git", "-C", tempDir, "add", ".gitignore", "main.c").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v: %s", err, out)
+	}
+	return tempDir
+}
+
+func TestArtifacts(t *testing.T) {
+	repo := setupRepo(t)
+	defer os.RemoveAll(repo)
+
+	tests := []struct {
+		desc string
+		dir  string
+		opts Options
+		want []string
+	}{
+		{"ignored only", repo, Options{}, []string{".env", "build", "main.o", "scratch/main.o"}},
+		{"exclude by name", repo, Options{Excludes: []string{".env"}}, []string{"build", "main.o", "scratch/main.o"}},
+		{"exclude by path", repo, Options{Excludes: []string{"scratch/*"}}, []string{".env", "build", "main.o"}},
+		{"subdirectory", filepath.Join(repo, "scratch"), Options{}, []string{"scratch/main.o"}},
+		{"untracked too", repo, Options{Untracked: true}, []string{".env", "build", "main.o", "notes.txt", "scratch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			paths, err := Artifacts(tt.dir, tt.opts)
+			if err != nil {
+				t.Fatalf("Artifacts() error = %v", err)
+			}
+			var got []string
+			for _, path := range paths {
+				rel, _ := filepath.Rel(repo, path)
+				got = append(got, rel)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Artifacts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArtifactsOutsideRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	tempDir, err := os.MkdirTemp("", "saferm-clean-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := Artifacts(tempDir, Options{}); err == nil {
+		t.Error("Artifacts() outside a git work tree should fail")
+	}
+}
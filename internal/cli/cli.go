@@ -2,28 +2,132 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/inode"
+	"github.com/user/safe-rm/internal/output"
 )
 
 // Options represents parsed command-line options
 type Options struct {
 	// Standard rm flags
-	Force           bool     // -f, --force
-	Interactive     bool     // -i
-	InteractiveOnce bool     // -I
-	Recursive       bool     // -r, -R, --recursive
-	RemoveEmptyDirs bool     // -d, --dir
-	Verbose         bool     // -v, --verbose
-	PreserveRoot    bool     // --preserve-root (default true)
-	NoPreserveRoot  bool     // --no-preserve-root
-	Files           []string // Files/directories to remove
+	Force                bool     // -f, --force
+	Interactive          bool     // -i
+	InteractiveOnce      bool     // -I
+	Recursive            bool     // -r, -R, --recursive
+	OneFileSystem        bool     // --one-file-system (with -r, skip mount points below the operands)
+	RemoveEmptyDirs      bool     // -d, --dir
+	IgnoreFailOnNonEmpty bool     // --ignore-fail-on-non-empty (with -d, skip non-empty directories)
+	Verbosity            int      // -v, --verbose (repeat for more detail), -q, --quiet (-1)
+	PreserveRoot         bool     // --preserve-root (default true)
+	NoPreserveRoot       bool     // --no-preserve-root
+	Posix                bool     // --posix or POSIXLY_CORRECT set
+	ScriptMode           bool     // --script-mode: never prompt, refuse instead of ignoring, JSON errors
+	NoScriptMode         bool     // --no-script-mode, overriding script_mode in the config
+	Permanent            bool     // --permanent (delete without moving to trash)
+	Idempotent           bool     // --idempotent (a path trashed earlier this session or window counts as removed)
+	IgnoreMissing        bool     // --ignore-missing (warn about nonexistent files instead of failing)
+	LenientPaths         bool     // --lenient-paths (accept file:// URIs, strip pasted quotes and '\r')
+	Inodes               []string // --inode=N[@DIR] (remove files by inode number)
+	InodesFrom           string   // --inodes-from=FILE (inode specs, one per line; - for stdin)
+	Resume               string   // --resume=SESSION (finish removals interrupted in SESSION)
+	ErrorFormat          string   // --errors=text|json (format of errors on stderr)
+	VerboseErrors        bool     // --verbose-errors (print a per-path status table at the end)
+	Report               string   // --report=FILE (write per-path results as JSON lines)
+	Files                []string // Files/directories to remove
 
 	// Safe-rm specific flags
-	SafeList    bool   // --safe-list
-	SafeRestore string // --safe-restore=PATH
-	SafePurge   bool   // --safe-purge
-	SafeEmpty   bool   // --safe-empty (empty entire trash)
-	PurgeDays   int    // --purge-days=N (default 30)
+	SafeList           bool     // --safe-list
+	SafeRestore        string   // --safe-restore=PATH
+	SafeRestoreSession string   // --safe-restore-session=SESSION (restore everything a session trashed)
+	SafeRestoreID      string   // --safe-restore-id=ID (restore the item with ID or an unambiguous prefix of it)
+	RestoreArchive     string   // --restore-as-archive=FILE (pack the items to restore into a tar.gz instead)
+	SafeUndo           bool     // --safe-undo (restore everything the last removal moved to the trash)
+	Conflict           string   // --conflict=skip|overwrite|rename (batch restores onto existing files)
+	Maps               []string // --map=OLD=NEW (repeatable; restore items trashed below OLD below NEW)
+	SafeInfo           string   // --safe-info=PATH (details and manifest of a trashed item)
+	SafePurge          bool     // --safe-purge
+	SafeEmpty          bool     // --safe-empty (empty entire trash)
+	Shred              bool     // --shred (overwrite contents before --safe-empty and --safe-purge delete them)
+	SafeHarden         bool     // --safe-harden (fix permissions of existing trash)
+	SafeScan           bool     // --safe-scan (measure trashed directories queued for a scan)
+	SafeReindex        bool     // --safe-reindex (rebuild the trash index)
+	SafeBrowse         bool     // --safe-browse (browse, restore and delete trashed items interactively)
+	SafeMigrateHost    string   // --safe-migrate-host=OLD=NEW (move the trashed items of host OLD to NEW)
+	SafeAutopurge      bool     // --safe-autopurge (notify, then enforce retention)
+	SafeEnforce        bool     // --safe-enforce (as root, autopurge every user's trash as that user)
+	SafePin            string   // --safe-pin=PATH (exempt item from purging by age)
+	SafeUnpin          string   // --safe-unpin=PATH
+	SafeAnnotate       string   // --safe-annotate=PATH (attach --note to a trashed item)
+	Note               string   // --note=TEXT (empty removes the note)
+	SafeRetag          string   // --safe-retag=PATH (replace the tags of a trashed item with --tag)
+	Tags               []string // --tag=TAG (repeatable or comma-separated)
+	SafeHistory        bool     // --safe-history[=PATH]
+	SafeVerifyReceipts bool     // --safe-verify-receipts (check the signatures of purge receipts)
+	HistoryPath        string   // only show history for this original path
+	PurgeDays          int      // --purge-days=N (default 0: retention_days from config)
+	SafeForecast       bool     // --safe-forecast[=DAYS]
+	ForecastDays       int      // days ahead for --safe-forecast (default 7)
+	SafeTrend          bool     // --safe-trend[=DAYS]
+	TrendDays          int      // days of history for --safe-trend (default 30)
+	SafeStats          bool     // --safe-stats[=N] (local usage statistics of protection rules)
+	StatsPaths         int      // protected paths listed by --safe-stats (default 20)
+	SafeUsers          bool     // --safe-users (trash usage per user)
+	SafeDu             bool     // --safe-du (trash size by original directory and age)
+	JSON               bool     // --json (JSON on stdout for --safe-list, --safe-purge, --safe-du and -v)
+	SafeSimulate       bool     // --safe-simulate[=FILE] (report what removing the listed paths would do)
+	SimulateFrom       string   // file listing the paths for --safe-simulate; empty or "-" is stdin
+	TrashDir           string   // --trash-dir=PATH (overrides config and environment)
+	AssumeTrash        bool     // --assume-trash (accept and mark a trash directory without the safe-rm marker)
+	Fallback           string   // --fallback=copy|fail|mount (cross-device strategy; overrides cross_device)
+	NoThrottle         bool     // --no-throttle (ignore throttle_* settings and autopurge idle checks)
+	Namespace          string   // --namespace=NAME (trash namespace; overrides SAFERM_NAMESPACE)
+	AllNamespaces      bool     // --all-namespaces (list and manage items of every namespace)
+	TimeStyle          string   // --time-style=iso|long-iso|relative (listings)
+	AllTrashes         bool     // --all-trashes (aggregate list/restore/purge across trash roots)
+
+	// Cleaning build artifacts
+	SafeClean bool     // --safe-clean[=DIR] (trash git-ignored files)
+	CleanDir  string   // directory to clean (default: current directory)
+	Untracked bool     // --untracked (also untracked files that are not ignored)
+	Excludes  []string // --exclude=PATTERN (keep matching paths)
+	DryRun    bool     // --dry-run (only list what would be removed)
+
+	// Content search
+	SafeGrep    string   // --safe-grep=PATTERN (search trashed files for a regular expression)
+	GrepMaxSize int64    // --grep-max-size=SIZE (skip larger files; 0 uses the default)
+	GrepInclude []string // --grep-include=GLOB (only search files with matching names)
+
+	// Destroying the data of a subject
+	SafeDestroyMatching string   // --safe-destroy-matching=PATTERN (shred everything matching, with receipts)
+	DestroyLive         []string // --destroy-live=DIR (repeatable; also search the files below DIR)
+	ApprovalToken       string   // --approval-token=TOKEN (destroy without confirming, if the matches are unchanged)
+
+	// Janitor profiles
+	SafeJanitor bool   // --safe-janitor[=PROFILE] (run a cleanup profile, or list them)
+	Profile     string // janitor profile to run
+
+	// Filters of batch restores
+	DeletedAfter  time.Time     // --deleted-after=DATE (only restore items trashed since DATE)
+	DeletedWithin time.Duration // --deleted-within=AGE (only restore items trashed in the last AGE)
+
+	// Trash root registry
+	SafeTrashRoots bool   // --safe-trash-roots (list known trash roots)
+	RegisterRoot   string // --register=PATH (add PATH to the registry)
+	ForgetRoot     string // --forget=PATH (remove PATH from the registry)
+
+	// Canary files
+	SafeCanary   []string // --safe-canary=DIR (seed a canary file in DIR)
+	SafeCanaries bool     // --safe-canaries (list installed canary files)
+
+	// Self-update
+	SafeSelfUpdate bool   // --safe-self-update (replace the binary with the latest release)
+	Channel        string // --channel=stable|beta (release channel for --safe-self-update)
 
 	// Internal flags
 	ExitClean bool // Set when --help or --version is used
@@ -33,15 +137,18 @@ type Options struct {
 func Parse(args []string) (*Options, error) {
 	opts := &Options{
 		PreserveRoot: true, // Default to preserve root
-		PurgeDays:    30,   // Default purge days
+		ForecastDays: 7,    // Default forecast horizon
+		TrendDays:    30,   // Default trend history
+		StatsPaths:   20,   // Default paths listed by --safe-stats
+		Posix:        os.Getenv("POSIXLY_CORRECT") != "",
 	}
 
 	i := 0
 	for i < len(args) {
 		arg := args[i]
 
-		if arg == "--" {
-			// Everything after -- is a file
+		if arg == "--" || arg == "--literal" {
+			// Everything after -- (or --literal) is a file
 			opts.Files = append(opts.Files, args[i+1:]...)
 			break
 		}
@@ -49,13 +156,17 @@ func Parse(args []string) (*Options, error) {
 		if strings.HasPrefix(arg, "--") {
 			// Long option
 			if err := parseLongOption(opts, arg, args, &i); err != nil {
-				return nil, err
+				return nil, withDashFileHint(err, arg)
 			}
 		} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
 			// Short option(s)
 			if err := parseShortOptions(opts, arg[1:]); err != nil {
-				return nil, err
+				return nil, withDashFileHint(err, arg)
 			}
+		} else if opts.Posix {
+			// POSIX: option parsing stops at the first operand
+			opts.Files = append(opts.Files, args[i:]...)
+			break
 		} else {
 			// File argument
 			opts.Files = append(opts.Files, arg)
@@ -66,6 +177,304 @@ func Parse(args []string) (*Options, error) {
 	return opts, nil
 }
 
+// UsesSubcommands reports whether the program was invoked under a name that
+// selects the subcommand interface (safe-rm COMMAND ...) instead of the
+// rm-compatible flag interface.
+func UsesSubcommands(program string) bool {
+	name := strings.TrimSuffix(filepath.Base(program), ".exe")
+	return name == "safe-rm"
+}
+
+// ParseSubcommand parses arguments of the form COMMAND [ARGS...] and returns
+// Options equivalent to the corresponding rm-style invocation, so that
+// "safe-rm restore PATH" and "rm --safe-restore=PATH" behave identically.
+func ParseSubcommand(args []string) (*Options, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing command\nTry 'safe-rm help' for more information.")
+	}
+
+	command, rest := args[0], args[1:]
+	switch command {
+	case "help", "--help", "-h":
+		printSubcommandHelp()
+		return &Options{ExitClean: true}, nil
+	case "--version":
+		return Parse([]string{"--version"})
+	case "trash":
+		return Parse(rest)
+	}
+
+	opts, err := Parse(rest)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ExitClean {
+		return opts, nil
+	}
+
+	switch command {
+	case "list":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("list: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeList = true
+	case "restore":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("restore: requires exactly one path argument")
+		}
+		opts.SafeRestore = opts.Files[0]
+		opts.Files = nil
+	case "undo":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("undo: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeUndo = true
+	case "restore-session":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("restore-session: requires exactly one session argument")
+		}
+		opts.SafeRestoreSession = opts.Files[0]
+		opts.Files = nil
+	case "restore-id":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("restore-id: requires exactly one ID argument")
+		}
+		opts.SafeRestoreID = opts.Files[0]
+		opts.Files = nil
+	case "info":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("info: requires exactly one path argument")
+		}
+		opts.SafeInfo = opts.Files[0]
+		opts.Files = nil
+	case "purge":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("purge: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafePurge = true
+	case "empty":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("empty: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeEmpty = true
+	case "resume":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("resume: requires exactly one session argument")
+		}
+		opts.Resume = opts.Files[0]
+		opts.Files = nil
+	case "forecast":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("forecast: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeForecast = true
+		if len(opts.Files) == 1 {
+			if _, err := fmt.Sscanf(opts.Files[0], "%d", &opts.ForecastDays); err != nil || opts.ForecastDays < 0 {
+				return nil, fmt.Errorf("forecast: invalid number of days: %s", opts.Files[0])
+			}
+			opts.Files = nil
+		}
+	case "trend":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("trend: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeTrend = true
+		if len(opts.Files) == 1 {
+			if _, err := fmt.Sscanf(opts.Files[0], "%d", &opts.TrendDays); err != nil || opts.TrendDays < 1 {
+				return nil, fmt.Errorf("trend: invalid number of days: %s", opts.Files[0])
+			}
+			opts.Files = nil
+		}
+	case "stats":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("stats: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeStats = true
+		if len(opts.Files) == 1 {
+			if _, err := fmt.Sscanf(opts.Files[0], "%d", &opts.StatsPaths); err != nil || opts.StatsPaths < 1 {
+				return nil, fmt.Errorf("stats: invalid number of paths: %s", opts.Files[0])
+			}
+			opts.Files = nil
+		}
+	case "history":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("history: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeHistory = true
+		if len(opts.Files) == 1 {
+			opts.HistoryPath = opts.Files[0]
+			opts.Files = nil
+		}
+	case "verify-receipts":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("verify-receipts: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeVerifyReceipts = true
+	case "autopurge":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("autopurge: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeAutopurge = true
+	case "enforce":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("enforce: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeEnforce = true
+	case "pin", "unpin":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("%s: requires exactly one path argument", command)
+		}
+		if command == "pin" {
+			opts.SafePin = opts.Files[0]
+		} else {
+			opts.SafeUnpin = opts.Files[0]
+		}
+		opts.Files = nil
+	case "annotate", "retag":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("%s: requires exactly one path argument", command)
+		}
+		if command == "annotate" {
+			opts.SafeAnnotate = opts.Files[0]
+		} else {
+			opts.SafeRetag = opts.Files[0]
+		}
+		opts.Files = nil
+	case "harden":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("harden: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeHarden = true
+	case "scan":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("scan: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeScan = true
+	case "reindex":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("reindex: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeReindex = true
+	case "browse":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("browse: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeBrowse = true
+	case "migrate-host":
+		if len(opts.Files) != 2 {
+			return nil, fmt.Errorf("migrate-host: requires the old and the new host name")
+		}
+		opts.SafeMigrateHost = opts.Files[0] + "=" + opts.Files[1]
+		opts.Files = nil
+	case "simulate":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("simulate: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeSimulate = true
+		if len(opts.Files) == 1 {
+			opts.SimulateFrom = opts.Files[0]
+			opts.Files = nil
+		}
+	case "clean":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("clean: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeClean = true
+		if len(opts.Files) == 1 {
+			opts.CleanDir = opts.Files[0]
+			opts.Files = nil
+		}
+	case "grep":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("grep: requires exactly one pattern argument")
+		}
+		opts.SafeGrep = opts.Files[0]
+		opts.Files = nil
+	case "destroy-matching":
+		if len(opts.Files) != 1 {
+			return nil, fmt.Errorf("destroy-matching: requires exactly one pattern argument")
+		}
+		opts.SafeDestroyMatching = opts.Files[0]
+		opts.Files = nil
+	case "janitor":
+		if len(opts.Files) > 1 {
+			return nil, fmt.Errorf("janitor: unexpected argument '%s'", opts.Files[1])
+		}
+		opts.SafeJanitor = true
+		if len(opts.Files) == 1 {
+			opts.Profile = opts.Files[0]
+			opts.Files = nil
+		}
+	case "users":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("users: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeUsers = true
+	case "du":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("du: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeDu = true
+	case "canary":
+		switch {
+		case len(opts.Files) >= 2 && opts.Files[0] == "install":
+			opts.SafeCanary = opts.Files[1:]
+		case len(opts.Files) == 1 && opts.Files[0] == "list":
+			opts.SafeCanaries = true
+		default:
+			return nil, fmt.Errorf("canary: expected 'install DIR...' or 'list'")
+		}
+		opts.Files = nil
+	case "trash-roots":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("trash-roots: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeTrashRoots = true
+	case "self-update":
+		if len(opts.Files) > 0 {
+			return nil, fmt.Errorf("self-update: unexpected argument '%s'", opts.Files[0])
+		}
+		opts.SafeSelfUpdate = true
+	default:
+		return nil, fmt.Errorf("unknown command '%s'\nTry 'safe-rm help' for more information.", command)
+	}
+
+	return opts, nil
+}
+
+// ErrorFormatArg returns the value of the last --errors=FORMAT option in args,
+// "json" for --script-mode without one, or "" if neither is given. It lets
+// errors from Parse itself be reported in the requested format.
+func ErrorFormatArg(args []string) string {
+	format, script := "", false
+	for _, arg := range args {
+		if arg == "--" || arg == "--literal" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(arg, "--errors="):
+			format = strings.TrimPrefix(arg, "--errors=")
+		case arg == "--script-mode":
+			script = true
+		case arg == "--no-script-mode":
+			script = false
+		}
+	}
+	if format == "" && script {
+		return "json"
+	}
+	return format
+}
+
+// withDashFileHint adds a hint on how to remove a file whose name starts with
+// a dash when an option fails to parse and a file by that name exists.
+func withDashFileHint(err error, arg string) error {
+	if _, statErr := os.Lstat(arg); statErr != nil {
+		return err
+	}
+	return fmt.Errorf("%v\nTry 'rm ./%s' or 'rm -- %s' to remove the file '%s'.", err, arg, arg, arg)
+}
+
 func parseLongOption(opts *Options, arg string, args []string, i *int) error {
 	// Handle --option=value format
 	var value string
@@ -76,21 +485,78 @@ func parseLongOption(opts *Options, arg string, args []string, i *int) error {
 
 	switch arg {
 	case "--force":
-		opts.Force = true
+		setForce(opts)
 	case "--interactive":
-		opts.Interactive = true
+		// As in coreutils rm: --interactive[=WHEN]
+		switch value {
+		case "", "always", "yes":
+			setInteractive(opts)
+		case "once":
+			setInteractiveOnce(opts)
+		case "never", "no", "none":
+			opts.Interactive = false
+			opts.InteractiveOnce = false
+		default:
+			return fmt.Errorf("invalid argument '%s' for '--interactive'\nValid arguments are: 'never', 'no', 'none', 'once', 'always', 'yes'", value)
+		}
 	case "--recursive":
 		opts.Recursive = true
 	case "--dir":
 		opts.RemoveEmptyDirs = true
 	case "--verbose":
-		opts.Verbose = true
+		increaseVerbosity(opts)
+	case "--quiet":
+		opts.Verbosity = -1
+	case "--no-force":
+		opts.Force = false
+	case "--no-interactive":
+		opts.Interactive = false
+		opts.InteractiveOnce = false
+	case "--no-recursive":
+		opts.Recursive = false
+	case "--no-dir":
+		opts.RemoveEmptyDirs = false
+	case "--no-verbose":
+		opts.Verbosity = 0
 	case "--preserve-root":
 		opts.PreserveRoot = true
 		opts.NoPreserveRoot = false
 	case "--no-preserve-root":
 		opts.NoPreserveRoot = true
 		opts.PreserveRoot = false
+	case "--one-file-system":
+		opts.OneFileSystem = true
+	case "--posix":
+		opts.Posix = true
+	case "--script-mode":
+		opts.ScriptMode = true
+		opts.NoScriptMode = false
+	case "--no-script-mode":
+		opts.NoScriptMode = true
+		opts.ScriptMode = false
+	case "--permanent":
+		opts.Permanent = true
+	case "--verbose-errors":
+		opts.VerboseErrors = true
+	case "--report":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--report requires a file argument")
+		}
+		opts.Report = value
+	case "--ignore-fail-on-non-empty":
+		opts.IgnoreFailOnNonEmpty = true
+	case "--ignore-missing":
+		opts.IgnoreMissing = true
+	case "--lenient-paths":
+		opts.LenientPaths = true
+	case "--idempotent":
+		opts.Idempotent = true
+	case "--errors":
+		if value != "text" && value != "json" {
+			return fmt.Errorf("--errors: invalid format '%s' (expected 'text' or 'json')", value)
+		}
+		opts.ErrorFormat = value
 	case "--safe-list":
 		opts.SafeList = true
 	case "--safe-restore":
@@ -98,10 +564,212 @@ func parseLongOption(opts *Options, arg string, args []string, i *int) error {
 			return fmt.Errorf("--safe-restore requires a path argument")
 		}
 		opts.SafeRestore = value
+	case "--safe-restore-session":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-restore-session requires a session argument")
+		}
+		opts.SafeRestoreSession = value
+	case "--safe-restore-id":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-restore-id requires an ID argument")
+		}
+		opts.SafeRestoreID = value
+	case "--safe-undo":
+		opts.SafeUndo = true
+	case "--restore-as-archive":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--restore-as-archive requires a file argument")
+		}
+		opts.RestoreArchive = value
+	case "--deleted-after":
+		value = optionValue(value, args, i)
+		after, err := parseDate(value)
+		if err != nil {
+			return fmt.Errorf("--deleted-after: %v", err)
+		}
+		opts.DeletedAfter = after
+	case "--deleted-within":
+		value = optionValue(value, args, i)
+		within, err := parseAge(value)
+		if err != nil {
+			return fmt.Errorf("--deleted-within: %v", err)
+		}
+		opts.DeletedWithin = within
+	case "--conflict":
+		if value != "skip" && value != "overwrite" && value != "rename" {
+			return fmt.Errorf("--conflict: invalid resolution '%s' (expected 'skip', 'overwrite' or 'rename')", value)
+		}
+		opts.Conflict = value
 	case "--safe-purge":
 		opts.SafePurge = true
 	case "--safe-empty":
 		opts.SafeEmpty = true
+	case "--shred":
+		opts.Shred = true
+	case "--assume-trash":
+		opts.AssumeTrash = true
+	case "--safe-harden":
+		opts.SafeHarden = true
+	case "--safe-scan":
+		opts.SafeScan = true
+	case "--safe-reindex":
+		opts.SafeReindex = true
+	case "--safe-browse":
+		opts.SafeBrowse = true
+	case "--safe-migrate-host":
+		value = optionValue(value, args, i)
+		if from, to, ok := strings.Cut(value, "="); !ok || from == "" || to == "" {
+			return fmt.Errorf("--safe-migrate-host requires an OLD=NEW argument")
+		}
+		opts.SafeMigrateHost = value
+	case "--safe-simulate":
+		opts.SafeSimulate = true
+		opts.SimulateFrom = value
+	case "--safe-clean":
+		opts.SafeClean = true
+		opts.CleanDir = value
+	case "--untracked":
+		opts.Untracked = true
+	case "--exclude":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--exclude requires a pattern argument")
+		}
+		opts.Excludes = append(opts.Excludes, value)
+	case "--dry-run":
+		opts.DryRun = true
+	case "--safe-info":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-info requires a path argument")
+		}
+		opts.SafeInfo = value
+	case "--safe-grep":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-grep requires a pattern argument")
+		}
+		opts.SafeGrep = value
+	case "--grep-max-size":
+		value = optionValue(value, args, i)
+		size, err := config.ParseByteSize(value)
+		if err != nil {
+			return fmt.Errorf("--grep-max-size: %v", err)
+		}
+		opts.GrepMaxSize = int64(size)
+	case "--grep-include":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--grep-include requires a pattern argument")
+		}
+		opts.GrepInclude = append(opts.GrepInclude, value)
+	case "--safe-destroy-matching":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-destroy-matching requires a pattern argument")
+		}
+		opts.SafeDestroyMatching = value
+	case "--destroy-live":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--destroy-live requires a directory argument")
+		}
+		opts.DestroyLive = append(opts.DestroyLive, value)
+	case "--approval-token":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--approval-token requires a token argument")
+		}
+		opts.ApprovalToken = value
+	case "--safe-janitor":
+		opts.SafeJanitor = true
+		opts.Profile = value
+	case "--safe-users":
+		opts.SafeUsers = true
+	case "--safe-du":
+		opts.SafeDu = true
+	case "--json":
+		opts.JSON = true
+	case "--safe-history":
+		opts.SafeHistory = true
+		opts.HistoryPath = value
+	case "--safe-verify-receipts":
+		opts.SafeVerifyReceipts = true
+	case "--safe-autopurge":
+		opts.SafeAutopurge = true
+	case "--safe-enforce":
+		opts.SafeEnforce = true
+	case "--safe-canary":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--safe-canary requires a directory argument")
+		}
+		opts.SafeCanary = append(opts.SafeCanary, value)
+	case "--safe-canaries":
+		opts.SafeCanaries = true
+	case "--safe-pin", "--safe-unpin":
+		if value == "" {
+			return fmt.Errorf("%s requires a path argument", arg)
+		}
+		if arg == "--safe-pin" {
+			opts.SafePin = value
+		} else {
+			opts.SafeUnpin = value
+		}
+	case "--safe-annotate", "--safe-retag":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("%s requires a path argument", arg)
+		}
+		if arg == "--safe-annotate" {
+			opts.SafeAnnotate = value
+		} else {
+			opts.SafeRetag = value
+		}
+	case "--note":
+		opts.Note = optionValue(value, args, i)
+	case "--map":
+		value = optionValue(value, args, i)
+		if from, to, ok := strings.Cut(value, "="); !ok || from == "" || to == "" {
+			return fmt.Errorf("--map requires an OLD=NEW argument")
+		}
+		opts.Maps = append(opts.Maps, value)
+	case "--tag":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--tag requires a tag argument")
+		}
+		opts.Tags = append(opts.Tags, value)
+	case "--safe-forecast":
+		opts.SafeForecast = true
+		if value != "" {
+			var days int
+			if _, err := fmt.Sscanf(value, "%d", &days); err != nil || days < 0 {
+				return fmt.Errorf("--safe-forecast: invalid number: %s", value)
+			}
+			opts.ForecastDays = days
+		}
+	case "--safe-trend":
+		opts.SafeTrend = true
+		if value != "" {
+			var days int
+			if _, err := fmt.Sscanf(value, "%d", &days); err != nil || days < 1 {
+				return fmt.Errorf("--safe-trend: invalid number: %s", value)
+			}
+			opts.TrendDays = days
+		}
+	case "--safe-stats":
+		opts.SafeStats = true
+		if value != "" {
+			var paths int
+			if _, err := fmt.Sscanf(value, "%d", &paths); err != nil || paths < 1 {
+				return fmt.Errorf("--safe-stats: invalid number: %s", value)
+			}
+			opts.StatsPaths = paths
+		}
 	case "--purge-days":
 		if value == "" {
 			return fmt.Errorf("--purge-days requires a number argument")
@@ -111,12 +779,77 @@ func parseLongOption(opts *Options, arg string, args []string, i *int) error {
 			return fmt.Errorf("--purge-days: invalid number: %s", value)
 		}
 		opts.PurgeDays = days
+	case "--all-trashes":
+		opts.AllTrashes = true
+	case "--time-style":
+		if !output.ValidTimeStyle(value) {
+			return fmt.Errorf("--time-style: invalid style '%s' (expected 'iso', 'long-iso' or 'relative')", value)
+		}
+		opts.TimeStyle = value
+	case "--safe-trash-roots":
+		opts.SafeTrashRoots = true
+	case "--safe-self-update":
+		opts.SafeSelfUpdate = true
+	case "--channel":
+		if value != "stable" && value != "beta" {
+			return fmt.Errorf("--channel: invalid channel '%s' (expected 'stable' or 'beta')", value)
+		}
+		opts.Channel = value
+	case "--register", "--forget":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("%s requires a path argument", arg)
+		}
+		opts.SafeTrashRoots = true
+		if arg == "--register" {
+			opts.RegisterRoot = value
+		} else {
+			opts.ForgetRoot = value
+		}
+	case "--inode":
+		value = optionValue(value, args, i)
+		if _, err := inode.ParseSpec(value); err != nil {
+			return fmt.Errorf("--inode: %v", err)
+		}
+		opts.Inodes = append(opts.Inodes, value)
+	case "--inodes-from":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--inodes-from requires a file argument")
+		}
+		opts.InodesFrom = value
+	case "--resume":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--resume requires a session argument")
+		}
+		opts.Resume = value
+	case "--namespace":
+		value = optionValue(value, args, i)
+		if value == "" {
+			return fmt.Errorf("--namespace requires a name argument")
+		}
+		opts.Namespace = value
+	case "--all-namespaces":
+		opts.AllNamespaces = true
+	case "--trash-dir":
+		if value == "" {
+			return fmt.Errorf("--trash-dir requires a path argument")
+		}
+		opts.TrashDir = value
+	case "--fallback":
+		if value != "copy" && value != "fail" && value != "mount" {
+			return fmt.Errorf("--fallback: invalid strategy '%s' (expected 'copy', 'fail' or 'mount')", value)
+		}
+		opts.Fallback = value
+	case "--no-throttle":
+		opts.NoThrottle = true
 	case "--help":
 		printHelp()
 		opts.ExitClean = true
 		return nil
 	case "--version":
-		fmt.Println("safe-rm version 1.0.0")
+		printVersion()
 		opts.ExitClean = true
 		return nil
 	default:
@@ -126,21 +859,63 @@ func parseLongOption(opts *Options, arg string, args []string, i *int) error {
 	return nil
 }
 
+// optionValue returns the value given with --option=value, or else consumes
+// the following argument as the value (--option value)
+func optionValue(value string, args []string, i *int) string {
+	if value != "" || *i+1 >= len(args) {
+		return value
+	}
+	*i++
+	return args[*i]
+}
+
+// Layouts accepted by parseDate, in local time unless they carry a zone
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseDate parses a date, optionally with a time of day
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s' (expected e.g. 2024-05-01 or '2024-05-01 14:30')", value)
+}
+
+// parseAge parses a positive duration such as 90m, 2h or 3d (days) or 2w
+// (weeks)
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			if count, err := strconv.Atoi(n); err == nil && count > 0 {
+				return time.Duration(count) * unit, nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age '%s' (expected e.g. 30m, 2h, 3d or 2w)", value)
+}
+
 func parseShortOptions(opts *Options, flags string) error {
 	for _, flag := range flags {
 		switch flag {
 		case 'f':
-			opts.Force = true
+			setForce(opts)
 		case 'i':
-			opts.Interactive = true
+			setInteractive(opts)
 		case 'I':
-			opts.InteractiveOnce = true
+			setInteractiveOnce(opts)
 		case 'r', 'R':
 			opts.Recursive = true
 		case 'd':
 			opts.RemoveEmptyDirs = true
 		case 'v':
-			opts.Verbose = true
+			increaseVerbosity(opts)
+		case 'q':
+			opts.Verbosity = -1
 		default:
 			return fmt.Errorf("invalid option -- '%c'", flag)
 		}
@@ -148,6 +923,36 @@ func parseShortOptions(opts *Options, flags string) error {
 	return nil
 }
 
+// increaseVerbosity handles -v: each occurrence raises the level by one,
+// and -v after -q starts again from verbose
+func increaseVerbosity(opts *Options) {
+	if opts.Verbosity < 0 {
+		opts.Verbosity = 0
+	}
+	opts.Verbosity++
+}
+
+// The prompting modes are mutually exclusive and, as in coreutils rm, the
+// last one given on the command line wins (e.g. "-i -f" means force).
+
+func setForce(opts *Options) {
+	opts.Force = true
+	opts.Interactive = false
+	opts.InteractiveOnce = false
+}
+
+func setInteractive(opts *Options) {
+	opts.Interactive = true
+	opts.InteractiveOnce = false
+	opts.Force = false
+}
+
+func setInteractiveOnce(opts *Options) {
+	opts.InteractiveOnce = true
+	opts.Interactive = false
+	opts.Force = false
+}
+
 func printHelp() {
 	help := `Usage: rm [OPTION]... [FILE]...
 Remove (move to trash) the FILE(s).
@@ -158,31 +963,282 @@ Instead of permanently deleting files, they are moved to a trash directory.
 Standard options:
   -f, --force           ignore nonexistent files and arguments
   -i                    prompt before every removal
-  -I                    prompt once before removing more than three files
+  -I                    prompt once before removing more than three files, or
+                            when removing recursively
+      --interactive[=WHEN]  prompt according to WHEN: never, once (-I), or
+                            always (-i); without WHEN, prompt always
   -r, -R, --recursive   remove directories and their contents recursively
   -d, --dir             remove empty directories
-  -v, --verbose         explain what is being done
+      --ignore-fail-on-non-empty
+                        with -d, silently skip directories that are not empty
+  -v, --verbose         explain what is being done (-vv for extra detail such as
+                        protection evaluations and rename vs copy decisions)
+  -q, --quiet           suppress all output except errors and prompts
+      --one-file-system when removing recursively, skip any directory that is on
+                        a file system different from that of the operand
       --preserve-root   do not remove '/' (default)
       --no-preserve-root  do not treat '/' specially
+      --errors=FORMAT   write errors to stderr as 'text' (default) or 'json'
+                        (one object per line with level, code, path and message)
+      --verbose-errors  finish with a table of every operand's status
+                        (removed, skipped or failed, with the error code)
+      --report=FILE     write the same per-operand results to FILE as JSON
+                        lines, e.g. to retry exactly the failed paths
+      --json            print JSON on stdout instead of tables: one object per
+                        item (id, original_path, deleted_at, size) for
+                        --safe-list, --safe-purge and removals with -v, one
+                        document for --safe-du; other messages go to stderr
+      --permanent       delete permanently instead of moving to trash
+                        (protection rules still apply)
+      --ignore-missing  warn about nonexistent files instead of failing, without
+                        the other effects of -f (prompts still apply)
+      --lenient-paths   accept file:// URIs and strip paste artifacts (surrounding
+                        quotes, a trailing carriage return) from operands
+      --idempotent      treat a missing file that was trashed earlier in this
+                        session (SAFERM_SESSION) or idempotent_window as removed
+      --inode=N[@DIR]   remove the file with inode N, found by scanning DIR
+                        (default '.') on its filesystem; for un-typeable names
+      --inodes-from=FILE  read inode specs (N or N@DIR) from FILE, one per
+                        line ('-' for stdin), e.g. from find -printf '%i\n'
+      --resume=SESSION  finish removals that failed partway through in SESSION
+                        (named in the error) once the problem is fixed
+      --literal         treat all following arguments as file names (same as --)
+      --posix           strict POSIX behavior (also enabled by POSIXLY_CORRECT)
+      --script-mode     for rm chained in scripts: never prompt (anything that
+                        needs a confirmation fails), require -r for directories
+                        even with -d, fail on globs that matched nothing and on
+                        a missing operand even with -f, and write errors as
+                        JSON (also enabled by script_mode in the config)
+      --no-script-mode  turn script mode off despite script_mode in the config
+      --no-force, --no-interactive, --no-recursive, --no-dir, --no-verbose
+                        cancel the corresponding option given earlier
+
+To remove a file whose name starts with '-', for example '-foo', use one of:
+  rm -- -foo
+  rm ./-foo
+
+When -f, -i and -I are combined, the last one given takes effect.
 
 Safe-rm options:
       --safe-list           list all items in the trash
-      --safe-restore=PATH   restore a file from trash to its original location
+      --safe-restore=PATH   restore a file from trash to its original location; a
+                            glob PATTERN (quoted; DIR/** for everything below DIR)
+                            restores every matching item
+      --safe-restore-session=SESSION
+                            restore every item trashed in SESSION (see --safe-info)
+      --safe-restore-id=ID  restore the item with ID (shown by --safe-list), or the
+                            only item whose ID starts with ID
+      --safe-undo           restore everything the last removal moved to the trash
+                            (all items of its session), as a batch restore
+      --deleted-after=DATE  with --safe-restore, --safe-restore-session or
+                            --restore-as-archive, only select items trashed since
+                            DATE (2024-05-01, or '2024-05-01 14:30')
+      --deleted-within=AGE  likewise, only items trashed in the last AGE (30m, 2h,
+                            3d or 2w)
+      --restore-as-archive=FILE
+                            with --safe-restore, --safe-restore-id or
+                            --safe-restore-session, pack the selected items into
+                            the tar.gz FILE (under their original paths) instead
+                            of restoring them; they stay in the trash
+      --conflict=WHAT       when a batch restore would overwrite existing files,
+                            'skip' them, 'overwrite' them (existing files go to
+                            the trash) or 'rename' the restored copies; by
+                            default all conflicts are listed first and resolved
+                            in one question (or nothing is restored without a
+                            terminal)
+      --map=OLD=NEW         restore items trashed below the directory OLD below
+                            NEW instead, e.g. after moving a mount (repeatable;
+                            adds to restore_map)
+      --safe-info=PATH      show details of a trashed item; for directories, the
+                            manifest (largest top-level entries, files by extension)
       --safe-purge          purge old items from trash
-      --purge-days=N        with --safe-purge, remove items older than N days (default 30)
-      --safe-empty          permanently delete ALL items in trash (requires confirmation)
+      --purge-days=N        with --safe-purge, remove items older than N days
+                            (default: retention_days from config, 30)
+      --safe-forecast[=N]   list items that will be purged within N days (default 7)
+      --safe-trend[=N]      show the daily size of the trash and its growth over
+                            the last N days (default 30)
+      --safe-stats[=N]      show how often protection rules blocked, asked for
+                            confirmation or were bypassed, and the N protected
+                            paths hit most often (default 20; needs usage_stats)
+      --safe-simulate[=FILE]
+                            read paths (one per line) from FILE or stdin and report
+                            whether removing each would trash, delete directly,
+                            confirm or block it, and which rule decides; only stats
+                            the paths (combine with -r, -f, --permanent, ...)
+      --safe-clean[=DIR]    in a git work tree, move the ignored files below DIR
+                            (default: current directory) to the trash, like a
+                            reversible 'git clean -dX'
+      --untracked           with --safe-clean, also untracked files (like -x)
+      --exclude=PATTERN     with --safe-clean, keep paths whose relative path or
+                            name matches PATTERN (repeatable)
+      --safe-grep=PATTERN   search the contents of trashed text files (also inside
+                            trashed directories) for a regular expression and
+                            print matching lines with the original path
+      --grep-max-size=SIZE  with --safe-grep, skip files larger than SIZE (default 10MB)
+      --grep-include=GLOB   with --safe-grep, only search files whose name matches
+                            GLOB (repeatable)
+      --safe-destroy-matching=PATTERN
+                            shred every trashed item whose path, note or tags
+                            refer to a data subject (a substring, ignoring case,
+                            or a glob matched against each name), with signed
+                            receipts; asks twice, issues a token with --dry-run
+      --destroy-live=DIR    with --safe-destroy-matching, also shred the files
+                            whose path below DIR matches (repeatable)
+      --approval-token=TOKEN
+                            with --safe-destroy-matching, destroy without asking
+                            if the last --dry-run issued TOKEN for the same
+                            matches, within an hour; each token works once
+      --safe-janitor[=PROFILE]
+                            move the entries selected by a janitor profile (see
+                            config) to the trash; without PROFILE, list profiles
+      --dry-run             with --safe-clean, --safe-janitor or
+                            --safe-destroy-matching, list what would be removed
+                            and its size without removing anything
+      --safe-users          show trash usage per user (items, size, oldest item),
+                            largest first; for shared trash directories
+      --safe-du             show the total size and item count of the trash, by
+                            original top-level directory and by age
+      --safe-history[=PATH] show who removed, restored or purged what and when
+                            (optionally only for PATH and items below it)
+      --safe-verify-receipts
+                            check the signatures of the purge receipts in the
+                            audit log (purge_receipts) and show the public key
+      --safe-autopurge      announce upcoming purges via purge_notify_command, then
+                            purge items older than retention_days (for timers/cron)
+      --safe-enforce        as root, run --safe-autopurge on every user's trash
+                            (enforce_trashes in config) as the user owning it
+      --safe-canary=DIR     seed a hidden canary file in DIR; removing it, or a
+                            directory containing it, is blocked and alerted
+      --safe-canaries       list installed canary files
+      --safe-pin=PATH       exempt a trashed item from purging by age
+      --safe-unpin=PATH     remove the exemption again
+      --safe-annotate=PATH --note=TEXT
+                            attach a note to a trashed item (shown by --safe-list
+                            and --safe-info, searched by --safe-grep); an empty
+                            note removes it
+      --safe-retag=PATH --tag=TAG
+                            replace the tags of a trashed item (--tag repeatable
+                            or comma-separated; none removes them)
+      --safe-empty          permanently delete ALL items in trash (shows the trash
+                            path, item count and size; confirm with the count)
+      --shred               with --safe-empty or --safe-purge, overwrite the contents
+                            of files several times before deleting them
+      --safe-harden         restrict permissions of an existing trash (directories
+                            0700, metadata 0600); with --all-trashes, all roots
+      --safe-scan           measure trashed directories now (normally done in the
+                            background after removal) and write their file index
+      --safe-reindex        rebuild the index used to list, restore and purge
+                            without walking the trash; with --all-trashes, all roots
+      --safe-browse         browse the trash on the terminal: filter, preview,
+                            select, then restore or permanently delete items
+      --safe-migrate-host=OLD=NEW
+                            move the items trashed on host OLD (e.g. in a home
+                            directory synced from an old machine) to host NEW;
+                            with --all-trashes, in all roots
+      --trash-dir=PATH      use PATH as the trash directory for this invocation
+                            (applies to removals and to all --safe-* commands)
+      --assume-trash        use a trash directory that safe-rm did not create (it
+                            lacks the .saferm-format marker); commands that
+                            change the trash mark it
+      --fallback=STRATEGY   when the trash is on another filesystem, 'copy' the item
+                            there and delete the original (default), 'fail', or
+                            rename it into a trash on its own filesystem ('mount')
+      --no-throttle         ignore throttle_rate, throttle_ionice, throttle_nice and
+                            the autopurge idle checks, for urgent manual runs
+      --namespace=NAME      put removed items in trash namespace NAME, and limit the
+                            --safe-* commands to it (default: SAFERM_NAMESPACE)
+      --all-namespaces      with --safe-* commands, cover every namespace even when
+                            SAFERM_NAMESPACE is set
+      --time-style=STYLE    with --safe-list, show times as 'long-iso' (default),
+                            'iso' (RFC 3339) or 'relative' (e.g. "2 hours ago")
+      --all-trashes         with --safe-list, --safe-restore or --safe-purge, include
+                            all known trash roots (trash_roots config, registered
+                            roots and mounted .Trash-$UID directories)
+      --safe-trash-roots    list all known trash roots
+      --register=PATH       add PATH to the trash root registry
+      --forget=PATH         remove PATH from the trash root registry
+      --safe-self-update    replace this binary with the latest release for this
+                            platform, verified against its signed checksums
+      --channel=CHANNEL     with --safe-self-update, follow 'stable' releases
+                            (default) or 'beta', which includes pre-releases
 
       --help     display this help and exit
-      --version  output version information and exit
+      --version  output version, build and feature information and exit
 
 Protected paths (will require confirmation or be blocked):
   - Root directory (/) and top-level system directories
   - .git directories
   - Paths specified in ~/.config/safe-rm/config.yml
 
+In POSIX mode, option parsing stops at the first operand, protected paths
+are blocked instead of prompting, write-protected files are confirmed as
+POSIX requires, and safe-rm specific output is suppressed.
+
 Environment variables:
+  POSIXLY_CORRECT        Enable strict POSIX mode
   SAFERM_TRASH           Override trash directory location
   SAFERM_PROTECTED_PATHS Additional protected paths (colon-separated)
+  SAFERM_SESSION         Session ID shared by related invocations
+  SAFERM_NAMESPACE       Trash namespace for removals and --safe-* commands
+
+For more information, see: https://github.com/user/safe-rm
+`
+	fmt.Print(help)
+}
+
+func printSubcommandHelp() {
+	help := `Usage: safe-rm COMMAND [OPTION]... [ARG]...
+Manage files with safe-rm using subcommands.
+
+Commands:
+  trash [OPTION]... FILE...   move FILE(s) to trash (accepts all rm options)
+  list [--json]               list all items in the trash
+  restore PATH                restore a file from trash to its original location
+  restore-id ID               restore the item with ID (or an unambiguous prefix)
+  undo                        restore everything the last removal moved to the trash
+  info PATH                   show details and manifest of a trashed item
+  purge [--purge-days=N] [--shred] [--json]
+                              purge items older than N days (default: retention_days)
+  forecast [DAYS]             list items that will be purged within DAYS days (default 7)
+  trend [DAYS]                show trash growth over the last DAYS days (default 30)
+  stats [N]                   show local usage statistics of protection rules
+  simulate [OPTION]... [FILE] report what removing the paths listed in FILE (or
+                              stdin) would do, without removing anything
+  clean [OPTION]... [DIR]     move git-ignored build artifacts below DIR to the trash
+                              (--dry-run, --exclude=PATTERN, --untracked)
+  grep PATTERN                search trashed text files for a regular expression
+  destroy-matching PATTERN    shred everything referring to a data subject, with
+                              receipts (--destroy-live=DIR, --dry-run, --approval-token)
+  janitor [PROFILE]           run a cleanup profile (--dry-run to preview), or list them
+  users                       show trash usage per user, largest first
+  du [--json]                 show trash size by original directory and by age
+  history [PATH]              show removal, restore and purge history
+  verify-receipts             check the signatures of purge receipts in the audit log
+  resume SESSION              finish removals interrupted in SESSION
+  autopurge                   announce upcoming purges, then enforce retention
+  enforce                     as root, autopurge every user's trash (enforce_trashes)
+                              as its owner, with the owner's own configuration
+  canary install DIR...       seed hidden canary files whose removal is blocked and
+                              alerted (canary_alert_command)
+  canary list                 list installed canary files
+  pin PATH / unpin PATH       exempt a trashed item from purging by age (or undo)
+  empty [--shred]             permanently delete ALL items in trash (requires confirmation)
+  harden                      restrict permissions of an existing trash
+  scan                        measure trashed directories awaiting a scan
+  reindex                     rebuild the trash index
+  browse                      browse, restore and delete trashed items interactively
+  migrate-host OLD NEW        move the items trashed on host OLD to host NEW
+  trash-roots [--register PATH] [--forget PATH]
+                              list, register or forget known trash roots
+  self-update [--channel=stable|beta]
+                              replace this binary with the latest release
+  help                        display this help and exit
+
+All commands accept --trash-dir=PATH to operate on a specific trash directory
+and --namespace=NAME to operate on one trash namespace.
+
+The rm-compatible interface is used when the binary is invoked as 'rm';
+the --safe-* options remain available there as aliases for these commands.
 
 For more information, see: https://github.com/user/safe-rm
 `
@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseSingleFlags(t *testing.T) {
@@ -14,11 +17,15 @@ func TestParseSingleFlags(t *testing.T) {
 		{[]string{"-r"}, func(o *Options) bool { return o.Recursive }, "recursive lowercase"},
 		{[]string{"-R"}, func(o *Options) bool { return o.Recursive }, "recursive uppercase"},
 		{[]string{"-i"}, func(o *Options) bool { return o.Interactive }, "interactive flag"},
-		{[]string{"-v"}, func(o *Options) bool { return o.Verbose }, "verbose flag"},
+		{[]string{"-v"}, func(o *Options) bool { return o.Verbosity == 1 }, "verbose flag"},
+		{[]string{"-vv"}, func(o *Options) bool { return o.Verbosity == 2 }, "extra verbose flag"},
+		{[]string{"-q"}, func(o *Options) bool { return o.Verbosity == -1 }, "quiet flag"},
+		{[]string{"--quiet"}, func(o *Options) bool { return o.Verbosity == -1 }, "quiet long"},
+		{[]string{"-q", "-v"}, func(o *Options) bool { return o.Verbosity == 1 }, "verbose after quiet"},
 		{[]string{"-d"}, func(o *Options) bool { return o.RemoveEmptyDirs }, "remove empty dirs"},
 		{[]string{"--force"}, func(o *Options) bool { return o.Force }, "force long"},
 		{[]string{"--recursive"}, func(o *Options) bool { return o.Recursive }, "recursive long"},
-		{[]string{"--verbose"}, func(o *Options) bool { return o.Verbose }, "verbose long"},
+		{[]string{"--verbose"}, func(o *Options) bool { return o.Verbosity == 1 }, "verbose long"},
 	}
 
 	for _, tt := range tests {
@@ -60,8 +67,8 @@ func TestParseCombinedFlags(t *testing.T) {
 			if opts.Recursive != tt.wantR {
 				t.Errorf("Recursive = %v, want %v", opts.Recursive, tt.wantR)
 			}
-			if opts.Verbose != tt.wantV {
-				t.Errorf("Verbose = %v, want %v", opts.Verbose, tt.wantV)
+			if (opts.Verbosity > 0) != tt.wantV {
+				t.Errorf("Verbosity = %v, want verbose %v", opts.Verbosity, tt.wantV)
 			}
 		})
 	}
@@ -108,6 +115,94 @@ func TestParseSafeRmFlags(t *testing.T) {
 		{[]string{"--safe-restore=/path"}, func(o *Options) bool { return o.SafeRestore == "/path" }, "safe restore"},
 		{[]string{"--safe-purge"}, func(o *Options) bool { return o.SafePurge }, "safe purge"},
 		{[]string{"--purge-days=7"}, func(o *Options) bool { return o.PurgeDays == 7 }, "purge days"},
+		{[]string{"--safe-history"}, func(o *Options) bool { return o.SafeHistory && o.HistoryPath == "" }, "safe history"},
+		{[]string{"--safe-history=/a"}, func(o *Options) bool { return o.SafeHistory && o.HistoryPath == "/a" }, "safe history path"},
+		{[]string{"--safe-autopurge"}, func(o *Options) bool { return o.SafeAutopurge }, "safe autopurge"},
+		{[]string{"--safe-enforce"}, func(o *Options) bool { return o.SafeEnforce }, "safe enforce"},
+		{[]string{"--safe-pin=/a"}, func(o *Options) bool { return o.SafePin == "/a" }, "safe pin"},
+		{[]string{"--safe-unpin=/a"}, func(o *Options) bool { return o.SafeUnpin == "/a" }, "safe unpin"},
+		{[]string{"--safe-annotate=/a", "--note", "good copy"}, func(o *Options) bool { return o.SafeAnnotate == "/a" && o.Note == "good copy" }, "safe annotate"},
+		{[]string{"--safe-retag=/a", "--tag=x", "--tag", "y,z"}, func(o *Options) bool {
+			return o.SafeRetag == "/a" && len(o.Tags) == 2 && o.Tags[1] == "y,z" && len(o.Files) == 0
+		}, "safe retag"},
+		{[]string{"--safe-forecast"}, func(o *Options) bool { return o.SafeForecast && o.ForecastDays == 7 }, "safe forecast"},
+		{[]string{"--safe-forecast=14"}, func(o *Options) bool { return o.SafeForecast && o.ForecastDays == 14 }, "safe forecast days"},
+		{[]string{"--safe-trend"}, func(o *Options) bool { return o.SafeTrend && o.TrendDays == 30 }, "safe trend"},
+		{[]string{"--safe-trend=90"}, func(o *Options) bool { return o.SafeTrend && o.TrendDays == 90 }, "safe trend days"},
+		{[]string{"--safe-restore=/data/x", "--map=/mnt/old=/mnt/new", "--map", "~/a=~/b"}, func(o *Options) bool {
+			return len(o.Maps) == 2 && o.Maps[0] == "/mnt/old=/mnt/new" && o.Maps[1] == "~/a=~/b"
+		}, "restore maps"},
+		{[]string{"--safe-stats"}, func(o *Options) bool { return o.SafeStats && o.StatsPaths == 20 }, "safe stats"},
+		{[]string{"--safe-stats=5"}, func(o *Options) bool { return o.SafeStats && o.StatsPaths == 5 }, "safe stats paths"},
+		{[]string{"--safe-users"}, func(o *Options) bool { return o.SafeUsers }, "safe users"},
+		{[]string{"--safe-du", "--json"}, func(o *Options) bool { return o.SafeDu && o.JSON }, "safe du json"},
+		{[]string{"--safe-list", "--json"}, func(o *Options) bool { return o.SafeList && o.JSON }, "safe list json"},
+		{[]string{"--safe-undo"}, func(o *Options) bool { return o.SafeUndo }, "safe undo"},
+		{[]string{"--safe-verify-receipts"}, func(o *Options) bool { return o.SafeVerifyReceipts }, "verify receipts"},
+		{[]string{"--safe-restore=/a/**", "--restore-as-archive", "out.tar.gz"}, func(o *Options) bool {
+			return o.SafeRestore == "/a/**" && o.RestoreArchive == "out.tar.gz"
+		}, "restore as archive"},
+		{[]string{"--safe-restore=/a/**", "--deleted-within=2h"}, func(o *Options) bool {
+			return o.SafeRestore == "/a/**" && o.DeletedWithin == 2*time.Hour
+		}, "restore deleted within"},
+		{[]string{"--safe-restore-session=abc", "--deleted-within", "3d"}, func(o *Options) bool {
+			return o.DeletedWithin == 72*time.Hour
+		}, "restore deleted within days"},
+		{[]string{"--safe-restore=/a/**", "--deleted-after=2024-05-01 14:30"}, func(o *Options) bool {
+			return o.DeletedAfter.Equal(time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local))
+		}, "restore deleted after"},
+		{[]string{"--safe-destroy-matching=cust-42", "--destroy-live", "/srv", "--approval-token=abc"}, func(o *Options) bool {
+			return o.SafeDestroyMatching == "cust-42" && len(o.DestroyLive) == 1 && o.DestroyLive[0] == "/srv" && o.ApprovalToken == "abc"
+		}, "safe destroy matching"},
+		{[]string{"-v", "--json", "a"}, func(o *Options) bool { return o.JSON && o.Verbosity == 1 && len(o.Files) == 1 }, "verbose json"},
+		{[]string{"--safe-janitor=cache"}, func(o *Options) bool { return o.SafeJanitor && o.Profile == "cache" }, "safe janitor"},
+		{[]string{"--safe-info=/home/user/project"}, func(o *Options) bool { return o.SafeInfo == "/home/user/project" }, "safe info"},
+		{[]string{"--safe-grep", "TODO-payment", "--grep-max-size=1MB", "--grep-include=*.go"}, func(o *Options) bool {
+			return o.SafeGrep == "TODO-payment" && o.GrepMaxSize == 1<<20 && len(o.GrepInclude) == 1
+		}, "safe grep"},
+		{[]string{"--safe-clean", "--dry-run"}, func(o *Options) bool { return o.SafeClean && o.DryRun && o.CleanDir == "" }, "safe clean dry run"},
+		{[]string{"--safe-clean=app", "--exclude", "*.env", "--exclude=node_modules", "--untracked"}, func(o *Options) bool {
+			return o.SafeClean && o.CleanDir == "app" && o.Untracked && len(o.Excludes) == 2 && o.Excludes[1] == "node_modules"
+		}, "safe clean options"},
+		{[]string{"--safe-simulate"}, func(o *Options) bool { return o.SafeSimulate && o.SimulateFrom == "" }, "safe simulate stdin"},
+		{[]string{"-r", "--safe-simulate=paths.txt"}, func(o *Options) bool { return o.SafeSimulate && o.Recursive && o.SimulateFrom == "paths.txt" }, "safe simulate file"},
+		{[]string{"--time-style=relative"}, func(o *Options) bool { return o.TimeStyle == "relative" }, "time style"},
+		{[]string{"--errors=json"}, func(o *Options) bool { return o.ErrorFormat == "json" }, "errors json"},
+		{[]string{"--script-mode"}, func(o *Options) bool { return o.ScriptMode && !o.NoScriptMode }, "script mode"},
+		{[]string{"--script-mode", "--no-script-mode"}, func(o *Options) bool { return !o.ScriptMode && o.NoScriptMode }, "no script mode"},
+		{[]string{"--permanent"}, func(o *Options) bool { return o.Permanent }, "permanent"},
+		{[]string{"-d", "--ignore-fail-on-non-empty"}, func(o *Options) bool {
+			return o.RemoveEmptyDirs && o.IgnoreFailOnNonEmpty
+		}, "ignore fail on non-empty"},
+		{[]string{"--verbose-errors"}, func(o *Options) bool { return o.VerboseErrors }, "verbose errors"},
+		{[]string{"--report", "out.jsonl", "a"}, func(o *Options) bool {
+			return o.Report == "out.jsonl" && len(o.Files) == 1
+		}, "report"},
+		{[]string{"--ignore-missing"}, func(o *Options) bool { return o.IgnoreMissing && !o.Force }, "ignore missing"},
+		{[]string{"--safe-list", "--assume-trash"}, func(o *Options) bool { return o.SafeList && o.AssumeTrash }, "assume trash"},
+		{[]string{"--safe-empty", "--shred"}, func(o *Options) bool { return o.SafeEmpty && o.Shred }, "shred"},
+		{[]string{"--safe-migrate-host=old=new"}, func(o *Options) bool { return o.SafeMigrateHost == "old=new" }, "migrate host"},
+		{[]string{"-r", "--one-file-system", "a"}, func(o *Options) bool {
+			return o.Recursive && o.OneFileSystem && len(o.Files) == 1
+		}, "one file system"},
+		{[]string{"--namespace", "dev", "a"}, func(o *Options) bool {
+			return o.Namespace == "dev" && len(o.Files) == 1
+		}, "namespace"},
+		{[]string{"--all-namespaces"}, func(o *Options) bool { return o.AllNamespaces }, "all namespaces"},
+		{[]string{"--idempotent"}, func(o *Options) bool { return o.Idempotent }, "idempotent"},
+		{[]string{"--inode=12@/mnt", "--inode", "34"}, func(o *Options) bool {
+			return len(o.Inodes) == 2 && o.Inodes[0] == "12@/mnt" && o.Inodes[1] == "34" && len(o.Files) == 0
+		}, "inode"},
+		{[]string{"--inodes-from=-"}, func(o *Options) bool { return o.InodesFrom == "-" }, "inodes from"},
+		{[]string{"--resume=abc"}, func(o *Options) bool { return o.Resume == "abc" }, "resume"},
+		{[]string{"--safe-restore-session", "abc", "--conflict=rename"}, func(o *Options) bool {
+			return o.SafeRestoreSession == "abc" && o.Conflict == "rename" && len(o.Files) == 0
+		}, "restore session"},
+		{[]string{"--trash-dir=/tmp/.trash"}, func(o *Options) bool { return o.TrashDir == "/tmp/.trash" }, "trash dir"},
+		{[]string{"--lenient-paths", "file:///tmp/a%20b"}, func(o *Options) bool { return o.LenientPaths && o.Files[0] == "file:///tmp/a%20b" }, "lenient paths"},
+		{[]string{"--fallback=fail", "file"}, func(o *Options) bool { return o.Fallback == "fail" }, "fallback fail"},
+		{[]string{"--fallback=mount", "file"}, func(o *Options) bool { return o.Fallback == "mount" }, "fallback mount"},
+		{[]string{"--safe-purge", "--no-throttle"}, func(o *Options) bool { return o.SafePurge && o.NoThrottle }, "no throttle"},
 	}
 
 	for _, tt := range tests {
@@ -145,4 +240,442 @@ func TestParseInvalidFlag(t *testing.T) {
 	if err == nil {
 		t.Error("Parse should return error for invalid flag")
 	}
+	if _, err := Parse([]string{"--map=/mnt/old"}); err == nil {
+		t.Error("Parse should return error for a --map without NEW")
+	}
+	if _, err := Parse([]string{"--safe-migrate-host=old"}); err == nil {
+		t.Error("Parse should return error for a --safe-migrate-host without NEW")
+	}
+	if _, err := Parse([]string{"--fallback=move", "file"}); err == nil {
+		t.Error("Parse should return error for an invalid --fallback strategy")
+	}
+	if _, err := Parse([]string{"--safe-restore-session=abc", "--conflict=merge"}); err == nil {
+		t.Error("Parse should return error for an invalid --conflict resolution")
+	}
+	if _, err := Parse([]string{"--safe-restore=/a/**", "--deleted-after=yesterday"}); err == nil {
+		t.Error("Parse should return error for an invalid --deleted-after date")
+	}
+	if _, err := Parse([]string{"--safe-restore=/a/**", "--deleted-within=-2h"}); err == nil {
+		t.Error("Parse should return error for a negative --deleted-within age")
+	}
+}
+
+func TestUsesSubcommands(t *testing.T) {
+	tests := []struct {
+		program string
+		want    bool
+	}{
+		{"rm", false},
+		{"/usr/local/bin/rm", false},
+		{"safe-rm", true},
+		{"/home/user/.local/bin/safe-rm", true},
+		{"safe-rm.exe", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.program, func(t *testing.T) {
+			if got := UsesSubcommands(tt.program); got != tt.want {
+				t.Errorf("UsesSubcommands(%q) = %v, want %v", tt.program, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubcommand(t *testing.T) {
+	tests := []struct {
+		args  []string
+		check func(*Options) bool
+		desc  string
+	}{
+		{[]string{"list"}, func(o *Options) bool { return o.SafeList }, "list"},
+		{[]string{"restore", "/path"}, func(o *Options) bool { return o.SafeRestore == "/path" && len(o.Files) == 0 }, "restore"},
+		{[]string{"restore", "--", "-file"}, func(o *Options) bool { return o.SafeRestore == "-file" }, "restore dash path"},
+		{[]string{"purge"}, func(o *Options) bool { return o.SafePurge && o.PurgeDays == 0 }, "purge uses retention"},
+		{[]string{"history", "/a"}, func(o *Options) bool { return o.SafeHistory && o.HistoryPath == "/a" && len(o.Files) == 0 }, "history"},
+		{[]string{"autopurge"}, func(o *Options) bool { return o.SafeAutopurge }, "autopurge"},
+		{[]string{"enforce"}, func(o *Options) bool { return o.SafeEnforce }, "enforce"},
+		{[]string{"canary", "install", "/srv", "/data"}, func(o *Options) bool { return len(o.SafeCanary) == 2 && len(o.Files) == 0 }, "canary install"},
+		{[]string{"canary", "list"}, func(o *Options) bool { return o.SafeCanaries && len(o.Files) == 0 }, "canary list"},
+		{[]string{"pin", "/a"}, func(o *Options) bool { return o.SafePin == "/a" && len(o.Files) == 0 }, "pin"},
+		{[]string{"unpin", "/a"}, func(o *Options) bool { return o.SafeUnpin == "/a" }, "unpin"},
+		{[]string{"annotate", "/a", "--note=keep"}, func(o *Options) bool { return o.SafeAnnotate == "/a" && o.Note == "keep" && len(o.Files) == 0 }, "annotate"},
+		{[]string{"retag", "/a", "--tag=x"}, func(o *Options) bool { return o.SafeRetag == "/a" && len(o.Tags) == 1 }, "retag"},
+		{[]string{"forecast"}, func(o *Options) bool { return o.SafeForecast && o.ForecastDays == 7 }, "forecast"},
+		{[]string{"scan"}, func(o *Options) bool { return o.SafeScan }, "scan"},
+		{[]string{"reindex"}, func(o *Options) bool { return o.SafeReindex }, "reindex"},
+		{[]string{"browse"}, func(o *Options) bool { return o.SafeBrowse }, "browse"},
+		{[]string{"migrate-host", "old", "new"}, func(o *Options) bool { return o.SafeMigrateHost == "old=new" && len(o.Files) == 0 }, "migrate host"},
+		{[]string{"self-update", "--channel=beta"}, func(o *Options) bool { return o.SafeSelfUpdate && o.Channel == "beta" }, "self-update"},
+		{[]string{"users"}, func(o *Options) bool { return o.SafeUsers }, "users"},
+		{[]string{"du", "--json"}, func(o *Options) bool { return o.SafeDu && o.JSON }, "du"},
+		{[]string{"list", "--json"}, func(o *Options) bool { return o.SafeList && o.JSON }, "list json"},
+		{[]string{"undo"}, func(o *Options) bool { return o.SafeUndo }, "undo"},
+		{[]string{"purge", "--json"}, func(o *Options) bool { return o.SafePurge && o.JSON }, "purge json"},
+		{[]string{"janitor"}, func(o *Options) bool { return o.SafeJanitor && o.Profile == "" }, "janitor list"},
+		{[]string{"info", "/home/user/project"}, func(o *Options) bool { return o.SafeInfo == "/home/user/project" && len(o.Files) == 0 }, "info"},
+		{[]string{"destroy-matching", "--dry-run", "cust-42"}, func(o *Options) bool {
+			return o.SafeDestroyMatching == "cust-42" && o.DryRun && len(o.Files) == 0
+		}, "destroy matching"},
+		{[]string{"grep", "fix.*payment"}, func(o *Options) bool { return o.SafeGrep == "fix.*payment" && len(o.Files) == 0 }, "grep"},
+		{[]string{"janitor", "--dry-run", "downloads"}, func(o *Options) bool { return o.SafeJanitor && o.DryRun && o.Profile == "downloads" && len(o.Files) == 0 }, "janitor profile"},
+		{[]string{"clean", "--dry-run", "src"}, func(o *Options) bool { return o.SafeClean && o.DryRun && o.CleanDir == "src" && len(o.Files) == 0 }, "clean"},
+		{[]string{"simulate", "-r", "paths.txt"}, func(o *Options) bool { return o.SafeSimulate && o.Recursive && o.SimulateFrom == "paths.txt" && len(o.Files) == 0 }, "simulate"},
+		{[]string{"resume", "abc"}, func(o *Options) bool { return o.Resume == "abc" && len(o.Files) == 0 }, "resume"},
+		{[]string{"restore-session", "abc"}, func(o *Options) bool { return o.SafeRestoreSession == "abc" && len(o.Files) == 0 }, "restore session"},
+		{[]string{"restore-id", "3fa"}, func(o *Options) bool { return o.SafeRestoreID == "3fa" && len(o.Files) == 0 }, "restore by ID"},
+		{[]string{"forecast", "3"}, func(o *Options) bool { return o.SafeForecast && o.ForecastDays == 3 && len(o.Files) == 0 }, "forecast days"},
+		{[]string{"trend", "7"}, func(o *Options) bool { return o.SafeTrend && o.TrendDays == 7 && len(o.Files) == 0 }, "trend days"},
+		{[]string{"stats", "10"}, func(o *Options) bool { return o.SafeStats && o.StatsPaths == 10 && len(o.Files) == 0 }, "stats paths"},
+		{[]string{"purge", "--purge-days=7"}, func(o *Options) bool { return o.SafePurge && o.PurgeDays == 7 }, "purge days"},
+		{[]string{"empty"}, func(o *Options) bool { return o.SafeEmpty }, "empty"},
+		{[]string{"trash-roots"}, func(o *Options) bool { return o.SafeTrashRoots }, "trash roots"},
+		{[]string{"trash-roots", "--register", "/mnt/.trash"}, func(o *Options) bool { return o.SafeTrashRoots && o.RegisterRoot == "/mnt/.trash" }, "register root"},
+		{[]string{"trash-roots", "--forget=/mnt/.trash"}, func(o *Options) bool { return o.SafeTrashRoots && o.ForgetRoot == "/mnt/.trash" }, "forget root"},
+		{[]string{"list", "--trash-dir=.trash"}, func(o *Options) bool { return o.SafeList && o.TrashDir == ".trash" }, "list trash dir"},
+		{[]string{"trash", "-rf", "dir"}, func(o *Options) bool { return o.Recursive && o.Force && len(o.Files) == 1 }, "trash"},
+		{[]string{"trash", "--safe-list"}, func(o *Options) bool { return o.SafeList }, "trash keeps aliases"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts, err := ParseSubcommand(tt.args)
+			if err != nil {
+				t.Fatalf("ParseSubcommand() error = %v", err)
+			}
+			if !tt.check(opts) {
+				t.Errorf("ParseSubcommand(%v) options not set correctly", tt.args)
+			}
+		})
+	}
+}
+
+func TestParseSubcommandErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		desc string
+	}{
+		{[]string{}, "missing command"},
+		{[]string{"frobnicate"}, "unknown command"},
+		{[]string{"restore"}, "restore without path"},
+		{[]string{"restore", "/a", "/b"}, "restore with two paths"},
+		{[]string{"list", "extra"}, "list with argument"},
+		{[]string{"resume"}, "resume without session"},
+		{[]string{"restore-session"}, "restore-session without session"},
+		{[]string{"restore-id"}, "restore-id without ID"},
+		{[]string{"canary", "install"}, "canary install without directory"},
+		{[]string{"canary"}, "canary without action"},
+		{[]string{"migrate-host", "old"}, "migrate-host without new host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if _, err := ParseSubcommand(tt.args); err == nil {
+				t.Errorf("ParseSubcommand(%v) should return error", tt.args)
+			}
+		})
+	}
+}
+
+func TestParseInvalidInode(t *testing.T) {
+	for _, arg := range []string{"--inode=abc", "--inode=12@", "--inodes-from="} {
+		if _, err := Parse([]string{arg}); err == nil {
+			t.Errorf("Parse(%q) should return error", arg)
+		}
+	}
+}
+
+func TestParseLastPromptModeWins(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantF     bool
+		wantI     bool
+		wantOnce  bool
+		desc      string
+	}{
+		{[]string{"-i", "-f"}, true, false, false, "force after interactive"},
+		{[]string{"-f", "-i"}, false, true, false, "interactive after force"},
+		{[]string{"-fi"}, false, true, false, "combined fi"},
+		{[]string{"-if"}, true, false, false, "combined if"},
+		{[]string{"-f", "-I"}, false, false, true, "interactive once after force"},
+		{[]string{"-I", "--force"}, true, false, false, "long force after interactive once"},
+		{[]string{"--force", "--interactive"}, false, true, false, "long interactive after long force"},
+		{[]string{"-f", "--interactive=always"}, false, true, false, "interactive always"},
+		{[]string{"-f", "--interactive=once"}, false, false, true, "interactive once"},
+		{[]string{"-i", "--interactive=never"}, false, false, false, "interactive never"},
+		{[]string{"-f", "--interactive=never"}, true, false, false, "interactive never keeps force"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts, err := Parse(tt.args)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if opts.Force != tt.wantF {
+				t.Errorf("Force = %v, want %v", opts.Force, tt.wantF)
+			}
+			if opts.Interactive != tt.wantI {
+				t.Errorf("Interactive = %v, want %v", opts.Interactive, tt.wantI)
+			}
+			if opts.InteractiveOnce != tt.wantOnce {
+				t.Errorf("InteractiveOnce = %v, want %v", opts.InteractiveOnce, tt.wantOnce)
+			}
+		})
+	}
+
+	if _, err := Parse([]string{"--interactive=sometimes"}); err == nil {
+		t.Error("Parse(--interactive=sometimes) should return error")
+	}
+}
+
+func TestParseNegations(t *testing.T) {
+	tests := []struct {
+		args  []string
+		check func(*Options) bool
+		desc  string
+	}{
+		{[]string{"-r", "--no-recursive"}, func(o *Options) bool { return !o.Recursive }, "no recursive"},
+		{[]string{"--no-recursive", "-r"}, func(o *Options) bool { return o.Recursive }, "recursive after negation"},
+		{[]string{"-v", "--no-verbose"}, func(o *Options) bool { return o.Verbosity == 0 }, "no verbose"},
+		{[]string{"-f", "--no-force"}, func(o *Options) bool { return !o.Force }, "no force"},
+		{[]string{"-i", "--no-interactive"}, func(o *Options) bool { return !o.Interactive }, "no interactive"},
+		{[]string{"-I", "--no-interactive"}, func(o *Options) bool { return !o.InteractiveOnce }, "no interactive clears once"},
+		{[]string{"-d", "--no-dir"}, func(o *Options) bool { return !o.RemoveEmptyDirs }, "no dir"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts, err := Parse(tt.args)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !tt.check(opts) {
+				t.Errorf("Parse(%v) negation not applied correctly", tt.args)
+			}
+		})
+	}
+}
+
+func TestParsePosix(t *testing.T) {
+	oldPosix, hadPosix := os.LookupEnv("POSIXLY_CORRECT")
+	defer func() {
+		if hadPosix {
+			os.Setenv("POSIXLY_CORRECT", oldPosix)
+		} else {
+			os.Unsetenv("POSIXLY_CORRECT")
+		}
+	}()
+
+	os.Unsetenv("POSIXLY_CORRECT")
+	opts, err := Parse([]string{"file.txt", "-f"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Posix || !opts.Force || len(opts.Files) != 1 {
+		t.Errorf("without POSIX mode options after operands should be parsed")
+	}
+
+	opts, err = Parse([]string{"--posix", "file.txt", "-f"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Posix || opts.Force || len(opts.Files) != 2 || opts.Files[1] != "-f" {
+		t.Errorf("--posix should stop option parsing at first operand, got %+v", opts)
+	}
+
+	os.Setenv("POSIXLY_CORRECT", "1")
+	opts, err = Parse([]string{"-r", "dir", "-v"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !opts.Posix || !opts.Recursive || opts.Verbosity != 0 || len(opts.Files) != 2 {
+		t.Errorf("POSIXLY_CORRECT should enable POSIX mode, got %+v", opts)
+	}
+}
+
+func TestParseLiteral(t *testing.T) {
+	opts, err := Parse([]string{"-v", "--literal", "-f", "--safe-empty"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if opts.Verbosity != 1 {
+		t.Error("options before --literal should still be parsed")
+	}
+	if opts.Force || opts.SafeEmpty {
+		t.Error("arguments after --literal should not be parsed as options")
+	}
+	if len(opts.Files) != 2 || opts.Files[0] != "-f" || opts.Files[1] != "--safe-empty" {
+		t.Errorf("Files = %v, want [-f --safe-empty]", opts.Files)
+	}
+}
+
+func TestParseDashFileHint(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-cli-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldWd, _ := os.Getwd()
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(oldWd)
+
+	if err := os.WriteFile("-x", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Parse([]string{"-x"})
+	if err == nil {
+		t.Fatal("Parse should return error for invalid flag")
+	}
+	if !strings.Contains(err.Error(), "rm ./-x") {
+		t.Errorf("error should suggest 'rm ./-x' when the file exists, got %q", err)
+	}
+
+	_, err = Parse([]string{"-y"})
+	if err == nil {
+		t.Fatal("Parse should return error for invalid flag")
+	}
+	if strings.Contains(err.Error(), "rm ./") {
+		t.Errorf("error should not include a hint when no such file exists, got %q", err)
+	}
+}
+
+func TestErrorFormatArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-rf", "dir"}, ""},
+		{[]string{"--errors=json", "-x"}, "json"},
+		{[]string{"--errors=json", "--errors=text"}, "text"},
+		{[]string{"--", "--errors=json"}, ""},
+		{[]string{"--script-mode", "-f"}, "json"},
+		{[]string{"--script-mode", "--errors=text"}, "text"},
+		{[]string{"--script-mode", "--no-script-mode"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorFormatArg(tt.args); got != tt.want {
+			t.Errorf("ErrorFormatArg(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if _, err := Parse([]string{"--time-style=locale"}); err == nil {
+		t.Error("Parse should reject an invalid --time-style")
+	}
+	if _, err := Parse([]string{"--errors=xml"}); err == nil {
+		t.Error("Parse should reject an invalid --errors format")
+	}
+}
+
+func TestLenientPath(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{"/home/user/file.txt", "/home/user/file.txt", false},
+		{"file:///home/user/My%20Documents/report.pdf", "/home/user/My Documents/report.pdf", false},
+		{"file://localhost/tmp/a.txt", "/tmp/a.txt", false},
+		{"'/home/user/it''s here'", "/home/user/it''s here", false},
+		{"\"/home/user/notes.txt\"\r", "/home/user/notes.txt", false},
+		{"\"file:///tmp/x\"", "/tmp/x", false},
+		{"notes.txt\r\n", "notes.txt", false},
+		{"\"unbalanced", "\"unbalanced", false},
+		{"\"", "\"", false},
+		{"file://server/share/file", "", true},
+		{"file:relative", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := LenientPath(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LenientPath(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LenientPath(%q) = %q, want %q", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"-rf\x00dir",
+		"--safe-restore=a=b",
+		"--namespace",
+		"--\x00-x\x00--safe-list",
+		"-\x00--",
+		"--safe-forecast=é",
+		"--conflict=",
+		"--interactive=\x00-i\x00-I\x00-f",
+		"--inode=12@/mnt\x00--inodes-from",
+		"--purge-days=-1\x00--safe-purge",
+		"--trash-dir=\x00-d",
+		"--safe-simulate\x00--posix\x00-rfv",
+	}
+	for _, seed := range seeds {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	// --help and --version print to stdout
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		f.Fatal(err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+
+	f.Fuzz(func(t *testing.T, input string, subcommand bool) {
+		args := strings.Split(input, "\x00")
+		parse := Parse
+		if subcommand {
+			parse = ParseSubcommand
+		}
+
+		opts, err := parse(args)
+		if err == nil && opts == nil {
+			t.Fatalf("parse(%q) returned neither options nor an error", args)
+		}
+		again, errAgain := parse(args)
+		if (err == nil) != (errAgain == nil) || (err == nil && len(opts.Files) != len(again.Files)) {
+			t.Fatalf("parse(%q) is not deterministic", args)
+		}
+	})
+}
+
+func TestVersionInfo(t *testing.T) {
+	oldBuildDate := BuildDate
+	BuildDate = "2026-01-02T03:04:05Z"
+	defer func() { BuildDate = oldBuildDate }()
+
+	lines := VersionInfo()
+	if len(lines) == 0 || lines[0] != "safe-rm version "+Version {
+		t.Fatalf("VersionInfo() = %q, want the version first", lines)
+	}
+	keys := map[string]string{}
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			t.Errorf("line %q is not \"key: value\"", line)
+		}
+		keys[key] = value
+	}
+	for _, key := range []string{"commit", "built", "go", "platform", "backends", "index", "fuse", "reflink", "xattr", "shred"} {
+		if keys[key] == "" {
+			t.Errorf("VersionInfo() has no %s", key)
+		}
+	}
+	if keys["built"] != BuildDate {
+		t.Errorf("built = %q, want %q", keys["built"], BuildDate)
+	}
 }
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// LenientPath turns an operand pasted from a browser or GUI into a path: a
+// file:// URI becomes the path it names, and a trailing carriage return (from
+// Windows clipboards) and matching surrounding quotes are removed.
+// Other operands are returned unchanged.
+func LenientPath(arg string) (string, error) {
+	path := strings.TrimRight(arg, "\r\n")
+
+	if len(path) >= 2 {
+		first, last := path[0], path[len(path)-1]
+		if (first == '"' || first == '\'') && first == last {
+			path = path[1 : len(path)-1]
+		}
+	}
+
+	if strings.HasPrefix(strings.ToLower(path), "file:") {
+		u, err := url.Parse(path)
+		if err != nil {
+			return "", fmt.Errorf("invalid file URI %q: %v", path, err)
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return "", fmt.Errorf("file URI %q names a file on another host (%s)", path, u.Host)
+		}
+		if u.Path == "" {
+			return "", fmt.Errorf("file URI %q has no path", path)
+		}
+		path = u.Path
+	}
+
+	return path, nil
+}
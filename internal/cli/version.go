@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build information, set by the release workflow with -ldflags
+// "-X github.com/user/safe-rm/internal/cli.Version=...". Commit defaults to
+// the revision Go records when building from a git checkout.
+var (
+	Version   = "1.0.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Feature is a capability of this build reported by --version, so that bug
+// reports and scripts can tell what it supports
+type Feature struct {
+	Name  string
+	Value string
+}
+
+// Features lists the optional capabilities of this build. Values are
+// "yes", "no" or the supported variants, comma-separated.
+var Features = []Feature{
+	{"backends", "saferm, xdg"}, // trash_backend values
+	{"layouts", "central, sibling"},
+	{"index", "jsonl"}, // Trash index format (.saferm-index); no sqlite
+	{"fuse", "no"},     // No mountable view of the trash
+	{"reflink", "no"},  // Cross-device copies are plain copies
+	{"xattr", "no"},    // Extended attributes are not preserved by copies
+	{"shred", "yes"},   // --shred and shred_on_empty overwrite contents before deleting
+}
+
+// VersionInfo returns the lines printed by --version: the version, then one
+// "key: value" line each for the build and its features
+func VersionInfo() []string {
+	commit, built := Commit, BuildDate
+	modified := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	} else if modified {
+		commit += " (modified)"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+
+	lines := []string{
+		fmt.Sprintf("safe-rm version %s", Version),
+		"commit: " + commit,
+		"built: " + built,
+		"go: " + runtime.Version(),
+		fmt.Sprintf("platform: %s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+	for _, feature := range Features {
+		lines = append(lines, feature.Name+": "+feature.Value)
+	}
+	return lines
+}
+
+// printVersion prints the version information
+func printVersion() {
+	fmt.Println(strings.Join(VersionInfo(), "\n"))
+}
@@ -1,32 +1,152 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the safe-rm configuration
 type Config struct {
-	TrashDir          string   `yaml:"trash_dir"`
-	RetentionDays     int      `yaml:"retention_days"`
-	ProtectedPaths    []string `yaml:"protected_paths"`
-	ProtectedBehavior string   `yaml:"protected_behavior"` // "block" or "confirm"
-	VerboseWarnings   bool     `yaml:"verbose_warnings"`
+	TrashDir             string                     `yaml:"trash_dir"`
+	TrashLayout          string                     `yaml:"trash_layout"`       // "central" (trash_dir) or "sibling" (.saferm-trash next to each item)
+	TrashBackend         string                     `yaml:"trash_backend"`      // "saferm" (trash_dir, trash_layout) or "xdg" (the freedesktop.org trash of file managers)
+	HashedNames          bool                       `yaml:"hashed_names"`       // Name central trash entries by a keyed hash instead of their path
+	TrashRoots           []string                   `yaml:"trash_roots"`        // Additional trash directories for aggregated list/restore
+	EnforceTrashes       []string                   `yaml:"enforce_trashes"`    // Glob patterns of users' trash directories for safe-rm enforce
+	FallbackTrashDir     string                     `yaml:"fallback_trash_dir"` // Used when the trash is read-only or full; empty refuses
+	RetentionDays        int                        `yaml:"retention_days"`
+	RetentionClass       string                     `yaml:"retention_class"`        // "delete" or "archive" (pack purged items into archive_dir)
+	ArchiveDir           string                     `yaml:"archive_dir"`            // Where the archive class keeps its pack files
+	ArchiveRetentionDays int                        `yaml:"archive_retention_days"` // How long pack files are kept
+	PurgeNotifyCommand   string                     `yaml:"purge_notify_command"`   // Run (via sh -c) with a summary on stdin before autopurge
+	PurgeNotifyHours     int                        `yaml:"purge_notify_hours"`     // How far ahead to announce purges
+	CanaryAlertCommand   string                     `yaml:"canary_alert_command"`   // Run (via sh -c) with a description on stdin when a canary is hit
+	Namespaces           map[string]NamespaceConfig `yaml:"namespaces"`             // Per-namespace settings
+	Janitor              map[string]JanitorProfile  `yaml:"janitor"`                // Cleanup profiles run with safe-rm janitor PROFILE
+	ProtectedPaths       []string                   `yaml:"protected_paths"`
+	RulePacks            []string                   `yaml:"rule_packs"`             // Optional protection rule packs, e.g. "iac"
+	ProtectedBehavior    string                     `yaml:"protected_behavior"`     // "block" or "confirm"
+	RuleActions          map[string]string          `yaml:"rule_actions"`           // Per-rule "block", "confirm" or "log-only", overriding protected_behavior
+	TimePolicies         []TimePolicy               `yaml:"time_policies"`          // Actions that depend on the time of day, e.g. maintenance windows
+	CriticalPaths        []string                   `yaml:"critical_paths"`         // Always copied into the trash and verified by checksum before removal
+	ImportantPatterns    []string                   `yaml:"important_patterns"`     // Trashed items matching these are never purged by age; only --safe-empty removes them
+	ShredOnEmpty         bool                       `yaml:"shred_on_empty"`         // Overwrite file contents before --safe-empty and --safe-purge delete them
+	SandboxPurge         bool                       `yaml:"sandbox_purge"`          // Confine empty, purge and destroy runs to the trash roots with Landlock (Linux)
+	IgnoreMissing        bool                       `yaml:"ignore_missing"`         // Warn instead of failing on nonexistent operands
+	ScriptMode           string                     `yaml:"script_mode"`            // "off" (default), "on" or "auto" (when stdin is not a terminal), as with --script-mode
+	SizeConfirmThreshold ByteSize                   `yaml:"size_confirm_threshold"` // Confirm removing single files larger than this (e.g. "50GB"); 0 disables
+	InlineSnapshotSize   ByteSize                   `yaml:"inline_snapshot_size"`   // Keep a compressed copy of files up to this size in their metadata; 0 disables
+	ReadOnlyItems        bool                       `yaml:"read_only_items"`        // Remove the write bits of trashed items once they land
+	MaxTrashSize         ByteSize                   `yaml:"max_trash_size"`         // Evict the oldest items when trash_dir would grow beyond this (e.g. "10GB"); 0 disables
+	ConfirmProjects      bool                       `yaml:"confirm_projects"`       // Confirm recursive removals of directories holding .git, .venv and similar
+	RestoreParentMode    string                     `yaml:"restore_parent_mode"`    // "original" (default), "umask" or an octal mode for parents recreated by restore
+	RestoreMap           map[string]string          `yaml:"restore_map"`            // Restore items trashed below a directory (key) below another one (value)
+	VerboseWarnings      bool                       `yaml:"verbose_warnings"`
+	AuditLog             bool                       `yaml:"audit_log"`            // Record operations in the audit log
+	AuditLogMaxSize      ByteSize                   `yaml:"audit_log_max_size"`   // Rotate the audit log once it grows beyond this (e.g. "10MB"); 0 never rotates
+	PurgeReceipts        bool                       `yaml:"purge_receipts"`       // Log a signed receipt (checksum, size, time, operator) for each purged item
+	ReceiptKey           string                     `yaml:"receipt_key"`          // Key signing purge receipts (default: receipt.key in the state directory)
+	UsageStats           bool                       `yaml:"usage_stats"`          // Count protection rule hits locally for safe-rm stats
+	BackgroundScan       bool                       `yaml:"background_scan"`      // Measure trashed directories in a background process
+	CopyIntegrity        string                     `yaml:"copy_integrity"`       // "fast", "safe" or "paranoid" for cross-device copies
+	CrossDevice          string                     `yaml:"cross_device"`         // "copy" (default), "fail" or "mount" when the trash is on another filesystem
+	MountTrashCreate     string                     `yaml:"mount_trash_create"`   // With cross_device mount: "auto" (default) creates per-mount trashes, "existing" only uses those present
+	MountTrashExclude    []string                   `yaml:"mount_trash_exclude"`  // Mount points (glob patterns) or filesystem types that get no per-mount trash
+	MountTrashFallback   string                     `yaml:"mount_trash_fallback"` // On excluded mounts: "copy" (default) into trash_dir or "permanent"
+	RemovableMedia       string                     `yaml:"removable_media"`      // On removable media: "device", "home" or "permanent"; unset follows cross_device
+	IdempotentWindow     time.Duration              `yaml:"idempotent_window"`    // How long --idempotent treats a trashed path as done
+	ProcessChain         bool                       `yaml:"process_chain"`        // Record the parent process chain with trashed items and in the audit log
+	Observe              bool                       `yaml:"observe"`              // Delete like plain rm, only logging what would be protected or trashed
+	ThrottleRate         ByteSize                   `yaml:"throttle_rate"`        // Bytes per second for background copies and archiving (e.g. "20MB"); 0 unlimited
+	ThrottleIOClass      string                     `yaml:"throttle_ionice"`      // I/O class of purge, autopurge and scan runs: "idle", "best-effort" or empty
+	ThrottleNice         int                        `yaml:"throttle_nice"`        // CPU niceness of purge, autopurge and scan runs (1-19); 0 unchanged
+	AutopurgeMaxLoad     float64                    `yaml:"autopurge_max_load"`   // Postpone autopurge while the one-minute load average is above this; 0 disables
+	AutopurgeRequireAC   bool                       `yaml:"autopurge_require_ac"` // Postpone autopurge while running on battery
+
+	// Namespace is the trash namespace selected with --namespace or
+	// SAFERM_NAMESPACE; empty means items of all namespaces
+	Namespace string `yaml:"-"`
+
+	// Session identifies the invocation (or the group of invocations sharing
+	// SAFERM_SESSION) and is recorded with every trashed item
+	Session string `yaml:"-"`
+
+	// Process is the parent process chain of the invocation when
+	// process_chain is enabled, recorded like Session
+	Process string `yaml:"-"`
+
+	// AssumeTrash accepts a trash directory without the marker written by
+	// safe-rm (--assume-trash), and marks it
+	AssumeTrash bool `yaml:"-"`
+
+	// Clock and Hostname replace the system clock and host name, so that
+	// safe-rm's own tests get reproducible trash paths and deletion times
+	// and can fake time for retention; nil uses the system's. pkg/guard
+	// only evaluates paths and exposes the clock alone, as SetClock.
+	Clock    func() time.Time `yaml:"-"`
+	Hostname func() string    `yaml:"-"`
+}
+
+// TimePolicy protects paths with an action that depends on the time of day,
+// such as a maintenance window outside which production data is blocked
+type TimePolicy struct {
+	Paths    []string `yaml:"paths"`    // Glob patterns as in protected_paths
+	Window   string   `yaml:"window"`   // "HH:MM-HH:MM"; may span midnight
+	Timezone string   `yaml:"timezone"` // IANA name such as "Europe/Berlin"; empty is local time
+	Inside   string   `yaml:"inside"`   // Action within the window; default "confirm"
+	Outside  string   `yaml:"outside"`  // Action outside the window; default "block"
+}
+
+// NamespaceConfig holds settings that differ per trash namespace
+type NamespaceConfig struct {
+	RetentionDays  *int   `yaml:"retention_days"`  // Unset uses the global retention_days
+	RetentionClass string `yaml:"retention_class"` // Empty uses the global retention_class
+}
+
+// JanitorProfile selects entries of some directories for cleanup. An entry
+// matches when it meets every criterion that is set.
+type JanitorProfile struct {
+	Paths         []string `yaml:"paths"`           // Directories whose entries are candidates
+	Patterns      []string `yaml:"patterns"`        // Glob patterns for entry names; empty matches all
+	OlderThanDays int      `yaml:"older_than_days"` // Not modified for this many days
+	LargerThan    ByteSize `yaml:"larger_than"`     // Larger than this (directories in total)
+	Namespace     string   `yaml:"namespace"`       // Trash namespace; default "janitor-NAME"
+	RetentionDays *int     `yaml:"retention_days"`  // Retention of the namespace; unset uses namespaces or retention_days
 }
 
 // Default returns a Config with default values
 func Default() *Config {
 	homeDir, _ := os.UserHomeDir()
 	return &Config{
-		TrashDir:          filepath.Join(homeDir, ".local", "share", "safe-rm", "trash"),
-		RetentionDays:     30,
-		ProtectedPaths:    []string{},
-		ProtectedBehavior: "confirm",
-		VerboseWarnings:   true,
+		TrashDir:             filepath.Join(homeDir, ".local", "share", "safe-rm", "trash"),
+		TrashLayout:          "central",
+		TrashBackend:         "saferm",
+		RetentionDays:        30,
+		RetentionClass:       "delete",
+		ArchiveDir:           filepath.Join(homeDir, ".local", "share", "safe-rm", "archive"),
+		ArchiveRetentionDays: 365,
+		PurgeNotifyHours:     24,
+		ProtectedPaths:       []string{},
+		ProtectedBehavior:    "confirm",
+		VerboseWarnings:      true,
+		AuditLog:             true,
+		AuditLogMaxSize:      10 << 20,
+		BackgroundScan:       true,
+		CopyIntegrity:        "safe",
+		CrossDevice:          "copy",
+		RestoreParentMode:    "original",
+		EnforceTrashes:       []string{"/home/*/.local/share/safe-rm/trash"},
+		IdempotentWindow:     10 * time.Minute,
+		Janitor: map[string]JanitorProfile{
+			"downloads": {Paths: []string{"~/Downloads"}, OlderThanDays: 60},
+			"cache":     {Paths: []string{"~/.cache"}, LargerThan: 1 << 30},
+		},
 	}
 }
 
@@ -42,10 +162,14 @@ func Load() (*Config, error) {
 		}
 	}
 
-	// Expand ~ in trash_dir
-	if strings.HasPrefix(cfg.TrashDir, "~") {
-		homeDir, _ := os.UserHomeDir()
-		cfg.TrashDir = filepath.Join(homeDir, cfg.TrashDir[1:])
+	// Expand ~ in trash_dir, fallback_trash_dir and archive_dir
+	cfg.TrashDir = ExpandHome(cfg.TrashDir)
+	cfg.FallbackTrashDir = ExpandHome(cfg.FallbackTrashDir)
+	cfg.ArchiveDir = ExpandHome(cfg.ArchiveDir)
+	restoreMap := cfg.RestoreMap
+	cfg.RestoreMap = nil
+	for from, to := range restoreMap {
+		cfg.AddRestoreMapping(from, to)
 	}
 
 	// Override with environment variables
@@ -53,6 +177,14 @@ func Load() (*Config, error) {
 		cfg.TrashDir = envTrash
 	}
 
+	if envLayout := os.Getenv("SAFERM_TRASH_LAYOUT"); envLayout != "" {
+		cfg.TrashLayout = envLayout
+	}
+
+	if envBackend := os.Getenv("SAFERM_TRASH_BACKEND"); envBackend != "" {
+		cfg.TrashBackend = envBackend
+	}
+
 	if envProtected := os.Getenv("SAFERM_PROTECTED_PATHS"); envProtected != "" {
 		paths := strings.Split(envProtected, string(os.PathListSeparator))
 		cfg.ProtectedPaths = append(cfg.ProtectedPaths, paths...)
@@ -64,6 +196,18 @@ func Load() (*Config, error) {
 		}
 	}
 
+	if envNamespace := os.Getenv("SAFERM_NAMESPACE"); envNamespace != "" {
+		cfg.Namespace = envNamespace
+	}
+
+	if envSession := os.Getenv("SAFERM_SESSION"); envSession != "" {
+		cfg.Session = envSession
+	}
+
+	if envObserve := os.Getenv("SAFERM_OBSERVE"); envObserve != "" {
+		cfg.Observe = envObserve == "1" || envObserve == "true"
+	}
+
 	if envBehavior := os.Getenv("SAFERM_PROTECTED_BEHAVIOR"); envBehavior != "" {
 		cfg.ProtectedBehavior = envBehavior
 	}
@@ -71,18 +215,207 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
-func getConfigPath() string {
+// ExpandHome replaces a leading ~ in path with the user's home directory
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, path[1:])
+}
+
+// Dir returns the safe-rm configuration directory
+func Dir() string {
 	// Check XDG_CONFIG_HOME first
 	if xdgConfig := os.Getenv("XDG_CONFIG_HOME"); xdgConfig != "" {
-		return filepath.Join(xdgConfig, "safe-rm", "config.yml")
+		return filepath.Join(xdgConfig, "safe-rm")
 	}
 
 	// Fall back to ~/.config
 	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".config", "safe-rm", "config.yml")
+	return filepath.Join(homeDir, ".config", "safe-rm")
+}
+
+// StateDir returns the directory for safe-rm state such as the audit log
+func StateDir() string {
+	// Check XDG_STATE_HOME first
+	if xdgState := os.Getenv("XDG_STATE_HOME"); xdgState != "" {
+		return filepath.Join(xdgState, "safe-rm")
+	}
+
+	// Fall back to ~/.local/state
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".local", "state", "safe-rm")
+}
+
+// XDGTrashDir returns the home trash of the freedesktop.org trash
+// specification, shared with file managers
+func XDGTrashDir() string {
+	if xdgData := os.Getenv("XDG_DATA_HOME"); xdgData != "" {
+		return filepath.Join(xdgData, "Trash")
+	}
+
+	// Fall back to ~/.local/share
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".local", "share", "Trash")
+}
+
+func getConfigPath() string {
+	return filepath.Join(Dir(), "config.yml")
+}
+
+// Now returns the current time from Clock, or the system clock
+func (c *Config) Now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// Host returns the host name from Hostname, or the system's; it is
+// recorded in metadata and names the top directory of the central trash
+func (c *Config) Host() string {
+	if c.Hostname != nil {
+		return c.Hostname()
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
 }
 
-// GetTrashDir returns the resolved trash directory path
+// GetTrashDir returns the resolved trash directory path: trash_dir, or the
+// XDG home trash with trash_backend xdg
 func (c *Config) GetTrashDir() string {
+	if c.TrashBackend == "xdg" {
+		return XDGTrashDir()
+	}
 	return c.TrashDir
 }
+
+// RetentionFor returns the retention in days for items in namespace
+func (c *Config) RetentionFor(namespace string) int {
+	if ns, ok := c.Namespaces[namespace]; ok && ns.RetentionDays != nil {
+		return *ns.RetentionDays
+	}
+	for name, profile := range c.Janitor {
+		if profile.RetentionDays != nil && c.JanitorNamespace(name) == namespace {
+			return *profile.RetentionDays
+		}
+	}
+	return c.RetentionDays
+}
+
+// JanitorNamespace returns the trash namespace of a janitor profile
+func (c *Config) JanitorNamespace(profile string) string {
+	if ns := c.Janitor[profile].Namespace; ns != "" {
+		return ns
+	}
+	return "janitor-" + profile
+}
+
+// RetentionClassFor returns what happens to expired items in namespace:
+// "delete" or "archive"
+func (c *Config) RetentionClassFor(namespace string) string {
+	if ns, ok := c.Namespaces[namespace]; ok && ns.RetentionClass != "" {
+		return ns.RetentionClass
+	}
+	return c.RetentionClass
+}
+
+// AddRestoreMapping makes restores of items trashed below the directory
+// from go below the directory to instead
+func (c *Config) AddRestoreMapping(from, to string) {
+	if c.RestoreMap == nil {
+		c.RestoreMap = make(map[string]string)
+	}
+	c.RestoreMap[filepath.Clean(ExpandHome(from))] = filepath.Clean(ExpandHome(to))
+}
+
+// MapRestorePath returns where an item trashed from path is restored to:
+// path itself, or its equivalent below the target of the restore_map entry
+// with the longest matching directory
+func (c *Config) MapRestorePath(path string) string {
+	return mapPrefix(c.RestoreMap, path, false)
+}
+
+// UnmapRestorePath is the inverse of MapRestorePath: it returns the
+// original path of an item that restore_map restores to path
+func (c *Config) UnmapRestorePath(path string) string {
+	return mapPrefix(c.RestoreMap, path, true)
+}
+
+// mapPrefix replaces the longest directory of mapping (or, in reverse, of
+// its values) that path is or is below
+func mapPrefix(mapping map[string]string, path string, reverse bool) string {
+	best, replacement := "", ""
+	for from, to := range mapping {
+		if reverse {
+			from, to = to, from
+		}
+		if len(from) <= len(best) {
+			continue
+		}
+		if path == from || strings.HasPrefix(path, strings.TrimSuffix(from, "/")+"/") {
+			best, replacement = from, to
+		}
+	}
+	if best == "" {
+		return path
+	}
+	return filepath.Join(replacement, strings.TrimPrefix(path, best))
+}
+
+// RetentionEnabled reports whether any items expire: globally or in some
+// namespace
+func (c *Config) RetentionEnabled() bool {
+	if c.RetentionDays > 0 {
+		return true
+	}
+	for _, ns := range c.Namespaces {
+		if ns.RetentionDays != nil && *ns.RetentionDays > 0 {
+			return true
+		}
+	}
+	for _, profile := range c.Janitor {
+		if profile.RetentionDays != nil && *profile.RetentionDays > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ByteSize is a size in bytes that can be written in configuration with a
+// binary unit suffix, e.g. "512MB" or "1.5G"
+type ByteSize int64
+
+// ParseByteSize parses a size such as "50GB", "1.5G", "512k" or "1048576"
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte("KMGTP", value[n-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			value = value[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return ByteSize(number * float64(multiplier)), nil
+}
+
+// UnmarshalYAML accepts a plain number of bytes or a size with a unit
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -32,11 +32,13 @@ func TestLoadWithEnvVars(t *testing.T) {
 	oldPaths := os.Getenv("SAFERM_PROTECTED_PATHS")
 	oldRetention := os.Getenv("SAFERM_RETENTION_DAYS")
 	oldBehavior := os.Getenv("SAFERM_PROTECTED_BEHAVIOR")
+	oldObserve := os.Getenv("SAFERM_OBSERVE")
 	defer func() {
 		os.Setenv("SAFERM_TRASH", oldTrash)
 		os.Setenv("SAFERM_PROTECTED_PATHS", oldPaths)
 		os.Setenv("SAFERM_RETENTION_DAYS", oldRetention)
 		os.Setenv("SAFERM_PROTECTED_BEHAVIOR", oldBehavior)
+		os.Setenv("SAFERM_OBSERVE", oldObserve)
 	}()
 
 	// Set test environment variables
@@ -44,6 +46,7 @@ func TestLoadWithEnvVars(t *testing.T) {
 	os.Setenv("SAFERM_PROTECTED_PATHS", "/path1:/path2")
 	os.Setenv("SAFERM_RETENTION_DAYS", "7")
 	os.Setenv("SAFERM_PROTECTED_BEHAVIOR", "block")
+	os.Setenv("SAFERM_OBSERVE", "1")
 
 	cfg, err := Load()
 	if err != nil {
@@ -62,6 +65,10 @@ func TestLoadWithEnvVars(t *testing.T) {
 		t.Errorf("ProtectedBehavior = %q, want 'block'", cfg.ProtectedBehavior)
 	}
 
+	if !cfg.Observe {
+		t.Error("Observe should be enabled by SAFERM_OBSERVE=1")
+	}
+
 	// Check protected paths (note: separator is OS-dependent)
 	if len(cfg.ProtectedPaths) < 2 {
 		t.Error("ProtectedPaths should have at least 2 entries from env var")
@@ -90,6 +97,7 @@ func TestLoadWithConfigFile(t *testing.T) {
 	configContent := `trash_dir: /from/config
 retention_days: 14
 protected_behavior: block
+size_confirm_threshold: 50GB
 protected_paths:
   - /protected/one
   - /protected/two
@@ -120,6 +128,43 @@ protected_paths:
 	if len(cfg.ProtectedPaths) != 2 {
 		t.Errorf("ProtectedPaths count = %d, want 2", len(cfg.ProtectedPaths))
 	}
+
+	if cfg.SizeConfirmThreshold != 50<<30 {
+		t.Errorf("SizeConfirmThreshold = %d, want %d", cfg.SizeConfirmThreshold, int64(50<<30))
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ByteSize
+		wantErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"512K", 512 << 10, false},
+		{"512kb", 512 << 10, false},
+		{"100MiB", 100 << 20, false},
+		{"50GB", 50 << 30, false},
+		{"1.5G", 3 << 29, false},
+		{"2 TB", 2 << 40, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"GB", 0, true},
+		{"-1G", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
 }
 
 func TestGetTrashDir(t *testing.T) {
@@ -131,3 +176,162 @@ func TestGetTrashDir(t *testing.T) {
 		t.Errorf("GetTrashDir() = %q, want '/test/trash'", cfg.GetTrashDir())
 	}
 }
+
+func TestRetentionFor(t *testing.T) {
+	disabled := 0
+	cfg := &Config{
+		RetentionDays: 30,
+		Namespaces: map[string]NamespaceConfig{
+			"prod": {RetentionDays: &disabled},
+			"dev":  {},
+		},
+	}
+
+	tests := []struct {
+		namespace string
+		want      int
+	}{
+		{"", 30},
+		{"prod", 0},
+		{"dev", 30},
+		{"unknown", 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			if got := cfg.RetentionFor(tt.namespace); got != tt.want {
+				t.Errorf("RetentionFor(%q) = %d, want %d", tt.namespace, got, tt.want)
+			}
+		})
+	}
+
+	if !cfg.RetentionEnabled() {
+		t.Error("RetentionEnabled() = false with retention_days 30")
+	}
+	week := 7
+	cfg = &Config{Namespaces: map[string]NamespaceConfig{"dev": {RetentionDays: &week}}}
+	if !cfg.RetentionEnabled() {
+		t.Error("RetentionEnabled() = false with a namespace retention")
+	}
+}
+
+func TestRetentionClassFor(t *testing.T) {
+	cfg := &Config{
+		RetentionClass: "delete",
+		Namespaces: map[string]NamespaceConfig{
+			"prod": {RetentionClass: "archive"},
+			"dev":  {},
+		},
+	}
+
+	for namespace, want := range map[string]string{"": "delete", "prod": "archive", "dev": "delete"} {
+		if got := cfg.RetentionClassFor(namespace); got != want {
+			t.Errorf("RetentionClassFor(%q) = %q, want %q", namespace, got, want)
+		}
+	}
+}
+
+func TestRestoreMap(t *testing.T) {
+	cfg := &Config{}
+	cfg.AddRestoreMapping("/mnt/old/", "/mnt/new")
+	cfg.AddRestoreMapping("/mnt/old/media", "/srv/media")
+
+	tests := []struct {
+		path, mapped string
+	}{
+		{"/mnt/old", "/mnt/new"},
+		{"/mnt/old/docs/a.txt", "/mnt/new/docs/a.txt"},
+		{"/mnt/old/media/film.mkv", "/srv/media/film.mkv"}, // Longest match wins
+		{"/mnt/older/a.txt", "/mnt/older/a.txt"},           // Whole directories only
+		{"/home/user/a.txt", "/home/user/a.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cfg.MapRestorePath(tt.path); got != tt.mapped {
+				t.Errorf("MapRestorePath(%s) = %s, want %s", tt.path, got, tt.mapped)
+			}
+			if got := cfg.UnmapRestorePath(tt.mapped); got != tt.path {
+				t.Errorf("UnmapRestorePath(%s) = %s, want %s", tt.mapped, got, tt.path)
+			}
+		})
+	}
+}
+
+func TestJanitorProfiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-config-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", tempDir)
+	defer os.Setenv("XDG_CONFIG_HOME", oldXDG)
+
+	configDir := filepath.Join(tempDir, "safe-rm")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configContent := `janitor:
+  builds:
+    paths: [~/src]
+    patterns: ["*.tar.gz"]
+    retention_days: 7
+  cache:
+    paths: [~/.cache]
+    larger_than: 2GB
+    namespace: caches
+`
+	if err := os.WriteFile(filepath.Join(configDir, "config.yml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Configured profiles join the shipped ones, replacing those of the same name
+	if _, ok := cfg.Janitor["downloads"]; !ok {
+		t.Error("shipped downloads profile missing")
+	}
+	if got := cfg.Janitor["cache"].LargerThan; got != 2<<30 {
+		t.Errorf("cache larger_than = %d, want %d", got, int64(2<<30))
+	}
+
+	if got := cfg.JanitorNamespace("builds"); got != "janitor-builds" {
+		t.Errorf("JanitorNamespace(builds) = %q, want janitor-builds", got)
+	}
+	if got := cfg.JanitorNamespace("cache"); got != "caches" {
+		t.Errorf("JanitorNamespace(cache) = %q, want caches", got)
+	}
+	if got := cfg.RetentionFor("janitor-builds"); got != 7 {
+		t.Errorf("RetentionFor(janitor-builds) = %d, want 7", got)
+	}
+	if got := cfg.RetentionFor("caches"); got != cfg.RetentionDays {
+		t.Errorf("RetentionFor(caches) = %d, want retention_days %d", got, cfg.RetentionDays)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	homeDir, _ := os.UserHomeDir()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"~/trash", filepath.Join(homeDir, "trash")},
+		{"~", homeDir},
+		{"/abs/trash", "/abs/trash"},
+		{"relative/trash", "relative/trash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ExpandHome(tt.path); got != tt.want {
+				t.Errorf("ExpandHome(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package enforce
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Target is a user's trash directory found by Targets
+type Target struct {
+	TrashDir string
+	UID      int
+	GID      int
+	User     string
+	Home     string
+}
+
+// Targets returns the trash directories matching the enforce_trashes glob
+// patterns, each with the user owning it. Symlinks and entries that are not
+// directories are skipped, as are directories owned by unknown users.
+func Targets(patterns []string) ([]Target, error) {
+	seen := map[string]bool{}
+	var targets []Target
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(config.ExpandHome(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid enforce_trashes pattern '%s': %v", pattern, err)
+		}
+		for _, dir := range matches {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+
+			// Lstat: a user must not be able to point root at another directory
+			info, err := os.Lstat(dir)
+			if err != nil || !info.IsDir() {
+				output.Warning("skipping %s: not a directory", dir)
+				continue
+			}
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				continue
+			}
+			owner, err := user.LookupId(strconv.Itoa(int(stat.Uid)))
+			if err != nil {
+				output.Warning("skipping %s: unknown owner uid %d", dir, stat.Uid)
+				continue
+			}
+			gid, err := strconv.Atoi(owner.Gid)
+			if err != nil {
+				continue
+			}
+			targets = append(targets, Target{
+				TrashDir: dir,
+				UID:      int(stat.Uid),
+				GID:      gid,
+				User:     owner.Username,
+				Home:     owner.HomeDir,
+			})
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].TrashDir < targets[j].TrashDir
+	})
+	return targets, nil
+}
+
+// Enforce applies each user's own retention to their trash. It must run as
+// root; every trash is purged by a child process running as its owner with
+// the owner's home and configuration, so root never walks or removes files
+// in user-controlled directories itself.
+func Enforce(cfg *config.Config) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("enforce must run as root (it purges every user's trash as that user)")
+	}
+
+	targets, err := Targets(cfg.EnforceTrashes)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		output.Printf("No trash directories match enforce_trashes.\n")
+		return nil
+	}
+
+	failed := 0
+	for _, target := range targets {
+		output.Printf("== %s (%s)\n", target.TrashDir, target.User)
+		if err := run(target); err != nil {
+			output.PathError(target.TrashDir, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("enforcing retention failed for %d of %d trash directories", failed, len(targets))
+	}
+	return nil
+}
+
+// run purges a target's expired items with "rm --safe-autopurge" running as
+// the target's owner, in a minimal environment so that nothing of root's
+// (SAFERM_*, XDG_*) leaks into it
+func run(target Target) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "--safe-autopurge", "--trash-dir="+target.TrashDir)
+	cmd.Args[0] = "rm" // The rm interface accepts --safe-* whatever the binary is named
+	cmd.Dir = "/"
+	cmd.Env = []string{
+		"HOME=" + target.Home,
+		"USER=" + target.User,
+		"LOGNAME=" + target.User,
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(target.UID), Gid: uint32(target.GID)},
+	}
+	return cmd.Run()
+}
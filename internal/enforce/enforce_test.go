@@ -0,0 +1,63 @@
+package enforce
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-enforce-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Two users' trashes, a user without one, a file and a symlink planted
+	// where a trash is expected
+	for _, dir := range []string{"alice/trash", "bob/trash", "carol"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "dave"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "dave", "trash"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "eve"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tempDir, "alice"), filepath.Join(tempDir, "eve", "trash")); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern := filepath.Join(tempDir, "*", "trash")
+	targets, err := Targets([]string{pattern, pattern})
+	if err != nil {
+		t.Fatalf("Targets() error = %v", err)
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("cannot look up the current user:", err)
+	}
+	want := []string{filepath.Join(tempDir, "alice", "trash"), filepath.Join(tempDir, "bob", "trash")}
+	if len(targets) != len(want) {
+		t.Fatalf("Targets() = %+v, want %v", targets, want)
+	}
+	for i, target := range targets {
+		if target.TrashDir != want[i] {
+			t.Errorf("Targets()[%d] = %s, want %s", i, target.TrashDir, want[i])
+		}
+		if target.User != current.Username || target.Home != current.HomeDir {
+			t.Errorf("Targets()[%d] owner = %s (%s), want %s", i, target.User, target.Home, current.Username)
+		}
+	}
+
+	if _, err := Targets([]string{"[invalid"}); err == nil {
+		t.Error("Targets() should reject an invalid pattern")
+	}
+}
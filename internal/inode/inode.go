@@ -0,0 +1,114 @@
+// Package inode resolves inode numbers to paths so that files with
+// un-typeable names (invalid encodings, control characters) can be removed
+// without spelling out their names.
+package inode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Spec identifies a file by inode number within a directory tree
+type Spec struct {
+	Inode uint64
+	Dir   string // Directory to search; the search stays on its filesystem
+}
+
+// String returns the spec in N@DIR form
+func (s Spec) String() string {
+	return fmt.Sprintf("%d@%s", s.Inode, s.Dir)
+}
+
+// ParseSpec parses N or N@DIR; DIR defaults to the current directory
+func ParseSpec(spec string) (Spec, error) {
+	number, dir := spec, "."
+	if i := strings.Index(spec, "@"); i >= 0 {
+		number, dir = spec[:i], spec[i+1:]
+		if dir == "" {
+			return Spec{}, fmt.Errorf("invalid inode '%s': empty directory after '@'", spec)
+		}
+	}
+
+	ino, err := strconv.ParseUint(strings.TrimSpace(number), 10, 64)
+	if err != nil {
+		return Spec{}, fmt.Errorf("invalid inode '%s' (expected N or N@DIR)", spec)
+	}
+	return Spec{Inode: ino, Dir: dir}, nil
+}
+
+// ReadSpecs reads one spec per line, as produced by find -printf '%i\n'.
+// Blank lines are skipped.
+func ReadSpecs(r io.Reader) ([]Spec, error) {
+	var specs []Spec
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		spec, err := ParseSpec(line)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, scanner.Err()
+}
+
+// Resolve scans spec.Dir for the entry with the given inode and returns its
+// path. Hard links make the name ambiguous, so an inode with several names
+// is refused rather than guessed.
+func Resolve(spec Spec) (string, error) {
+	root, err := os.Lstat(spec.Dir)
+	if err != nil {
+		return "", err
+	}
+	rootStat, ok := root.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("inode lookup is not supported on this platform")
+	}
+
+	var matches []string
+	filepath.WalkDir(spec.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories cannot hold the name we can remove anyway
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if uint64(stat.Dev) != uint64(rootStat.Dev) {
+			// Inode numbers are only unique within one filesystem
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if uint64(stat.Ino) == spec.Inode {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no file with inode %d under %s", spec.Inode, spec.Dir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("inode %d has %d names under %s (hard links); remove them by path",
+			spec.Inode, len(matches), spec.Dir)
+	}
+}
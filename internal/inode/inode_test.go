@@ -0,0 +1,95 @@
+package inode
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Spec
+		wantErr bool
+	}{
+		{"1234", Spec{Inode: 1234, Dir: "."}, false},
+		{"1234@/mnt/data", Spec{Inode: 1234, Dir: "/mnt/data"}, false},
+		{"1234@", Spec{}, true},
+		{"abc", Spec{}, true},
+		{"-5@/tmp", Spec{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSpecs(t *testing.T) {
+	specs, err := ReadSpecs(strings.NewReader("12\n\n34@/srv\n"))
+	if err != nil {
+		t.Fatalf("ReadSpecs() error = %v", err)
+	}
+	if len(specs) != 2 || specs[0].Inode != 12 || specs[1].Dir != "/srv" {
+		t.Errorf("ReadSpecs() = %+v", specs)
+	}
+
+	if _, err := ReadSpecs(strings.NewReader("12\nnot-an-inode\n")); err == nil {
+		t.Error("ReadSpecs() should reject malformed lines")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A name that cannot be typed in most terminals
+	weird := filepath.Join(tempDir, "sub", "bad\xff\x01name")
+	if err := os.MkdirAll(filepath.Dir(weird), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(weird, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Resolve(Spec{Inode: inodeOf(t, weird), Dir: tempDir})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got != weird {
+		t.Errorf("Resolve() = %q, want %q", got, weird)
+	}
+
+	if _, err := Resolve(Spec{Inode: 1<<63 - 1, Dir: tempDir}); err == nil {
+		t.Error("Resolve() should fail for an unknown inode")
+	}
+
+	// Hard links make the name ambiguous
+	if err := os.Link(weird, filepath.Join(tempDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(Spec{Inode: inodeOf(t, weird), Dir: tempDir}); err == nil {
+		t.Error("Resolve() should refuse an inode with several names")
+	}
+}
+
+func inodeOf(t *testing.T, path string) uint64 {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uint64(info.Sys().(*syscall.Stat_t).Ino)
+}
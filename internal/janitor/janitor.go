@@ -0,0 +1,83 @@
+package janitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// Match is a directory entry selected by a profile
+type Match struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Find returns the entries of the profile's directories that meet all of its
+// criteria, largest first. A profile without any criterion is rejected
+// rather than matching everything.
+func Find(profile config.JanitorProfile) ([]Match, error) {
+	if len(profile.Patterns) == 0 && profile.OlderThanDays <= 0 && profile.LargerThan <= 0 {
+		return nil, fmt.Errorf("profile has no patterns, older_than_days or larger_than")
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -profile.OlderThanDays)
+	var matches []Match
+	for _, dir := range profile.Paths {
+		dir = config.ExpandHome(dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !matchesName(entry.Name(), profile.Patterns) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if profile.OlderThanDays > 0 && !info.ModTime().Before(cutoff) {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			size := info.Size()
+			if info.IsDir() {
+				size, _ = trash.Size(path)
+			}
+			if profile.LargerThan > 0 && size <= int64(profile.LargerThan) {
+				continue
+			}
+			matches = append(matches, Match{Path: path, Size: size, ModTime: info.ModTime()})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Size > matches[j].Size
+	})
+	return matches, nil
+}
+
+// matchesName reports whether name matches one of patterns; no patterns
+// match every name
+func matchesName(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
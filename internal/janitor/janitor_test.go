@@ -0,0 +1,89 @@
+package janitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+func TestFind(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-janitor-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	old := time.Now().AddDate(0, 0, -90)
+	entries := []struct {
+		name string
+		size int
+		old  bool
+	}{
+		{"old.iso", 2000, true},
+		{"old.txt", 10, true},
+		{"new.iso", 3000, false},
+		{"new.txt", 10, false},
+	}
+	for _, e := range entries {
+		path := filepath.Join(tempDir, e.name)
+		if err := os.WriteFile(path, make([]byte, e.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if e.old {
+			os.Chtimes(path, old, old)
+		}
+	}
+	// A directory counts with its total size
+	bigDir := filepath.Join(tempDir, "bigdir")
+	if err := os.MkdirAll(bigDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bigDir, "blob"), make([]byte, 5000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc    string
+		profile config.JanitorProfile
+		want    []string
+	}{
+		{"older than", config.JanitorProfile{OlderThanDays: 60}, []string{"old.iso", "old.txt"}},
+		{"larger than", config.JanitorProfile{LargerThan: 1000}, []string{"bigdir", "new.iso", "old.iso"}},
+		{"pattern", config.JanitorProfile{Patterns: []string{"*.txt"}}, []string{"new.txt", "old.txt"}},
+		{"all criteria", config.JanitorProfile{Patterns: []string{"*.iso"}, OlderThanDays: 60, LargerThan: 1000}, []string{"old.iso"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.profile.Paths = []string{tempDir, filepath.Join(tempDir, "missing")}
+			matches, err := Find(tt.profile)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			got := map[string]bool{}
+			for _, m := range matches {
+				got[filepath.Base(m.Path)] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+			for _, name := range tt.want {
+				if !got[name] {
+					t.Errorf("Find() = %v, missing %s", got, name)
+				}
+			}
+			for i := 1; i < len(matches); i++ {
+				if matches[i].Size > matches[i-1].Size {
+					t.Errorf("Find() not sorted largest first: %+v", matches)
+				}
+			}
+		})
+	}
+
+	if _, err := Find(config.JanitorProfile{Paths: []string{tempDir}}); err == nil {
+		t.Error("Find() with no criteria should fail instead of matching everything")
+	}
+}
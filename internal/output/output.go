@@ -0,0 +1,290 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Error codes reported with --errors=json. These are part of the stable
+// interface for automation and must not change between releases.
+const (
+	CodeNotFound         = "ENOENT"
+	CodeIsDir            = "EISDIR"
+	CodeNotEmpty         = "ENOTEMPTY"
+	CodePermission       = "EACCES"
+	CodeNotPermitted     = "EPERM"
+	CodeReadOnly         = "EROFS"
+	CodeNoSpace          = "ENOSPC"
+	CodeProtected        = "PROTECTED"
+	CodeAborted          = "ABORTED"
+	CodeTrashUnavailable = "TRASH_UNAVAILABLE"
+	CodeUsage            = "USAGE"
+	CodeError            = "ERROR"
+)
+
+// Error formats accepted by SetErrorFormat
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Stderr is where errors and warnings are written
+var Stderr io.Writer = os.Stderr
+
+var errorFormat = FormatText
+
+// SetErrorFormat selects how errors are written to stderr ("text" or "json")
+func SetErrorFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+		errorFormat = format
+		return nil
+	}
+	return fmt.Errorf("invalid error format '%s' (expected 'text' or 'json')", format)
+}
+
+// CodedError attaches a stable machine-readable code to an error
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns err annotated with code
+func WithCode(code string, err error) error {
+	return &CodedError{Code: code, Err: err}
+}
+
+// Code returns the machine-readable code for err: an explicit code attached
+// with WithCode, else one derived from the underlying errno, else CodeError
+func Code(err error) string {
+	var coded *CodedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	errnoCodes := []struct {
+		errno syscall.Errno
+		code  string
+	}{
+		{syscall.ENOENT, CodeNotFound},
+		{syscall.EISDIR, CodeIsDir},
+		{syscall.ENOTEMPTY, CodeNotEmpty},
+		{syscall.EACCES, CodePermission},
+		{syscall.EPERM, CodeNotPermitted},
+		{syscall.EROFS, CodeReadOnly},
+		{syscall.ENOSPC, CodeNoSpace},
+	}
+	for _, ec := range errnoCodes {
+		if errors.Is(err, ec.errno) {
+			return ec.code
+		}
+	}
+	return CodeError
+}
+
+// record is the JSON representation of one error or warning
+type record struct {
+	Level   string `json:"level"`
+	Code    string `json:"code"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// PathError reports a failure to remove path
+func PathError(path string, err error) {
+	if errorFormat == FormatJSON {
+		writeRecord(record{Level: "error", Code: Code(err), Path: path, Message: err.Error()})
+		return
+	}
+	fmt.Fprintf(Stderr, "safe-rm: cannot remove '%s': %v\n", path, err)
+}
+
+// Error reports an error that is not tied to a single path
+func Error(err error) {
+	if errorFormat == FormatJSON {
+		writeRecord(record{Level: "error", Code: Code(err), Message: err.Error()})
+		return
+	}
+	fmt.Fprintf(Stderr, "safe-rm: %v\n", err)
+}
+
+// Warning reports a non-fatal problem
+func Warning(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if errorFormat == FormatJSON {
+		writeRecord(record{Level: "warning", Code: CodeError, Message: message})
+		return
+	}
+	fmt.Fprintf(Stderr, "safe-rm: warning: %s\n", message)
+}
+
+func writeRecord(r record) {
+	data, _ := json.Marshal(r)
+	fmt.Fprintf(Stderr, "%s\n", data)
+}
+
+// Verbosity levels
+const (
+	LevelQuiet   = -1 // -q: only errors
+	LevelNormal  = 0  // default
+	LevelVerbose = 1  // -v: explain what is being done
+	LevelDebug   = 2  // -vv: protection evaluations, rename vs copy decisions
+)
+
+// Stdout is where informational output is written
+var Stdout io.Writer = os.Stdout
+
+var level = LevelNormal
+
+// jsonOutput is set by --json: stdout then only carries JSON objects, and
+// informational messages move to stderr
+var jsonOutput bool
+
+// SetLevel sets the verbosity level
+func SetLevel(l int) {
+	level = l
+}
+
+// Level returns the current verbosity level
+func Level() int {
+	return level
+}
+
+// SetJSON selects JSON output on stdout (--json)
+func SetJSON(on bool) {
+	jsonOutput = on
+}
+
+// JSON reports whether JSON output was selected
+func JSON() bool {
+	return jsonOutput
+}
+
+// Object writes v to stdout as one line of JSON
+func Object(v interface{}) {
+	encoder := json.NewEncoder(Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
+
+// messages returns where informational output is written
+func messages() io.Writer {
+	if jsonOutput {
+		return Stderr
+	}
+	return Stdout
+}
+
+// Printf writes informational output to stdout unless quiet
+func Printf(format string, args ...interface{}) {
+	if level >= LevelNormal {
+		fmt.Fprintf(messages(), format, args...)
+	}
+}
+
+// Verbosef writes output to stdout at -v and above
+func Verbosef(format string, args ...interface{}) {
+	if level >= LevelVerbose {
+		fmt.Fprintf(messages(), format, args...)
+	}
+}
+
+// Debugf writes diagnostic detail to stderr at -vv and above
+func Debugf(format string, args ...interface{}) {
+	if level >= LevelDebug {
+		fmt.Fprintf(Stderr, "safe-rm: debug: "+format+"\n", args...)
+	}
+}
+
+// FormatBytes formats a byte count using binary units (e.g. "1.5 MB")
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatThroughput formats elapsed time and, when bytes are known, the
+// transfer rate (e.g. "1.20s, 85.3 MB/s")
+func FormatThroughput(bytes int64, elapsed time.Duration) string {
+	seconds := elapsed.Seconds()
+	if bytes <= 0 || seconds <= 0 {
+		return fmt.Sprintf("%.2fs", seconds)
+	}
+	rate := float64(bytes) / seconds / (1024 * 1024)
+	return fmt.Sprintf("%.2fs, %.1f MB/s", seconds, rate)
+}
+
+// Time styles accepted by FormatTime
+const (
+	TimeStyleISO      = "iso"      // RFC 3339, stable for scripts
+	TimeStyleLongISO  = "long-iso" // "2006-01-02 15:04:05" (default)
+	TimeStyleRelative = "relative" // "2 hours ago"
+)
+
+// ValidTimeStyle reports whether style is a known time style
+func ValidTimeStyle(style string) bool {
+	switch style {
+	case TimeStyleISO, TimeStyleLongISO, TimeStyleRelative:
+		return true
+	}
+	return false
+}
+
+// FormatTime formats t according to style, defaulting to long-iso
+func FormatTime(t time.Time, style string) string {
+	switch style {
+	case TimeStyleISO:
+		return t.Format(time.RFC3339)
+	case TimeStyleRelative:
+		return relativeTime(time.Since(t))
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// relativeTime describes how long ago something happened
+func relativeTime(d time.Duration) string {
+	if d < 0 {
+		return "in the future"
+	}
+
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month")
+	}
+	return plural(int(d/(365*24*time.Hour)), "year")
+}
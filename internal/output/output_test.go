@@ -0,0 +1,214 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+		desc string
+	}{
+		{WithCode(CodeProtected, fmt.Errorf("blocked")), CodeProtected, "explicit code"},
+		{fmt.Errorf("wrapped: %w", WithCode(CodeAborted, fmt.Errorf("aborted"))), CodeAborted, "wrapped explicit code"},
+		{&os.PathError{Op: "lstat", Path: "/x", Err: syscall.ENOENT}, CodeNotFound, "errno not found"},
+		{fmt.Errorf("failed: %w", &os.PathError{Op: "rename", Path: "/x", Err: syscall.EACCES}), CodePermission, "wrapped errno"},
+		{fmt.Errorf("something else"), CodeError, "unknown error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := Code(tt.err); got != tt.want {
+				t.Errorf("Code(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetErrorFormat(t *testing.T) {
+	defer SetErrorFormat(FormatText)
+
+	if err := SetErrorFormat("xml"); err == nil {
+		t.Error("SetErrorFormat should reject unknown formats")
+	}
+	if err := SetErrorFormat(FormatJSON); err != nil {
+		t.Errorf("SetErrorFormat(json) error = %v", err)
+	}
+}
+
+func TestPathErrorFormats(t *testing.T) {
+	var buf bytes.Buffer
+	oldStderr := Stderr
+	Stderr = &buf
+	defer func() {
+		Stderr = oldStderr
+		SetErrorFormat(FormatText)
+	}()
+
+	err := WithCode(CodeNotFound, fmt.Errorf("No such file or directory"))
+
+	PathError("missing.txt", err)
+	if got := buf.String(); got != "safe-rm: cannot remove 'missing.txt': No such file or directory\n" {
+		t.Errorf("text output = %q", got)
+	}
+
+	buf.Reset()
+	SetErrorFormat(FormatJSON)
+	PathError("missing.txt", err)
+	Warning("config %s", "broken")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("JSON output should have one object per line, got %q", buf.String())
+	}
+
+	var rec record
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	want := record{Level: "error", Code: CodeNotFound, Path: "missing.txt", Message: "No such file or directory"}
+	if rec != want {
+		t.Errorf("error record = %+v, want %+v", rec, want)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[1], err)
+	}
+	if rec.Level != "warning" || rec.Message != "config broken" {
+		t.Errorf("warning record = %+v", rec)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	oldStdout, oldStderr := Stdout, Stderr
+	Stdout, Stderr = &stdout, &stderr
+	defer func() {
+		Stdout, Stderr = oldStdout, oldStderr
+		SetLevel(LevelNormal)
+	}()
+
+	tests := []struct {
+		level      int
+		wantStdout string
+		wantDebug  bool
+	}{
+		{LevelQuiet, "", false},
+		{LevelNormal, "info\n", false},
+		{LevelVerbose, "info\nverbose\n", false},
+		{LevelDebug, "info\nverbose\n", true},
+	}
+
+	for _, tt := range tests {
+		stdout.Reset()
+		stderr.Reset()
+		SetLevel(tt.level)
+
+		Printf("info\n")
+		Verbosef("verbose\n")
+		Debugf("debug %d", 2)
+
+		if stdout.String() != tt.wantStdout {
+			t.Errorf("level %d: stdout = %q, want %q", tt.level, stdout.String(), tt.wantStdout)
+		}
+		if gotDebug := strings.Contains(stderr.String(), "debug 2"); gotDebug != tt.wantDebug {
+			t.Errorf("level %d: debug output = %v, want %v", tt.level, gotDebug, tt.wantDebug)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{10 * 1024 * 1024, "10.0 MB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatThroughput(t *testing.T) {
+	if got := FormatThroughput(0, 1500*time.Millisecond); got != "1.50s" {
+		t.Errorf("FormatThroughput without bytes = %q, want 1.50s", got)
+	}
+	if got := FormatThroughput(20*1024*1024, 2*time.Second); got != "2.00s, 10.0 MB/s" {
+		t.Errorf("FormatThroughput = %q, want '2.00s, 10.0 MB/s'", got)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2025, 12, 10, 3, 15, 0, 0, time.UTC)
+
+	if got := FormatTime(ts, TimeStyleISO); got != "2025-12-10T03:15:00Z" {
+		t.Errorf("iso = %q", got)
+	}
+	if got := FormatTime(ts, TimeStyleLongISO); got != "2025-12-10 03:15:00" {
+		t.Errorf("long-iso = %q", got)
+	}
+	if got := FormatTime(ts, ""); got != "2025-12-10 03:15:00" {
+		t.Errorf("default style = %q, want long-iso", got)
+	}
+	if got := FormatTime(time.Now().Add(-2*time.Hour-time.Minute), TimeStyleRelative); got != "2 hours ago" {
+		t.Errorf("relative = %q, want '2 hours ago'", got)
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{45 * time.Minute, "45 minutes ago"},
+		{25 * time.Hour, "1 day ago"},
+		{10 * 24 * time.Hour, "10 days ago"},
+		{65 * 24 * time.Hour, "2 months ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+		{-time.Hour, "in the future"},
+	}
+
+	for _, tt := range tests {
+		if got := relativeTime(tt.d); got != tt.want {
+			t.Errorf("relativeTime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	oldStdout, oldStderr := Stdout, Stderr
+	Stdout, Stderr = &stdout, &stderr
+	defer func() {
+		Stdout, Stderr = oldStdout, oldStderr
+		SetJSON(false)
+	}()
+
+	SetJSON(true)
+	Printf("Purged %d item(s).\n", 1)
+	Object(map[string]string{"original_path": "/tmp/<a>"})
+
+	if got := stdout.String(); got != "{\"original_path\":\"/tmp/<a>\"}\n" {
+		t.Errorf("stdout = %q, want only the JSON object", got)
+	}
+	if got := stderr.String(); got != "Purged 1 item(s).\n" {
+		t.Errorf("stderr = %q, want the message", got)
+	}
+}
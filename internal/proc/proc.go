@@ -0,0 +1,83 @@
+// Package proc describes the chain of processes that started safe-rm, so
+// that a removal can be traced back to the shell or script that made it.
+package proc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxDepth bounds how many ancestors are recorded
+const maxDepth = 8
+
+// Process is one ancestor of the current process
+type Process struct {
+	PID  int
+	Comm string // Command name as the kernel reports it (at most 15 bytes)
+}
+
+// String returns the process as comm(pid)
+func (p Process) String() string {
+	return fmt.Sprintf("%s(%d)", p.Comm, p.PID)
+}
+
+// Chain returns the ancestors of the current process, nearest first, up to
+// but excluding init. It reads /proc and returns nothing where that is not
+// available.
+func Chain() []Process {
+	return chain("/proc", os.Getppid())
+}
+
+// Describe returns the ancestors as "comm(pid), comm(pid), ...", nearest
+// first, or "" if they are unknown
+func Describe() string {
+	var parts []string
+	for _, p := range Chain() {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// chain walks the parent links in procDir starting at pid
+func chain(procDir string, pid int) []Process {
+	var processes []Process
+	for len(processes) < maxDepth && pid > 1 {
+		comm, ppid, err := readStat(filepath.Join(procDir, strconv.Itoa(pid), "stat"))
+		if err != nil {
+			break
+		}
+		processes = append(processes, Process{PID: pid, Comm: comm})
+		if ppid == pid {
+			break
+		}
+		pid = ppid
+	}
+	return processes
+}
+
+// readStat returns the command name and parent pid from a /proc/PID/stat
+// file: "pid (comm) state ppid ...". The command name may itself contain
+// spaces and parentheses, so it runs up to the last ')'.
+func readStat(path string) (string, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+	stat := string(data)
+	start, end := strings.Index(stat, "("), strings.LastIndex(stat, ")")
+	if start < 0 || end < start {
+		return "", 0, fmt.Errorf("malformed %s", path)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("malformed %s", path)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed %s: %v", path, err)
+	}
+	return stat[start+1 : end], ppid, nil
+}
@@ -0,0 +1,51 @@
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-proc-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// deploy.sh (300) was started by a shell (200) under sshd (100) under init
+	stats := map[int]string{
+		300: "300 (deploy.sh) S 200 300 200 0",
+		200: "200 (ba) sh)) S 100 200 200 0",
+		100: "100 (sshd) S 1 100 100 0",
+		1:   "1 (systemd) S 0 1 1 0",
+	}
+	for pid, stat := range stats {
+		dir := filepath.Join(tempDir, strconv.Itoa(pid))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		pid  int
+		want []Process
+	}{
+		{"full chain", 300, []Process{{300, "deploy.sh"}, {200, "ba) sh)"}, {100, "sshd"}}},
+		{"stops at init", 1, nil},
+		{"vanished process", 400, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chain(tempDir, tt.pid); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chain(%d) = %v, want %v", tt.pid, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package protect
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/proc"
+)
+
+// CanaryName is the name of the hidden files seeded by InstallCanary
+const CanaryName = ".saferm-canary"
+
+// RuleCanary is the rule of removals that would take a canary file with
+// them; they are always blocked and raise an alert
+const RuleCanary = "canary"
+
+// canaryContent explains a canary file to whoever comes across it
+const canaryContent = `This file is a safe-rm canary. Removing it, or any directory containing it,
+through safe-rm is blocked and raises an alert, to catch overly broad
+recursive deletes. Remove it with a plain unlink if it is no longer wanted.
+`
+
+// canariesPath returns the registry of installed canary files
+func canariesPath() string {
+	return filepath.Join(config.StateDir(), "canaries")
+}
+
+// InstallCanary seeds a canary file in dir and registers it, returning the
+// path of the canary
+func InstallCanary(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", absDir)
+	}
+
+	// An existing canary only needs registering
+	canary := filepath.Join(absDir, CanaryName)
+	if _, err := os.Lstat(canary); os.IsNotExist(err) {
+		if err := os.WriteFile(canary, []byte(canaryContent), 0444); err != nil {
+			return "", err
+		}
+	}
+
+	canaries, err := Canaries()
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range canaries {
+		if existing == canary {
+			return canary, nil
+		}
+	}
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(canariesPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, canary); err != nil {
+		return "", err
+	}
+	return canary, nil
+}
+
+// Canaries returns the registered canary files, which may since have been
+// removed by other means
+func Canaries() ([]string, error) {
+	f, err := os.Open(canariesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var canaries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			canaries = append(canaries, line)
+		}
+	}
+	return canaries, scanner.Err()
+}
+
+// ListCanaries prints the registered canary files and whether they are
+// still in place
+func ListCanaries() error {
+	canaries, err := Canaries()
+	if err != nil {
+		return err
+	}
+	if len(canaries) == 0 {
+		fmt.Println("No canaries installed.")
+		return nil
+	}
+	fmt.Printf("%-8s %s\n", "STATUS", "CANARY")
+	for _, canary := range canaries {
+		status := "ok"
+		if _, err := os.Lstat(canary); err != nil {
+			status = "missing"
+		}
+		fmt.Printf("%-8s %s\n", status, canary)
+	}
+	return nil
+}
+
+// matchCanary reports whether removing absPath would remove a canary file:
+// the path is a canary, or a recursive removal covers a registered one
+func matchCanary(absPath string, recursive bool) (string, bool) {
+	if filepath.Base(absPath) == CanaryName {
+		return "Path is a canary file", true
+	}
+	if !recursive {
+		return "", false
+	}
+	canaries, err := Canaries()
+	if err != nil {
+		output.Debugf("failed to read canaries: %v", err)
+	}
+	for _, canary := range canaries {
+		if strings.HasPrefix(canary, absPath+"/") || absPath == "/" {
+			if _, err := os.Lstat(canary); err == nil {
+				return "Path contains a canary file: " + canary, true
+			}
+		}
+	}
+	return "", false
+}
+
+// CanaryAlert records a blocked removal of a canary in the audit log and
+// runs canary_alert_command with a description on stdin
+func CanaryAlert(cfg *config.Config, absPath, reason string) {
+	entry := audit.Entry{Action: audit.ActionCanary, Path: absPath, Rule: reason}
+	if err := audit.Record(cfg, entry); err != nil {
+		output.Warning("failed to write audit log: %v", err)
+	}
+	if cfg.CanaryAlertCommand == "" {
+		return
+	}
+
+	// The alert is worth the cost of finding out who removed it
+	userName := "unknown"
+	if u, err := user.Current(); err == nil {
+		userName = u.Username
+	}
+	process := cfg.Process
+	if process == "" {
+		process = proc.Describe()
+	}
+	message := fmt.Sprintf("safe-rm: blocked a removal that would have deleted a canary file\n\n  Path:    %s\n  Reason:  %s\n  User:    %s\n  Process: %s\n",
+		absPath, reason, userName, process)
+	cmd := exec.Command("sh", "-c", cfg.CanaryAlertCommand)
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "SAFERM_CANARY_PATH="+absPath)
+	if err := cmd.Run(); err != nil {
+		output.Warning("canary alert failed: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package protect
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// RuleMount is the key of the rule protecting mount points in rule_actions
+const RuleMount = "mount"
+
+// IsMountPoint reports whether absPath is a directory on another device
+// than its parent, i.e. the top of a mounted filesystem. Bind mounts of a
+// directory of the same filesystem are not detected, as in rm
+// --one-file-system.
+func IsMountPoint(absPath string) bool {
+	absPath = filepath.Clean(absPath)
+	parent := filepath.Dir(absPath)
+	if parent == absPath {
+		return false
+	}
+	dev, ok := deviceOf(absPath)
+	if !ok {
+		return false
+	}
+	parentDev, ok := deviceOf(parent)
+	return ok && dev != parentDev
+}
+
+// MountsBelow returns the mount points found below the directory dir, not
+// descending into them
+func MountsBelow(dir string) []string {
+	dev, ok := deviceOf(dir)
+	if !ok {
+		return nil
+	}
+
+	var mounts []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || path == dir {
+			return nil
+		}
+		if pathDev, ok := deviceOf(path); ok && pathDev != dev {
+			mounts = append(mounts, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return mounts
+}
+
+// deviceOf returns the device of a directory, not following symlinks
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
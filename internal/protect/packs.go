@@ -0,0 +1,226 @@
+package protect
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// packRule recognizes one kind of file or directory worth protecting
+type packRule struct {
+	Name  string // What the rule protects, e.g. "terraform state"
+	Match func(path string, info os.FileInfo) bool
+
+	// Block, if set, reports whether a match is refused outright instead of
+	// following protected_behavior, e.g. while a database is running
+	Block func(path string) bool
+}
+
+// rulePacks are the optional protection rules enabled with rule_packs. A
+// pack protects a matching path and, for recursive removals, any directory
+// with a match anywhere below it.
+var rulePacks = map[string][]packRule{
+	"iac": {
+		{"terraform state", func(path string, info os.FileInfo) bool {
+			return info.Mode().IsRegular() && matchName(filepath.Base(path), "terraform.tfstate*", "*.tfstate", "*.tfstate.backup")
+		}, nil},
+		{"terraform working directory", func(path string, info os.FileInfo) bool {
+			return info.IsDir() && filepath.Base(path) == ".terraform"
+		}, nil},
+		{"ansible vault file", func(path string, info os.FileInfo) bool {
+			return info.Mode().IsRegular() && matchName(filepath.Base(path), "*.yml", "*.yaml", "*vault*") &&
+				hasHeader(path, "$ANSIBLE_VAULT;")
+		}, nil},
+		{"kubeconfig", func(path string, info os.FileInfo) bool {
+			name := filepath.Base(path)
+			if info.IsDir() {
+				return name == ".kube"
+			}
+			return info.Mode().IsRegular() && (matchName(name, "kubeconfig*", "*.kubeconfig") ||
+				name == "config" && filepath.Base(filepath.Dir(path)) == ".kube")
+		}, nil},
+	},
+	"db": {
+		{"postgres data directory", dataDir("PG_VERSION"), func(path string) bool {
+			return pidFileAlive(filepath.Join(path, "postmaster.pid"))
+		}},
+		{"mysql data directory", dataDir("ibdata1"), func(path string) bool {
+			pidFiles, _ := filepath.Glob(filepath.Join(path, "*.pid"))
+			for _, pidFile := range pidFiles {
+				if pidFileAlive(pidFile) {
+					return true
+				}
+			}
+			return processRunning("mysqld", "mariadbd")
+		}},
+		{"mongodb data directory", dataDir("WiredTiger"), func(path string) bool {
+			// mongod.lock holds the pid while mongod runs and is emptied on shutdown
+			return pidFileAlive(filepath.Join(path, "mongod.lock"))
+		}},
+		{"etcd member directory", func(path string, info os.FileInfo) bool {
+			return filepath.Base(path) == "member" && dataDir("wal")(path, info)
+		}, func(path string) bool {
+			return processRunning("etcd")
+		}},
+	},
+}
+
+// warnedPacks records the unknown rule_packs entries already warned about
+var warnedPacks = map[string]bool{}
+
+// matchPacks checks absPath against the enabled rule packs, searching the
+// whole tree below it for recursive removals. It returns why the path is
+// protected and by which pack, or no reason, and whether the matching rule
+// refuses the removal outright. A rule that refuses wins over one that only
+// asks for confirmation, wherever in the tree either matches.
+func matchPacks(cfg *config.Config, absPath string, recursive bool) (reason, pack string, blocked bool) {
+	var packs []string
+	for _, pack := range cfg.RulePacks {
+		if _, ok := rulePacks[pack]; ok {
+			packs = append(packs, pack)
+		} else if !warnedPacks[pack] {
+			output.Warning("unknown rule pack '%s' in rule_packs", pack)
+			warnedPacks[pack] = true
+		}
+	}
+	if len(packs) == 0 {
+		return "", "", false
+	}
+
+	// match describes the rule that path matches as "NAME (PACK rule pack)",
+	// preferring one that refuses the removal
+	match := func(path string, info os.FileInfo) (rule, pack string, block bool) {
+		for _, p := range packs {
+			for _, r := range rulePacks[p] {
+				if !r.Match(path, info) {
+					continue
+				}
+				if r.Block != nil && r.Block(path) {
+					return r.Name + " (" + p + " rule pack)", p, true
+				}
+				if rule == "" {
+					rule, pack = r.Name+" ("+p+" rule pack)", p
+				}
+			}
+		}
+		return rule, pack, false
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return "", "", false
+	}
+	if rule, matched, block := match(absPath, info); rule != "" {
+		reason, pack, blocked = "Path is a "+running(rule, block), matched, block
+	}
+	if blocked || !recursive || !info.IsDir() {
+		return reason, pack, blocked
+	}
+
+	// Confirmations keep the walk going: a refusal further down decides
+	filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == absPath {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if rule, matched, block := match(path, info); rule != "" && (block || reason == "") {
+			rel, _ := filepath.Rel(absPath, path)
+			reason, pack, blocked = "Path contains a "+running(rule, block)+": "+rel, matched, block
+			if block {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return reason, pack, blocked
+}
+
+// running adds to a rule description that the removal is refused because
+// the service using the match is running
+func running(rule string, blocked bool) string {
+	if blocked {
+		return rule + " in use by a running service"
+	}
+	return rule
+}
+
+// matchName reports whether name matches any of the glob patterns
+func matchName(name string, patterns ...string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHeader reports whether the file at path starts with header
+func hasHeader(path, header string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, len(header))
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(buf), header)
+}
+
+// dataDir returns a rule matching directories that contain marker
+func dataDir(marker string) func(path string, info os.FileInfo) bool {
+	return func(path string, info os.FileInfo) bool {
+		if !info.IsDir() {
+			return false
+		}
+		_, err := os.Lstat(filepath.Join(path, marker))
+		return err == nil
+	}
+}
+
+// pidFileAlive reports whether the pid on the first line of path belongs to
+// a running process
+func pidFileAlive(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	// Signal 0 checks for existence; EPERM means it exists as another user
+	err = syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processRunning reports whether a process with one of the command names is
+// running, as far as /proc shows
+func processRunning(names ...string) bool {
+	comms, _ := filepath.Glob("/proc/[0-9]*/comm")
+	for _, comm := range comms {
+		data, err := os.ReadFile(comm)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if strings.TrimSpace(string(data)) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
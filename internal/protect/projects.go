@@ -0,0 +1,51 @@
+package protect
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProjectMarkers are hidden directories whose presence usually means a
+// directory is a live project (a work tree, deployed infrastructure, an
+// environment in use) rather than disposable files
+var ProjectMarkers = []string{".git", ".hg", ".terraform", ".venv"}
+
+// FindProjectMarkers returns the project marker directories in the top two
+// levels of dir, relative to it (e.g. ".git", "api/.venv"). Deeper levels
+// are not read, so the check stays cheap on large trees.
+func FindProjectMarkers(dir string) []string {
+	var found []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if isProjectMarker(entry.Name()) {
+			found = append(found, entry.Name())
+			continue
+		}
+		subEntries, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, sub := range subEntries {
+			if sub.IsDir() && isProjectMarker(sub.Name()) {
+				found = append(found, filepath.Join(entry.Name(), sub.Name()))
+			}
+		}
+	}
+	return found
+}
+
+// isProjectMarker reports whether name is one of ProjectMarkers
+func isProjectMarker(name string) bool {
+	for _, marker := range ProjectMarkers {
+		if name == marker {
+			return true
+		}
+	}
+	return false
+}
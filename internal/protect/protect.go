@@ -5,14 +5,25 @@ import (
 	"strings"
 
 	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
 )
 
 // Status represents the protection status of a path
 type Status struct {
 	Protected bool
 	Reason    string
+	Rule      string // Key of the matching rule in rule_actions
+	Action    string // ActionBlock, ActionConfirm or ActionLogOnly
 }
 
+// Keys of the built-in rules in rule_actions. User rules are keyed by their
+// protected_paths pattern and rule packs by their name.
+const (
+	RuleRoot   = "root"   // The root directory and /*
+	RuleSystem = "system" // Built-in system directories
+	RuleGit    = "git"    // .git directories and repository roots
+)
+
 // Built-in protected paths (absolute paths on Unix-like systems)
 var builtinProtectedPaths = []string{
 	"/",
@@ -35,54 +46,135 @@ var builtinProtectedPaths = []string{
 	"/var",
 }
 
-// Check checks if a path is protected
+// Check checks if a path is protected, and what to do about it
 func Check(cfg *config.Config, absPath string, recursive bool) Status {
 	// Normalize path
 	absPath = filepath.Clean(absPath)
 
+	// Canaries are blocked whatever other rules say
+	if reason, ok := matchCanary(absPath, recursive); ok {
+		return Status{Protected: true, Reason: reason, Rule: RuleCanary, Action: ActionBlock}
+	}
+
 	// Check for root directory
 	if absPath == "/" || absPath == "\\" {
-		return Status{
-			Protected: true,
-			Reason:    "Root directory is always protected",
-		}
+		return protectedBy(cfg, RuleRoot, "Root directory is always protected")
 	}
 
 	// Check for dangerous patterns like /* (all top-level dirs)
 	if isWildcardRoot(absPath) {
-		return Status{
-			Protected: true,
-			Reason:    "Wildcard patterns targeting root level are blocked",
-		}
+		return protectedBy(cfg, RuleRoot, "Wildcard patterns targeting root level are blocked")
 	}
 
 	// Check built-in protected paths
 	for _, protected := range builtinProtectedPaths {
 		if absPath == protected || absPath == protected+"/" {
-			return Status{
-				Protected: true,
-				Reason:    "System directory is protected: " + protected,
-			}
+			return protectedBy(cfg, RuleSystem, "System directory is protected: "+protected)
 		}
 		// Also protect if trying to recursively delete parent of protected path
 		if recursive && strings.HasPrefix(protected, absPath+"/") {
-			return Status{
-				Protected: true,
-				Reason:    "Path contains protected system directory: " + protected,
-			}
+			return protectedBy(cfg, RuleSystem, "Path contains protected system directory: "+protected)
 		}
 	}
 
 	// Check for .git directories
 	if isGitPath(absPath) {
-		return Status{
-			Protected: true,
-			Reason:    ".git directory or repository root is protected",
-		}
+		return protectedBy(cfg, RuleGit, ".git directory or repository root is protected")
+	}
+
+	// Removing a mount point would empty (or copy into the trash) a whole
+	// filesystem
+	if IsMountPoint(absPath) {
+		return protectedBy(cfg, RuleMount, "Mount point is protected: "+absPath)
+	}
+
+	// Time policies come before protected_paths, which would otherwise
+	// shadow them with a constant action
+	if status, ok := matchTimePolicies(cfg, absPath); ok {
+		return status
 	}
 
 	// Check user-defined protected paths from config
-	for _, pattern := range cfg.ProtectedPaths {
+	if pattern, reason, ok := matchPatterns(cfg.ProtectedPaths, absPath, "protected"); ok {
+		return protectedBy(cfg, pattern, reason)
+	}
+
+	// Check the optional rule packs (rule_packs); a running database is
+	// blocked whatever the rule's action
+	if reason, pack, block := matchPacks(cfg, absPath, recursive); reason != "" {
+		status := protectedBy(cfg, pack, reason)
+		if block {
+			status.Action = ActionBlock
+		}
+		return status
+	}
+
+	return Status{Protected: false}
+}
+
+// protectedBy returns the status of a path protected by rule, with the
+// rule's action from rule_actions or else protected_behavior. The root
+// directory can never be removed without confirmation.
+func protectedBy(cfg *config.Config, rule, reason string) Status {
+	action := ruleAction(cfg, rule)
+	if rule == RuleRoot && action == ActionLogOnly {
+		action = ActionConfirm
+	}
+	return Status{Protected: true, Reason: reason, Rule: rule, Action: action}
+}
+
+// warnedActions records the invalid rule_actions entries already warned about
+var warnedActions = map[string]bool{}
+
+// ruleAction returns the action configured for rule in rule_actions,
+// falling back to protected_behavior and then to confirm
+func ruleAction(cfg *config.Config, rule string) string {
+	for _, action := range []string{cfg.RuleActions[rule], cfg.ProtectedBehavior} {
+		switch action {
+		case ActionBlock, ActionConfirm, ActionLogOnly:
+			return action
+		case "":
+		default:
+			if !warnedActions[action] {
+				output.Warning("invalid protection action '%s' (expected 'block', 'confirm' or 'log-only'), using 'confirm'", action)
+				warnedActions[action] = true
+			}
+		}
+	}
+	return ActionConfirm
+}
+
+// IsCritical reports whether absPath matches critical_paths, returning the
+// matching rule
+func IsCritical(cfg *config.Config, absPath string) (string, bool) {
+	_, reason, ok := matchPatterns(cfg.CriticalPaths, absPath, "critical")
+	return reason, ok
+}
+
+// IsImportant reports whether absPath matches important_patterns, returning
+// the matching pattern. Patterns without a slash (such as "*.kdbx") match
+// the file name; others match the whole path like protected_paths.
+func IsImportant(cfg *config.Config, absPath string) (string, bool) {
+	name := filepath.Base(absPath)
+	for _, pattern := range cfg.ImportantPatterns {
+		if strings.Contains(pattern, "/") {
+			continue
+		}
+		if matched, err := filepath.Match(pattern, name); err == nil && matched {
+			return pattern, true
+		}
+	}
+	rule, _, ok := matchPatterns(cfg.ImportantPatterns, absPath, "important")
+	return rule, ok
+}
+
+// matchPatterns checks absPath against glob patterns as used in
+// protected_paths, returning the matching pattern as written and a
+// description of the match with kind ("protected", "critical")
+func matchPatterns(patterns []string, absPath, kind string) (string, string, bool) {
+	absPath = filepath.Clean(absPath)
+	for _, rule := range patterns {
+		pattern := rule
 		// Expand ~ in pattern
 		if strings.HasPrefix(pattern, "~") {
 			homeDir, _ := filepath.Abs(filepath.Join("~"))
@@ -91,25 +183,18 @@ func Check(cfg *config.Config, absPath string, recursive bool) Status {
 
 		matched, err := filepath.Match(pattern, absPath)
 		if err == nil && matched {
-			return Status{
-				Protected: true,
-				Reason:    "Path matches protected pattern: " + pattern,
-			}
+			return rule, "Path matches " + kind + " pattern: " + pattern, true
 		}
 
-		// Also check if absPath is under a protected directory pattern
+		// Also check if absPath is under a directory pattern
 		if strings.HasSuffix(pattern, "/**") {
 			dirPattern := strings.TrimSuffix(pattern, "/**")
-			if strings.HasPrefix(absPath, dirPattern) {
-				return Status{
-					Protected: true,
-					Reason:    "Path is under protected directory: " + dirPattern,
-				}
+			if absPath == dirPattern || strings.HasPrefix(absPath, dirPattern+"/") {
+				return rule, "Path is under " + kind + " directory: " + dirPattern, true
 			}
 		}
 	}
-
-	return Status{Protected: false}
+	return "", "", false
 }
 
 // isWildcardRoot checks if the path looks like a dangerous wildcard operation
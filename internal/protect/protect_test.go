@@ -1,9 +1,15 @@
 package protect
 
 import (
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/user/safe-rm/internal/config"
 )
@@ -105,3 +111,548 @@ func TestIsProtectedByDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestSimulate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := filepath.Join(tempDir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tempDir, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(tempDir, "secret.key")
+	if err := os.WriteFile(secret, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(tempDir, "missing")
+
+	confirm := &config.Config{ProtectedPaths: []string{filepath.Join(tempDir, "*.key")}, ProtectedBehavior: "confirm"}
+	block := &config.Config{ProtectedPaths: confirm.ProtectedPaths, ProtectedBehavior: "block"}
+	large := &config.Config{SizeConfirmThreshold: 10}
+	big := filepath.Join(tempDir, "big.bin")
+	if err := os.WriteFile(big, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc   string
+		cfg    *config.Config
+		path   string
+		opts   SimulateOptions
+		action string
+	}{
+		{"plain file", confirm, file, SimulateOptions{}, ActionTrash},
+		{"permanent", confirm, file, SimulateOptions{Permanent: true}, ActionDelete},
+		{"directory without -r", confirm, dir, SimulateOptions{}, ActionError},
+		{"directory with -r", confirm, dir, SimulateOptions{Recursive: true}, ActionTrash},
+		{"directory with -d", confirm, dir, SimulateOptions{RemoveEmptyDirs: true}, ActionTrash},
+		{"missing", confirm, missing, SimulateOptions{}, ActionError},
+		{"missing with -f", confirm, missing, SimulateOptions{Force: true}, ActionSkip},
+		{"missing with ignore_missing", confirm, missing, SimulateOptions{IgnoreMissing: true}, ActionSkip},
+		{"protected, confirm", confirm, secret, SimulateOptions{}, ActionConfirm},
+		{"protected, permanent still confirms", confirm, secret, SimulateOptions{Permanent: true}, ActionConfirm},
+		{"protected, -f", confirm, secret, SimulateOptions{Force: true}, ActionBlock},
+		{"protected, posix", confirm, secret, SimulateOptions{Posix: true}, ActionBlock},
+		{"protected, block", block, secret, SimulateOptions{}, ActionBlock},
+		{"large file", large, big, SimulateOptions{}, ActionConfirm},
+		{"large file with -f", large, big, SimulateOptions{Force: true}, ActionTrash},
+		{"small file under threshold", large, file, SimulateOptions{}, ActionTrash},
+		{"large file threshold ignores directories", large, dir, SimulateOptions{Recursive: true}, ActionTrash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			decision := Simulate(tt.cfg, tt.path, tt.opts)
+			if decision.Action != tt.action {
+				t.Errorf("Simulate(%q) = %s (%s), want %s", tt.path, decision.Action, decision.Rule, tt.action)
+			}
+			if decision.Rule == "" {
+				t.Errorf("Simulate(%q) gave no rule", tt.path)
+			}
+		})
+	}
+
+	// Simulating never touches the files
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Simulate removed %s", file)
+	}
+}
+
+func TestIsCritical(t *testing.T) {
+	cfg := &config.Config{CriticalPaths: []string{"/data/finance/**", "/srv/*.db"}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/data/finance/2025/ledger.csv", true},
+		{"/srv/users.db", true},
+		{"/srv/cache/users.db", false},
+		{"/data/scratch/tmp.csv", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule, got := IsCritical(cfg, tt.path)
+			if got != tt.want {
+				t.Errorf("IsCritical(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+			if got && rule == "" {
+				t.Errorf("IsCritical(%q) gave no rule", tt.path)
+			}
+		})
+	}
+
+	// Critical paths are not protected: they are removed, just more carefully
+	if status := Check(cfg, "/srv/users.db", false); status.Protected {
+		t.Errorf("Check() = %+v, critical paths should not be protected", status)
+	}
+}
+
+func TestFindProjectMarkers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{".git/objects", "api/.venv/bin", "infra/prod/.terraform", "docs"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A file named like a marker is not a marker
+	if err := os.WriteFile(filepath.Join(tempDir, "docs", ".hg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := FindProjectMarkers(tempDir)
+	want := []string{".git", filepath.Join("api", ".venv")}
+	if len(got) != len(want) {
+		t.Fatalf("FindProjectMarkers() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("FindProjectMarkers()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if got := FindProjectMarkers(filepath.Join(tempDir, "docs")); len(got) != 0 {
+		t.Errorf("FindProjectMarkers() of a plain directory = %v, want none", got)
+	}
+}
+
+func TestRulePackIaC(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	files := map[string]string{
+		"stack/terraform.tfstate.backup": "{}",
+		"play/group_vars/secrets.yml":    "$ANSIBLE_VAULT;1.1;AES256\n6162",
+		"play/group_vars/plain.yml":      "user: deploy\n",
+		"home/.kube/config":              "apiVersion: v1\n",
+		"clusters/prod.kubeconfig":       "apiVersion: v1\n",
+		"notes/readme.txt":               "nothing to see",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "infra", "modules", ".terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{RulePacks: []string{"iac"}}
+	tests := []struct {
+		path      string
+		recursive bool
+		want      bool
+	}{
+		{"stack/terraform.tfstate.backup", false, true},
+		{"stack", true, true},
+		{"play/group_vars/secrets.yml", false, true},
+		{"play/group_vars/plain.yml", false, false},
+		{"play", true, true},
+		{"home/.kube/config", false, true},
+		{"home", true, true},
+		{"clusters/prod.kubeconfig", false, true},
+		{"infra", true, true},
+		{"infra", false, false},
+		{"notes", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status := Check(cfg, filepath.Join(tempDir, tt.path), tt.recursive)
+			if status.Protected != tt.want {
+				t.Errorf("Check(%q, %v) = %+v, want protected %v", tt.path, tt.recursive, status, tt.want)
+			}
+		})
+	}
+
+	// Without the pack nothing is protected
+	if status := Check(&config.Config{}, filepath.Join(tempDir, "stack"), true); status.Protected {
+		t.Errorf("Check() without rule packs = %+v", status)
+	}
+}
+
+func TestRulePackDB(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A running postgres (this test's own pid stands in for the postmaster)
+	// and a stopped mongod, whose lock file is emptied on shutdown
+	files := map[string]string{
+		"pg/16/main/PG_VERSION":     "16\n",
+		"pg/16/main/postmaster.pid": fmt.Sprintf("%d\n/var/lib/postgresql/16/main\n", os.Getpid()),
+		"mongo/WiredTiger":          "WiredTiger\n",
+		"mongo/mongod.lock":         "",
+		"logs/app.log":              "started\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{RulePacks: []string{"db"}}
+	tests := []struct {
+		path          string
+		wantProtected bool
+		wantBlock     bool
+	}{
+		{"pg/16/main", true, true},
+		{"pg", true, true},
+		{"mongo", true, false},
+		{"logs", false, false},
+		// The stopped mongod comes first but only asks for confirmation
+		{".", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status := Check(cfg, filepath.Join(tempDir, tt.path), true)
+			if status.Protected != tt.wantProtected || (status.Action == ActionBlock) != tt.wantBlock {
+				t.Errorf("Check(%q) = %+v, want protected %v, block %v", tt.path, status, tt.wantProtected, tt.wantBlock)
+			}
+		})
+	}
+
+	// Nor does a match of another pack keep the walk from the running postgres
+	if err := os.MkdirAll(filepath.Join(tempDir, "infra", ".terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	both := &config.Config{RulePacks: []string{"iac", "db"}}
+	if status := Check(both, tempDir, true); status.Action != ActionBlock {
+		t.Errorf("Check() with iac and db = %+v, want block", status)
+	}
+
+	// Once postgres is stopped its data directory only asks for confirmation
+	if err := os.Remove(filepath.Join(tempDir, "pg/16/main/postmaster.pid")); err != nil {
+		t.Fatal(err)
+	}
+	if status := Check(cfg, filepath.Join(tempDir, "pg"), true); !status.Protected || status.Action == ActionBlock {
+		t.Errorf("Check() of a stopped postgres = %+v, want protected without block", status)
+	}
+}
+
+func TestRuleActions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	repo := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(tempDir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		ProtectedPaths:    []string{notes},
+		ProtectedBehavior: ActionBlock,
+		RuleActions: map[string]string{
+			RuleGit:  ActionConfirm,
+			notes:    ActionLogOnly,
+			RuleRoot: ActionLogOnly,
+		},
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"rule action", repo, ActionConfirm},
+		{"user pattern", notes, ActionLogOnly},
+		{"protected_behavior", "/etc", ActionBlock},
+		{"root is never log-only", "/", ActionConfirm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := Check(cfg, tt.path, true)
+			if !status.Protected || status.Action != tt.want {
+				t.Errorf("Check(%q) = %+v, want action %s", tt.path, status, tt.want)
+			}
+		})
+	}
+
+	// A log-only rule lets the removal through, even with -f
+	decision := Simulate(cfg, notes, SimulateOptions{Force: true})
+	if decision.Action != ActionLogOnly {
+		t.Errorf("Simulate() = %+v, want %s", decision, ActionLogOnly)
+	}
+}
+
+func TestTimePolicies(t *testing.T) {
+	cfg := &config.Config{
+		ProtectedPaths: []string{"/srv/prod/**"},
+		TimePolicies: []config.TimePolicy{
+			{Paths: []string{"/srv/prod/**"}, Window: "02:00-04:00", Timezone: "Asia/Tokyo"},
+			{Paths: []string{"/srv/batch/**"}, Window: "22:00-02:00", Timezone: "UTC", Inside: ActionLogOnly, Outside: ActionConfirm},
+		},
+	}
+	tests := []struct {
+		name string
+		path string
+		at   string // UTC
+		want string
+	}{
+		{"inside window", "/srv/prod/db/old.dump", "2026-03-01T18:30:00Z", ActionConfirm}, // 03:30 in Tokyo
+		{"outside window", "/srv/prod/db/old.dump", "2026-03-01T03:30:00Z", ActionBlock},  // 12:30 in Tokyo
+		{"end is exclusive", "/srv/prod/db/old.dump", "2026-03-01T19:00:00Z", ActionBlock},
+		{"spanning midnight", "/srv/batch/out.csv", "2026-03-01T01:00:00Z", ActionLogOnly},
+		{"spanning midnight, outside", "/srv/batch/out.csv", "2026-03-01T12:00:00Z", ActionConfirm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Clock = func() time.Time { return at }
+			status := Check(cfg, tt.path, false)
+			if !status.Protected || status.Action != tt.want || status.Rule != RuleTime {
+				t.Errorf("Check(%q) at %s = %+v, want action %s", tt.path, tt.at, status, tt.want)
+			}
+		})
+	}
+
+	// A policy that cannot be evaluated fails closed
+	cfg.TimePolicies = []config.TimePolicy{{Paths: []string{"/srv/prod/**"}, Window: "2am-4am"}}
+	if status := Check(cfg, "/srv/prod/db/old.dump", false); status.Action != ActionBlock {
+		t.Errorf("Check() with an invalid window = %+v, want block", status)
+	}
+}
+
+func TestCanary(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	important := filepath.Join(tempDir, "srv", "important")
+	if err := os.MkdirAll(important, 0755); err != nil {
+		t.Fatal(err)
+	}
+	canary, err := InstallCanary(important)
+	if err != nil {
+		t.Fatalf("InstallCanary() error = %v", err)
+	}
+	// Installing twice registers the canary once
+	if _, err := InstallCanary(important); err != nil {
+		t.Fatalf("second InstallCanary() error = %v", err)
+	}
+	if canaries, _ := Canaries(); len(canaries) != 1 || canaries[0] != canary {
+		t.Errorf("Canaries() = %v, want [%s]", canaries, canary)
+	}
+
+	// Not even log-only rules let a canary go
+	cfg := &config.Config{RuleActions: map[string]string{RuleCanary: ActionLogOnly}}
+	tests := []struct {
+		path      string
+		recursive bool
+		want      bool
+	}{
+		{canary, false, true},
+		{important, true, true},
+		{filepath.Join(tempDir, "srv"), true, true},
+		{filepath.Join(tempDir, "srv"), false, false},
+		{filepath.Join(tempDir, "srv", "imp"), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status := Check(cfg, tt.path, tt.recursive)
+			got := status.Rule == RuleCanary && status.Action == ActionBlock
+			if got != tt.want {
+				t.Errorf("Check(%q, %v) = %+v, want canary block %v", tt.path, tt.recursive, status, tt.want)
+			}
+		})
+	}
+
+	// A canary removed by other means no longer protects its directory
+	if err := os.Remove(canary); err != nil {
+		t.Fatal(err)
+	}
+	if status := Check(cfg, important, true); status.Protected {
+		t.Errorf("Check() after the canary was removed = %+v", status)
+	}
+}
+
+// relPath is a random relative path for property tests: one to five
+// components drawn from names that stress matching (dots, dashes, names
+// that are prefixes of each other)
+type relPath string
+
+func (relPath) Generate(r *rand.Rand, size int) reflect.Value {
+	names := []string{"a", "ab", "data", "data-old", "data2", ".hidden", "x.txt", "file.tfstate.bak", "ü", "with space"}
+	parts := make([]string, 1+r.Intn(5))
+	for i := range parts {
+		parts[i] = names[r.Intn(len(names))]
+	}
+	return reflect.ValueOf(relPath(strings.Join(parts, "/")))
+}
+
+// propertyRoot is a base directory that does not exist, so no .git
+// directory or rule pack file below it can be found on disk
+const propertyRoot = "/nonexistent-saferm-property"
+
+// strictness orders protection actions from weakest to strongest
+func strictness(status Status) int {
+	if !status.Protected {
+		return 0
+	}
+	switch status.Action {
+	case ActionLogOnly:
+		return 1
+	case ActionConfirm:
+		return 2
+	}
+	return 3
+}
+
+func TestCheckProperties(t *testing.T) {
+	blocked := filepath.Join(propertyRoot, "data")
+	cfg := config.Default()
+	cfg.ProtectedBehavior = ActionBlock
+	cfg.ProtectedPaths = []string{blocked + "/**", propertyRoot + "/*/x.txt"}
+	cfg.RuleActions = map[string]string{propertyRoot + "/*/x.txt": ActionLogOnly}
+	quickConfig := &quick.Config{MaxCount: 500}
+
+	properties := []struct {
+		name string
+		fn   any
+	}{
+		{"paths under a blocked directory are at least confirm-level", func(rel relPath, recursive bool) bool {
+			return strictness(Check(cfg, filepath.Join(blocked, string(rel)), recursive)) >= 2
+		}},
+		{"siblings sharing a blocked directory's prefix are not under it", func(suffix relPath) bool {
+			sibling := blocked + "-" + strings.ReplaceAll(string(suffix), "/", "-")
+			status := Check(cfg, sibling, true)
+			return !status.Protected || status.Rule != blocked+"/**"
+		}},
+		{"normalization is idempotent", func(rel relPath, recursive bool) bool {
+			path := filepath.Join(propertyRoot, string(rel))
+			want := Check(cfg, path, recursive)
+			messy := []string{
+				path + "/",
+				strings.ReplaceAll(path, "/", "//"),
+				strings.ReplaceAll(path, "/", "/./"),
+				filepath.Dir(path) + "/../" + filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path),
+			}
+			for _, variant := range messy {
+				if Check(cfg, variant, recursive) != want {
+					return false
+				}
+			}
+			return Check(cfg, filepath.Clean(path), recursive) == want
+		}},
+		{"recursive removal never weakens protection", func(rel relPath) bool {
+			path := filepath.Join(propertyRoot, string(rel))
+			return strictness(Check(cfg, path, true)) >= strictness(Check(cfg, path, false))
+		}},
+		{"ancestors of system directories are protected when recursive", func(index uint8) bool {
+			system := builtinProtectedPaths[int(index)%len(builtinProtectedPaths)]
+			for dir := system; ; dir = filepath.Dir(dir) {
+				if !Check(cfg, dir, true).Protected {
+					return false
+				}
+				if dir == "/" {
+					return true
+				}
+			}
+		}},
+		{"the root is never log-only", func(slashes uint8) bool {
+			cfg := *cfg
+			cfg.RuleActions = map[string]string{RuleRoot: ActionLogOnly}
+			root := strings.Repeat("/", 1+int(slashes)%4)
+			return strictness(Check(&cfg, root, true)) >= 2
+		}},
+	}
+
+	for _, p := range properties {
+		t.Run(p.name, func(t *testing.T) {
+			if err := quick.Check(p.fn, quickConfig); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMountPoints(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-protect-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err := os.MkdirAll(filepath.Join(tempDir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directories of one filesystem hold no mount points
+	if IsMountPoint(filepath.Join(tempDir, "a")) {
+		t.Error("a plain directory is reported as a mount point")
+	}
+	if mounts := MountsBelow(tempDir); len(mounts) != 0 {
+		t.Errorf("MountsBelow() = %v, want none", mounts)
+	}
+	if IsMountPoint("/") {
+		t.Error("/ has no parent to be mounted on")
+	}
+
+	// procfs is mounted on /proc wherever it exists
+	if _, err := os.Stat("/proc/self"); err != nil {
+		t.Skip("no /proc")
+	}
+	if !IsMountPoint("/proc") {
+		t.Error("/proc is not reported as a mount point")
+	}
+}
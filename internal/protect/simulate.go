@@ -0,0 +1,123 @@
+package protect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Actions a simulated removal reports
+const (
+	ActionTrash   = "trash"         // Moved to the trash
+	ActionDelete  = "direct-delete" // Deleted without the trash (--permanent)
+	ActionConfirm = "confirm"       // Protected; removed only after typed confirmation
+	ActionBlock   = "block"         // Protected; refused
+	ActionLogOnly = "log-only"      // Protected; removed with a warning
+	ActionSkip    = "skip"          // Nonexistent and ignored
+	ActionError   = "error"         // Fails before any protection rule applies
+)
+
+// SimulateOptions are the rm options that influence the outcome of a removal
+type SimulateOptions struct {
+	Recursive       bool // -r
+	RemoveEmptyDirs bool // -d
+	Force           bool // -f
+	Permanent       bool // --permanent
+	Posix           bool // POSIX mode
+	IgnoreMissing   bool // --ignore-missing or ignore_missing
+}
+
+// Decision is what a removal of Path would do, and the rule responsible
+type Decision struct {
+	Path   string
+	Action string
+	Rule   string
+}
+
+// Simulate reports what removing path would do under cfg, following the same
+// order of checks as a real removal. It only stats the path and never
+// modifies anything.
+func Simulate(cfg *config.Config, path string, opts SimulateOptions) Decision {
+	decision := Decision{Path: path}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		decision.Action, decision.Rule = ActionError, err.Error()
+		return decision
+	}
+
+	info, err := os.Lstat(absPath)
+	switch {
+	case os.IsNotExist(err) && opts.Force:
+		decision.Action, decision.Rule = ActionSkip, "-f ignores nonexistent files"
+		return decision
+	case os.IsNotExist(err) && opts.IgnoreMissing:
+		decision.Action, decision.Rule = ActionSkip, "ignore_missing"
+		return decision
+	case os.IsNotExist(err):
+		decision.Action, decision.Rule = ActionError, "No such file or directory"
+		return decision
+	case err != nil:
+		decision.Action, decision.Rule = ActionError, err.Error()
+		return decision
+	}
+
+	if info.IsDir() && !opts.Recursive {
+		if !opts.RemoveEmptyDirs {
+			decision.Action, decision.Rule = ActionError, "Is a directory (needs -r)"
+			return decision
+		}
+		// Checking emptiness would mean reading the directory; -d is
+		// reported as if it were empty
+	}
+
+	status := Check(cfg, absPath, opts.Recursive)
+	if status.Protected {
+		switch {
+		case status.Action == ActionLogOnly:
+			decision.Action, decision.Rule = ActionLogOnly, status.Reason+actionSource(cfg, status)
+		case opts.Posix:
+			decision.Action, decision.Rule = ActionBlock, status.Reason+" (POSIX mode blocks protected paths)"
+		case status.Action == ActionBlock:
+			decision.Action, decision.Rule = ActionBlock, status.Reason+actionSource(cfg, status)
+		case opts.Force:
+			decision.Action, decision.Rule = ActionBlock, status.Reason+" (-f cannot confirm)"
+		default:
+			decision.Action, decision.Rule = ActionConfirm, status.Reason+actionSource(cfg, status)
+		}
+		return decision
+	}
+
+	threshold := int64(cfg.SizeConfirmThreshold)
+	if threshold > 0 && info.Mode().IsRegular() && info.Size() > threshold && !opts.Force && !opts.Posix {
+		decision.Action, decision.Rule = ActionConfirm, fmt.Sprintf("larger than size_confirm_threshold (%s)", output.FormatBytes(threshold))
+		return decision
+	}
+
+	if opts.Permanent {
+		decision.Action, decision.Rule = ActionDelete, "--permanent"
+		return decision
+	}
+	decision.Action, decision.Rule = ActionTrash, "not protected"
+	return decision
+}
+
+// actionSource names the setting that chose the action of a protected path,
+// or nothing when the rule itself imposes it (a running database, the root)
+func actionSource(cfg *config.Config, status Status) string {
+	switch status.Rule {
+	case RuleTime:
+		return " (" + RuleTime + ")"
+	case RuleCanary:
+		return ""
+	}
+	if status.Action != ruleAction(cfg, status.Rule) {
+		return ""
+	}
+	if _, ok := cfg.RuleActions[status.Rule]; ok {
+		return " (rule_actions: " + status.Action + ")"
+	}
+	return " (protected_behavior: " + status.Action + ")"
+}
@@ -0,0 +1,90 @@
+package protect
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// RuleTime is the rule of paths protected by time_policies, which carry
+// their own actions
+const RuleTime = "time_policies"
+
+// warnedPolicies records the invalid time_policies already warned about
+var warnedPolicies = map[string]bool{}
+
+// matchTimePolicies checks absPath against time_policies, returning the
+// status under the first policy covering it at the current time
+func matchTimePolicies(cfg *config.Config, absPath string) (Status, bool) {
+	for _, policy := range cfg.TimePolicies {
+		_, reason, ok := matchPatterns(policy.Paths, absPath, "time policy")
+		if !ok {
+			continue
+		}
+
+		inside, zone, err := inWindow(policy, cfg.Now())
+		if err != nil {
+			if !warnedPolicies[policy.Window+policy.Timezone] {
+				output.Warning("invalid time policy: %v; treating it as outside its window", err)
+				warnedPolicies[policy.Window+policy.Timezone] = true
+			}
+		}
+		status := Status{Protected: true, Rule: RuleTime}
+		if inside {
+			status.Action = policyAction(policy.Inside, ActionConfirm)
+			status.Reason = fmt.Sprintf("%s, inside maintenance window %s (%s)", reason, policy.Window, zone)
+		} else {
+			status.Action = policyAction(policy.Outside, ActionBlock)
+			status.Reason = fmt.Sprintf("%s, outside maintenance window %s (%s)", reason, policy.Window, zone)
+		}
+		return status, true
+	}
+	return Status{}, false
+}
+
+// inWindow reports whether t falls within the policy's window in its time
+// zone, also returning the zone's name
+func inWindow(policy config.TimePolicy, t time.Time) (bool, string, error) {
+	loc := time.Local
+	if policy.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(policy.Timezone); err != nil {
+			return false, policy.Timezone, fmt.Errorf("unknown timezone '%s'", policy.Timezone)
+		}
+	}
+	t = t.In(loc)
+
+	from, to, ok := strings.Cut(policy.Window, "-")
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil {
+		return false, loc.String(), fmt.Errorf("window '%s' is not HH:MM-HH:MM", policy.Window)
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	startMinute, endMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute, loc.String(), nil
+	}
+	// The window spans midnight, e.g. 22:00-02:00
+	return minute >= startMinute || minute < endMinute, loc.String(), nil
+}
+
+// policyAction returns action if it is valid, else fallback
+func policyAction(action, fallback string) string {
+	switch action {
+	case ActionBlock, ActionConfirm, ActionLogOnly:
+		return action
+	case "":
+		return fallback
+	default:
+		if !warnedActions[action] {
+			output.Warning("invalid protection action '%s' (expected 'block', 'confirm' or 'log-only'), using '%s'", action, fallback)
+			warnedActions[action] = true
+		}
+		return fallback
+	}
+}
@@ -0,0 +1,100 @@
+package restore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// Annotate attaches a note to the most recently deleted item with the given
+// original path, replacing any earlier note; an empty note removes it
+func Annotate(cfg *config.Config, originalPath, note string, opts RestoreOptions) error {
+	note = strings.TrimSpace(note)
+	err := updateLatest(cfg, originalPath, opts, func(meta *trash.Metadata) {
+		meta.Note = note
+	})
+	if err != nil {
+		return err
+	}
+
+	if note == "" {
+		output.Printf("Removed note: %s\n", originalPath)
+	} else {
+		output.Printf("Annotated: %s\n", originalPath)
+	}
+	return nil
+}
+
+// Retag replaces the tags of the most recently deleted item with the given
+// original path; no tags remove them all
+func Retag(cfg *config.Config, originalPath string, tags []string, opts RestoreOptions) error {
+	tags = normalizeTags(tags)
+	err := updateLatest(cfg, originalPath, opts, func(meta *trash.Metadata) {
+		meta.Tags = tags
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		output.Printf("Removed tags: %s\n", originalPath)
+	} else {
+		output.Printf("Tagged: %s (%s)\n", originalPath, strings.Join(tags, ", "))
+	}
+	return nil
+}
+
+// updateLatest applies update to the metadata of the most recently deleted
+// item with the given original path and saves it
+func updateLatest(cfg *config.Config, originalPath string, opts RestoreOptions, update func(*trash.Metadata)) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	item, meta := findLatest(items, originalPath)
+	if item == "" {
+		return fmt.Errorf("no item found in trash with original path: %s", originalPath)
+	}
+
+	update(meta)
+	if err := trash.UpdateMetadata(item, meta); err != nil {
+		return fmt.Errorf("failed to update metadata: %v", err)
+	}
+	return nil
+}
+
+// normalizeTags trims tags, splits comma-separated lists, and drops empty
+// and duplicate tags, returning them sorted
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, tag := range tags {
+		for _, t := range strings.Split(tag, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" || seen[t] {
+				continue
+			}
+			seen[t] = true
+			result = append(result, t)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// annotations describes the note and tags of an item for listings
+func annotations(meta *trash.Metadata) []string {
+	var lines []string
+	if meta.Note != "" {
+		lines = append(lines, "note: "+meta.Note)
+	}
+	if len(meta.Tags) > 0 {
+		lines = append(lines, "tags: "+strings.Join(meta.Tags, ", "))
+	}
+	return lines
+}
@@ -0,0 +1,235 @@
+package restore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/throttle"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// Retention classes: what purging does with an expired item
+const (
+	ClassDelete  = "delete"
+	ClassArchive = "archive"
+)
+
+// packMode makes archive packs read-only once written
+const packMode os.FileMode = 0400
+
+// pack is a compressed tar file collecting the items archived by one purge.
+// Entries are named after the original path and carry the deletion time in
+// PAX records, so no metadata files are needed.
+type pack struct {
+	path  string
+	file  *os.File
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	rate  int64       // Bytes per second read into the pack (throttle_rate)
+	mode  os.FileMode // Mode of the pack once written
+	items int
+}
+
+// openPack creates a new pack file in the archive directory
+func openPack(cfg *config.Config) (*pack, error) {
+	if err := os.MkdirAll(cfg.ArchiveDir, trash.DirMode); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(cfg.ArchiveDir, "pack-"+cfg.Now().Format("20060102-150405.000000000")+".tar.gz")
+	return createPack(path, int64(cfg.ThrottleRate), packMode)
+}
+
+// createPack creates a pack file at path, which must not exist yet
+func createPack(path string, rate int64, mode os.FileMode) (*pack, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, trash.MetadataMode)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &pack{path: path, file: f, gz: gz, tw: tar.NewWriter(gz), rate: rate, mode: mode}, nil
+}
+
+// add writes a trashed item to the pack under its original path
+func (p *pack) add(item string, meta *trash.Metadata) error {
+	base := strings.TrimPrefix(filepath.ToSlash(meta.OriginalPath), "/")
+	records := map[string]string{
+		"SAFERM.deleted_at": meta.DeletedAt.Format(time.RFC3339),
+		"SAFERM.hostname":   meta.Hostname,
+	}
+
+	// Read-only items are packed with the modes they had
+	modes, err := trash.OriginalModes(item, meta)
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %v", meta.OriginalPath, err)
+	}
+
+	err = filepath.Walk(item, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(item, path)
+		if mode, ok := modes[rel]; ok {
+			header.Mode = header.Mode&^0777 | int64(mode.Perm())
+		}
+		header.Name = filepath.ToSlash(filepath.Join(base, rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.PAXRecords = records
+		header.Format = tar.FormatPAX
+		if err := p.tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(throttle.Writer(p.tw, p.rate), f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %v", meta.OriginalPath, err)
+	}
+	p.items++
+	return nil
+}
+
+// close finishes the pack and flushes it to stable storage; archived items
+// may only be deleted after it succeeds
+func (p *pack) close() error {
+	if err := p.tw.Close(); err != nil {
+		p.file.Close()
+		return err
+	}
+	if err := p.gz.Close(); err != nil {
+		p.file.Close()
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		p.file.Close()
+		return err
+	}
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(p.path, p.mode)
+}
+
+// discard removes an unfinished pack
+func (p *pack) discard() {
+	p.file.Close()
+	os.Remove(p.path)
+}
+
+// archiveItems packs the given items into a new pack file, returning the
+// items that were archived. On failure nothing is reported archived, so the
+// caller keeps every item.
+func archiveItems(cfg *config.Config, items []string, metas map[string]*trash.Metadata) ([]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	p, err := openPack(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := p.add(item, metas[item]); err != nil {
+			p.discard()
+			return nil, err
+		}
+	}
+	if err := p.close(); err != nil {
+		p.discard()
+		return nil, err
+	}
+
+	output.Verbosef("Archived %d item(s) to %s\n", p.items, p.path)
+	return items, nil
+}
+
+// RestoreArchive packages the items a batch restore would select into a
+// tar.gz at path instead of restoring them, each under its original path
+// (without the leading /), for handing recovered data to someone else. The
+// items stay in the trash, and the file is only readable by its owner.
+func RestoreArchive(cfg *config.Config, path string, opts BatchOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+	batch := selectBatch(cfg, items, opts)
+	if len(batch) == 0 {
+		return fmt.Errorf("no items found in trash for %s", batchDescription(opts))
+	}
+
+	p, err := createPack(path, 0, trash.MetadataMode)
+	if err != nil {
+		return err
+	}
+	for _, item := range batch {
+		if err := p.add(item.path, item.meta); err != nil {
+			p.discard()
+			return err
+		}
+		output.Verbosef("Packed: %s\n", item.meta.OriginalPath)
+	}
+	if err := p.close(); err != nil {
+		p.discard()
+		return err
+	}
+
+	size := "unknown size"
+	if info, err := os.Stat(path); err == nil {
+		size = output.FormatBytes(info.Size())
+	}
+	output.Printf("Packed %d item(s) into %s (%s)\n", p.items, path, size)
+	return nil
+}
+
+// pruneArchive removes pack files older than archive_retention_days
+func pruneArchive(cfg *config.Config) {
+	if cfg.ArchiveRetentionDays <= 0 {
+		return
+	}
+	packs, err := filepath.Glob(filepath.Join(cfg.ArchiveDir, "pack-*.tar.gz"))
+	if err != nil {
+		return
+	}
+
+	cutoff := cfg.Now().AddDate(0, 0, -cfg.ArchiveRetentionDays)
+	for _, path := range packs {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			output.Warning("failed to remove archive pack %s: %v", path, err)
+			continue
+		}
+		output.Verbosef("Removed archive pack %s\n", path)
+	}
+}
@@ -0,0 +1,170 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/throttle"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// notifiedFile records items already announced by the purge notification,
+// so that periodic autopurge runs do not repeat them
+const notifiedFile = "purge-notified"
+
+// Pin marks the most recently deleted item with the given original path as
+// exempt from purging by age, or clears the mark when pinned is false
+func Pin(cfg *config.Config, originalPath string, pinned bool, opts RestoreOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	item, meta := findLatest(items, originalPath)
+	if item == "" {
+		return fmt.Errorf("no item found in trash with original path: %s", originalPath)
+	}
+
+	meta.Pinned = pinned
+	if err := trash.UpdateMetadata(item, meta); err != nil {
+		return fmt.Errorf("failed to update metadata: %v", err)
+	}
+
+	if pinned {
+		output.Printf("Pinned: %s (will not be purged by age)\n", originalPath)
+	} else {
+		output.Printf("Unpinned: %s\n", originalPath)
+	}
+	return nil
+}
+
+// Autopurge enforces the configured retention. It is meant to run
+// periodically (cron, systemd timer): items expiring within
+// purge_notify_hours are first announced through purge_notify_command, then
+// expired items are purged. Nothing happens while the system is busy
+// (autopurge_max_load, autopurge_require_ac).
+func Autopurge(cfg *config.Config, opts PurgeOptions) error {
+	if !cfg.RetentionEnabled() {
+		output.Printf("Retention is disabled (retention_days: %d), nothing to purge.\n", cfg.RetentionDays)
+		return nil
+	}
+	if reason, busy := throttle.Busy(cfg.AutopurgeMaxLoad, cfg.AutopurgeRequireAC); busy {
+		// The next timer run tries again
+		output.Printf("Autopurge postponed: %s.\n", reason)
+		return nil
+	}
+
+	if cfg.PurgeNotifyCommand != "" && cfg.PurgeNotifyHours > 0 {
+		if err := notifyUpcoming(cfg, opts); err != nil {
+			output.Warning("purge notification failed: %v", err)
+		}
+	}
+
+	if err := Purge(cfg, 0, opts); err != nil {
+		return err
+	}
+	// Autopurge runs daily, which keeps the trend history without gaps
+	if err := RecordDailySnapshot(cfg); err != nil {
+		output.Debugf("failed to record trash snapshot: %v", err)
+	}
+	return nil
+}
+
+// upcomingItem is an item that will expire within the notification window
+type upcomingItem struct {
+	path   string
+	meta   *trash.Metadata
+	expiry time.Time
+}
+
+// notifyUpcoming runs the notification command for items that will expire
+// within the notification window and have not been announced before
+func notifyUpcoming(cfg *config.Config, opts PurgeOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	notified := readNotified()
+	horizon := cfg.Now().Add(time.Duration(cfg.PurgeNotifyHours) * time.Hour)
+
+	var upcoming []upcomingItem
+	var stillPending []string
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		expiry, ok := Expiry(cfg, meta)
+		if !ok || expiry.After(horizon) {
+			continue
+		}
+		stillPending = append(stillPending, item.Path)
+		if !notified[item.Path] {
+			upcoming = append(upcoming, upcomingItem{path: item.Path, meta: meta, expiry: expiry})
+		}
+	}
+
+	if len(upcoming) > 0 {
+		sort.Slice(upcoming, func(i, j int) bool {
+			return upcoming[i].expiry.Before(upcoming[j].expiry)
+		})
+
+		cmd := exec.Command("sh", "-c", cfg.PurgeNotifyCommand)
+		cmd.Stdin = strings.NewReader(purgeSummary(cfg, upcoming))
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), fmt.Sprintf("SAFERM_PURGE_COUNT=%d", len(upcoming)))
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+
+	// Only remember items that are still pending, so the file cannot grow forever
+	return writeNotified(stillPending)
+}
+
+// purgeSummary builds the notification text for upcoming purges
+func purgeSummary(cfg *config.Config, upcoming []upcomingItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "safe-rm: %d item(s) will be permanently purged within %d hour(s):\n\n",
+		len(upcoming), cfg.PurgeNotifyHours)
+	for _, item := range upcoming {
+		fmt.Fprintf(&b, "  %s  %s\n", item.expiry.Format("2006-01-02 15:04"), item.meta.OriginalPath)
+	}
+	b.WriteString("\nTo keep an item, pin it:\n")
+	fmt.Fprintf(&b, "  rm --safe-pin=%s\n", upcoming[0].meta.OriginalPath)
+	return b.String()
+}
+
+func readNotified() map[string]bool {
+	notified := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(config.StateDir(), notifiedFile))
+	if err != nil {
+		return notified
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			notified[line] = true
+		}
+	}
+	return notified
+}
+
+func writeNotified(paths []string) error {
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return err
+	}
+	data := strings.Join(paths, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	return os.WriteFile(filepath.Join(config.StateDir(), notifiedFile), []byte(data), 0600)
+}
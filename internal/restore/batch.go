@@ -0,0 +1,317 @@
+package restore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// How a batch restore resolves items whose original path exists again
+// (--conflict); with none given, an interactive restore asks
+const (
+	ConflictSkip      = "skip"      // Leave the item in the trash
+	ConflictOverwrite = "overwrite" // Move the existing file to the trash, then restore
+	ConflictRename    = "rename"    // Restore next to it as PATH.restored (or .restored-N)
+)
+
+// BatchOptions selects the items of a batch restore and how conflicts are
+// resolved
+type BatchOptions struct {
+	AllRoots     bool      // Search all known trash roots
+	Session      string    // Restore the items trashed in this session
+	Pattern      string    // Restore the items whose original path matches this glob
+	ID           string    // Restore the items whose ID starts with this
+	DeletedAfter time.Time // Only restore items trashed after this, if set
+	Conflict     string    // ConflictSkip, ConflictOverwrite, ConflictRename, or empty to ask
+	Interactive  bool      // Conflicts may be resolved by asking on the terminal
+}
+
+// batchItem is an item selected for a batch restore
+type batchItem struct {
+	path     string
+	meta     *trash.Metadata
+	dest     string
+	conflict string // Resolution, for items whose destination exists
+}
+
+// stdin reads the answers to prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// ask prints prompt and reads the line typed in answer; replaced in tests
+var ask = func(prompt string) string {
+	fmt.Fprint(os.Stderr, prompt)
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// IsPattern reports whether path is a glob pattern rather than a path
+func IsPattern(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// RestoreBatch restores every item of a session or matching a glob. All
+// conflicts are found before anything is restored and resolved in one pass,
+// so a batch either stops before touching anything or restores all items
+// that were not skipped.
+func RestoreBatch(cfg *config.Config, opts BatchOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	batch := selectBatch(cfg, items, opts)
+	if len(batch) == 0 {
+		return fmt.Errorf("no items found in trash for %s", batchDescription(opts))
+	}
+
+	if err := checkHosts(cfg, batch, opts.Interactive); err != nil {
+		return err
+	}
+
+	var conflicts []*batchItem
+	for _, item := range batch {
+		if _, err := os.Lstat(item.dest); err == nil {
+			conflicts = append(conflicts, item)
+		}
+	}
+	if len(conflicts) > 0 {
+		if err := resolveConflicts(conflicts, len(batch), opts); err != nil {
+			return err
+		}
+	}
+
+	restored, skipped, failed := 0, 0, 0
+	for _, item := range batch {
+		switch item.conflict {
+		case ConflictSkip:
+			output.Verbosef("Skipped: %s (exists)\n", item.dest)
+			skipped++
+			continue
+		case ConflictOverwrite:
+			if _, err := trash.Move(cfg, item.dest); err != nil {
+				output.PathError(item.dest, fmt.Errorf("cannot move existing file to the trash: %v", err))
+				failed++
+				continue
+			}
+		case ConflictRename:
+			item.dest = renamedDest(item.dest)
+		}
+		if err := restoreItem(cfg, items, item.path, item.meta, item.dest); err != nil {
+			output.PathError(item.dest, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+
+	output.Printf("Restored %d item(s), skipped %d, failed %d\n", restored, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) could not be restored", failed)
+	}
+	return nil
+}
+
+// Undo restores every item the last operation moved to the trash, as a
+// batch restore of its session, and forgets the operation once all of them
+// are back
+func Undo(cfg *config.Config, opts BatchOptions) error {
+	op, err := trash.LastOperation()
+	if err != nil {
+		return fmt.Errorf("cannot read the last operation: %v", err)
+	}
+	if op == nil {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	output.Printf("Undoing: %s (%s, session %s)\n", op.Command,
+		output.FormatTime(op.Time, output.TimeStyleRelative), op.Session)
+	opts.Session = op.Session
+	if err := RestoreBatch(cfg, opts); err != nil {
+		return err
+	}
+	return trash.ForgetOperation()
+}
+
+// selectBatch returns the latest item of each original path selected by
+// opts, parents before their contents. Items go back to their original
+// path, or where restore_map moves it; a pattern may name either.
+func selectBatch(cfg *config.Config, items []rootItem, opts BatchOptions) []*batchItem {
+	pattern := opts.Pattern
+	if pattern != "" {
+		pattern, _ = filepath.Abs(config.ExpandHome(pattern))
+	}
+
+	latest := map[string]*batchItem{}
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		if opts.Session != "" && meta.Session != opts.Session {
+			continue
+		}
+		if opts.ID != "" && !strings.HasPrefix(meta.ID, strings.ToLower(opts.ID)) {
+			continue
+		}
+		if !opts.DeletedAfter.IsZero() && !meta.DeletedAt.After(opts.DeletedAfter) {
+			continue
+		}
+		dest := cfg.MapRestorePath(meta.OriginalPath)
+		if pattern != "" && !matchOriginal(pattern, meta.OriginalPath) && !matchOriginal(pattern, dest) {
+			continue
+		}
+		if prev, ok := latest[meta.OriginalPath]; !ok || meta.DeletedAt.After(prev.meta.DeletedAt) {
+			latest[meta.OriginalPath] = &batchItem{path: item.Path, meta: meta, dest: dest}
+		}
+	}
+
+	var batch []*batchItem
+	for _, item := range latest {
+		batch = append(batch, item)
+	}
+	sort.Slice(batch, func(i, j int) bool { return batch[i].dest < batch[j].dest })
+	return batch
+}
+
+// matchOriginal matches an original path against a glob pattern, where a
+// trailing /** matches everything below a directory
+func matchOriginal(pattern, originalPath string) bool {
+	if matched, err := filepath.Match(pattern, originalPath); err == nil && matched {
+		return true
+	}
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(originalPath, dir+"/")
+	}
+	return false
+}
+
+// checkHosts asks once whether items trashed on other hosts should be
+// restored here, as checkHost does for single items
+func checkHosts(cfg *config.Config, batch []*batchItem, interactive bool) error {
+	hosts := map[string]int{}
+	for _, item := range batch {
+		if item.meta.Hostname != "" && item.meta.Hostname != cfg.Host() {
+			hosts[item.meta.Hostname]++
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	var names []string
+	for host, n := range hosts {
+		names = append(names, fmt.Sprintf("%s (%d)", host, n))
+	}
+	sort.Strings(names)
+	if !interactive {
+		output.Warning("restoring items trashed on other hosts: %s", strings.Join(names, ", "))
+		return nil
+	}
+	answer := strings.ToLower(ask(fmt.Sprintf("Some items were trashed on other hosts than %s: %s. Restore them here? [y/N] ",
+		cfg.Host(), strings.Join(names, ", "))))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("aborted; nothing was restored")
+	}
+	return nil
+}
+
+// resolveConflicts sets the resolution of every conflicting item, from
+// opts.Conflict or by asking once for all of them
+func resolveConflicts(conflicts []*batchItem, total int, opts BatchOptions) error {
+	if opts.Conflict == "" && !opts.Interactive {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d of %d item(s) would overwrite existing files; nothing was restored:", len(conflicts), total)
+		for _, item := range conflicts {
+			fmt.Fprintf(&b, "\n  %s", item.dest)
+		}
+		b.WriteString("\nUse --conflict=skip, --conflict=overwrite or --conflict=rename")
+		return fmt.Errorf("%s", b.String())
+	}
+
+	resolution := opts.Conflict
+	if resolution == "" {
+		fmt.Fprintf(os.Stderr, "%d of %d item(s) would overwrite existing files:\n", len(conflicts), total)
+		for _, item := range conflicts {
+			fmt.Fprintf(os.Stderr, "  %s\n", item.dest)
+		}
+		switch strings.ToLower(ask("Restore the others and [s]kip these, [o]verwrite them (existing files go to the trash), [r]ename the restored copies, decide [i]ndividually, or [a]bort? ")) {
+		case "s", "skip":
+			resolution = ConflictSkip
+		case "o", "overwrite":
+			resolution = ConflictOverwrite
+		case "r", "rename":
+			resolution = ConflictRename
+		case "i", "individually":
+			return resolveEach(conflicts)
+		default:
+			return fmt.Errorf("aborted; nothing was restored")
+		}
+	}
+	for _, item := range conflicts {
+		item.conflict = resolution
+	}
+	return nil
+}
+
+// resolveEach asks about each conflict in turn; an upper case answer
+// applies to the remaining conflicts too
+func resolveEach(conflicts []*batchItem) error {
+	all := ""
+	for _, item := range conflicts {
+		if all != "" {
+			item.conflict = all
+			continue
+		}
+		answer := ask(fmt.Sprintf("%s exists: [s]kip, [o]verwrite, [r]ename, [a]bort (upper case: all remaining)? ", item.dest))
+		switch strings.ToLower(answer) {
+		case "s":
+			item.conflict = ConflictSkip
+		case "o":
+			item.conflict = ConflictOverwrite
+		case "r":
+			item.conflict = ConflictRename
+		default:
+			return fmt.Errorf("aborted; nothing was restored")
+		}
+		if answer != strings.ToLower(answer) {
+			all = item.conflict
+		}
+	}
+	return nil
+}
+
+// renamedDest returns a free name next to dest for a renamed restore
+func renamedDest(dest string) string {
+	renamed := dest + ".restored"
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(renamed); os.IsNotExist(err) {
+			return renamed
+		}
+		renamed = fmt.Sprintf("%s.restored-%d", dest, n)
+	}
+}
+
+// batchDescription describes the selection of a batch restore for errors
+func batchDescription(opts BatchOptions) string {
+	if !opts.DeletedAfter.IsZero() {
+		filter := opts
+		filter.DeletedAfter = time.Time{}
+		return batchDescription(filter) + " deleted after " + opts.DeletedAfter.Format("2006-01-02 15:04:05")
+	}
+	switch {
+	case opts.Session != "":
+		return "session " + opts.Session
+	case opts.ID != "":
+		return "ID " + opts.ID
+	case !IsPattern(opts.Pattern):
+		return "path " + opts.Pattern
+	}
+	return "pattern " + opts.Pattern
+}
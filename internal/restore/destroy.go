@@ -0,0 +1,397 @@
+package restore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+	"github.com/user/safe-rm/internal/shred"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// ApprovalFile holds the secret of the last dry run of DestroyMatching in
+// the state directory, which its approval token is keyed with
+const ApprovalFile = "destroy-approval"
+
+// approvalTTL is how long the approval token of a dry run can be used
+const approvalTTL = time.Hour
+
+// approval is a dry run of DestroyMatching awaiting its approval token
+type approval struct {
+	Secret  string    `json:"secret"` // Hex random key of the token
+	Expires time.Time `json:"expires"`
+}
+
+// DestroyOptions selects where DestroyMatching searches and how the
+// destruction is authorized
+type DestroyOptions struct {
+	AllRoots bool     // Search all known trash roots
+	Live     []string // Also search the files below these directories
+	Token    string   // Approval token of the last dry run, instead of confirming twice
+	DryRun   bool     // Only show the selection and issue its approval token
+}
+
+// destroyTarget is an item selected by DestroyMatching
+type destroyTarget struct {
+	path      string // Original path of a trashed item, or a live file
+	trashPath string // Trashed item; empty for live files
+	size      int64
+	contains  int    // Matching entries inside a trashed directory that does not match itself
+	protected string // Why a live file needs confirmation by a protection rule
+}
+
+// DestroyMatching shreds every trashed item, and with opts.Live every file
+// below those directories, that refers to a data subject, e.g. by a
+// customer number or e-mail address in its path: the matches are shown,
+// then destroyed once confirmed twice, or without asking if opts.Token is
+// the approval token a dry run issued for exactly these matches. Tokens are
+// keyed with a secret the dry run keeps in the state directory, so they
+// cannot be derived from the matches; each can be used once, within
+// approvalTTL. Live files blocked by protection rules are never destroyed.
+// Each destroyed item gets a signed purge receipt in the audit log, whether
+// or not purge_receipts is enabled.
+func DestroyMatching(cfg *config.Config, pattern string, opts DestroyOptions) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("the pattern to destroy must not be empty")
+	}
+	targets, err := selectDestroy(cfg, pattern, opts)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		output.Printf("Nothing matches '%s'.\n", pattern)
+		return nil
+	}
+
+	var total int64
+	for _, t := range targets {
+		total += t.size
+	}
+	fmt.Printf("%d item(s) (%s) match '%s':\n", len(targets), output.FormatBytes(total), pattern)
+	for _, t := range targets {
+		where := "trash"
+		if t.trashPath == "" {
+			where = "live"
+		}
+		line := fmt.Sprintf("  %-5s %9s  %s", where, output.FormatBytes(t.size), t.path)
+		if t.contains > 0 {
+			line += fmt.Sprintf(" (directory with %d matching entries)", t.contains)
+		}
+		if t.protected != "" {
+			line += fmt.Sprintf(" (protected: %s)", t.protected)
+		}
+		fmt.Println(line)
+	}
+
+	switch {
+	case opts.DryRun:
+		token, err := issueApproval(cfg, pattern, targets)
+		if err != nil {
+			return fmt.Errorf("cannot issue an approval token: %v", err)
+		}
+		fmt.Printf("Approval token: %s\n", token)
+		fmt.Printf("Dry run: nothing was destroyed. Pass --approval-token=%s within %v to destroy exactly these items.\n", token, approvalTTL)
+		return nil
+	case opts.Token != "":
+		for _, t := range targets {
+			if t.protected != "" {
+				return fmt.Errorf("%s is protected (%s); an approval token cannot confirm it, nothing was destroyed", t.path, t.protected)
+			}
+		}
+		if err := useApproval(cfg, pattern, targets, opts.Token); err != nil {
+			return err
+		}
+	default:
+		fmt.Printf("WARNING: This will SHRED %d item(s); they cannot be restored.\n", len(targets))
+		if ask(fmt.Sprintf("Type the number of items (%d) to confirm: ", len(targets))) != strconv.Itoa(len(targets)) {
+			fmt.Println("Aborted.")
+			return nil
+		}
+		if ask(fmt.Sprintf("Type the pattern (%s) again to destroy them: ", pattern)) != pattern {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	// Nothing is destroyed without a receipt
+	if _, err := audit.ReceiptPublicKey(cfg); err != nil {
+		return fmt.Errorf("cannot sign purge receipts: %v", err)
+	}
+	if err := confine(cfg, selectRoots(cfg, opts.AllRoots), liveDirs(opts)...); err != nil {
+		return err
+	}
+	destroyed, failed := 0, 0
+	for _, t := range targets {
+		if err := destroy(cfg, t); err != nil {
+			output.Warning("failed to destroy %s: %v", t.path, err)
+			failed++
+			continue
+		}
+		destroyed++
+	}
+	for _, root := range selectRoots(cfg, opts.AllRoots) {
+		cleanEmptyDirs(root)
+	}
+
+	output.Printf("Shredded %d item(s) matching '%s'; their receipts are in %s.\n", destroyed, pattern, audit.Path())
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) matching '%s' could not be destroyed", failed, pattern)
+	}
+	return nil
+}
+
+// selectDestroy returns the trashed items and live files matching pattern:
+// trashed items by original path, note or tags, and live files by their path
+// below the directory searched, so that a pattern that happens to match
+// that directory does not select everything in it. A trashed directory also
+// matches by any entry inside it; it is then destroyed as a whole. A live
+// file blocked by a protection rule fails the whole selection.
+func selectDestroy(cfg *config.Config, pattern string, opts DestroyOptions) ([]destroyTarget, error) {
+	match := subjectMatcher(pattern)
+
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return nil, err
+	}
+	var targets []destroyTarget
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		target := destroyTarget{path: meta.OriginalPath, trashPath: item.Path, size: meta.Size}
+		if match(meta.OriginalPath) || match(meta.Note) || matchAny(match, meta.Tags) {
+			targets = append(targets, target)
+			continue
+		}
+		filepath.WalkDir(item.Path, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && path != item.Path {
+				rel, _ := filepath.Rel(item.Path, path)
+				if match(filepath.Join(meta.OriginalPath, rel)) {
+					target.contains++
+				}
+			}
+			return nil
+		})
+		if target.contains > 0 {
+			targets = append(targets, target)
+		}
+	}
+
+	trashDir := cfg.GetTrashDir()
+	var blocked error
+	for _, dir := range opts.Live {
+		root, err := filepath.Abs(config.ExpandHome(dir))
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == root {
+				return nil
+			}
+			if path == trashDir {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || !match(rel) {
+				return nil
+			}
+			target := destroyTarget{path: path}
+			switch status := protect.Check(cfg, path, entry.IsDir()); {
+			case !status.Protected:
+			case status.Action == protect.ActionBlock:
+				blocked = fmt.Errorf("%s matches, but it is protected (%s); nothing was destroyed", path, status.Reason)
+				return filepath.SkipAll
+			case status.Action == protect.ActionConfirm:
+				target.protected = status.Reason
+			default:
+				output.Warning("destroying protected path %s (%s)", path, status.Reason)
+			}
+			target.size, _ = trash.Size(path)
+			targets = append(targets, target)
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot search %s: %v", root, err)
+		}
+		if blocked != nil {
+			return nil, blocked
+		}
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].path < targets[j].path })
+	return targets, nil
+}
+
+// liveDirs returns the absolute directories searched for live files
+func liveDirs(opts DestroyOptions) []string {
+	var dirs []string
+	for _, dir := range opts.Live {
+		if abs, err := filepath.Abs(config.ExpandHome(dir)); err == nil {
+			dirs = append(dirs, abs)
+		}
+	}
+	return dirs
+}
+
+// subjectMatcher returns whether a path, note or tag refers to the subject
+// identified by pattern: a glob is matched against the whole string and
+// each name in it, anything else is looked for in it, ignoring case
+func subjectMatcher(pattern string) func(string) bool {
+	if IsPattern(pattern) {
+		return func(s string) bool {
+			if matched, _ := filepath.Match(pattern, s); matched {
+				return true
+			}
+			for _, name := range strings.Split(s, "/") {
+				if matched, _ := filepath.Match(pattern, name); matched {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	lower := strings.ToLower(pattern)
+	return func(s string) bool {
+		return s != "" && strings.Contains(strings.ToLower(s), lower)
+	}
+}
+
+// matchAny reports whether match accepts any of values
+func matchAny(match func(string) bool, values []string) bool {
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalPath returns the location of ApprovalFile
+func approvalPath() string {
+	return filepath.Join(config.StateDir(), ApprovalFile)
+}
+
+// issueApproval keeps a new secret for the approval token of a selection,
+// replacing that of any earlier dry run, and returns the token
+func issueApproval(cfg *config.Config, pattern string, targets []destroyTarget) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(approval{Secret: hex.EncodeToString(secret), Expires: cfg.Now().Add(approvalTTL)})
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return "", err
+	}
+	tmp := fmt.Sprintf("%s.%d", approvalPath(), os.Getpid())
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, approvalPath()); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return approvalToken(secret, pattern, targets), nil
+}
+
+// useApproval checks that token was issued by the last dry run for exactly
+// this selection, and spends it
+func useApproval(cfg *config.Config, pattern string, targets []destroyTarget, token string) error {
+	data, err := os.ReadFile(approvalPath())
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no approval token is pending; review the matches with --dry-run first")
+	}
+	if err != nil {
+		return err
+	}
+	var pending approval
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("%s: %v", approvalPath(), err)
+	}
+	secret, err := hex.DecodeString(pending.Secret)
+	if err != nil || len(secret) == 0 {
+		return fmt.Errorf("%s holds no approval secret", approvalPath())
+	}
+	if cfg.Now().After(pending.Expires) {
+		return fmt.Errorf("approval token %s has expired; review the matches again with --dry-run", token)
+	}
+	if !hmac.Equal([]byte(token), []byte(approvalToken(secret, pattern, targets))) {
+		return fmt.Errorf("approval token %s was not issued for the items matching '%s' now; review them again with --dry-run", token, pattern)
+	}
+	// A token authorizes one destruction
+	if err := os.Remove(approvalPath()); err != nil {
+		return fmt.Errorf("cannot spend approval token: %v", err)
+	}
+	return nil
+}
+
+// approvalToken identifies a selection by its pattern and every item in
+// it, keyed with the secret of a dry run, so that a token only authorizes
+// destroying exactly what that dry run showed
+func approvalToken(secret []byte, pattern string, targets []destroyTarget) string {
+	h := hmac.New(sha256.New, secret)
+	fmt.Fprintf(h, "%s\x00", pattern)
+	for _, t := range targets {
+		fmt.Fprintf(h, "%s\x00%s\x00%d\x00", t.path, t.trashPath, t.size)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// destroy shreds one selected item and records its receipt
+func destroy(cfg *config.Config, t destroyTarget) error {
+	path := t.trashPath
+	if path == "" {
+		path = t.path
+	}
+	receipt, err := audit.NewReceipt(t.path, path, audit.MethodShred)
+	if err != nil {
+		return fmt.Errorf("cannot checksum it for its receipt: %v", err)
+	}
+
+	if t.trashPath != "" {
+		if err := trash.Shred(t.trashPath, shred.DefaultPasses); err != nil {
+			return err
+		}
+		trash.CleanSibling(t.trashPath)
+	} else {
+		skipped, err := shred.Tree(t.path, shred.DefaultPasses)
+		if err != nil {
+			return err
+		}
+		for _, file := range skipped {
+			output.Warning("%s has other hard links; its contents were not overwritten", file)
+		}
+		if err := os.RemoveAll(t.path); err != nil {
+			return err
+		}
+	}
+
+	entry := audit.Entry{Action: audit.ActionDestroy, Path: t.path, TrashPath: t.trashPath, Bytes: receipt.Size, Receipt: receipt}
+	if err := audit.Record(cfg, entry); err != nil {
+		return fmt.Errorf("destroyed, but its receipt could not be recorded: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// Age buckets of DiskUsage, by time since deletion
+var ageBuckets = []struct {
+	Name string
+	Max  time.Duration // Upper bound; 0 for none
+}{
+	{"<7d", 7 * 24 * time.Hour},
+	{"7-30d", 30 * 24 * time.Hour},
+	{">30d", 0},
+}
+
+// TrashUsage is the disk usage of the trash, in total and broken down by
+// where items came from and how long ago they were deleted
+type TrashUsage struct {
+	Items       int          `json:"items"`
+	Bytes       int64        `json:"bytes"`
+	Pending     int          `json:"pending,omitempty"` // Directories whose size is not known yet
+	Directories []UsageGroup `json:"directories"`       // By original top-level directory, largest first
+	Ages        []UsageGroup `json:"ages"`              // By age bucket, newest first
+}
+
+// UsageGroup is the share of one group of items in TrashUsage
+type UsageGroup struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+	Bytes int64  `json:"bytes"`
+}
+
+// diskUsage measures the trashed items in roots
+func diskUsage(cfg *config.Config, roots []string) (*TrashUsage, error) {
+	items, err := findItems(cfg, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	usage := &TrashUsage{Directories: []UsageGroup{}}
+	byDir := map[string]*UsageGroup{}
+	ages := make([]UsageGroup, len(ageBuckets))
+	for i, bucket := range ageBuckets {
+		ages[i].Name = bucket.Name
+	}
+
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		usage.Items++
+		usage.Bytes += meta.Size
+		if !meta.Scanned {
+			usage.Pending++
+		}
+
+		dir := topDirectory(meta.OriginalPath, homeDir)
+		group, ok := byDir[dir]
+		if !ok {
+			group = &UsageGroup{Name: dir}
+			byDir[dir] = group
+		}
+		group.Items++
+		group.Bytes += meta.Size
+
+		age := cfg.Now().Sub(meta.DeletedAt)
+		for i, bucket := range ageBuckets {
+			if bucket.Max == 0 || age < bucket.Max {
+				ages[i].Items++
+				ages[i].Bytes += meta.Size
+				break
+			}
+		}
+	}
+
+	for _, group := range byDir {
+		usage.Directories = append(usage.Directories, *group)
+	}
+	sort.Slice(usage.Directories, func(i, j int) bool {
+		a, b := usage.Directories[i], usage.Directories[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Name < b.Name
+	})
+	usage.Ages = ages
+	return usage, nil
+}
+
+// topDirectory returns the directory an item is accounted to by DiskUsage:
+// the top-level directory of its original path, or below the home
+// directory the top-level directory there (as ~/NAME)
+func topDirectory(originalPath, homeDir string) string {
+	if homeDir != "" && homeDir != "/" {
+		if rel, err := filepath.Rel(homeDir, originalPath); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			first, _, nested := strings.Cut(rel, "/")
+			if rel == "." || !nested {
+				return "~"
+			}
+			return "~/" + first
+		}
+	}
+	first, _, nested := strings.Cut(strings.TrimPrefix(originalPath, "/"), "/")
+	if !nested {
+		return "/"
+	}
+	return "/" + first
+}
+
+// DiskUsage displays the total size and item count of the trash, broken
+// down by original top-level directory and by age, as a table or as JSON
+func DiskUsage(cfg *config.Config, opts ListOptions) error {
+	usage, err := diskUsage(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(usage)
+	}
+
+	if usage.Items == 0 {
+		output.Printf("Trash is empty.\n")
+		return nil
+	}
+
+	total := output.FormatBytes(usage.Bytes)
+	if usage.Pending > 0 {
+		total = "at least " + total
+	}
+	fmt.Printf("Total: %d item(s), %s\n\n", usage.Items, total)
+
+	fmt.Printf("%-40s %8s %12s\n", "DIRECTORY", "ITEMS", "SIZE")
+	fmt.Println(strings.Repeat("-", 62))
+	for _, group := range usage.Directories {
+		fmt.Printf("%-40s %8d %12s\n", group.Name, group.Items, output.FormatBytes(group.Bytes))
+	}
+
+	fmt.Printf("\n%-40s %8s %12s\n", "AGE", "ITEMS", "SIZE")
+	fmt.Println(strings.Repeat("-", 62))
+	for _, group := range usage.Ages {
+		fmt.Printf("%-40s %8d %12s\n", group.Name, group.Items, output.FormatBytes(group.Bytes))
+	}
+
+	if usage.Pending > 0 {
+		fmt.Printf("\n%d director(ies) not measured yet are counted as 0 bytes.\n", usage.Pending)
+	}
+	return nil
+}
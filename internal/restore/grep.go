@@ -0,0 +1,165 @@
+package restore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// DefaultGrepMaxSize bounds the files searched by Grep unless set otherwise
+const DefaultGrepMaxSize = 10 << 20
+
+// maxMatchLength truncates matching lines in Grep output
+const maxMatchLength = 200
+
+// GrepOptions controls which trashed files Grep searches
+type GrepOptions struct {
+	AllRoots bool     // Search all known trash roots
+	MaxSize  int64    // Skip files larger than this
+	Include  []string // Only search files whose name matches one of these globs
+}
+
+// GrepMatch is a line of a trashed file matching the pattern, or the note
+// or tags of a trashed item (Line 0)
+type GrepMatch struct {
+	OriginalPath string // Where the file was before it was trashed
+	TrashPath    string
+	Line         int
+	Text         string
+}
+
+// Grep displays the lines of trashed files matching a regular expression,
+// prefixed with the file's original path and the line number
+func Grep(cfg *config.Config, pattern string, opts GrepOptions) error {
+	matches, err := grepTrash(cfg, pattern, opts)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		output.Printf("No trashed files match.\n")
+		return nil
+	}
+
+	for _, m := range matches {
+		if m.Line == 0 {
+			fmt.Printf("%s: [%s]\n", m.OriginalPath, m.Text)
+			output.Verbosef("  (in trash: %s)\n", m.TrashPath)
+			continue
+		}
+		fmt.Printf("%s:%d: %s\n", m.OriginalPath, m.Line, m.Text)
+		output.Verbosef("  (in trash: %s)\n", m.TrashPath)
+	}
+	return nil
+}
+
+// grepTrash searches the notes and tags of trashed items and the contents
+// of trashed text files, including the files inside trashed directories,
+// for a regular expression. Binary files (with a NUL byte near the start)
+// and files over MaxSize are skipped.
+func grepTrash(cfg *config.Config, pattern string, opts GrepOptions) ([]GrepMatch, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultGrepMaxSize
+	}
+
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []GrepMatch
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		if meta.Note != "" && re.MatchString(meta.Note) {
+			matches = append(matches, GrepMatch{OriginalPath: meta.OriginalPath, TrashPath: item.Path, Text: "note: " + meta.Note})
+		}
+		for _, tag := range meta.Tags {
+			if re.MatchString(tag) {
+				matches = append(matches, GrepMatch{OriginalPath: meta.OriginalPath, TrashPath: item.Path, Text: "tags: " + strings.Join(meta.Tags, ", ")})
+				break
+			}
+		}
+		filepath.Walk(item.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			if info.Size() > opts.MaxSize || !includes(info.Name(), opts.Include) {
+				return nil
+			}
+			rel, _ := filepath.Rel(item.Path, path)
+			original := filepath.Join(meta.OriginalPath, rel)
+			found, err := grepFile(path, re)
+			if err != nil {
+				return nil
+			}
+			for _, m := range found {
+				m.OriginalPath, m.TrashPath = original, path
+				matches = append(matches, m)
+			}
+			return nil
+		})
+	}
+	return matches, nil
+}
+
+// grepFile returns the lines of a text file matching re
+func grepFile(path string, re *regexp.Regexp) ([]GrepMatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(8000)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil // Binary
+	}
+
+	var matches []GrepMatch
+	for line := 1; ; line++ {
+		text, err := reader.ReadBytes('\n')
+		if len(text) > 0 && re.Match(text) {
+			text = bytes.TrimRight(text, "\r\n")
+			if len(text) > maxMatchLength {
+				text = append(text[:maxMatchLength:maxMatchLength], "..."...)
+			}
+			matches = append(matches, GrepMatch{Line: line, Text: string(text)})
+		}
+		if err == io.EOF {
+			return matches, nil
+		}
+		if err != nil {
+			return matches, err
+		}
+	}
+}
+
+// includes reports whether name matches one of patterns; no patterns
+// include every name
+func includes(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package restore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// History displays the lifecycle events recorded in the audit log: removals,
+// restores, purges and empties. If path is not empty, only events for that
+// original path (or items below it) are shown.
+func History(cfg *config.Config, path string, opts ListOptions) error {
+	entries, err := audit.Read()
+	if err != nil {
+		return err
+	}
+
+	var shown []audit.Entry
+	for _, entry := range entries {
+		if path != "" && entry.Path != path && !strings.HasPrefix(entry.Path, strings.TrimSuffix(path, "/")+"/") {
+			continue
+		}
+		shown = append(shown, entry)
+	}
+
+	if len(shown) == 0 {
+		fmt.Println("No history recorded.")
+		return nil
+	}
+
+	fmt.Printf("%-30s %-10s %-12s %s\n", "TIME", "ACTION", "USER", "PATH")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, entry := range shown {
+		target := entry.Path
+		if target == "" {
+			target = entry.TrashPath
+		}
+		fmt.Printf("%-30s %-10s %-12s %s\n",
+			output.FormatTime(entry.Time, opts.TimeStyle),
+			entry.Action,
+			entry.User,
+			target)
+	}
+
+	return nil
+}
+
+// VerifyReceipts checks the signature of every purge receipt in the audit
+// log and shows the public key they should be signed with. Receipts signed
+// with another key are reported apart: they are genuine only if that key is
+// known to be (or have been) the operator's.
+func VerifyReceipts(cfg *config.Config) error {
+	entries, err := audit.Read()
+	if err != nil {
+		return err
+	}
+	publicKey, err := audit.ReceiptPublicKey(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot read receipt key: %v", err)
+	}
+
+	valid, otherKey, invalid := 0, 0, 0
+	for _, entry := range entries {
+		receipt := entry.Receipt
+		if receipt == nil {
+			continue
+		}
+		switch err := receipt.Verify(); {
+		case err != nil:
+			invalid++
+			output.Warning("receipt for %s (%s): %v", receipt.Path, receipt.Time.Format("2006-01-02 15:04:05"), err)
+		case receipt.PublicKey != publicKey:
+			otherKey++
+			output.Verbosef("Signed with key %s: %s\n", receipt.PublicKey, receipt.Path)
+		default:
+			valid++
+		}
+	}
+
+	fmt.Printf("Public key: %s (%s)\n", publicKey, audit.ReceiptKeyPath(cfg))
+	fmt.Printf("%d valid receipt(s), %d signed with another key, %d invalid\n", valid, otherKey, invalid)
+	if invalid > 0 {
+		return fmt.Errorf("%d receipt(s) failed verification", invalid)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// maxInfoExtensions bounds the extensions shown by Info
+const maxInfoExtensions = 10
+
+// Info displays the details of the most recently trashed item with the given
+// original path and, for a scanned directory, its manifest
+func Info(cfg *config.Config, originalPath string, opts ListOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+	trashPath, meta := findLatest(items, originalPath)
+	if trashPath == "" {
+		return fmt.Errorf("no item found in trash with original path: %s", originalPath)
+	}
+
+	kind := "file"
+	if meta.IsDirectory {
+		kind = "directory"
+	}
+	fmt.Printf("ID:            %s\n", meta.ID)
+	fmt.Printf("Original path: %s\n", meta.OriginalPath)
+	fmt.Printf("Trash path:    %s\n", trashPath)
+	fmt.Printf("Type:          %s\n", kind)
+	fmt.Printf("Deleted at:    %s (%s left)\n", output.FormatTime(meta.DeletedAt, opts.TimeStyle), daysLeft(cfg, meta))
+	fmt.Printf("Hostname:      %s\n", meta.Hostname)
+	if meta.UID != nil {
+		fmt.Printf("User:          %s\n", userName(*meta.UID))
+	}
+	if meta.Namespace != "" {
+		fmt.Printf("Namespace:     %s\n", meta.Namespace)
+	}
+	if meta.Session != "" {
+		fmt.Printf("Session:       %s\n", meta.Session)
+	}
+	if meta.Process != "" {
+		fmt.Printf("Process:       %s\n", meta.Process)
+	}
+	if meta.Device != nil {
+		fmt.Printf("Device:        %s, mounted at %s\n", meta.Device, meta.Device.MountPoint)
+	}
+	if meta.Note != "" {
+		fmt.Printf("Note:          %s\n", meta.Note)
+	}
+	if len(meta.Tags) > 0 {
+		fmt.Printf("Tags:          %s\n", strings.Join(meta.Tags, ", "))
+	}
+	fmt.Printf("Size:          %s\n", itemSize(meta))
+	if meta.Snapshot != nil {
+		fmt.Printf("Snapshot:      inline (%s compressed)\n", output.FormatBytes(int64(len(meta.Snapshot.Data))))
+	}
+	if !meta.IsDirectory {
+		return nil
+	}
+
+	manifest, err := trash.ReadManifest(trashPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("\nContents not measured yet; run 'rm --safe-scan' to build the manifest.\n")
+			return nil
+		}
+		return err
+	}
+
+	fmt.Printf("Contents:      %d file(s), %d director(ies)\n", manifest.Files, manifest.Dirs)
+
+	fmt.Printf("\n%-12s %8s  %s\n", "SIZE", "FILES", "NAME")
+	for _, entry := range manifest.Entries {
+		name, files := entry.Name, "-"
+		if entry.IsDir {
+			name += "/"
+			files = fmt.Sprintf("%d", entry.Files)
+		}
+		fmt.Printf("%-12s %8s  %s\n", output.FormatBytes(entry.Size), files, name)
+	}
+	if manifest.MoreEntries > 0 {
+		fmt.Printf("... and %d more\n", manifest.MoreEntries)
+	}
+
+	type extCount struct {
+		ext   string
+		count int
+	}
+	var exts []extCount
+	for ext, count := range manifest.Extensions {
+		if ext == "" {
+			ext = "(none)"
+		}
+		exts = append(exts, extCount{ext, count})
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if exts[i].count != exts[j].count {
+			return exts[i].count > exts[j].count
+		}
+		return exts[i].ext < exts[j].ext
+	})
+	if len(exts) > maxInfoExtensions {
+		exts = exts[:maxInfoExtensions]
+	}
+	if len(exts) > 0 {
+		fmt.Printf("\nFiles by extension:")
+		for _, e := range exts {
+			fmt.Printf(" %s %d", e.ext, e.count)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package restore
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// maxPageSize bounds the entries a single ListPage call holds in memory
+const maxPageSize = 1000
+
+// ListFilter selects the items returned by ListPage; zero fields match
+// every item
+type ListFilter struct {
+	AllRoots      bool      // Page through all known trash roots
+	Namespace     string    // Only items trashed in this namespace
+	PathPrefix    string    // Only items whose original path is under this directory
+	DeletedAfter  time.Time // Only items deleted at or after this time
+	DeletedBefore time.Time // Only items deleted before this time
+}
+
+// Entry is a trashed item with its metadata
+type Entry struct {
+	Root string
+	Path string
+	Meta *trash.Metadata
+}
+
+// Entries returns every trashed item with its metadata, most recently
+// deleted first, for callers that show the whole trash at once
+func Entries(cfg *config.Config, allRoots bool) ([]Entry, error) {
+	items, err := findItems(cfg, selectRoots(cfg, allRoots))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Root: item.Root, Path: item.Path, Meta: meta})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Meta.DeletedAt.After(entries[j].Meta.DeletedAt)
+	})
+	return entries, nil
+}
+
+// Page is one window of the items matching a ListFilter
+type Page struct {
+	Entries []Entry
+	Total   int // Matching items across all pages
+}
+
+// ListPage returns at most limit matching items, skipping the first offset,
+// in a stable order (by trash root, then trash path). The trash is streamed
+// rather than loaded, so only the entries of the page are held in memory,
+// however large the trash; Total still counts every match. A limit of zero
+// or more than maxPageSize is capped to maxPageSize.
+func ListPage(cfg *config.Config, offset, limit int, filter ListFilter) (*Page, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	page := &Page{}
+	for _, root := range selectRoots(cfg, filter.AllRoots) {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := visitTrash(root, func(path string) {
+			meta, err := trash.GetMetadata(path)
+			if err != nil || !filter.matches(meta) {
+				return
+			}
+			if page.Total >= offset && len(page.Entries) < limit {
+				page.Entries = append(page.Entries, Entry{Root: root, Path: path, Meta: meta})
+			}
+			page.Total++
+		}, func(string) {})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// matches reports whether the metadata of an item passes the filter
+func (f ListFilter) matches(meta *trash.Metadata) bool {
+	if f.Namespace != "" && meta.Namespace != f.Namespace {
+		return false
+	}
+	if f.PathPrefix != "" {
+		prefix := strings.TrimSuffix(f.PathPrefix, "/")
+		if meta.OriginalPath != prefix && !strings.HasPrefix(meta.OriginalPath, prefix+"/") {
+			return false
+		}
+	}
+	if !f.DeletedAfter.IsZero() && meta.DeletedAt.Before(f.DeletedAfter) {
+		return false
+	}
+	if !f.DeletedBefore.IsZero() && !meta.DeletedAt.Before(f.DeletedBefore) {
+		return false
+	}
+	return true
+}
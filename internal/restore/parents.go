@@ -0,0 +1,81 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Policies for the parent directories recreated by restore
+// (restore_parent_mode); any other value is an octal mode such as "0750"
+const (
+	ParentModeOriginal = "original" // The mode recorded when the item was trashed
+	ParentModeUmask    = "umask"    // 0777 less the umask, like mkdir -p
+)
+
+// defaultParentMode is used for recreated parents whose mode is unknown
+const defaultParentMode os.FileMode = 0700
+
+// makeParents creates the missing parent directories of path, top down.
+// modeOf returns the recorded mode of a directory, if known.
+func makeParents(cfg *config.Config, path string, modeOf func(dir string) (os.FileMode, bool)) error {
+	var missing []string
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+	}
+
+	policy := parentPolicy(cfg)
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		if policy == ParentModeUmask {
+			if err := os.Mkdir(dir, 0777); err != nil && !os.IsExist(err) {
+				return err
+			}
+			continue
+		}
+
+		mode := defaultParentMode
+		if policy == ParentModeOriginal {
+			if recorded, ok := modeOf(dir); ok {
+				// The owner must still be able to create what is restored inside
+				mode = recorded.Perm() | 0700
+			}
+		} else {
+			parsed, _ := strconv.ParseUint(policy, 8, 32)
+			mode = os.FileMode(parsed)
+		}
+		if err := os.Mkdir(dir, mode); err != nil && !os.IsExist(err) {
+			return err
+		}
+		// Mkdir applies the umask; the policy is meant exactly
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+		output.Debugf("created %s with mode %04o", dir, mode)
+	}
+	return nil
+}
+
+// parentPolicy returns the configured restore_parent_mode, defaulting to
+// original
+func parentPolicy(cfg *config.Config) string {
+	switch policy := cfg.RestoreParentMode; policy {
+	case ParentModeOriginal, ParentModeUmask:
+		return policy
+	case "":
+		return ParentModeOriginal
+	default:
+		if mode, err := strconv.ParseUint(policy, 8, 32); err != nil || mode > 0777 || mode&0700 != 0700 {
+			output.Warning("invalid restore_parent_mode '%s' (expected 'original', 'umask' or an octal mode with owner rwx), using '%s'",
+				policy, ParentModeOriginal)
+			return ParentModeOriginal
+		}
+		return policy
+	}
+}
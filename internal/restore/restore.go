@@ -1,215 +1,777 @@
 package restore
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/user/safe-rm/internal/audit"
 	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/sandbox"
 	"github.com/user/safe-rm/internal/trash"
 )
 
-// List displays all items in the trash
-func List(cfg *config.Config) error {
-	trashDir := cfg.GetTrashDir()
+// ListOptions controls how List selects and displays trash items
+type ListOptions struct {
+	AllRoots  bool   // Aggregate items across all known trash roots
+	TimeStyle string // iso, long-iso (default) or relative
+	JSON      bool   // Machine-readable output instead of a table
+}
 
-	if _, err := os.Stat(trashDir); os.IsNotExist(err) {
-		fmt.Println("Trash is empty.")
-		return nil
-	}
+// RestoreOptions controls how Restore locates the item to restore
+type RestoreOptions struct {
+	AllRoots    bool // Search all known trash roots, not just the configured one
+	Interactive bool // Items trashed on another host may be confirmed on the terminal
+}
+
+// PurgeOptions controls which trash roots Purge enforces retention on
+type PurgeOptions struct {
+	AllRoots bool // Purge all known trash roots, not just the configured one
+	JSON     bool // Print one JSON object per purged item
+}
 
-	items, err := findTrashItems(trashDir)
+// rootItem is a trashed item together with the trash root it was found in
+type rootItem struct {
+	Root  string
+	Path  string
+	Entry *trash.IndexEntry // From the trash index; nil in an XDG trash
+}
+
+// List displays all items in the trash
+func List(cfg *config.Config, opts ListOptions) error {
+	roots := selectRoots(cfg, opts.AllRoots)
+
+	items, err := findItems(cfg, roots)
 	if err != nil {
 		return err
 	}
 
+	if opts.JSON {
+		listJSON(items)
+		return nil
+	}
+
 	if len(items) == 0 {
 		fmt.Println("Trash is empty.")
 		return nil
 	}
 
-	fmt.Printf("Items in trash (%s):\n\n", trashDir)
-	fmt.Printf("%-30s %-50s %s\n", "DELETED AT", "ORIGINAL PATH", "TRASH PATH")
-	fmt.Println(strings.Repeat("-", 120))
+	if opts.AllRoots {
+		fmt.Printf("Items in %d trash root(s):\n\n", len(roots))
+		fmt.Printf("%-12s %-30s %-10s %-10s %-12s %-50s %-30s %s\n", "ID", "DELETED AT", "LEFT", "SIZE", "NAMESPACE", "ORIGINAL PATH", "TRASH", "TRASH PATH")
+		fmt.Println(strings.Repeat("-", 193))
+	} else {
+		if len(roots) > 1 {
+			fmt.Printf("Items in trash (%s, plus %d sibling trash(es)):\n\n", roots[0], len(roots)-1)
+		} else {
+			fmt.Printf("Items in trash (%s):\n\n", roots[0])
+		}
+		fmt.Printf("%-12s %-30s %-10s %-10s %-12s %-50s %s\n", "ID", "DELETED AT", "LEFT", "SIZE", "NAMESPACE", "ORIGINAL PATH", "TRASH PATH")
+		fmt.Println(strings.Repeat("-", 163))
+	}
 
 	for _, item := range items {
-		meta, err := trash.GetMetadata(item)
-		if err != nil {
-			// If no metadata, show what we can
-			fmt.Printf("%-30s %-50s %s\n", "unknown", "unknown", item)
-			continue
+		id, deletedAt, left, size, namespace, originalPath := "-", "unknown", "unknown", "unknown", "-", "unknown"
+		var notes []string
+		if meta, err := trash.GetMetadata(item.Path); err == nil {
+			id = meta.ID
+			deletedAt = output.FormatTime(meta.DeletedAt, opts.TimeStyle)
+			left = daysLeft(cfg, meta)
+			size = itemSize(meta)
+			if meta.Namespace != "" {
+				namespace = meta.Namespace
+			}
+			originalPath = meta.OriginalPath
+			notes = annotations(meta)
+		}
+		if opts.AllRoots {
+			fmt.Printf("%-12s %-30s %-10s %-10s %-12s %-50s %-30s %s\n", id, deletedAt, left, size, namespace, originalPath, item.Root, item.Path)
+		} else {
+			fmt.Printf("%-12s %-30s %-10s %-10s %-12s %-50s %s\n", id, deletedAt, left, size, namespace, originalPath, item.Path)
+		}
+		for _, note := range notes {
+			fmt.Printf("%-43s %s\n", "", note)
 		}
-		fmt.Printf("%-30s %-50s %s\n",
-			meta.DeletedAt.Format("2006-01-02 15:04:05"),
-			meta.OriginalPath,
-			item)
 	}
 
 	return nil
 }
 
-// Restore restores a file from trash to its original location
-func Restore(cfg *config.Config, originalPath string) error {
-	trashDir := cfg.GetTrashDir()
+// listJSON prints one JSON object per item; items without metadata only
+// have their trash path
+func listJSON(items []rootItem) {
+	for _, item := range items {
+		record := trash.Record{TrashPath: item.Path}
+		if meta, err := trash.GetMetadata(item.Path); err == nil {
+			record = trash.NewRecord(meta, item.Path)
+		}
+		output.Object(record)
+	}
+}
 
+// itemSize formats the size of a trashed item; directories show "pending"
+// until the background scan has measured them
+func itemSize(meta *trash.Metadata) string {
+	if !meta.Scanned {
+		return "pending"
+	}
+	return output.FormatBytes(meta.Size)
+}
+
+// Restore restores a file from trash to its original location
+func Restore(cfg *config.Config, originalPath string, opts RestoreOptions) error {
 	// Find the item in trash
-	items, err := findTrashItems(trashDir)
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
 	if err != nil {
 		return err
 	}
 
-	var matchedItem string
-	var matchedMeta *trash.Metadata
+	// The path may be given as restore_map restores it
+	if unmapped := cfg.UnmapRestorePath(originalPath); unmapped != originalPath {
+		if matchedItem, _ := findLatest(items, originalPath); matchedItem == "" {
+			originalPath = unmapped
+		}
+	}
+
+	matchedItem, meta := findLatest(items, originalPath)
+	if matchedItem == "" {
+		// The path may be inside a directory that was trashed as a whole
+		if src, parent, parentMeta := findWithin(items, originalPath); src != "" {
+			if err := checkHost(cfg, parentMeta, opts.Interactive); err != nil {
+				return err
+			}
+			return restoreWithin(cfg, originalPath, src, parent, parentMeta)
+		}
+		return fmt.Errorf("no item found in trash with original path: %s", originalPath)
+	}
+	if err := checkHost(cfg, meta, opts.Interactive); err != nil {
+		return err
+	}
+
+	// Check if destination exists
+	dest := cfg.MapRestorePath(originalPath)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("destination already exists: %s", dest)
+	}
+	return restoreItem(cfg, items, matchedItem, meta, dest)
+}
+
+// RestoreID restores the item with the given ID, or the one item whose ID
+// starts with it, to its original location
+func RestoreID(cfg *config.Config, id string, opts RestoreOptions) error {
+	items, matched, meta, err := matchID(cfg, id, opts)
+	if err != nil {
+		return err
+	}
+	if err := checkHost(cfg, meta, opts.Interactive); err != nil {
+		return err
+	}
+	dest := cfg.MapRestorePath(meta.OriginalPath)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("destination already exists: %s", dest)
+	}
+	return restoreItem(cfg, items, matched, meta, dest)
+}
+
+// checkHost lets the user confirm restoring an item trashed on another
+// host (e.g. in a home directory synced from an old machine), where its
+// original path may not mean the same thing. Without a terminal to ask on,
+// it is restored with a warning.
+func checkHost(cfg *config.Config, meta *trash.Metadata, interactive bool) error {
+	if meta.Hostname == "" || meta.Hostname == cfg.Host() {
+		return nil
+	}
+	if !interactive {
+		output.Warning("%s was trashed on host %s, not %s", meta.OriginalPath, meta.Hostname, cfg.Host())
+		return nil
+	}
+	answer := strings.ToLower(ask(fmt.Sprintf("%s was trashed on host %s, not %s. Restore it here? [y/N] ",
+		meta.OriginalPath, meta.Hostname, cfg.Host())))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("not restored: %s (to move the trash of %s to this host, use 'safe-rm migrate-host %s %s')",
+			meta.OriginalPath, meta.Hostname, meta.Hostname, cfg.Host())
+	}
+	return nil
+}
+
+// checkDevice refuses to restore an item deleted from a removable device to
+// dest on that device while it is not mounted where it was: the item would
+// land on the filesystem below the empty mount point. The error names the
+// device to reattach, by the label and UUID recorded when it was trashed.
+func checkDevice(meta *trash.Metadata, dest string) error {
+	dev := meta.Device
+	if dev == nil || !strings.HasPrefix(dest, dev.MountPoint+"/") {
+		return nil
+	}
+	switch mountPoint := trash.DeviceMount(dev); mountPoint {
+	case dev.MountPoint:
+		return nil
+	case "":
+		return fmt.Errorf("cannot restore %s: it was deleted from removable device %s, which is not mounted; reattach it at %s",
+			meta.OriginalPath, dev, dev.MountPoint)
+	default:
+		return fmt.Errorf("cannot restore %s: removable device %s is now mounted at %s, not %s; remount it, or add restore_map '%s: %s'",
+			meta.OriginalPath, dev, mountPoint, dev.MountPoint, dev.MountPoint, mountPoint)
+	}
+}
+
+// DeleteID permanently deletes the trashed item with the given ID, or the
+// one item whose ID starts with it
+func DeleteID(cfg *config.Config, id string, opts RestoreOptions) error {
+	_, matched, meta, err := matchID(cfg, id, opts)
+	if err != nil {
+		return err
+	}
+
+	receipt := trash.PurgeReceipt(cfg, matched, meta.OriginalPath, audit.MethodDelete)
+	if err := trash.Discard(matched); err != nil {
+		return fmt.Errorf("failed to delete %s: %v", meta.OriginalPath, err)
+	}
+	trash.CleanSibling(matched)
+	recordAudit(cfg, audit.Entry{Action: audit.ActionPurge, Path: meta.OriginalPath, TrashPath: matched, Receipt: receipt})
+	output.Printf("Deleted: %s\n", meta.OriginalPath)
+	return nil
+}
+
+// matchID returns the item with the given ID or an unambiguous prefix of
+// it, along with every item it was chosen from
+func matchID(cfg *config.Config, id string, opts RestoreOptions) ([]rootItem, string, *trash.Metadata, error) {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return nil, "", nil, err
+	}
 
+	matches, metas := findID(items, id)
+	switch len(matches) {
+	case 0:
+		return nil, "", nil, fmt.Errorf("no item found in trash with ID: %s", id)
+	case 1:
+		return items, matches[0], metas[0], nil
+	}
+	var candidates []string
+	for i := range matches {
+		candidates = append(candidates, fmt.Sprintf("  %s  %s (deleted at %s)",
+			metas[i].ID, metas[i].OriginalPath, metas[i].DeletedAt.Format("2006-01-02 15:04:05")))
+	}
+	return nil, "", nil, fmt.Errorf("ID %s is ambiguous; it matches %d items:\n%s", id, len(matches), strings.Join(candidates, "\n"))
+}
+
+// findID returns the items whose ID starts with prefix (ignoring case),
+// along with their metadata. An exact match wins over longer IDs.
+func findID(items []rootItem, prefix string) ([]string, []*trash.Metadata) {
+	prefix = strings.ToLower(prefix)
+	var matches []string
+	var metas []*trash.Metadata
 	for _, item := range items {
-		meta, err := trash.GetMetadata(item)
-		if err != nil {
+		if item.Entry != nil && item.Entry.ID != "" && !strings.HasPrefix(item.Entry.ID, prefix) {
+			continue
+		}
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil || !strings.HasPrefix(meta.ID, prefix) {
 			continue
 		}
+		if meta.ID == prefix {
+			return []string{item.Path}, []*trash.Metadata{meta}
+		}
+		matches = append(matches, item.Path)
+		metas = append(metas, meta)
+	}
+	return matches, metas
+}
 
-		if meta.OriginalPath == originalPath {
-			// If multiple matches, prefer the most recent
-			if matchedMeta == nil || meta.DeletedAt.After(matchedMeta.DeletedAt) {
-				matchedItem = item
-				matchedMeta = meta
+// restoreItem moves the trashed item back to dest, which is its original
+// path unless restore_map moved it or a batch restore renamed it
+func restoreItem(cfg *config.Config, items []rootItem, matchedItem string, meta *trash.Metadata, dest string) error {
+	originalPath := meta.OriginalPath
+	if err := checkDevice(meta, dest); err != nil {
+		return err
+	}
+
+	// Create parent directories if needed, with the modes they had (where
+	// restore_map moved them, the modes of the directories they replace)
+	modeOf := func(dir string) (os.FileMode, bool) {
+		mode, ok := meta.ParentModes[cfg.UnmapRestorePath(dir)]
+		return mode, ok
+	}
+	if err := makeParents(cfg, dest, modeOf); err != nil {
+		return fmt.Errorf("failed to create parent directory: %v", err)
+	}
+
+	var size int64
+	if output.Level() >= output.LevelVerbose {
+		size, _ = trash.Size(matchedItem)
+	}
+	start := time.Now()
+
+	// Lock the item so that a concurrent purge cannot delete it while it is
+	// being moved back; it may already be gone by the time the lock is held
+	unlock, err := trash.LockItem(matchedItem)
+	if err != nil {
+		return fmt.Errorf("cannot restore %s: %v", originalPath, err)
+	}
+	defer unlock()
+	if trash.NeedsSnapshot(matchedItem, meta) {
+		// The payload is damaged or gone; the metadata holds a copy
+		output.Warning("%s is missing or damaged in the trash, restoring its inline snapshot", originalPath)
+		if err := trash.RestoreSnapshot(meta, dest); err != nil {
+			return fmt.Errorf("failed to restore: %v", err)
+		}
+		os.RemoveAll(matchedItem)
+	} else {
+		if _, err := os.Lstat(matchedItem); err != nil {
+			return fmt.Errorf("cannot restore %s: it was purged meanwhile", originalPath)
+		}
+
+		// A read-only item gets its modes back before it leaves the trash
+		sealed := meta.ReadOnly
+		if err := trash.Unseal(matchedItem, meta); err != nil {
+			return fmt.Errorf("failed to restore the modes of %s: %v", originalPath, err)
+		}
+
+		// Move the item back, copying it if the trash is on another filesystem
+		var cleanup *trash.CleanupError
+		if err := trash.MoveBack(cfg, matchedItem, dest); errors.As(err, &cleanup) {
+			// Restored; only the copy in the trash is left over
+			output.Warning("restored %s, but %s is left in the trash: %v", dest, matchedItem, cleanup.Err)
+		} else if err != nil {
+			if sealed {
+				trash.Seal(matchedItem, meta)
 			}
+			return fmt.Errorf("failed to restore: %v", err)
 		}
 	}
+	if err := trash.RestoreAttrs(meta, dest); err != nil {
+		output.Warning("cannot restore the owner and mode of %s: %v", dest, err)
+	}
+	elapsed := time.Since(start)
 
-	if matchedItem == "" {
-		return fmt.Errorf("no item found in trash with original path: %s", originalPath)
+	// Remove metadata file
+	trash.RemoveSidecars(matchedItem)
+	trash.CleanSibling(matchedItem)
+	if _, meta := findLatest(items, originalPath); meta == nil {
+		trash.ForgetRecent(originalPath)
 	}
 
-	// Check if destination exists
-	if _, err := os.Stat(originalPath); err == nil {
-		return fmt.Errorf("destination already exists: %s", originalPath)
+	recordAudit(cfg, audit.Entry{
+		Action:     audit.ActionRestore,
+		Path:       dest,
+		TrashPath:  matchedItem,
+		Bytes:      size,
+		DurationMs: elapsed.Milliseconds(),
+	})
+
+	output.Printf("Restored: %s -> %s\n", matchedItem, dest)
+	output.Verbosef("%s (%s)\n", output.FormatBytes(size), output.FormatThroughput(size, elapsed))
+	return nil
+}
+
+// restoreWithin copies src, located inside the trashed directory parent,
+// back to originalPath, or where restore_map moves it. The trashed directory
+// itself stays in the trash.
+func restoreWithin(cfg *config.Config, originalPath, src, parent string, meta *trash.Metadata) error {
+	dest := cfg.MapRestorePath(originalPath)
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("destination already exists: %s", dest)
+	}
+	if err := checkDevice(meta, dest); err != nil {
+		return err
 	}
 
-	// Create parent directory if needed
-	parentDir := filepath.Dir(originalPath)
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
+	// Directories inside the trashed one take their mode from the trash
+	modeOf := func(dir string) (os.FileMode, bool) {
+		dir = cfg.UnmapRestorePath(dir)
+		if rel, err := filepath.Rel(meta.OriginalPath, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			if info, err := os.Stat(filepath.Join(parent, rel)); err == nil {
+				return info.Mode().Perm(), true
+			}
+		}
+		mode, ok := meta.ParentModes[dir]
+		return mode, ok
+	}
+	if err := makeParents(cfg, dest, modeOf); err != nil {
 		return fmt.Errorf("failed to create parent directory: %v", err)
 	}
 
-	// Move the item back
-	if err := os.Rename(matchedItem, originalPath); err != nil {
-		return fmt.Errorf("failed to restore: %v", err)
+	unlock, err := trash.LockItem(parent)
+	if err != nil {
+		return fmt.Errorf("cannot restore %s: %v", originalPath, err)
+	}
+	defer unlock()
+	if _, err := os.Lstat(src); err != nil {
+		return fmt.Errorf("cannot restore %s: it was purged meanwhile", originalPath)
 	}
 
-	// Remove metadata file
-	metadataPath := matchedItem + ".saferm-meta"
-	os.Remove(metadataPath) // Ignore error
+	start := time.Now()
+	if err := trash.Extract(cfg, src, dest); err != nil {
+		os.RemoveAll(dest)
+		return fmt.Errorf("failed to restore: %v", err)
+	}
+	rel, _ := filepath.Rel(parent, src)
+	if err := trash.UnsealCopy(parent, meta, rel, dest); err != nil {
+		output.Warning("cannot restore the modes of %s: %v", dest, err)
+	}
+	elapsed := time.Since(start)
+	size, _ := trash.Size(dest)
+
+	recordAudit(cfg, audit.Entry{
+		Action:     audit.ActionRestore,
+		Path:       dest,
+		TrashPath:  src,
+		Bytes:      size,
+		DurationMs: elapsed.Milliseconds(),
+	})
 
-	fmt.Printf("Restored: %s -> %s\n", matchedItem, originalPath)
+	output.Printf("Restored: %s -> %s\n", src, dest)
+	output.Printf("The rest of %s remains in the trash.\n", meta.OriginalPath)
+	output.Verbosef("%s (%s)\n", output.FormatBytes(size), output.FormatThroughput(size, elapsed))
 	return nil
 }
 
-// Purge removes items older than the specified number of days
-func Purge(cfg *config.Config, days int) error {
-	trashDir := cfg.GetTrashDir()
+// Purge removes items older than the specified number of days, or with
+// days 0, the items whose retention (per namespace) has expired
+func Purge(cfg *config.Config, days int, opts PurgeOptions) error {
+	roots := selectRoots(cfg, opts.AllRoots)
 
-	if _, err := os.Stat(trashDir); os.IsNotExist(err) {
-		fmt.Println("Trash is empty, nothing to purge.")
-		return nil
+	if len(roots) == 1 {
+		if _, err := os.Stat(roots[0]); os.IsNotExist(err) {
+			output.Printf("Trash is empty, nothing to purge.\n")
+			return nil
+		}
+	}
+	for _, root := range roots {
+		if err := trash.ValidateRoot(cfg, root); err != nil {
+			return err
+		}
+	}
+	if err := confine(cfg, roots); err != nil {
+		return err
 	}
 
-	items, err := findTrashItems(trashDir)
+	rootItems, err := findItems(cfg, roots)
 	if err != nil {
 		return err
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -days)
-	purged := 0
+	// An explicit age applies to every item; otherwise each item expires
+	// under the retention of its namespace, and items without metadata
+	// under retention_days
+	ageDays := days
+	if ageDays <= 0 {
+		ageDays = cfg.RetentionDays
+	}
+	cutoff := cfg.Now().AddDate(0, 0, -ageDays)
+	expired := func(meta *trash.Metadata) bool {
+		if days > 0 {
+			return meta.DeletedAt.Before(cutoff)
+		}
+		expiry, ok := Expiry(cfg, meta)
+		return ok && !cfg.Now().Before(expiry)
+	}
 
-	for _, item := range items {
+	purged := 0
+	var freed int64 // Known sizes only; directories not yet scanned count as 0
+	var toArchive []string
+	metas := map[string]*trash.Metadata{}
+
+	for _, rootItem := range rootItems {
+		// The index tells which items cannot have expired without opening
+		// their metadata
+		if entry := rootItem.Entry; entry != nil && !mayExpire(cfg, days, cutoff, entry) {
+			continue
+		}
+		item := rootItem.Path
 		meta, err := trash.GetMetadata(item)
 		if err != nil {
 			// If no metadata, check file modification time
 			info, err := os.Stat(item)
-			if err != nil {
+			if err != nil || ageDays <= 0 {
 				continue
 			}
 			if info.ModTime().Before(cutoff) {
-				if err := os.RemoveAll(item); err == nil {
+				receipt := trash.PurgeReceipt(cfg, item, item, trash.DiscardMethod(cfg))
+				if err := trash.DiscardItem(cfg, item); err == nil {
 					purged++
-					fmt.Printf("Purged: %s\n", item)
+					recordAudit(cfg, audit.Entry{Action: audit.ActionPurge, TrashPath: item, Receipt: receipt})
+					output.Printf("Purged: %s\n", item)
+					if opts.JSON {
+						output.Object(trash.Record{TrashPath: item, Action: audit.ActionPurge})
+					}
 				}
 			}
 			continue
 		}
 
-		if meta.DeletedAt.Before(cutoff) {
-			if err := os.RemoveAll(item); err == nil {
-				os.Remove(item + ".saferm-meta")
-				purged++
-				fmt.Printf("Purged: %s (deleted at %s)\n", meta.OriginalPath, meta.DeletedAt.Format("2006-01-02"))
-			}
+		if meta.Pinned {
+			continue
+		}
+		// Even an explicit --purge-days keeps important items
+		if isImportant(cfg, meta) {
+			output.Verbosef("Kept: %s (matches important_patterns)\n", meta.OriginalPath)
+			continue
+		}
+
+		if !expired(meta) {
+			continue
+		}
+		if cfg.RetentionClassFor(meta.Namespace) == ClassArchive {
+			toArchive = append(toArchive, item)
+			metas[item] = meta
+			continue
+		}
+		receipt := trash.PurgeReceipt(cfg, item, meta.OriginalPath, trash.DiscardMethod(cfg))
+		if err := trash.DiscardItem(cfg, item); err == nil {
+			trash.CleanSibling(item)
+			purged++
+			freed += meta.Size
+			recordAudit(cfg, audit.Entry{Action: audit.ActionPurge, Path: meta.OriginalPath, TrashPath: item, Receipt: receipt})
+			output.Printf("Purged: %s (deleted at %s)\n", meta.OriginalPath, meta.DeletedAt.Format("2006-01-02"))
+			purgeRecord(opts, meta, item, audit.ActionPurge)
+		} else if errors.Is(err, trash.ErrBusy) {
+			output.Verbosef("Skipped: %s (being restored)\n", meta.OriginalPath)
 		}
 	}
 
-	if purged == 0 {
-		fmt.Printf("No items older than %d days found.\n", days)
-	} else {
-		fmt.Printf("\nPurged %d item(s).\n", purged)
+	// Archived items are only deleted once their pack is safely written
+	archived, err := archiveItems(cfg, toArchive, metas)
+	if err != nil {
+		output.Warning("failed to archive %d item(s), keeping them in the trash: %v", len(toArchive), err)
+	}
+	for _, item := range archived {
+		meta := metas[item]
+		if err := trash.DiscardItem(cfg, item); err == nil {
+			trash.CleanSibling(item)
+			purged++
+			freed += meta.Size
+			recordAudit(cfg, audit.Entry{Action: audit.ActionArchive, Path: meta.OriginalPath, TrashPath: item})
+			output.Verbosef("Archived: %s (deleted at %s)\n", meta.OriginalPath, meta.DeletedAt.Format("2006-01-02"))
+			purgeRecord(opts, meta, item, audit.ActionArchive)
+		}
+	}
+	pruneArchive(cfg)
+	removeTombstones(roots)
+
+	switch {
+	case purged > 0:
+		output.Printf("Purged %d item(s), %s freed.\n", purged, output.FormatBytes(freed))
+	case days > 0:
+		output.Printf("No items older than %d days found.\n", days)
+	default:
+		output.Printf("No expired items found.\n")
 	}
 
 	return nil
 }
 
-// Empty permanently deletes all items in the trash
+// purgeRecord prints the JSON object of a purged item with --json
+func purgeRecord(opts PurgeOptions, meta *trash.Metadata, trashPath, action string) {
+	if !opts.JSON {
+		return
+	}
+	record := trash.NewRecord(meta, trashPath)
+	record.Action = action
+	output.Object(record)
+}
+
+// mayExpire reports whether the indexed item may have expired: pinned and
+// important items are left to the metadata
+func mayExpire(cfg *config.Config, days int, cutoff time.Time, entry *trash.IndexEntry) bool {
+	if days > 0 {
+		return entry.DeletedAt.Before(cutoff)
+	}
+	retention := cfg.RetentionFor(entry.Namespace)
+	return retention > 0 && !cfg.Now().Before(entry.DeletedAt.AddDate(0, 0, retention))
+}
+
+// emptyLargest is how many of the largest items Empty shows before asking
+const emptyLargest = 5
+
+// Empty permanently deletes all items in the trash, after showing where the
+// trash is, how much it holds and its largest items, and having the number
+// of items typed back as confirmation
 func Empty(cfg *config.Config) error {
 	trashDir := cfg.GetTrashDir()
 
 	if _, err := os.Stat(trashDir); os.IsNotExist(err) {
-		fmt.Println("Trash is already empty.")
+		output.Printf("Trash is already empty.\n")
 		return nil
 	}
+	if err := trash.ValidateRoot(cfg, trashDir); err != nil {
+		return err
+	}
 
-	items, err := findTrashItems(trashDir)
+	rootItems, err := findItems(cfg, []string{trashDir})
 	if err != nil {
 		return err
 	}
+	var items []string
+	for _, item := range rootItems {
+		items = append(items, item.Path)
+	}
 
 	if len(items) == 0 {
-		fmt.Println("Trash is already empty.")
+		output.Printf("Trash is already empty.\n")
 		return nil
 	}
 
 	// Require confirmation
-	fmt.Printf("WARNING: This will PERMANENTLY DELETE %d item(s) from trash!\n", len(items))
+	var total int64
+	unscanned, important := 0, 0
+	var metas []*trash.Metadata
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item)
+		if err != nil {
+			continue
+		}
+		metas = append(metas, meta)
+		total += meta.Size
+		if !meta.Scanned {
+			unscanned++
+		}
+		if isImportant(cfg, meta) {
+			important++
+		}
+	}
+	size := output.FormatBytes(total)
+	if unscanned > 0 {
+		size = "at least " + size
+	}
+	resolved, err := filepath.EvalSymlinks(trashDir)
+	if err != nil {
+		resolved = trashDir
+	}
+	if cfg.Namespace != "" {
+		fmt.Printf("WARNING: This will PERMANENTLY DELETE %d item(s) (%s) of namespace '%s' from the trash in %s!\n", len(items), size, cfg.Namespace, resolved)
+	} else {
+		fmt.Printf("WARNING: This will PERMANENTLY DELETE %d item(s) (%s) from the trash in %s!\n", len(items), size, resolved)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Size > metas[j].Size })
+	if len(metas) > emptyLargest {
+		metas = metas[:emptyLargest]
+	}
+	fmt.Printf("Largest:\n")
+	for _, meta := range metas {
+		fmt.Printf("  %9s  %s\n", itemSize(meta), meta.OriginalPath)
+	}
+	if important > 0 {
+		fmt.Printf("%d of them match important_patterns and are otherwise never purged.\n", important)
+	}
 	fmt.Printf("This action cannot be undone.\n")
-	fmt.Printf("Type 'yes I am sure' to confirm: ")
-
-	var response string
-	fmt.Scanln(&response)
-	if response != "yes I am sure" {
+	if ask(fmt.Sprintf("Type the number of items (%d) to confirm: ", len(items))) != strconv.Itoa(len(items)) {
 		fmt.Println("Aborted.")
 		return nil
 	}
+	if err := confine(cfg, []string{trashDir}); err != nil {
+		return err
+	}
 
 	// Delete all items
 	deleted := 0
 	for _, item := range items {
-		if err := os.RemoveAll(item); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", item, err)
+		entry := audit.Entry{Action: audit.ActionEmpty, TrashPath: item}
+		if meta, err := trash.GetMetadata(item); err == nil {
+			entry.Path = meta.OriginalPath
+		}
+		entry.Receipt = trash.PurgeReceipt(cfg, item, entry.Path, trash.DiscardMethod(cfg))
+
+		if err := trash.DiscardItem(cfg, item); err != nil {
+			output.Warning("failed to delete %s: %v", item, err)
 			continue
 		}
-		// Also remove metadata file
-		os.Remove(item + ".saferm-meta")
 		deleted++
+		recordAudit(cfg, entry)
 	}
 
-	// Clean up empty directories in trash
+	// Clean up interrupted purges and empty directories in trash
+	removeTombstones([]string{trashDir})
 	cleanEmptyDirs(trashDir)
 
-	fmt.Printf("\nPermanently deleted %d item(s).\n", deleted)
+	output.Printf("Permanently deleted %d item(s).\n", deleted)
+	return nil
+}
+
+// confine restricts the process before items are destroyed, with
+// sandbox_purge: from then on it can only change files in roots, the state
+// directory (audit log, indexes), the archive directory and the extra
+// paths. Nothing is destroyed if the sandbox cannot be set up.
+func confine(cfg *config.Config, roots []string, extra ...string) error {
+	if !cfg.SandboxPurge {
+		return nil
+	}
+	if err := os.MkdirAll(config.StateDir(), trash.DirMode); err != nil {
+		return err
+	}
+	writable := []string{config.StateDir(), os.DevNull}
+	if keyDir := filepath.Dir(audit.ReceiptKeyPath(cfg)); keyDir != config.StateDir() {
+		writable = append(writable, keyDir)
+	}
+	writable = append(writable, roots...)
+	if usesArchive(cfg) {
+		if err := os.MkdirAll(cfg.ArchiveDir, trash.DirMode); err != nil {
+			return err
+		}
+		writable = append(writable, cfg.ArchiveDir)
+	}
+	writable = append(writable, extra...)
+
+	if err := sandbox.Confine(writable); err != nil {
+		return fmt.Errorf("sandbox_purge: cannot confine the process, nothing was destroyed: %v", err)
+	}
+	output.Debugf("confined to changing %s", strings.Join(writable, ", "))
+	return nil
+}
+
+// usesArchive reports whether any namespace archives expired items
+func usesArchive(cfg *config.Config) bool {
+	if cfg.RetentionClass == ClassArchive {
+		return true
+	}
+	for _, ns := range cfg.Namespaces {
+		if ns.RetentionClass == ClassArchive {
+			return true
+		}
+	}
+	return false
+}
+
+// ListRoots displays all known trash roots with their source and item count
+func ListRoots(cfg *config.Config) error {
+	fmt.Printf("%-12s %-8s %s\n", "SOURCE", "ITEMS", "PATH")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, root := range trash.RootSources(cfg) {
+		count := "-"
+		if _, err := os.Stat(root.Path); err == nil {
+			items, err := findTrashItems(root.Path)
+			if err != nil {
+				return err
+			}
+			count = fmt.Sprintf("%d", len(items))
+		}
+		fmt.Printf("%-12s %-8s %s\n", root.Source, count, root.Path)
+	}
+
 	return nil
 }
 
-// cleanEmptyDirs removes empty directories in the trash
+// recordAudit appends an entry to the audit log, warning on failure
+func recordAudit(cfg *config.Config, entry audit.Entry) {
+	if err := audit.Record(cfg, entry); err != nil {
+		output.Warning("failed to write audit log: %v", err)
+	}
+}
+
+// cleanEmptyDirs removes empty directories in the trash. An XDG trash has
+// none of its own, only items.
 func cleanEmptyDirs(dir string) {
+	if trash.IsXDGTrash(dir) {
+		return
+	}
 	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || !info.IsDir() || path == dir {
 			return nil
@@ -222,46 +784,162 @@ func cleanEmptyDirs(dir string) {
 	})
 }
 
-// findTrashItems finds all trashed items (files without .saferm-meta extension)
-func findTrashItems(trashDir string) ([]string, error) {
-	var items []string
+// removeTombstones finishes purges that were interrupted after the item was
+// renamed to its tombstone
+func removeTombstones(roots []string) {
+	for _, root := range roots {
+		_, tombstones, _ := walkTrash(root)
+		for _, tombstone := range tombstones {
+			if err := trash.RemoveTombstone(tombstone); err != nil {
+				output.Debugf("failed to remove %s: %v", tombstone, err)
+			}
+		}
+	}
+}
+
+// findLatest returns the most recently deleted item with the given original
+// path, or "" if there is none
+func findLatest(items []rootItem, originalPath string) (string, *trash.Metadata) {
+	var matchedItem string
+	var matchedMeta *trash.Metadata
 
-	err := filepath.Walk(trashDir, func(path string, info os.FileInfo, err error) error {
+	for _, item := range items {
+		if item.Entry != nil && item.Entry.OriginalPath != originalPath {
+			continue
+		}
+		meta, err := trash.GetMetadata(item.Path)
 		if err != nil {
-			return nil // Skip errors
+			continue
 		}
 
-		// Skip metadata files
-		if strings.HasSuffix(path, ".saferm-meta") {
-			return nil
+		if meta.OriginalPath == originalPath {
+			// If multiple matches, prefer the most recent
+			if matchedMeta == nil || meta.DeletedAt.After(matchedMeta.DeletedAt) {
+				matchedItem = item.Path
+				matchedMeta = meta
+			}
 		}
+	}
 
-		// Skip the root trash directory itself
-		if path == trashDir {
-			return nil
+	return matchedItem, matchedMeta
+}
+
+// findWithin locates originalPath inside the most recently trashed directory
+// that contained it, returning its location in the trash along with the
+// trashed directory and its metadata, or "" if no trashed directory
+// contains it
+func findWithin(items []rootItem, originalPath string) (string, string, *trash.Metadata) {
+	var src, parent string
+	var latest *trash.Metadata
+
+	for _, item := range items {
+		if item.Entry != nil && !strings.HasPrefix(originalPath, item.Entry.OriginalPath+"/") {
+			continue
+		}
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil || !meta.IsDirectory {
+			continue
 		}
+		rel, err := filepath.Rel(meta.OriginalPath, originalPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		candidate := filepath.Join(item.Path, rel)
+		if _, err := os.Lstat(candidate); err != nil {
+			continue
+		}
+		if latest == nil || meta.DeletedAt.After(latest.DeletedAt) {
+			src, parent, latest = candidate, item.Path, meta
+		}
+	}
 
-		// Skip directories that contain other items (we only want leaf items)
-		if info.IsDir() {
-			entries, err := os.ReadDir(path)
-			if err != nil {
-				return nil
-			}
-			// If directory has entries, skip it (we'll get the contents)
-			for _, entry := range entries {
-				if !strings.HasSuffix(entry.Name(), ".saferm-meta") {
-					return nil
-				}
-			}
+	return src, parent, latest
+}
+
+// selectRoots returns the trash roots to operate on. Sibling trashes and the
+// per-mount trashes of cross_device mount hold items that would otherwise be
+// in the configured trash, so they are always included.
+func selectRoots(cfg *config.Config, allRoots bool) []string {
+	if allRoots {
+		return trash.Roots(cfg)
+	}
+	roots := []string{cfg.GetTrashDir()}
+	for _, root := range trash.SiblingTrashes() {
+		if root != cfg.GetTrashDir() {
+			roots = append(roots, root)
 		}
+	}
+	return append(roots, trash.MountTrashes(cfg)...)
+}
 
-		// Check if there's a metadata file for this item
-		if _, err := os.Stat(path + ".saferm-meta"); err == nil {
-			items = append(items, path)
+// findRootItems finds all trashed items in the given roots, skipping roots
+// that do not exist
+func findRootItems(roots []string) ([]rootItem, error) {
+	var items []rootItem
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := trash.VisitTrash(root, func(path string, entry *trash.IndexEntry) {
+			items = append(items, rootItem{Root: root, Path: path, Entry: entry})
+		}, func(string) {})
+		if err != nil {
+			return nil, err
 		}
+	}
+	return items, nil
+}
 
-		return nil
-	})
+// findItems finds the trashed items in roots that belong to the selected
+// namespace, or all items when no namespace is selected. It fails if one of
+// the roots is not marked as a trash (see trash.CheckRoot).
+func findItems(cfg *config.Config, roots []string) ([]rootItem, error) {
+	for _, root := range roots {
+		if err := trash.CheckRoot(cfg, root); err != nil {
+			return nil, err
+		}
+	}
+	items, err := findRootItems(roots)
+	if err != nil || cfg.Namespace == "" {
+		return items, err
+	}
+
+	var selected []rootItem
+	for _, item := range items {
+		if item.Entry != nil {
+			if item.Entry.Namespace == cfg.Namespace {
+				selected = append(selected, item)
+			}
+		} else if meta, err := trash.GetMetadata(item.Path); err == nil && meta.Namespace == cfg.Namespace {
+			selected = append(selected, item)
+		}
+	}
+	return selected, nil
+}
 
+// findTrashItems finds all trashed items: files and directories with a
+// .saferm-meta file next to them. Trashed directories are not descended into.
+func findTrashItems(trashDir string) ([]string, error) {
+	items, _, err := walkTrash(trashDir)
 	return items, err
 }
+
+// walkTrash returns the trashed items of a trash directory along with the
+// tombstones of items whose purge was interrupted
+func walkTrash(trashDir string) ([]string, []string, error) {
+	var items, tombstones []string
+	err := visitTrash(trashDir, func(path string) {
+		items = append(items, path)
+	}, func(path string) {
+		tombstones = append(tombstones, path)
+	})
+	return items, tombstones, err
+}
+
+// visitTrash visits a trash directory in lexical order, calling item for
+// each trashed item and tombstone for each tombstone, without collecting them
+func visitTrash(trashDir string, item, tombstone func(path string)) error {
+	return trash.VisitTrash(trashDir, func(path string, _ *trash.IndexEntry) {
+		item(path)
+	}, tombstone)
+}
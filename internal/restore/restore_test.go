@@ -0,0 +1,2453 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/sandbox"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+func TestRestoreDashNamedFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		TrashDir: filepath.Join(tempDir, "trash"),
+	}
+
+	for _, name := range []string{"-f", "--safe-empty", "-rf"} {
+		t.Run(name, func(t *testing.T) {
+			original := filepath.Join(tempDir, name)
+			if err := os.WriteFile(original, []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := trash.Move(cfg, original); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if _, err := os.Stat(original); !os.IsNotExist(err) {
+				t.Fatal("original file should not exist after Move()")
+			}
+
+			if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+
+			data, err := os.ReadFile(original)
+			if err != nil {
+				t.Fatalf("restored file should exist: %v", err)
+			}
+			if string(data) != name {
+				t.Errorf("restored content = %q, want %q", data, name)
+			}
+		})
+	}
+}
+
+func TestRestoreID(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	original := filepath.Join(tempDir, "notes.txt")
+
+	// The same path trashed twice, under IDs sharing a prefix
+	var trashPaths []string
+	for i, id := range []string{"abc111", "abc222"} {
+		if err := os.WriteFile(original, []byte(id), 0644); err != nil {
+			t.Fatal(err)
+		}
+		trashPath, err := trash.Move(cfg, original)
+		if err != nil {
+			t.Fatalf("Move() #%d error = %v", i, err)
+		}
+		meta, err := trash.GetMetadata(trashPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(meta.ID) != 12 {
+			t.Errorf("ID = %q, want 12 hex digits", meta.ID)
+		}
+		meta.ID = id
+		if err := trash.UpdateMetadata(trashPath, meta); err != nil {
+			t.Fatal(err)
+		}
+		trashPaths = append(trashPaths, trashPath)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		wantErr string
+	}{
+		{"unknown", "fff", "no item found"},
+		{"ambiguous", "abc", "ambiguous"},
+		{"unique prefix", "ABC1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RestoreID(cfg, tt.id, RestoreOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RestoreID(%s) error = %v, want %q", tt.id, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreID(%s) error = %v", tt.id, err)
+			}
+		})
+	}
+
+	// The older of the two, not the latest, was restored
+	if data, err := os.ReadFile(original); err != nil || string(data) != "abc111" {
+		t.Errorf("restored content = %q, %v, want abc111", data, err)
+	}
+	if _, err := os.Lstat(trashPaths[1]); err != nil {
+		t.Errorf("the other item left the trash: %v", err)
+	}
+
+	// DeleteID removes the other one for good
+	if err := DeleteID(cfg, "abc2", RestoreOptions{}); err != nil {
+		t.Fatalf("DeleteID() error = %v", err)
+	}
+	if _, err := os.Lstat(trashPaths[1]); !os.IsNotExist(err) {
+		t.Errorf("deleted item still in the trash: %v", err)
+	}
+	if err := RestoreID(cfg, "abc2", RestoreOptions{}); err == nil {
+		t.Error("RestoreID() found a deleted item")
+	}
+
+	// Metadata without an ID, from older releases, gets a stable one
+	legacy := filepath.Join(cfg.TrashDir, "legacy.txt")
+	if err := os.WriteFile(legacy, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy+".saferm-meta", []byte(`{"original_path": "/legacy.txt"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	first, err := trash.GetMetadata(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := trash.GetMetadata(legacy)
+	if err != nil || first.ID == "" || first.ID != second.ID {
+		t.Errorf("legacy IDs = %q and %q, want the same non-empty ID", first.ID, second.ID)
+	}
+}
+
+func TestRestoreAllRoots(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	projectTrash := filepath.Join(tempDir, "project-trash")
+	original := filepath.Join(tempDir, "notes.txt")
+	if err := os.WriteFile(original, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trash.Move(&config.Config{TrashDir: projectTrash}, original); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	cfg := &config.Config{
+		TrashDir:   filepath.Join(tempDir, "trash"),
+		TrashRoots: []string{projectTrash},
+	}
+
+	if err := Restore(cfg, original, RestoreOptions{}); err == nil {
+		t.Fatal("Restore() should not find items outside the configured trash without AllRoots")
+	}
+	if err := Restore(cfg, original, RestoreOptions{AllRoots: true}); err != nil {
+		t.Fatalf("Restore() with AllRoots error = %v", err)
+	}
+	if _, err := os.Stat(original); err != nil {
+		t.Errorf("restored file should exist: %v", err)
+	}
+}
+
+func TestRestoreSiblingLayout(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{
+		TrashDir:    filepath.Join(tempDir, "trash"),
+		TrashLayout: trash.LayoutSibling,
+	}
+
+	original := filepath.Join(tempDir, "project", "main.go")
+	if err := os.MkdirAll(filepath.Dir(original), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(original, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trash.Move(cfg, original); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	// The sibling trash is found through the index without --all-trashes
+	if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(original); err != nil {
+		t.Errorf("Restored file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "project", trash.SiblingDirName)); !os.IsNotExist(err) {
+		t.Error("Empty sibling trash should be removed after restoring")
+	}
+}
+
+func TestRestoreXDG(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_DATA_HOME")
+	os.Setenv("XDG_DATA_HOME", filepath.Join(tempDir, "data"))
+	defer os.Setenv("XDG_DATA_HOME", oldXDG)
+
+	cfg := &config.Config{TrashBackend: trash.BackendXDG, RetentionDays: 30}
+	trashDir := cfg.GetTrashDir()
+	ours := filepath.Join(tempDir, "ours.txt")
+	trashPath := trashAged(t, cfg, ours, 40*24*time.Hour)
+
+	// An item trashed by a file manager
+	theirs := filepath.Join(tempDir, "theirs.txt")
+	if err := os.WriteFile(filepath.Join(trashDir, "files", "theirs.txt"), []byte("theirs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := "[Trash Info]\nPath=" + theirs + "\nDeletionDate=" + time.Now().Format("2006-01-02T15:04:05") + "\n"
+	if err := os.WriteFile(filepath.Join(trashDir, "info", "theirs.txt.trashinfo"), []byte(info), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(cfg, theirs, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() of a file manager item error = %v", err)
+	}
+	if data, err := os.ReadFile(theirs); err != nil || string(data) != "theirs" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, "info", "theirs.txt.trashinfo")); !os.IsNotExist(err) {
+		t.Error("restore should remove the .trashinfo")
+	}
+
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(trashDir, "info"))
+	if _, err := os.Lstat(trashPath); !os.IsNotExist(err) || len(entries) != 0 {
+		t.Errorf("expired item should be purged with its .trashinfo and metadata, info holds %d entries", len(entries))
+	}
+	for _, sub := range []string{"files", "info"} {
+		if _, err := os.Stat(filepath.Join(trashDir, sub)); err != nil {
+			t.Errorf("purge should keep the %s directory: %v", sub, err)
+		}
+	}
+}
+
+func TestRestoreCrossDevice(t *testing.T) {
+	// Needs the trash and the original location on different filesystems
+	trashDir, err := os.MkdirTemp("/dev/shm", "saferm-restore-test-*")
+	if err != nil {
+		t.Skip("no second filesystem available:", err)
+	}
+	defer os.RemoveAll(trashDir)
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var a, b syscall.Stat_t
+	if syscall.Stat(trashDir, &a) != nil || syscall.Stat(tempDir, &b) != nil || a.Dev == b.Dev {
+		t.Skip("/dev/shm is on the same filesystem as", tempDir)
+	}
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: trashDir}
+	original := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(original, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(original, "src", "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashPath, err := trash.Move(cfg, original)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	cfg.CrossDevice = trash.CrossDeviceFail
+	if err := Restore(cfg, original, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "different filesystem") {
+		t.Fatalf("Restore() with cross_device fail error = %v", err)
+	}
+	if _, err := os.Stat(trashPath); err != nil {
+		t.Fatalf("item should stay in the trash: %v", err)
+	}
+
+	cfg.CrossDevice = trash.CrossDeviceCopy
+	if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(original, "src", "main.go")); err != nil || string(data) != "package main" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	for _, path := range []string{trashPath, trashPath + ".saferm-meta", original + trash.PartialSuffix} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist after restoring", path)
+		}
+	}
+}
+
+func TestRestorePartialNamed(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	// A download manager's temp file is an item like any other, also when
+	// the trash is walked without its index
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	original := filepath.Join(tempDir, "video.partial")
+	if err := os.WriteFile(original, []byte("frames"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashPath, err := trash.Move(cfg, original)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		items, err := findTrashItems(cfg.TrashDir)
+		if err != nil || len(items) != 1 || items[0] != trashPath {
+			t.Fatalf("findTrashItems() = %v, %v, want [%s]", items, err, trashPath)
+		}
+		// Rebuilt by walking the trash
+		if err := os.Remove(filepath.Join(cfg.TrashDir, trash.IndexFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if data, err := os.ReadFile(original); err != nil || string(data) != "frames" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+}
+
+func TestRestoreInlineSnapshot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), InlineSnapshotSize: 64 * 1024}
+	tests := []struct {
+		name   string
+		damage func(item string)
+	}{
+		{"damaged payload", func(item string) { os.WriteFile(item, []byte("corrupted"), 0644) }},
+		{"missing payload", func(item string) { os.Remove(item) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := filepath.Join(tempDir, "notes.txt")
+			if err := os.WriteFile(original, []byte("precious notes"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			item, err := trash.Move(cfg, original)
+			if err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			tt.damage(item)
+
+			if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			data, err := os.ReadFile(original)
+			if err != nil || string(data) != "precious notes" {
+				t.Errorf("restored content = %q, %v, want the snapshot", data, err)
+			}
+			if _, err := os.Stat(item + ".saferm-meta"); !os.IsNotExist(err) {
+				t.Error("metadata should be removed after restoring the snapshot")
+			}
+			os.Remove(original)
+		})
+	}
+}
+
+func TestRestoreParentModes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	tests := []struct {
+		policy      string
+		wantPrivate os.FileMode
+		wantSub     os.FileMode
+	}{
+		{"", 0700, 0750},
+		{ParentModeOriginal, 0700, 0750},
+		{"0711", 0711, 0711},
+		{"bogus", 0700, 0750},
+	}
+	for i, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RestoreParentMode: tt.policy}
+
+			// A file in a private directory tree, which is removed later on
+			private := filepath.Join(tempDir, fmt.Sprintf("private%d", i))
+			sub := filepath.Join(private, "sub")
+			if err := os.MkdirAll(sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+			os.Chmod(private, 0700)
+			os.Chmod(sub, 0750)
+			file := filepath.Join(sub, "notes.txt")
+			if err := os.WriteFile(file, []byte("notes"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := trash.Move(cfg, file); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if err := os.RemoveAll(private); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Restore(cfg, file, RestoreOptions{}); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			for dir, want := range map[string]os.FileMode{private: tt.wantPrivate, sub: tt.wantSub} {
+				info, err := os.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("%s mode = %04o, want %04o", dir, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreWithinDirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+
+	project := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(project, "src", "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"README.md":                                "readme",
+		filepath.Join("src", "main.go"):            "package main",
+		filepath.Join("src", "pkg", "pkg.go"):      "package pkg",
+		filepath.Join("src", "pkg", "pkg_test.go"): "package pkg",
+	} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trashPath, err := trash.Move(cfg, project)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		check string // File expected after restoring path
+		want  string
+	}{
+		{"src/main.go", "src/main.go", "package main"},
+		{"src/pkg", "src/pkg/pkg_test.go", "package pkg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := Restore(cfg, filepath.Join(project, tt.path), RestoreOptions{}); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(project, tt.check))
+			if err != nil || string(data) != tt.want {
+				t.Errorf("restored %s = %q, %v, want %q", tt.check, data, err, tt.want)
+			}
+		})
+	}
+
+	// Only the requested paths come back; the trashed tree stays whole
+	if _, err := os.Stat(filepath.Join(project, "README.md")); !os.IsNotExist(err) {
+		t.Error("README.md should not have been restored")
+	}
+	if _, err := os.Stat(filepath.Join(trashPath, "src", "main.go")); err != nil {
+		t.Errorf("trashed copy should remain: %v", err)
+	}
+
+	if err := Restore(cfg, filepath.Join(project, "src", "main.go"), RestoreOptions{}); err == nil {
+		t.Error("Restore() should refuse to overwrite an existing file")
+	}
+	if err := Restore(cfg, filepath.Join(project, "missing.go"), RestoreOptions{}); err == nil {
+		t.Error("Restore() should fail for a path not in the trashed directory")
+	}
+}
+
+func TestRestoreBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     BatchOptions
+		answers  []string
+		wantErr  bool
+		wantA    string // Content of a.txt afterwards (restored over "current")
+		restored bool   // b.txt and c/d.txt were restored
+		renamed  bool   // a.txt.restored holds the trashed copy
+	}{
+		{"non-interactive lists conflicts", BatchOptions{}, nil, true, "current", false, false},
+		{"skip", BatchOptions{Conflict: ConflictSkip}, nil, false, "current", true, false},
+		{"overwrite", BatchOptions{Conflict: ConflictOverwrite}, nil, false, "trashed", true, false},
+		{"rename", BatchOptions{Conflict: ConflictRename}, nil, false, "current", true, true},
+		{"ask once", BatchOptions{Interactive: true}, []string{"o"}, false, "trashed", true, false},
+		{"ask individually", BatchOptions{Interactive: true}, []string{"i", "r"}, false, "current", true, true},
+		{"abort", BatchOptions{Interactive: true}, []string{"a"}, true, "current", false, false},
+	}
+
+	oldAsk := ask
+	defer func() { ask = oldAsk }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			oldXDG := os.Getenv("XDG_STATE_HOME")
+			os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+			defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+			work := filepath.Join(tempDir, "work")
+			if err := os.MkdirAll(filepath.Join(work, "c"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), Session: "s1"}
+			for _, name := range []string{"a.txt", "b.txt", "c/d.txt"} {
+				path := filepath.Join(work, name)
+				if err := os.WriteFile(path, []byte("trashed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := trash.Move(cfg, path); err != nil {
+					t.Fatalf("Move() error = %v", err)
+				}
+			}
+			other := filepath.Join(tempDir, "other.txt")
+			if err := os.WriteFile(other, []byte("other"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := trash.Move(&config.Config{TrashDir: cfg.TrashDir, Session: "s2"}, other); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(work, "a.txt"), []byte("current"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			answers := tt.answers
+			ask = func(string) string {
+				if len(answers) == 0 {
+					t.Fatal("unexpected question")
+				}
+				answer := answers[0]
+				answers = answers[1:]
+				return answer
+			}
+
+			opts := tt.opts
+			opts.Session = "s1"
+			err = RestoreBatch(cfg, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestoreBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if data, _ := os.ReadFile(filepath.Join(work, "a.txt")); string(data) != tt.wantA {
+				t.Errorf("a.txt = %q, want %q", data, tt.wantA)
+			}
+			for _, name := range []string{"b.txt", "c/d.txt"} {
+				_, err := os.Stat(filepath.Join(work, name))
+				if (err == nil) != tt.restored {
+					t.Errorf("%s restored = %v, want %v", name, err == nil, tt.restored)
+				}
+			}
+			_, err = os.Stat(filepath.Join(work, "a.txt.restored"))
+			if (err == nil) != tt.renamed {
+				t.Errorf("a.txt.restored exists = %v, want %v", err == nil, tt.renamed)
+			}
+			if _, err := os.Stat(other); err == nil {
+				t.Error("items of another session should stay in the trash")
+			}
+		})
+	}
+}
+
+func TestRestorePattern(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	if err := os.MkdirAll(filepath.Join(tempDir, "src", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"src/a.go", "src/b.txt", "src/sub/c.go"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+	}
+
+	if err := RestoreBatch(cfg, BatchOptions{Pattern: filepath.Join(tempDir, "src", "*.go")}); err != nil {
+		t.Fatalf("RestoreBatch() error = %v", err)
+	}
+	for name, want := range map[string]bool{"src/a.go": true, "src/b.txt": false, "src/sub/c.go": false} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); (err == nil) != want {
+			t.Errorf("%s restored = %v, want %v", name, err == nil, want)
+		}
+	}
+
+	if err := RestoreBatch(cfg, BatchOptions{Pattern: filepath.Join(tempDir, "src", "**")}); err != nil {
+		t.Fatalf("RestoreBatch() with /** error = %v", err)
+	}
+	for _, name := range []string{"src/b.txt", "src/sub/c.go"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("%s should be restored: %v", name, err)
+		}
+	}
+	if err := RestoreBatch(cfg, BatchOptions{Pattern: filepath.Join(tempDir, "src", "*")}); err == nil {
+		t.Error("RestoreBatch() should fail when nothing matches")
+	}
+}
+
+func TestRestoreDeletedAfter(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	recent := filepath.Join(tempDir, "recent.txt")
+	old := filepath.Join(tempDir, "old.txt")
+	trashAged(t, cfg, recent, time.Hour)
+	trashAged(t, cfg, old, 3*24*time.Hour)
+
+	opts := BatchOptions{Pattern: filepath.Join(tempDir, "*.txt"), DeletedAfter: time.Now().Add(-2 * time.Hour)}
+	if err := RestoreBatch(cfg, opts); err != nil {
+		t.Fatalf("RestoreBatch() error = %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("item trashed an hour ago should be restored: %v", err)
+	}
+	if _, err := os.Stat(old); err == nil {
+		t.Error("item trashed three days ago should stay in the trash")
+	}
+
+	opts.DeletedAfter = time.Now().Add(-time.Minute)
+	if err := RestoreBatch(cfg, opts); err == nil {
+		t.Error("RestoreBatch() should fail when the filter selects nothing")
+	}
+}
+
+func TestFindTrashItemsDirectories(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+
+	original := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(original, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(original, "src", "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashPath, err := trash.Move(cfg, original)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if _, err := trash.ScanPending(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A non-empty trashed directory is one item, not its contents
+	items, err := findTrashItems(cfg.TrashDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0] != trashPath {
+		t.Fatalf("findTrashItems() = %v, want [%s]", items, trashPath)
+	}
+
+	if err := Restore(cfg, original, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(original, "src", "main.go")); err != nil {
+		t.Errorf("Restored directory incomplete: %v", err)
+	}
+	if _, err := os.Stat(trashPath + trash.FilesSuffix); !os.IsNotExist(err) {
+		t.Error("File index should be removed with the restored item")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	deletedAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	meta := &trash.Metadata{DeletedAt: deletedAt}
+
+	expiry, ok := Expiry(&config.Config{RetentionDays: 30}, meta)
+	if !ok || !expiry.Equal(deletedAt.AddDate(0, 0, 30)) {
+		t.Errorf("Expiry() = %v, %v, want %v", expiry, ok, deletedAt.AddDate(0, 0, 30))
+	}
+
+	if _, ok := Expiry(&config.Config{RetentionDays: 0}, meta); ok {
+		t.Error("Expiry() with retention disabled should report no expiry")
+	}
+}
+
+func TestDaysLeft(t *testing.T) {
+	cfg := &config.Config{RetentionDays: 30}
+
+	tests := []struct {
+		deletedAt time.Time
+		want      string
+	}{
+		{time.Now().Add(-time.Hour), "29 days"},
+		{time.Now().AddDate(0, 0, -29).Add(-time.Hour), "<1 day"},
+		{time.Now().AddDate(0, 0, -31), "expired"},
+	}
+
+	for _, tt := range tests {
+		if got := daysLeft(cfg, &trash.Metadata{DeletedAt: tt.deletedAt}); got != tt.want {
+			t.Errorf("daysLeft(deleted %v) = %q, want %q", tt.deletedAt, got, tt.want)
+		}
+	}
+
+	if got := daysLeft(&config.Config{}, &trash.Metadata{DeletedAt: time.Now()}); got != "never" {
+		t.Errorf("daysLeft() with retention disabled = %q, want never", got)
+	}
+}
+
+// trashAged moves a new file into the trash and backdates its deletion time
+func trashAged(t *testing.T, cfg *config.Config, path string, age time.Duration) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(filepath.Base(path)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashPath, err := trash.Move(cfg, path)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	meta, err := trash.GetMetadata(trashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.DeletedAt = time.Now().Add(-age)
+	if err := trash.UpdateMetadata(trashPath, meta); err != nil {
+		t.Fatal(err)
+	}
+	return trashPath
+}
+
+func TestListPage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30}
+	if err := os.Mkdir(filepath.Join(tempDir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		trashAged(t, cfg, filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i)), time.Duration(i)*24*time.Hour)
+	}
+	trashAged(t, cfg, filepath.Join(tempDir, "src", "main.go"), 10*24*time.Hour)
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		filter ListFilter
+		want   int
+		total  int
+	}{
+		{"first page", 0, 2, ListFilter{}, 2, 6},
+		{"last page", 4, 2, ListFilter{}, 2, 6},
+		{"past the end", 10, 2, ListFilter{}, 0, 6},
+		{"no limit", 0, 0, ListFilter{}, 6, 6},
+		{"path prefix", 0, 10, ListFilter{PathPrefix: filepath.Join(tempDir, "src")}, 1, 1},
+		{"deleted after", 0, 10, ListFilter{DeletedAfter: time.Now().Add(-36 * time.Hour)}, 2, 2},
+		{"deleted before", 0, 10, ListFilter{DeletedBefore: time.Now().Add(-5 * 24 * time.Hour)}, 1, 1},
+		{"namespace", 0, 10, ListFilter{Namespace: "prod"}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ListPage(cfg, tt.offset, tt.limit, tt.filter)
+			if err != nil {
+				t.Fatalf("ListPage() error = %v", err)
+			}
+			if len(page.Entries) != tt.want || page.Total != tt.total {
+				t.Errorf("ListPage() = %d entries of %d, want %d of %d", len(page.Entries), page.Total, tt.want, tt.total)
+			}
+		})
+	}
+
+	// Consecutive pages cover every item exactly once
+	seen := map[string]bool{}
+	for offset := 0; offset < 6; offset += 4 {
+		page, err := ListPage(cfg, offset, 4, ListFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range page.Entries {
+			if seen[entry.Path] {
+				t.Errorf("%s listed twice", entry.Path)
+			}
+			seen[entry.Path] = true
+		}
+	}
+	if len(seen) != 6 {
+		t.Errorf("pages covered %d items, want 6", len(seen))
+	}
+}
+
+func TestPinExemptsFromPurge(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30}
+	pinnedPath := filepath.Join(tempDir, "keep.txt")
+	pinnedItem := trashAged(t, cfg, pinnedPath, 40*24*time.Hour)
+	oldItem := trashAged(t, cfg, filepath.Join(tempDir, "old.txt"), 40*24*time.Hour)
+
+	if err := Pin(cfg, pinnedPath, true, RestoreOptions{}); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	if err := Pin(cfg, filepath.Join(tempDir, "missing.txt"), true, RestoreOptions{}); err == nil {
+		t.Error("Pin() should fail for an item not in trash")
+	}
+
+	if err := Purge(cfg, 30, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Stat(pinnedItem); err != nil {
+		t.Error("pinned item should survive purge")
+	}
+	if _, err := os.Stat(oldItem); !os.IsNotExist(err) {
+		t.Error("unpinned expired item should be purged")
+	}
+
+	if err := Pin(cfg, pinnedPath, false, RestoreOptions{}); err != nil {
+		t.Fatalf("unpin error = %v", err)
+	}
+	if err := Purge(cfg, 30, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Stat(pinnedItem); !os.IsNotExist(err) {
+		t.Error("unpinned item should be purged")
+	}
+}
+
+func TestPurgeInjectedClock(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	at := time.Now()
+	cfg := &config.Config{
+		TrashDir:      filepath.Join(tempDir, "trash"),
+		RetentionDays: 30,
+		Clock:         func() time.Time { return at },
+	}
+	testFile := filepath.Join(tempDir, "old.txt")
+	if err := os.WriteFile(testFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashPath, err := trash.Move(cfg, testFile)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	// Retention follows the injected clock, not the wall clock
+	at = at.AddDate(0, 0, 29)
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Stat(trashPath); err != nil {
+		t.Error("item within retention should survive purge")
+	}
+	at = at.AddDate(0, 0, 2)
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Stat(trashPath); !os.IsNotExist(err) {
+		t.Error("item past retention by the injected clock should be purged")
+	}
+}
+
+func TestImportantPatternsExemptFromPurge(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{
+		TrashDir:          filepath.Join(tempDir, "trash"),
+		RetentionDays:     30,
+		ImportantPatterns: []string{"*.kdbx", "*wallet*", filepath.Join(tempDir, "keys", "**")},
+	}
+	os.MkdirAll(filepath.Join(tempDir, "keys"), 0700)
+	kept := []string{
+		trashAged(t, cfg, filepath.Join(tempDir, "passwords.kdbx"), 40*24*time.Hour),
+		trashAged(t, cfg, filepath.Join(tempDir, "my-wallet.dat"), 40*24*time.Hour),
+		trashAged(t, cfg, filepath.Join(tempDir, "keys", "id_ed25519"), 40*24*time.Hour),
+	}
+	oldItem := trashAged(t, cfg, filepath.Join(tempDir, "old.txt"), 40*24*time.Hour)
+
+	meta, err := trash.GetMetadata(kept[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Expiry(cfg, meta); ok {
+		t.Error("Expiry() should report no expiry for an important item")
+	}
+	if got := daysLeft(cfg, meta); got != "important" {
+		t.Errorf("daysLeft() = %q, want important", got)
+	}
+
+	// Neither retention nor an explicit age purges important items
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if err := Purge(cfg, 1, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for _, item := range kept {
+		if _, err := os.Stat(item); err != nil {
+			t.Errorf("important item %s should survive purge", item)
+		}
+	}
+	if _, err := os.Stat(oldItem); !os.IsNotExist(err) {
+		t.Error("expired item should be purged")
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	original := filepath.Join(tempDir, "report.txt")
+	item := trashAged(t, cfg, original, time.Hour)
+
+	if err := Annotate(cfg, original, " the good copy of the report ", RestoreOptions{}); err != nil {
+		t.Fatalf("Annotate() error = %v", err)
+	}
+	if err := Retag(cfg, original, []string{"q3, finance", "q3"}, RestoreOptions{}); err != nil {
+		t.Fatalf("Retag() error = %v", err)
+	}
+	if err := Annotate(cfg, filepath.Join(tempDir, "missing.txt"), "note", RestoreOptions{}); err == nil {
+		t.Error("Annotate() should fail for an item not in trash")
+	}
+
+	meta, err := trash.GetMetadata(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Note != "the good copy of the report" {
+		t.Errorf("Note = %q", meta.Note)
+	}
+	if strings.Join(meta.Tags, ",") != "finance,q3" {
+		t.Errorf("Tags = %v, want [finance q3]", meta.Tags)
+	}
+
+	matches, err := grepTrash(cfg, "good copy|finance", GrepOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Line != 0 || matches[0].OriginalPath != original {
+		t.Errorf("grepTrash() = %+v, want the note and tags of %s", matches, original)
+	}
+
+	if err := Annotate(cfg, original, "", RestoreOptions{}); err != nil {
+		t.Fatalf("Annotate() error = %v", err)
+	}
+	if err := Retag(cfg, original, nil, RestoreOptions{}); err != nil {
+		t.Fatalf("Retag() error = %v", err)
+	}
+	meta, err = trash.GetMetadata(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Note != "" || len(meta.Tags) != 0 {
+		t.Errorf("annotations should be removed, got note %q tags %v", meta.Note, meta.Tags)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	keep := 0
+	short := 3
+	cfg := &config.Config{
+		TrashDir:      filepath.Join(tempDir, "trash"),
+		RetentionDays: 30,
+		Namespaces: map[string]config.NamespaceConfig{
+			"prod": {RetentionDays: &keep},
+			"dev":  {RetentionDays: &short},
+		},
+	}
+
+	trashIn := func(namespace, name string, age time.Duration) string {
+		cfg.Namespace = namespace
+		return trashAged(t, cfg, filepath.Join(tempDir, name), age)
+	}
+	prod := trashIn("prod", "prod.db", 100*24*time.Hour)
+	devOld := trashIn("dev", "dev-old.log", 5*24*time.Hour)
+	devNew := trashIn("dev", "dev-new.log", 24*time.Hour)
+	plain := trashIn("", "plain.txt", 5*24*time.Hour)
+
+	// Each item expires under its namespace's retention
+	cfg.Namespace = ""
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for path, want := range map[string]bool{prod: true, devOld: false, devNew: true, plain: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	// Selecting a namespace confines even an explicit purge to it
+	cfg.Namespace = "dev"
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if err := Purge(cfg, 1, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for path, want := range map[string]bool{prod: true, devNew: false, plain: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+}
+
+func TestPurgeArchive(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{
+		TrashDir:             filepath.Join(tempDir, "trash"),
+		RetentionDays:        3,
+		RetentionClass:       ClassDelete,
+		ArchiveDir:           filepath.Join(tempDir, "archive"),
+		ArchiveRetentionDays: 365,
+		Namespaces: map[string]config.NamespaceConfig{
+			"prod": {RetentionClass: ClassArchive},
+		},
+	}
+
+	cfg.Namespace = "prod"
+	archived := trashAged(t, cfg, filepath.Join(tempDir, "prod.db"), 5*24*time.Hour)
+	cfg.Namespace = ""
+	deleted := trashAged(t, cfg, filepath.Join(tempDir, "plain.txt"), 5*24*time.Hour)
+
+	// An old pack beyond archive_retention_days is pruned
+	if err := os.MkdirAll(cfg.ArchiveDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	oldPack := filepath.Join(cfg.ArchiveDir, "pack-20000101-000000.000000000.tar.gz")
+	if err := os.WriteFile(oldPack, nil, 0400); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(-2, 0, 0)
+	os.Chtimes(oldPack, old, old)
+
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for _, path := range []string{archived, deleted, archived + ".saferm-meta"} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after purge", path)
+		}
+	}
+	if _, err := os.Stat(oldPack); !os.IsNotExist(err) {
+		t.Error("expired archive pack was not pruned")
+	}
+
+	packs, _ := filepath.Glob(filepath.Join(cfg.ArchiveDir, "pack-*.tar.gz"))
+	if len(packs) != 1 {
+		t.Fatalf("got %d packs, want 1", len(packs))
+	}
+	info, err := os.Stat(packs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0400 {
+		t.Errorf("pack mode = %o, want 0400", info.Mode().Perm())
+	}
+
+	f, err := os.Open(packs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		if header.PAXRecords["SAFERM.deleted_at"] == "" {
+			t.Errorf("%s has no deletion time", header.Name)
+		}
+		data, _ := io.ReadAll(tr)
+		if string(data) != "prod.db" {
+			t.Errorf("%s content = %q, want %q", header.Name, data, "prod.db")
+		}
+	}
+	want := strings.TrimPrefix(filepath.Join(tempDir, "prod.db"), "/")
+	if len(names) != 1 || names[0] != want {
+		t.Errorf("pack entries = %v, want [%s]", names, want)
+	}
+}
+
+// TestPurgeCrashHelper is not a test of its own: TestPurgeCrash runs it in
+// a child process, which purges SAFERM_TRASH and is killed once the first
+// item is renamed to its tombstone
+func TestPurgeCrashHelper(t *testing.T) {
+	if os.Getenv("SAFERM_TEST_CRASH") == "" {
+		t.Skip("run by TestPurgeCrash")
+	}
+	trash.FaultHook = func(point, path string) error {
+		if point == trash.FaultDiscard {
+			syscall.Kill(os.Getpid(), syscall.SIGKILL)
+		}
+		return nil
+	}
+	Purge(&config.Config{TrashDir: os.Getenv("SAFERM_TRASH"), RetentionDays: 30}, 0, PurgeOptions{})
+	t.Fatal("not killed")
+}
+
+func TestPurgeCrash(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	// Inline snapshots would bring a half-purged item back if its metadata
+	// outlived it
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30, InlineSnapshotSize: 1024}
+	expired := []string{
+		trashAged(t, cfg, filepath.Join(tempDir, "a.txt"), 40*24*time.Hour),
+		trashAged(t, cfg, filepath.Join(tempDir, "b.txt"), 40*24*time.Hour),
+	}
+	kept := trashAged(t, cfg, filepath.Join(tempDir, "c.txt"), time.Hour)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPurgeCrashHelper$")
+	cmd.Env = append(os.Environ(), "SAFERM_TEST_CRASH=1", "SAFERM_TRASH="+cfg.TrashDir)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Sys().(syscall.WaitStatus).Signal() != syscall.SIGKILL {
+		t.Fatalf("helper was not killed: %v", err)
+	}
+
+	// The item being purged is gone from listings at once
+	items, err := findItems(cfg, []string{cfg.TrashDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("items after the crash = %+v, want the 2 not being purged", items)
+	}
+
+	// The next purge finishes the interrupted one
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for _, item := range expired {
+		for _, path := range []string{item, item + trash.TombstoneSuffix, item + ".saferm-meta"} {
+			if _, err := os.Lstat(path); !os.IsNotExist(err) {
+				t.Errorf("%s should be gone after recovery", path)
+			}
+		}
+	}
+	if data, err := os.ReadFile(kept); err != nil || string(data) != "c.txt" {
+		t.Errorf("item within retention = %q, %v, want it intact", data, err)
+	}
+}
+
+// TestPurgeSandboxHelper is not a test of its own: TestPurgeSandbox runs it
+// in a child process, which purges SAFERM_TRASH with sandbox_purge and
+// tries to remove SAFERM_OUTSIDE while doing so
+func TestPurgeSandboxHelper(t *testing.T) {
+	if os.Getenv("SAFERM_TEST_SANDBOX") == "" {
+		t.Skip("run by TestPurgeSandbox")
+	}
+	trash.FaultHook = func(point, path string) error {
+		if point == trash.FaultDiscard {
+			if err := os.Remove(os.Getenv("SAFERM_OUTSIDE")); err == nil {
+				t.Error("the sandbox should refuse removing a file outside the trash")
+			}
+		}
+		return nil
+	}
+	cfg := &config.Config{TrashDir: os.Getenv("SAFERM_TRASH"), RetentionDays: 30, AuditLog: true, SandboxPurge: true}
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+}
+
+func TestPurgeSandbox(t *testing.T) {
+	if !sandbox.Supported() {
+		t.Skip("Landlock is not available")
+	}
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30}
+	expired := trashAged(t, cfg, filepath.Join(tempDir, "old.txt"), 40*24*time.Hour)
+	outside := filepath.Join(tempDir, "outside.txt")
+	if err := os.WriteFile(outside, []byte("live"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPurgeSandboxHelper$")
+	cmd.Env = append(os.Environ(), "SAFERM_TEST_SANDBOX=1", "SAFERM_TRASH="+cfg.TrashDir, "SAFERM_OUTSIDE="+outside)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("sandboxed purge failed: %v\n%s", err, out)
+	}
+
+	if _, err := os.Lstat(expired); !os.IsNotExist(err) {
+		t.Error("the expired item should be purged inside the sandbox")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("the file outside the trash should survive: %v", err)
+	}
+	if data, err := os.ReadFile(audit.Path()); err != nil || !strings.Contains(string(data), `"purge"`) {
+		t.Errorf("audit log = %q, %v, want the purge recorded from inside the sandbox", data, err)
+	}
+}
+
+func TestPurgeRespectsLocks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 3}
+	original := filepath.Join(tempDir, "busy.txt")
+	item := trashAged(t, cfg, original, 5*24*time.Hour)
+
+	// A tombstone left behind by an interrupted purge
+	tombstone := filepath.Join(filepath.Dir(item), "gone.txt"+trash.TombstoneSuffix)
+	if err := os.WriteFile(tombstone, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An item held by a restore in progress survives the purge
+	unlock, err := trash.LockItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(cfg, original, RestoreOptions{}); err == nil {
+		t.Error("Restore() of a locked item succeeded")
+	}
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Lstat(item); err != nil {
+		t.Errorf("locked item was purged: %v", err)
+	}
+	if _, err := os.Lstat(tombstone); !os.IsNotExist(err) {
+		t.Error("leftover tombstone was not removed")
+	}
+	unlock()
+
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if _, err := os.Lstat(item); !os.IsNotExist(err) {
+		t.Error("unlocked item was not purged")
+	}
+}
+
+func TestPurgeKeepsTombstoneNamedItems(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30}
+	if err := os.MkdirAll(filepath.Join(tempDir, "w"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file named like a tombstone is trashed under an escaped name
+	original := filepath.Join(tempDir, "w", "notes"+trash.TombstoneSuffix)
+	item := trashAged(t, cfg, original, time.Hour)
+	if strings.HasSuffix(item, trash.TombstoneSuffix) {
+		t.Errorf("Move() = %s, want the name escaped", item)
+	}
+
+	// One trashed before names were escaped has metadata of its own
+	legacyOriginal := filepath.Join(tempDir, "w", "old"+trash.TombstoneSuffix)
+	legacy := filepath.Join(filepath.Dir(item), filepath.Base(legacyOriginal))
+	if err := os.WriteFile(legacy, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := &trash.Metadata{Version: trash.MetadataVersion, OriginalPath: legacyOriginal, DeletedAt: time.Now()}
+	if err := trash.UpdateMetadata(legacy, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing has expired: both survive the purge and are listed, also
+	// from a rebuilt index
+	if err := Purge(cfg, 0, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		items, err := findTrashItems(cfg.TrashDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed := strings.Join(items, "\n")
+		for _, path := range []string{item, legacy} {
+			if _, err := os.Lstat(path); err != nil {
+				t.Errorf("%s was purged: %v", path, err)
+			}
+			if !strings.Contains(listed, path) {
+				t.Errorf("findTrashItems() = %v, want %s", items, path)
+			}
+		}
+		if err := os.Remove(filepath.Join(cfg.TrashDir, trash.IndexFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{original, legacyOriginal} {
+		if err := Restore(cfg, path, RestoreOptions{}); err != nil {
+			t.Errorf("Restore(%s) error = %v", path, err)
+		}
+	}
+}
+
+func TestAutopurgeNotifies(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	notifications := filepath.Join(tempDir, "notifications")
+	cfg := &config.Config{
+		TrashDir:           filepath.Join(tempDir, "trash"),
+		RetentionDays:      30,
+		PurgeNotifyCommand: "cat >> " + notifications,
+		PurgeNotifyHours:   24,
+	}
+
+	// Expires in about 12 hours: announced but not yet purged
+	soonPath := filepath.Join(tempDir, "soon.txt")
+	soonItem := trashAged(t, cfg, soonPath, 30*24*time.Hour-12*time.Hour)
+	// Expires in 10 days: neither announced nor purged
+	trashAged(t, cfg, filepath.Join(tempDir, "later.txt"), 20*24*time.Hour)
+	// Already expired: purged
+	expiredItem := trashAged(t, cfg, filepath.Join(tempDir, "expired.txt"), 31*24*time.Hour)
+
+	if err := Autopurge(cfg, PurgeOptions{}); err != nil {
+		t.Fatalf("Autopurge() error = %v", err)
+	}
+
+	data, err := os.ReadFile(notifications)
+	if err != nil {
+		t.Fatalf("notification command should have run: %v", err)
+	}
+	summary := string(data)
+	if !strings.Contains(summary, soonPath) || !strings.Contains(summary, "--safe-pin=") {
+		t.Errorf("summary should list %s with a pin hint, got:\n%s", soonPath, summary)
+	}
+	if strings.Contains(summary, "later.txt") {
+		t.Errorf("summary should not list items outside the window, got:\n%s", summary)
+	}
+	if _, err := os.Stat(soonItem); err != nil {
+		t.Error("item expiring later must not be purged yet")
+	}
+	if _, err := os.Stat(expiredItem); !os.IsNotExist(err) {
+		t.Error("expired item should be purged")
+	}
+
+	// A second run does not announce the same item again
+	if err := Autopurge(cfg, PurgeOptions{}); err != nil {
+		t.Fatalf("Autopurge() error = %v", err)
+	}
+	data, _ = os.ReadFile(notifications)
+	if strings.Count(string(data), soonPath) != 1 {
+		t.Errorf("item should be announced once, got:\n%s", data)
+	}
+}
+
+func TestLifecycleIsAudited(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), AuditLog: true}
+	restored := filepath.Join(tempDir, "restored.txt")
+	trashAged(t, cfg, restored, time.Hour)
+	purged := filepath.Join(tempDir, "purged.txt")
+	trashAged(t, cfg, purged, 40*24*time.Hour)
+
+	if err := Restore(cfg, restored, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if err := Purge(cfg, 30, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+
+	entries, err := audit.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string]string)
+	for _, entry := range entries {
+		actions[entry.Path] = entry.Action
+	}
+	if actions[restored] != audit.ActionRestore {
+		t.Errorf("last action for %s = %q, want restore", restored, actions[restored])
+	}
+	if actions[purged] != audit.ActionPurge {
+		t.Errorf("last action for %s = %q, want purge", purged, actions[purged])
+	}
+}
+
+func TestTrendSnapshots(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	trashAged(t, cfg, filepath.Join(tempDir, "a.txt"), time.Hour)
+
+	if err := RecordDailySnapshot(cfg); err != nil {
+		t.Fatalf("RecordDailySnapshot() error = %v", err)
+	}
+	// A second removal on the same day keeps the first snapshot
+	trashAged(t, cfg, filepath.Join(tempDir, "bb.txt"), time.Hour)
+	if err := RecordDailySnapshot(cfg); err != nil {
+		t.Fatalf("RecordDailySnapshot() error = %v", err)
+	}
+	snapshots, err := ReadSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Items != 1 || snapshots[0].Bytes != int64(len("a.txt")) {
+		t.Fatalf("snapshots = %+v, want one of 1 item, %d bytes", snapshots, len("a.txt"))
+	}
+
+	// Trend refreshes today's snapshot
+	if err := Trend(cfg, 30); err != nil {
+		t.Fatalf("Trend() error = %v", err)
+	}
+	snapshots, _ = ReadSnapshots()
+	want := int64(len("a.txt") + len("bb.txt"))
+	if len(snapshots) != 1 || snapshots[0].Items != 2 || snapshots[0].Bytes != want {
+		t.Errorf("snapshots = %+v, want one of 2 items, %d bytes", snapshots, want)
+	}
+
+	// Older days are kept, and the history is bounded
+	var history []Snapshot
+	for i := 0; i < maxSnapshots+10; i++ {
+		history = append(history, Snapshot{Date: time.Now().AddDate(0, 0, -maxSnapshots-10+i).Format("2006-01-02")})
+	}
+	if err := writeSnapshots(history); err != nil {
+		t.Fatal(err)
+	}
+	if err := Trend(cfg, 7); err != nil {
+		t.Fatalf("Trend() error = %v", err)
+	}
+	snapshots, _ = ReadSnapshots()
+	if len(snapshots) != maxSnapshots {
+		t.Errorf("got %d snapshots, want %d", len(snapshots), maxSnapshots)
+	}
+}
+
+func TestUsageByUser(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	mine := trashAged(t, cfg, filepath.Join(tempDir, "mine.txt"), time.Hour)
+	trashAged(t, cfg, filepath.Join(tempDir, "mine-too.txt"), 48*time.Hour)
+	other := trashAged(t, cfg, filepath.Join(tempDir, "other-user-file.txt"), time.Hour)
+	legacy := trashAged(t, cfg, filepath.Join(tempDir, "legacy.txt"), time.Hour)
+
+	meta, err := trash.GetMetadata(mine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.UID == nil || *meta.UID != os.Getuid() {
+		t.Fatalf("UID = %v, want %d", meta.UID, os.Getuid())
+	}
+
+	// Simulate another user and metadata written before uids were recorded
+	otherUID := os.Getuid() + 1000
+	meta, _ = trash.GetMetadata(other)
+	meta.UID = &otherUID
+	trash.UpdateMetadata(other, meta)
+	meta, _ = trash.GetMetadata(legacy)
+	meta.UID = nil
+	trash.UpdateMetadata(legacy, meta)
+
+	usages, err := usageByUser(cfg, []string{cfg.TrashDir})
+	if err != nil {
+		t.Fatalf("usageByUser() error = %v", err)
+	}
+	if len(usages) != 3 {
+		t.Fatalf("got %d users, want 3", len(usages))
+	}
+	// Largest first: two files of ours outweigh the single longer name
+	want := []struct {
+		uid   int
+		items int
+		bytes int64
+	}{
+		{os.Getuid(), 2, int64(len("mine.txt") + len("mine-too.txt"))},
+		{otherUID, 1, int64(len("other-user-file.txt"))},
+		{-1, 1, int64(len("legacy.txt"))},
+	}
+	for i, w := range want {
+		if got := usages[i]; got.UID != w.uid || got.Items != w.items || got.Bytes != w.bytes {
+			t.Errorf("usages[%d] = %+v, want uid %d, %d items, %d bytes", i, got, w.uid, w.items, w.bytes)
+		}
+	}
+	if time.Since(usages[0].Oldest) < 47*time.Hour {
+		t.Errorf("Oldest = %v, want the item trashed 48h ago", usages[0].Oldest)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	trashAged(t, cfg, filepath.Join(tempDir, "new.txt"), time.Hour)
+	trashAged(t, cfg, filepath.Join(tempDir, "week-old.txt"), 10*24*time.Hour)
+	trashAged(t, cfg, filepath.Join(tempDir, "ancient.txt"), 90*24*time.Hour)
+
+	usage, err := diskUsage(cfg, []string{cfg.TrashDir})
+	if err != nil {
+		t.Fatalf("diskUsage() error = %v", err)
+	}
+	total := int64(len("new.txt") + len("week-old.txt") + len("ancient.txt"))
+	if usage.Items != 3 || usage.Bytes != total {
+		t.Errorf("diskUsage() = %d items, %d bytes, want 3, %d", usage.Items, usage.Bytes, total)
+	}
+	top := topDirectory(tempDir, "")
+	if len(usage.Directories) != 1 || usage.Directories[0].Name != top || usage.Directories[0].Items != 3 {
+		t.Errorf("Directories = %+v, want all items in %s", usage.Directories, top)
+	}
+	wantAges := []UsageGroup{
+		{"<7d", 1, int64(len("new.txt"))},
+		{"7-30d", 1, int64(len("week-old.txt"))},
+		{">30d", 1, int64(len("ancient.txt"))},
+	}
+	if !reflect.DeepEqual(usage.Ages, wantAges) {
+		t.Errorf("Ages = %+v, want %+v", usage.Ages, wantAges)
+	}
+
+	for _, tt := range []struct{ path, want string }{
+		{"/home/me/projects/app/main.go", "~/projects"},
+		{"/home/me/notes.txt", "~"},
+		{"/home/me", "~"},
+		{"/home/meow/file", "/home"},
+		{"/srv/data/x", "/srv"},
+		{"/file", "/"},
+	} {
+		if got := topDirectory(tt.path, "/home/me"); got != tt.want {
+			t.Errorf("topDirectory(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGrepTrash(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+
+	project := filepath.Join(tempDir, "project")
+	files := map[string]string{
+		"notes.txt":       "nothing here\n",
+		"project/pay.go":  "package pay\n// TODO-payment-fix: rounding\n",
+		"project/big.txt": "TODO-payment-fix " + strings.Repeat("x", 100),
+		"project/app.bin": "TODO-payment-fix\x00\x01",
+		"project/pay.md":  "TODO-payment-fix in docs\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(tempDir, "notes.txt"), project} {
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+	}
+
+	// Large and binary files are skipped; a glob narrows the search further
+	matches, err := grepTrash(cfg, "TODO-payment", GrepOptions{MaxSize: 64, Include: []string{"*.go", "*.txt", "*.bin"}})
+	if err != nil {
+		t.Fatalf("grepTrash() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("grepTrash() = %+v, want one match", matches)
+	}
+	m := matches[0]
+	if m.OriginalPath != filepath.Join(project, "pay.go") || m.Line != 2 || !strings.Contains(m.Text, "rounding") {
+		t.Errorf("match = %+v, want line 2 of %s", m, filepath.Join(project, "pay.go"))
+	}
+	if _, err := os.Stat(m.TrashPath); err != nil {
+		t.Errorf("TrashPath %s: %v", m.TrashPath, err)
+	}
+
+	// The default size limit includes the large file
+	matches, err = grepTrash(cfg, "TODO-payment", GrepOptions{})
+	if err != nil {
+		t.Fatalf("grepTrash() error = %v", err)
+	}
+	if len(matches) != 3 {
+		t.Errorf("grepTrash() found %d matches, want 3: %+v", len(matches), matches)
+	}
+
+	if _, err := grepTrash(cfg, "([", GrepOptions{}); err == nil {
+		t.Error("grepTrash() should reject an invalid pattern")
+	}
+}
+
+func TestRestoreMap(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RestoreParentMode: ParentModeOriginal}
+	oldMount, newMount := filepath.Join(tempDir, "old"), filepath.Join(tempDir, "new")
+
+	// Three files trashed from the old mount, which then moves
+	var originals []string
+	for _, name := range []string{"docs/a.txt", "docs/b.txt", "photos/c.jpg"} {
+		path := filepath.Join(oldMount, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+		originals = append(originals, path)
+	}
+	if err := os.RemoveAll(oldMount); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(newMount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AddRestoreMapping(oldMount, newMount)
+
+	// By the original path, the parent recreated with its original mode
+	if err := Restore(cfg, originals[0], RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(newMount, "docs", "a.txt")); err != nil || string(data) != "docs/a.txt" {
+		t.Errorf("mapped restore = %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(newMount, "docs")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("recreated parent mode = %v, %v, want 0750", info.Mode(), err)
+	}
+	if _, err := os.Stat(oldMount); !os.IsNotExist(err) {
+		t.Errorf("the old mount was recreated: %v", err)
+	}
+
+	// By the path it is restored to
+	if err := Restore(cfg, filepath.Join(newMount, "docs", "b.txt"), RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() by the mapped path error = %v", err)
+	}
+
+	// A batch, by a pattern below the new mount
+	if err := RestoreBatch(cfg, BatchOptions{Pattern: newMount + "/**"}); err != nil {
+		t.Fatalf("RestoreBatch() error = %v", err)
+	}
+	for _, name := range []string{"docs/b.txt", "photos/c.jpg"} {
+		if _, err := os.Stat(filepath.Join(newMount, name)); err != nil {
+			t.Errorf("%s not restored below the new mount: %v", name, err)
+		}
+	}
+}
+
+func TestRestoreOtherHost(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	host := "old-laptop"
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), Hostname: func() string { return host }}
+	var originals []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+		originals = append(originals, path)
+	}
+	host = "new-laptop"
+
+	var answer string
+	asked := 0
+	oldAsk := ask
+	ask = func(string) string {
+		asked++
+		return answer
+	}
+	defer func() { ask = oldAsk }()
+
+	tests := []struct {
+		name        string
+		interactive bool
+		answer      string
+		restored    bool
+		asked       int
+	}{
+		{"declined", true, "n", false, 1},
+		{"confirmed", true, "yes", true, 1},
+		{"no terminal", false, "", true, 0},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, asked = tt.answer, 0
+			err := Restore(cfg, originals[i], RestoreOptions{Interactive: tt.interactive})
+			if (err == nil) != tt.restored {
+				t.Errorf("Restore() error = %v, want restored %v", err, tt.restored)
+			}
+			if asked != tt.asked {
+				t.Errorf("asked %d time(s), want %d", asked, tt.asked)
+			}
+			if _, err := os.Stat(originals[i]); (err == nil) != tt.restored {
+				t.Errorf("%s restored = %v, want %v", originals[i], err == nil, tt.restored)
+			}
+		})
+	}
+
+	// Items on the current host are restored without a question
+	if _, err := trash.Move(cfg, originals[1]); err != nil {
+		t.Fatal(err)
+	}
+	asked = 0
+	if err := Restore(cfg, originals[1], RestoreOptions{Interactive: true}); err != nil || asked != 0 {
+		t.Errorf("Restore() from this host = %v, asked %d time(s)", err, asked)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var prompt string
+	oldAsk := ask
+	defer func() { ask = oldAsk }()
+
+	for _, tt := range []struct {
+		answer string
+		left   int
+	}{
+		{"yes I am sure", 3},
+		{"2", 3},
+		{"3", 0},
+	} {
+		ask = func(p string) string {
+			prompt = p
+			return tt.answer
+		}
+		if err := Empty(cfg); err != nil {
+			t.Fatalf("Empty() error = %v", err)
+		}
+		if !strings.Contains(prompt, "(3)") {
+			t.Errorf("prompt %q does not name the number of items", prompt)
+		}
+		items, err := findTrashItems(cfg.TrashDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != tt.left {
+			t.Errorf("answer %q left %d item(s), want %d", tt.answer, len(items), tt.left)
+		}
+	}
+
+	// A trash that is a mount point or the home directory is refused
+	// outright, marker or not
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", cfg.TrashDir)
+	defer os.Setenv("HOME", oldHome)
+	if err := Empty(cfg); err == nil || !strings.Contains(err.Error(), "home directory") {
+		t.Errorf("Empty() of the home directory error = %v", err)
+	}
+	if err := Purge(cfg, 1, PurgeOptions{}); err == nil {
+		t.Error("Purge() of the home directory should fail")
+	}
+}
+
+func TestListAndPurgeJSON(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	var stdout bytes.Buffer
+	oldStdout := output.Stdout
+	output.Stdout = &stdout
+	output.SetJSON(true)
+	defer func() {
+		output.Stdout = oldStdout
+		output.SetJSON(false)
+	}()
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), RetentionDays: 30}
+	oldPath := filepath.Join(tempDir, "old.txt")
+	trashAged(t, cfg, oldPath, 40*24*time.Hour)
+	trashAged(t, cfg, filepath.Join(tempDir, "new.txt"), time.Hour)
+
+	decode := func() []trash.Record {
+		var records []trash.Record
+		for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+			var record trash.Record
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("invalid JSON line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		stdout.Reset()
+		return records
+	}
+
+	if err := List(cfg, ListOptions{JSON: true}); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	records := decode()
+	if len(records) != 2 {
+		t.Fatalf("List() printed %d objects, want 2", len(records))
+	}
+	for _, record := range records {
+		if record.ID == "" || record.OriginalPath == "" || record.DeletedAt.IsZero() || record.TrashPath == "" {
+			t.Errorf("List() record %+v is missing fields", record)
+		}
+		if record.Size != int64(len(filepath.Base(record.OriginalPath))) {
+			t.Errorf("List() record size = %d for %s", record.Size, record.OriginalPath)
+		}
+	}
+
+	if err := Purge(cfg, 0, PurgeOptions{JSON: true}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	records = decode()
+	if len(records) != 1 || records[0].OriginalPath != oldPath || records[0].Action != audit.ActionPurge {
+		t.Errorf("Purge() printed %+v, want only %s purged", records, oldPath)
+	}
+}
+
+func TestCheckDevice(t *testing.T) {
+	meta := &trash.Metadata{
+		OriginalPath: "/media/user/STICK/photo.jpg",
+		Device:       &trash.Device{Label: "STICK", UUID: "saferm-test-missing", Source: "/dev/sdz1", MountPoint: "/media/user/STICK"},
+	}
+
+	err := checkDevice(meta, meta.OriginalPath)
+	if err == nil || !strings.Contains(err.Error(), `"STICK" (UUID saferm-test-missing)`) {
+		t.Errorf("checkDevice() with the device detached = %v, want an error naming it", err)
+	}
+	if err := checkDevice(meta, "/home/user/photo.jpg"); err != nil {
+		t.Errorf("checkDevice() restoring elsewhere (restore_map) = %v, want nil", err)
+	}
+	if err := checkDevice(&trash.Metadata{OriginalPath: "/tmp/x"}, "/tmp/x"); err != nil {
+		t.Errorf("checkDevice() without a device = %v, want nil", err)
+	}
+}
+
+func TestRestoreArchive(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	project := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(project, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "src", "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	trashedDir, err := trash.Move(cfg, project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashedFile := trashAged(t, cfg, filepath.Join(tempDir, "notes.txt"), time.Hour)
+	trashAged(t, cfg, filepath.Join(tempDir, "other.log"), time.Hour)
+
+	archive := filepath.Join(tempDir, "recovered.tar.gz")
+	if err := RestoreArchive(cfg, archive, BatchOptions{Pattern: filepath.Join(tempDir, "[np]*")}); err != nil {
+		t.Fatalf("RestoreArchive() error = %v", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	contents := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[header.Name] = string(data)
+	}
+	base := strings.TrimPrefix(tempDir, "/")
+	want := map[string]string{
+		base + "/notes.txt":           "notes.txt",
+		base + "/project/":            "",
+		base + "/project/src/":        "",
+		base + "/project/src/main.go": "package main",
+	}
+	if !reflect.DeepEqual(contents, want) {
+		t.Errorf("archive contents = %v, want %v", contents, want)
+	}
+
+	for _, item := range []string{trashedDir, trashedFile} {
+		if _, err := os.Lstat(item); err != nil {
+			t.Errorf("%s should stay in the trash: %v", item, err)
+		}
+	}
+	if info, err := os.Stat(archive); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("archive mode = %v, %v, want 0600", info, err)
+	}
+	if err := RestoreArchive(cfg, archive, BatchOptions{Pattern: filepath.Join(tempDir, "[np]*")}); err == nil {
+		t.Error("RestoreArchive() should not overwrite an existing file")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	if err := Undo(&config.Config{TrashDir: filepath.Join(tempDir, "trash")}, BatchOptions{}); err == nil {
+		t.Error("Undo() without a last operation should fail")
+	}
+
+	// Two operations; only the last one is undone
+	var paths []string
+	for i, session := range []string{"first", "second", "second"} {
+		cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), Session: session}
+		path := filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash.Move(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+		if err := trash.RecordOperation(trash.Operation{Session: session, Time: time.Now(), Command: "rm file"}); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	if err := Undo(cfg, BatchOptions{}); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if restored := err == nil; restored != (i > 0) {
+			t.Errorf("%s restored = %v, want %v", path, restored, i > 0)
+		}
+	}
+	if op, err := trash.LastOperation(); op != nil || err != nil {
+		t.Errorf("LastOperation() after Undo() = %+v, %v, want none", op, err)
+	}
+}
+
+func TestDestroyMatching(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	now := time.Now()
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), Clock: func() time.Time { return now }}
+	work := filepath.Join(tempDir, "work")
+	// Live files match by their path below the directory searched, which
+	// may itself be named after the subject
+	live := filepath.Join(tempDir, "export-cust-42")
+	for _, dir := range []string{filepath.Join(work, "exports"), live} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{"work/cust-42.csv", "work/other.txt", "work/exports/Cust-42-orders.csv", "export-cust-42/cust-42.log", "export-cust-42/unrelated.txt"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"cust-42.csv", "other.txt", "exports"} {
+		if _, err := trash.Move(cfg, filepath.Join(work, name)); err != nil {
+			t.Fatalf("Move() error = %v", err)
+		}
+	}
+
+	opts := DestroyOptions{Live: []string{live}}
+	targets, err := selectDestroy(cfg, "CUST-42", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, target := range targets {
+		paths = append(paths, target.path)
+	}
+	want := []string{filepath.Join(live, "cust-42.log"), filepath.Join(work, "cust-42.csv"), filepath.Join(work, "exports")}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("selectDestroy() = %v, want %v", paths, want)
+	}
+
+	// A matching live file blocked by a protection rule refuses them all
+	blocked := *cfg
+	blocked.ProtectedPaths = []string{filepath.Join(live, "*.log")}
+	blocked.ProtectedBehavior = "block"
+	if _, err := selectDestroy(&blocked, "CUST-42", opts); err == nil {
+		t.Error("selectDestroy() should refuse a protected live file")
+	}
+
+	oldAsk := ask
+	defer func() { ask = oldAsk }()
+	answers := []string{"3", "cust"}
+	ask = func(string) string {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer
+	}
+
+	// Neither a token without a dry run, a dry run, a token computed from
+	// the matches alone, an expired token nor a wrong second answer
+	// destroys anything
+	unkeyed := opts
+	unkeyed.Token = approvalToken(nil, "CUST-42", targets)
+	if err := DestroyMatching(cfg, "CUST-42", unkeyed); err == nil {
+		t.Error("DestroyMatching() should refuse a token before a dry run")
+	}
+	dryRun := opts
+	dryRun.DryRun = true
+	if err := DestroyMatching(cfg, "CUST-42", dryRun); err != nil {
+		t.Fatalf("DestroyMatching() dry run error = %v", err)
+	}
+	if err := DestroyMatching(cfg, "CUST-42", unkeyed); err == nil {
+		t.Error("DestroyMatching() should refuse a token not issued by the dry run")
+	}
+	data, err := os.ReadFile(approvalPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending approval
+	if err := json.Unmarshal(data, &pending); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := hex.DecodeString(pending.Secret)
+	token := approvalToken(secret, "CUST-42", targets)
+	expired := opts
+	expired.Token = token
+	now = now.Add(approvalTTL + time.Minute)
+	if err := DestroyMatching(cfg, "CUST-42", expired); err == nil {
+		t.Error("DestroyMatching() should refuse an expired token")
+	}
+	now = now.Add(-approvalTTL)
+	if err := DestroyMatching(cfg, "CUST-42", opts); err != nil {
+		t.Fatalf("DestroyMatching() error = %v", err)
+	}
+	if again, _ := selectDestroy(cfg, "CUST-42", opts); len(again) != 3 {
+		t.Fatalf("%d item(s) left after aborting, want 3", len(again))
+	}
+
+	opts.Token = token
+	if err := DestroyMatching(cfg, "CUST-42", opts); err != nil {
+		t.Fatalf("DestroyMatching() error = %v", err)
+	}
+	if _, err := os.Stat(approvalPath()); !os.IsNotExist(err) {
+		t.Error("the approval token should be spent")
+	}
+	if left, _ := selectDestroy(cfg, "CUST-42", opts); len(left) != 0 {
+		t.Errorf("selectDestroy() after destroying = %d item(s), want none", len(left))
+	}
+	if _, err := os.Stat(filepath.Join(live, "unrelated.txt")); err != nil {
+		t.Error("unrelated live files should be kept")
+	}
+	items, err := findTrashItems(cfg.TrashDir)
+	if err != nil || len(items) != 1 {
+		t.Errorf("trash holds %d item(s), %v, want other.txt only", len(items), err)
+	}
+
+	entries, err := audit.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts := 0
+	for _, entry := range entries {
+		if entry.Action != audit.ActionDestroy || entry.Receipt == nil {
+			continue
+		}
+		receipts++
+		if entry.Receipt.Method != audit.MethodShred || entry.Receipt.Verify() != nil {
+			t.Errorf("receipt of %s = %+v", entry.Path, entry.Receipt)
+		}
+	}
+	if receipts != 3 {
+		t.Errorf("%d destroy receipt(s), want 3", receipts)
+	}
+}
+
+func TestReadOnlyItems(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-restore-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldXDG := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Setenv("XDG_STATE_HOME", oldXDG)
+
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash"), ReadOnlyItems: true}
+	project := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(project, "src"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{"src/main.go": 0644, "README": 0444} {
+		if err := os.WriteFile(filepath.Join(project, name), []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trashPath, err := trash.Move(cfg, project)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	// Nothing in the trashed directory is writable
+	for _, name := range []string{"", "src", "src/main.go", "README"} {
+		info, err := os.Stat(filepath.Join(trashPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0222 != 0 {
+			t.Errorf("trashed %q has mode %v, want no write bits", name, info.Mode().Perm())
+		}
+	}
+
+	// A file restored out of it, and then the whole directory, get their
+	// modes back
+	if err := Restore(cfg, filepath.Join(project, "src", "main.go"), RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() of a file inside error = %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(project, "src", "main.go")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("restored file = %v, %v, want mode 0644", info, err)
+	}
+	if err := os.RemoveAll(project); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(cfg, project, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	for name, want := range map[string]os.FileMode{"": 0750, "src": 0750, "src/main.go": 0644, "README": 0444} {
+		if info, err := os.Stat(filepath.Join(project, name)); err != nil || info.Mode().Perm() != want {
+			t.Errorf("restored %q = %v, %v, want mode %v", name, info, err, want)
+		}
+	}
+	if _, err := os.Stat(trashPath + trash.ModesSuffix); !os.IsNotExist(err) {
+		t.Error("the modes sidecar should be gone after the restore")
+	}
+
+	// Read-only items can still be purged
+	trashPath, err = trash.Move(cfg, project)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	meta, err := trash.GetMetadata(trashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.DeletedAt = time.Now().Add(-48 * time.Hour)
+	if err := trash.UpdateMetadata(trashPath, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := Purge(cfg, 1, PurgeOptions{}); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if items, err := findTrashItems(cfg.TrashDir); err != nil || len(items) != 0 {
+		t.Errorf("trash holds %d item(s) after the purge, %v", len(items), err)
+	}
+}
@@ -0,0 +1,105 @@
+package restore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// Expiry returns when a trashed item becomes eligible for purging under the
+// effective retention policy, and false if it is never purged automatically
+func Expiry(cfg *config.Config, meta *trash.Metadata) (time.Time, bool) {
+	days := cfg.RetentionFor(meta.Namespace)
+	if meta.Pinned || isImportant(cfg, meta) || days <= 0 {
+		return time.Time{}, false
+	}
+	return meta.DeletedAt.AddDate(0, 0, days), true
+}
+
+// isImportant reports whether a trashed item matches important_patterns and
+// is therefore exempt from purging by age, like a pinned item
+func isImportant(cfg *config.Config, meta *trash.Metadata) bool {
+	_, ok := protect.IsImportant(cfg, meta.OriginalPath)
+	return ok
+}
+
+// daysLeft describes the time remaining before an item expires
+func daysLeft(cfg *config.Config, meta *trash.Metadata) string {
+	expiry, ok := Expiry(cfg, meta)
+	if !ok {
+		if meta.Pinned {
+			return "pinned"
+		}
+		if isImportant(cfg, meta) {
+			return "important"
+		}
+		return "never"
+	}
+
+	remaining := expiry.Sub(cfg.Now())
+	switch {
+	case remaining <= 0:
+		return "expired"
+	case remaining < 24*time.Hour:
+		return "<1 day"
+	case remaining < 48*time.Hour:
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", int(remaining/(24*time.Hour)))
+}
+
+// Forecast displays the items that will be purged within the given number
+// of days, soonest first
+func Forecast(cfg *config.Config, days int, opts ListOptions) error {
+	items, err := findItems(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+
+	type forecastItem struct {
+		path   string
+		meta   *trash.Metadata
+		expiry time.Time
+	}
+
+	horizon := cfg.Now().AddDate(0, 0, days)
+	var due []forecastItem
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		expiry, ok := Expiry(cfg, meta)
+		if !ok || expiry.After(horizon) {
+			continue
+		}
+		due = append(due, forecastItem{path: item.Path, meta: meta, expiry: expiry})
+	}
+
+	if len(due) == 0 {
+		fmt.Printf("No items will be purged in the next %d day(s).\n", days)
+		return nil
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].expiry.Before(due[j].expiry)
+	})
+
+	fmt.Printf("Items purged within %d day(s) (retention: %d days):\n\n", days, cfg.RetentionDays)
+	fmt.Printf("%-10s %-30s %s\n", "LEFT", "DELETED AT", "ORIGINAL PATH")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, item := range due {
+		fmt.Printf("%-10s %-30s %s\n",
+			daysLeft(cfg, item.meta),
+			output.FormatTime(item.meta.DeletedAt, opts.TimeStyle),
+			item.meta.OriginalPath)
+	}
+
+	return nil
+}
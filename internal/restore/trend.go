@@ -0,0 +1,187 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// trendFile holds one total-size snapshot of the trash per day, as JSON lines
+const trendFile = "trend"
+
+// maxSnapshots bounds the trend file to a little over a year
+const maxSnapshots = 400
+
+// Snapshot is the size of the whole trash on one day
+type Snapshot struct {
+	Date  string `json:"date"` // YYYY-MM-DD, local time
+	Bytes int64  `json:"bytes"`
+	Items int    `json:"items"`
+}
+
+// ReadSnapshots returns the recorded snapshots, oldest first
+func ReadSnapshots() ([]Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(config.StateDir(), trendFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal([]byte(line), &snapshot); err != nil {
+			continue // Skip corrupt lines rather than losing the history
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// writeSnapshots replaces the trend file, keeping the newest maxSnapshots
+func writeSnapshots(snapshots []Snapshot) error {
+	if len(snapshots) > maxSnapshots {
+		snapshots = snapshots[len(snapshots)-maxSnapshots:]
+	}
+
+	var b strings.Builder
+	for _, snapshot := range snapshots {
+		line, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(config.StateDir(), trash.DirMode); err != nil {
+		return err
+	}
+	path := filepath.Join(config.StateDir(), trendFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), trash.MetadataMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// measure totals the items of the trash and the sibling trashes across all
+// namespaces. Directories count once the background scan has measured them.
+func measure(cfg *config.Config) (Snapshot, error) {
+	items, err := findRootItems(selectRoots(cfg, false))
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{Date: cfg.Now().Format("2006-01-02"), Items: len(items)}
+	for _, item := range items {
+		if meta, err := trash.GetMetadata(item.Path); err == nil {
+			snapshot.Bytes += meta.Size
+		}
+	}
+	return snapshot, nil
+}
+
+// recordSnapshot stores snapshot as the entry for its day
+func recordSnapshot(snapshot Snapshot) ([]Snapshot, error) {
+	snapshots, err := ReadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(snapshots); n > 0 && snapshots[n-1].Date == snapshot.Date {
+		snapshots[n-1] = snapshot
+	} else {
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, writeSnapshots(snapshots)
+}
+
+// RecordDailySnapshot records the size of the trash unless today's snapshot
+// already exists, so that only the first removal or purge of a day pays for
+// measuring it
+func RecordDailySnapshot(cfg *config.Config) error {
+	snapshots, err := ReadSnapshots()
+	if err != nil {
+		return err
+	}
+	today := cfg.Now().Format("2006-01-02")
+	if n := len(snapshots); n > 0 && snapshots[n-1].Date == today {
+		return nil
+	}
+
+	snapshot, err := measure(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = recordSnapshot(snapshot)
+	return err
+}
+
+// Trend displays the daily size of the trash over the last days days and
+// its growth, refreshing today's snapshot first
+func Trend(cfg *config.Config, days int) error {
+	current, err := measure(cfg)
+	if err != nil {
+		return err
+	}
+	snapshots, err := recordSnapshot(current)
+	if err != nil {
+		return err
+	}
+
+	since := cfg.Now().AddDate(0, 0, -days).Format("2006-01-02")
+	var shown []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Date >= since {
+			shown = append(shown, snapshot)
+		}
+	}
+
+	if len(shown) < 2 {
+		output.Printf("Trash: %d item(s), %s. Not enough history for a trend yet; snapshots are recorded daily.\n",
+			current.Items, output.FormatBytes(current.Bytes))
+		return nil
+	}
+
+	fmt.Printf("%-12s %12s %8s %13s\n", "DATE", "SIZE", "ITEMS", "CHANGE")
+	fmt.Println(strings.Repeat("-", 48))
+	for i, snapshot := range shown {
+		change := "-"
+		if i > 0 {
+			change = formatChange(snapshot.Bytes - shown[i-1].Bytes)
+		}
+		fmt.Printf("%-12s %12s %8d %13s\n", snapshot.Date, output.FormatBytes(snapshot.Bytes), snapshot.Items, change)
+	}
+
+	first, last := shown[0], shown[len(shown)-1]
+	start, _ := time.Parse("2006-01-02", first.Date)
+	end, _ := time.Parse("2006-01-02", last.Date)
+	span := int(end.Sub(start).Hours()/24 + 0.5)
+	if span < 1 {
+		span = 1
+	}
+	growth := last.Bytes - first.Bytes
+	fmt.Printf("\nGrowth since %s: %s over %d day(s), %s per day on average.\n",
+		first.Date, formatChange(growth), span, formatChange(growth/int64(span)))
+	return nil
+}
+
+// formatChange formats a size difference with its sign
+func formatChange(delta int64) string {
+	if delta < 0 {
+		return "-" + output.FormatBytes(-delta)
+	}
+	return "+" + output.FormatBytes(delta)
+}
@@ -0,0 +1,114 @@
+package restore
+
+import (
+	"fmt"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// UserUsage is the trash usage of one user
+type UserUsage struct {
+	UID     int // -1 for items trashed before the uid was recorded
+	Items   int
+	Bytes   int64
+	Pending int // Directories whose size is not known yet
+	Oldest  time.Time
+}
+
+// usageByUser aggregates the trashed items in roots per user, largest first
+func usageByUser(cfg *config.Config, roots []string) ([]*UserUsage, error) {
+	items, err := findItems(cfg, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	byUID := map[int]*UserUsage{}
+	for _, item := range items {
+		meta, err := trash.GetMetadata(item.Path)
+		if err != nil {
+			continue
+		}
+		uid := -1
+		if meta.UID != nil {
+			uid = *meta.UID
+		}
+		usage, ok := byUID[uid]
+		if !ok {
+			usage = &UserUsage{UID: uid}
+			byUID[uid] = usage
+		}
+		usage.Items++
+		usage.Bytes += meta.Size
+		if !meta.Scanned {
+			usage.Pending++
+		}
+		if usage.Oldest.IsZero() || meta.DeletedAt.Before(usage.Oldest) {
+			usage.Oldest = meta.DeletedAt
+		}
+	}
+
+	usages := make([]*UserUsage, 0, len(byUID))
+	for _, usage := range byUID {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Bytes != usages[j].Bytes {
+			return usages[i].Bytes > usages[j].Bytes
+		}
+		if usages[i].Items != usages[j].Items {
+			return usages[i].Items > usages[j].Items
+		}
+		return usages[i].UID < usages[j].UID
+	})
+	return usages, nil
+}
+
+// userName returns the login name for uid, or the number if it is unknown
+func userName(uid int) string {
+	if uid < 0 {
+		return "(unknown)"
+	}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+// Users displays the trash usage per user (items, size, oldest item),
+// largest first. It is meant for shared trash directories.
+func Users(cfg *config.Config, opts ListOptions) error {
+	usages, err := usageByUser(cfg, selectRoots(cfg, opts.AllRoots))
+	if err != nil {
+		return err
+	}
+	if len(usages) == 0 {
+		output.Printf("Trash is empty.\n")
+		return nil
+	}
+
+	fmt.Printf("%-16s %8s %8s %12s  %s\n", "USER", "UID", "ITEMS", "SIZE", "OLDEST")
+	fmt.Println(strings.Repeat("-", 80))
+	pending := 0
+	for _, usage := range usages {
+		uid := "-"
+		if usage.UID >= 0 {
+			uid = strconv.Itoa(usage.UID)
+		}
+		fmt.Printf("%-16s %8s %8d %12s  %s\n",
+			userName(usage.UID), uid, usage.Items, output.FormatBytes(usage.Bytes),
+			output.FormatTime(usage.Oldest, opts.TimeStyle))
+		pending += usage.Pending
+	}
+
+	if pending > 0 {
+		fmt.Printf("\n%d director(ies) not measured yet are counted as 0 bytes.\n", pending)
+	}
+	return nil
+}
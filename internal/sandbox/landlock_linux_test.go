@@ -0,0 +1,75 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestConfineHelper is not a test of its own: TestConfine runs it in a
+// child process, which confines itself to SAFERM_ALLOWED and then tries to
+// remove a file there and one outside
+func TestConfineHelper(t *testing.T) {
+	allowed := os.Getenv("SAFERM_ALLOWED")
+	if allowed == "" {
+		t.Skip("run by TestConfine")
+	}
+	if err := Confine([]string{allowed, "/dev/null", filepath.Join(allowed, "missing")}); err != nil {
+		t.Fatalf("Confine() error = %v", err)
+	}
+	if err := os.Remove(filepath.Join(allowed, "inside.txt")); err != nil {
+		t.Errorf("removing inside the allowed directory error = %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(allowed, "dir"), 0700); err != nil {
+		t.Errorf("creating inside the allowed directory error = %v", err)
+	}
+	if err := os.Remove(os.Getenv("SAFERM_OUTSIDE")); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("removing outside the allowed directory error = %v, want EACCES", err)
+	}
+	if err := os.WriteFile(os.Getenv("SAFERM_OUTSIDE"), []byte("changed"), 0644); err == nil {
+		t.Error("writing outside the allowed directory should fail")
+	}
+	if _, err := os.ReadFile(os.Getenv("SAFERM_OUTSIDE")); err != nil {
+		t.Errorf("reading outside the allowed directory error = %v", err)
+	}
+}
+
+func TestConfine(t *testing.T) {
+	if !Supported() {
+		t.Skip("Landlock is not available")
+	}
+	tempDir, err := os.MkdirTemp("", "saferm-sandbox-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	allowed := filepath.Join(tempDir, "trash")
+	if err := os.Mkdir(allowed, 0700); err != nil {
+		t.Fatal(err)
+	}
+	inside := filepath.Join(allowed, "inside.txt")
+	outside := filepath.Join(tempDir, "outside.txt")
+	for _, path := range []string{inside, outside} {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestConfineHelper$", "-test.v")
+	cmd.Env = append(os.Environ(), "SAFERM_ALLOWED="+allowed, "SAFERM_OUTSIDE="+outside)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("confined helper failed: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(inside); !os.IsNotExist(err) {
+		t.Error("the file inside the allowed directory should be removed")
+	}
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "data" {
+		t.Errorf("file outside = %q, %v, want it untouched", data, err)
+	}
+}
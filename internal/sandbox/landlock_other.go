@@ -0,0 +1,14 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le
+
+package sandbox
+
+// Supported reports whether Confine can confine the process; Landlock is
+// only supported on Linux
+func Supported() bool {
+	return false
+}
+
+// Confine is only supported on Linux
+func Confine(writable []string) error {
+	return ErrUnsupported
+}
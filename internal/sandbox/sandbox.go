@@ -0,0 +1,12 @@
+// Package sandbox confines the process before irreversible operations
+// (emptying, purging and shredding the trash), so that a bug in path
+// handling cannot delete or change anything outside the directories the
+// operation is meant to touch. On Linux it uses Landlock; reading stays
+// allowed everywhere.
+package sandbox
+
+import "errors"
+
+// ErrUnsupported is returned by Confine when the system cannot confine the
+// process
+var ErrUnsupported = errors.New("self-sandboxing is not supported")
@@ -0,0 +1,117 @@
+package shred
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DefaultPasses is the number of times contents are overwritten
+const DefaultPasses = 3
+
+// chunkSize is how much is written at a time
+const chunkSize = 64 * 1024
+
+// ErrLinked is returned by File for a file with other hard links: its
+// contents are still reachable (and needed) under another name
+var ErrLinked = errors.New("file has other hard links")
+
+// File overwrites the contents of the regular file at path with random
+// data, passes times, syncing each pass to disk, so that deleting it
+// afterwards does not leave the old contents on the disk. Symbolic links
+// are not followed (a link holds no contents of its own) and other
+// non-regular files are left alone. Files with other hard links fail with
+// ErrLinked and are not touched.
+//
+// Overwriting in place only helps on filesystems that write in place:
+// copy-on-write and log-structured filesystems (btrfs, ZFS, F2FS), SSD wear
+// levelling and snapshots may keep the old blocks anyway.
+func File(path string, passes int) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+		return ErrLinked
+	}
+	if passes <= 0 {
+		passes = DefaultPasses
+	}
+
+	// Read-only files are about to be deleted anyway
+	if info.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The file may have been replaced since it was looked at
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, opened) {
+		return fmt.Errorf("%s changed while shredding", path)
+	}
+
+	buf := make([]byte, chunkSize)
+	for pass := 0; pass < passes; pass++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		for remaining := info.Size(); remaining > 0; {
+			n := int64(len(buf))
+			if remaining < n {
+				n = remaining
+			}
+			if _, err := rand.Read(buf[:n]); err != nil {
+				return err
+			}
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			remaining -= n
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tree overwrites every regular file at or below root (see File), without
+// following symbolic links, and returns the files skipped because they have
+// other hard links. Names of files and directories are left as they are.
+func Tree(root string, passes int) ([]string, error) {
+	var skipped []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if err := File(path, passes); err != nil {
+			if errors.Is(err, ErrLinked) {
+				skipped = append(skipped, path)
+				return nil
+			}
+			return fmt.Errorf("cannot shred %s: %v", path, err)
+		}
+		return nil
+	})
+	return skipped, err
+}
@@ -0,0 +1,85 @@
+package shred
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-shred-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	secret := bytes.Repeat([]byte("secret key material\n"), 10000)
+	write := func(name string, mode os.FileMode) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, secret, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	root := filepath.Join(tempDir, "item")
+	plain := write("item/id_rsa", 0600)
+	readOnly := write("item/nested/token", 0400)
+	empty := filepath.Join(root, "empty")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	outside := write("outside/target", 0600)
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	linked := write("item/linked", 0600)
+	if err := os.Link(linked, filepath.Join(tempDir, "outside", "other-name")); err != nil {
+		t.Fatal(err)
+	}
+
+	skipped, err := Tree(root, 2)
+	if err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	if len(skipped) != 1 || skipped[0] != linked {
+		t.Errorf("Tree() skipped %v, want only %s", skipped, linked)
+	}
+
+	tests := []struct {
+		path        string
+		overwritten bool
+	}{
+		{plain, true},
+		{readOnly, true},
+		{outside, false},
+		{linked, false},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != len(secret) {
+				t.Errorf("size = %d, want %d", len(data), len(secret))
+			}
+			if overwritten := !bytes.Equal(data, secret); overwritten != tt.overwritten {
+				t.Errorf("overwritten = %v, want %v", overwritten, tt.overwritten)
+			}
+		})
+	}
+	if info, err := os.Stat(empty); err != nil || info.Size() != 0 {
+		t.Errorf("empty file = %v, %v", info, err)
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	if err := File(filepath.Join(os.TempDir(), "saferm-shred-missing"), 1); !os.IsNotExist(err) {
+		t.Errorf("File() of a missing file error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,78 @@
+package throttle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Where the load average and power supplies are read; replaced in tests
+var (
+	loadavgPath    = "/proc/loadavg"
+	powerSupplyDir = "/sys/class/power_supply"
+)
+
+// Busy reports why the system is not idle enough for background work: a
+// one-minute load average above maxLoad (0 skips the check), or running on
+// battery when requireAC is set. Checks that cannot be made (no
+// /proc/loadavg, no power supply information) count as idle.
+func Busy(maxLoad float64, requireAC bool) (string, bool) {
+	if maxLoad > 0 {
+		if load, err := loadAverage(); err == nil && load > maxLoad {
+			return fmt.Sprintf("load average %.2f is above %.2f", load, maxLoad), true
+		}
+	}
+	if requireAC && onBattery() {
+		return "running on battery", true
+	}
+	return "", false
+}
+
+// loadAverage returns the one-minute load average
+func loadAverage() (float64, error) {
+	data, err := os.ReadFile(loadavgPath)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected format of %s", loadavgPath)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// onBattery reports whether the system has a mains power supply and none of
+// them is online; systems without one (desktops, servers) are never on
+// battery
+func onBattery() bool {
+	supplies, err := os.ReadDir(powerSupplyDir)
+	if err != nil {
+		return false
+	}
+	mains := false
+	for _, supply := range supplies {
+		dir := filepath.Join(powerSupplyDir, supply.Name())
+		kind, _ := os.ReadFile(filepath.Join(dir, "type"))
+		if strings.TrimSpace(string(kind)) != "Mains" {
+			continue
+		}
+		mains = true
+		online, _ := os.ReadFile(filepath.Join(dir, "online"))
+		if strings.TrimSpace(string(online)) == "1" {
+			return false
+		}
+	}
+	return mains
+}
+
+// SetNice sets the CPU scheduling niceness of the calling process; 0 leaves
+// it unchanged
+func SetNice(nice int) error {
+	if nice == 0 {
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+}
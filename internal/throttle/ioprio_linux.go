@@ -0,0 +1,25 @@
+package throttle
+
+import "syscall"
+
+// ioprio_set(2) constants
+const (
+	ioprioWhoProcess  = 1
+	ioprioClassShift  = 13
+	ioprioClassBE     = 2
+	ioprioClassIdle   = 3
+	ioprioLowestLevel = 7
+)
+
+// setIOClass sets the I/O priority of the calling process with ioprio_set
+func setIOClass(class string) error {
+	prio := ioprioClassIdle << ioprioClassShift
+	if class == ClassBestEffort {
+		prio = ioprioClassBE<<ioprioClassShift | ioprioLowestLevel
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package throttle
+
+import "fmt"
+
+// setIOClass is only supported on Linux
+func setIOClass(class string) error {
+	return fmt.Errorf("I/O classes are not supported on this system")
+}
@@ -0,0 +1,84 @@
+// Package throttle limits the disk bandwidth of background work (purging,
+// archiving, scanning and cross-device copies) so that it does not compete
+// with interactive workloads
+package throttle
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// I/O scheduling classes for SetIOClass
+const (
+	ClassIdle       = "idle"        // Only use the disk when nothing else does
+	ClassBestEffort = "best-effort" // Lowest priority within the normal class
+)
+
+// chunkSize bounds the bytes written between two pauses of a Writer
+const chunkSize = 64 * 1024
+
+// now and sleep are replaced in tests
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
+// writer is an io.Writer that pauses to stay below a rate
+type writer struct {
+	w       io.Writer
+	rate    int64 // Bytes per second
+	start   time.Time
+	written int64
+}
+
+// Writer returns w limited to rate bytes per second; a rate of 0 or less
+// returns w unchanged
+func Writer(w io.Writer, rate int64) io.Writer {
+	if rate <= 0 {
+		return w
+	}
+	return &writer{w: w, rate: rate}
+}
+
+// Write writes p in chunks, pausing after each until the average rate since
+// the first write is back at the limit
+func (t *writer) Write(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = now()
+	}
+
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		n, err := t.w.Write(chunk)
+		total += n
+		t.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+
+		due := t.start.Add(time.Duration(float64(t.written) / float64(t.rate) * float64(time.Second)))
+		if wait := due.Sub(now()); wait > 0 {
+			sleep(wait)
+		}
+	}
+	return total, nil
+}
+
+// SetIOClass moves the calling process to an I/O scheduling class, like
+// ionice; an empty class leaves it unchanged
+func SetIOClass(class string) error {
+	switch class {
+	case "":
+		return nil
+	case ClassIdle, ClassBestEffort:
+		return setIOClass(class)
+	default:
+		return fmt.Errorf("unknown I/O class '%s' (expected '%s' or '%s')", class, ClassIdle, ClassBestEffort)
+	}
+}
@@ -0,0 +1,100 @@
+package throttle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	oldNow, oldSleep := now, sleep
+	defer func() { now, sleep = oldNow, oldSleep }()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := clock
+	now = func() time.Time { return clock }
+	sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	var buf bytes.Buffer
+	w := Writer(&buf, 100*1024)
+	data := make([]byte, 300*1024)
+	n, err := w.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if buf.Len() != len(data) {
+		t.Errorf("wrote %d bytes, want %d", buf.Len(), len(data))
+	}
+	if elapsed := clock.Sub(start); elapsed != 3*time.Second {
+		t.Errorf("writing 300KB at 100KB/s took %v, want 3s", elapsed)
+	}
+
+	if Writer(&buf, 0) != &buf {
+		t.Error("Writer() with rate 0 should not wrap the writer")
+	}
+}
+
+func TestSetIOClass(t *testing.T) {
+	if err := SetIOClass(""); err != nil {
+		t.Errorf("SetIOClass(\"\") error = %v", err)
+	}
+	if err := SetIOClass("realtime"); err == nil {
+		t.Error("SetIOClass() should reject unknown classes")
+	}
+}
+
+func TestBusy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-throttle-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldLoadavg, oldPower := loadavgPath, powerSupplyDir
+	defer func() { loadavgPath, powerSupplyDir = oldLoadavg, oldPower }()
+	loadavgPath = filepath.Join(tempDir, "loadavg")
+	powerSupplyDir = filepath.Join(tempDir, "power_supply")
+
+	writeSupply := func(name, kind, online string) {
+		dir := filepath.Join(powerSupplyDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, "type"), []byte(kind+"\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "online"), []byte(online+"\n"), 0644)
+	}
+
+	if _, busy := Busy(1, true); busy {
+		t.Error("missing load average and power supplies should count as idle")
+	}
+
+	if err := os.WriteFile(loadavgPath, []byte("2.50 1.00 0.50 2/300 1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reason, busy := Busy(1.5, false); !busy {
+		t.Error("load 2.50 should be busy with a maximum of 1.5")
+	} else if reason != "load average 2.50 is above 1.50" {
+		t.Errorf("reason = %q", reason)
+	}
+	if _, busy := Busy(3, false); busy {
+		t.Error("load 2.50 should be idle with a maximum of 3")
+	}
+	if _, busy := Busy(0, false); busy {
+		t.Error("a maximum of 0 should disable the load check")
+	}
+
+	writeSupply("BAT0", "Battery", "0")
+	writeSupply("AC", "Mains", "0")
+	if _, busy := Busy(0, true); !busy {
+		t.Error("offline mains supply should mean running on battery")
+	}
+	if _, busy := Busy(0, false); busy {
+		t.Error("battery should only matter when AC is required")
+	}
+	writeSupply("AC", "Mains", "1")
+	if _, busy := Busy(0, true); busy {
+		t.Error("online mains supply should not be busy")
+	}
+}
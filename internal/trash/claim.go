@@ -0,0 +1,142 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/shred"
+)
+
+// TombstoneSuffix marks an item being purged. A purge renames the item to
+// its tombstone before deleting it, so a concurrent listing sees the item
+// either whole or not at all, never a half-deleted tree.
+const TombstoneSuffix = ".saferm-purging"
+
+// isTombstone reports whether path is a tombstone rather than a trashed item
+// whose name happens to end in TombstoneSuffix (trashed before such names
+// were escaped): an item has metadata of its own
+func isTombstone(path string) bool {
+	return strings.HasSuffix(path, TombstoneSuffix) && !isItem(path)
+}
+
+// ErrBusy is returned by LockItem when another process holds the item
+var ErrBusy = errors.New("item is being restored or purged by another process")
+
+// LockItem takes the exclusive lock of a trashed item (a lock on its
+// metadata file) without waiting, failing with ErrBusy if another process
+// holds it. Restore and purge both lock the item they work on, so a purge
+// never deletes an item while a restore is copying it. Items without
+// metadata cannot be locked and are not.
+func LockItem(trashPath string) (unlock func(), err error) {
+	f, err := os.Open(metadataPath(trashPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return func() {}, nil
+		}
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrBusy
+		}
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
+
+// Discard permanently deletes a trashed item and its sidecars. The item is
+// locked, then renamed to its tombstone and only then deleted. Tombstones
+// left behind by an interrupted purge are removed by the next purge.
+func Discard(trashPath string) error {
+	return discard(trashPath, 0)
+}
+
+// Shred is Discard that first overwrites the contents of the item and its
+// metadata (which may hold an inline snapshot) passes times, see
+// shred.Tree. Files with other hard links are deleted without overwriting,
+// with a warning. If overwriting fails, the tombstone is left in place.
+func Shred(trashPath string, passes int) error {
+	if passes <= 0 {
+		passes = shred.DefaultPasses
+	}
+	return discard(trashPath, passes)
+}
+
+// discard implements Discard, shredding the item first if passes > 0
+func discard(trashPath string, passes int) error {
+	unlock, err := LockItem(trashPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tombstone := trashPath + TombstoneSuffix
+	// The rename would replace a trashed item of that name
+	if isItem(tombstone) {
+		return fmt.Errorf("cannot purge %s: the trashed item %s holds its tombstone name", trashPath, tombstone)
+	}
+	if err := os.Rename(trashPath, tombstone); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// Only the metadata (with an inline snapshot) is left
+		if passes > 0 {
+			if err := shred.File(metadataPath(trashPath), passes); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		RemoveSidecars(trashPath)
+		return nil
+	}
+	if err := fault(FaultDiscard, tombstone); err != nil {
+		return err
+	}
+	if passes > 0 {
+		skipped, err := shred.Tree(tombstone, passes)
+		if err != nil {
+			return err
+		}
+		for _, path := range skipped {
+			output.Warning("not overwriting %s: it has other hard links", path)
+		}
+		if err := shred.File(metadataPath(trashPath), passes); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return RemoveTombstone(tombstone)
+}
+
+// RemoveTombstone finishes the purge of an item renamed to tombstone: the
+// sidecars of the item go first, so that a purge interrupted at any point
+// never brings the item back (from an inline snapshot), then the tombstone,
+// and last its record in the trash index, which is how the next purge
+// finds a tombstone left behind.
+func RemoveTombstone(tombstone string) error {
+	trashPath := strings.TrimSuffix(tombstone, TombstoneSuffix)
+	// A new item of the same name owns the sidecars now
+	_, err := os.Lstat(trashPath)
+	gone := os.IsNotExist(err)
+	if gone {
+		removeSidecarFiles(trashPath)
+	}
+	if err := os.RemoveAll(tombstone); err != nil {
+		if !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+		// The directories of a read-only item are read-only too
+		allowWrites(tombstone)
+		if err := os.RemoveAll(tombstone); err != nil {
+			return err
+		}
+	}
+	if gone {
+		unindexItem(trashPath)
+	}
+	unindexItem(tombstone)
+	return nil
+}
@@ -0,0 +1,24 @@
+package trash
+
+// Points of a removal or purge at which FaultHook is called
+const (
+	FaultWrite     = "write"     // Before writing a file of a copy
+	FaultRename    = "rename"    // Before moving an item into the trash, its metadata written
+	FaultRenamed   = "renamed"   // After moving an item into the trash
+	FaultPublished = "published" // After publishing a copied item, before removing its source
+	FaultDiscard   = "discard"   // After renaming a purged item to its tombstone
+)
+
+// FaultHook, when set, is called at the points where an interruption must
+// leave the trash consistent, with the point and the path being worked on.
+// Tests set it to fail the operation there, as a full disk would, or to
+// kill the process outright. It is nil otherwise.
+var FaultHook func(point, path string) error
+
+// fault calls FaultHook, if set
+func fault(point, path string) error {
+	if FaultHook == nil {
+		return nil
+	}
+	return FaultHook(point, path)
+}
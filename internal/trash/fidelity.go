@@ -0,0 +1,174 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/output"
+)
+
+// fileID identifies a file with several hard links by its inode
+type fileID struct {
+	dev, ino uint64
+}
+
+// copier copies one tree with full fidelity. Files linked more than once
+// inside the tree are copied once and linked again, as they were.
+type copier struct {
+	integrity string
+	rate      int64
+	links     map[fileID]string // First copy of each file with several links
+	root      string            // Destination of the whole tree
+	sum       string            // Checksum of the root, a regular file copied with paranoid integrity
+}
+
+// copyTree copies the file, directory, symlink or special file at src to
+// dst with the given integrity level and rate limit, keeping the owner,
+// permissions, extended attributes (including ACLs) and times of every
+// entry, the targets of symlinks and the hard links between files. Symlinks
+// are never followed. The SHA-256 checksum of src is returned when src is a
+// regular file copied with paranoid integrity.
+func copyTree(src, dst string, integrity string, rate int64) (string, error) {
+	c := &copier{integrity: integrity, rate: rate, links: map[fileID]string{}, root: dst}
+	if err := c.copy(src, dst); err != nil {
+		return "", err
+	}
+	return c.sum, nil
+}
+
+// copy copies one entry, and a directory's contents before its attributes
+// so that creating them does not change its times
+func (c *copier) copy(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	st, _ := info.Sys().(*syscall.Stat_t)
+
+	switch {
+	case info.IsDir():
+		if err := c.copyDir(src, dst); err != nil {
+			return err
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if st != nil && st.Nlink > 1 {
+			id := fileID{uint64(st.Dev), uint64(st.Ino)}
+			if first, ok := c.links[id]; ok {
+				// The link shares the attributes of the first copy
+				return os.Link(first, dst)
+			}
+			c.links[id] = dst
+		}
+		sum, err := copyFile(src, dst, c.integrity, c.rate)
+		if err != nil {
+			return err
+		}
+		if dst == c.root {
+			c.sum = sum
+		}
+	default:
+		// Named pipes, sockets and device nodes are recreated, not read
+		if st == nil {
+			return fmt.Errorf("cannot copy special file %s", src)
+		}
+		if err := mknod(dst, st); err != nil {
+			return fmt.Errorf("cannot copy special file %s: %v", src, err)
+		}
+	}
+	return preserveAttrs(src, dst, info)
+}
+
+// copyDir copies the entries of the directory src into the new directory dst
+func (c *copier) copyDir(src, dst string) error {
+	// Owner-writable until its entries are copied; preserveAttrs then gives
+	// it the exact mode of src, including restrictive ones
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	if c.integrity != IntegrityFast {
+		if err := syncDir(filepath.Dir(dst)); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := c.copy(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preserveAttrs gives dst the owner, permissions, extended attributes and
+// times of src, described by info. Only root may give files away; other
+// users keep owning their copies, as with cp -p.
+func preserveAttrs(src, dst string, info os.FileInfo) error {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil && !errors.Is(err, syscall.EPERM) {
+			return err
+		}
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		// Writable while its attributes are set, then the mode of src,
+		// after chown, which clears the setuid and setgid bits
+		if err := os.Chmod(dst, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+		if err := copyXattrs(src, dst); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, fileMode(info.Mode())); err != nil {
+			return err
+		}
+	}
+	return setTimes(dst, info)
+}
+
+// RestoreAttrs gives a restored item at path the mode and, for root, the
+// owner recorded when it was trashed. A copy into the trash made by another
+// user belongs to that user, as only root may give files away; restoring it
+// as root hands it back to its owner.
+func RestoreAttrs(meta *Metadata, path string) error {
+	if meta.Mode == 0 || meta.Mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	if meta.OwnerUID != nil && meta.OwnerGID != nil && os.Geteuid() == 0 {
+		if err := os.Lchown(path, *meta.OwnerUID, *meta.OwnerGID); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(path, fileMode(meta.Mode))
+}
+
+// fileMode returns the permission bits of mode along with the setuid,
+// setgid and sticky bits
+func fileMode(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// skipXattr reports whether an extended attribute cannot be copied because
+// the destination filesystem does not support it or only privileged users
+// may set it (security.*, trusted.*); it is then left out
+func skipXattr(src, name string, err error) bool {
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+		output.Debugf("cannot copy extended attribute %s of %s: %v", name, src, err)
+		return true
+	}
+	return false
+}
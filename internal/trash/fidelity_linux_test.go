@@ -0,0 +1,94 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+func TestCopyTreeFidelity(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := filepath.Join(src, "sub", "data")
+	if err := os.WriteFile(data, []byte("data"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(data, filepath.Join(src, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(src, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	xattrs := syscall.Setxattr(data, "user.origin", []byte("test"), 0) == nil
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, path := range []string{data, filepath.Join(src, "sub")} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A read-only directory is still copied into
+	if err := os.Chmod(filepath.Join(src, "sub"), 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(src, "sub"), 0755)
+
+	dst := filepath.Join(tempDir, "copy")
+	if _, err := copyTree(src, dst, IntegritySafe, 0); err != nil {
+		t.Fatalf("copyTree() error = %v", err)
+	}
+	defer os.Chmod(filepath.Join(dst, "sub"), 0755)
+
+	info, err := os.Lstat(filepath.Join(dst, "sub", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+		t.Errorf("copied file mode %v, mtime %v, want 0640 and %v", info.Mode().Perm(), info.ModTime(), mtime)
+	}
+	if linked, err := os.Lstat(filepath.Join(dst, "linked")); err != nil || !os.SameFile(info, linked) {
+		t.Error("hard links should be copied as links to the same file")
+	}
+	if dir, err := os.Lstat(filepath.Join(dst, "sub")); err != nil || dir.Mode().Perm() != 0500 || !dir.ModTime().Equal(mtime) {
+		t.Errorf("copied directory = %v, %v, want mode 0500 and its mtime", dir, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "dangling")); err != nil || target != "missing" {
+		t.Errorf("copied symlink = %q, %v, want a link to missing", target, err)
+	}
+	if pipe, err := os.Lstat(filepath.Join(dst, "pipe")); err != nil || pipe.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("copied named pipe = %v, %v", pipe, err)
+	}
+	if xattrs {
+		if value, err := getXattr(filepath.Join(dst, "sub", "data"), "user.origin"); err != nil || string(value) != "test" {
+			t.Errorf("copied extended attribute = %q, %v, want test", value, err)
+		}
+	}
+
+	// The mode and owner of a trashed item are recorded for its restore
+	cfg := &config.Config{TrashDir: filepath.Join(tempDir, "trash")}
+	trashPath, err := Move(cfg, filepath.Join(dst, "linked"))
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	meta, err := GetMetadata(trashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Mode.Perm() != 0640 || meta.OwnerUID == nil || *meta.OwnerUID != os.Getuid() {
+		t.Errorf("metadata mode %v, owner %v, want 0640 and the current user", meta.Mode, meta.OwnerUID)
+	}
+}
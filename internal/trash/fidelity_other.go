@@ -0,0 +1,30 @@
+//go:build !linux
+
+package trash
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// copyXattrs is only supported on Linux; elsewhere extended attributes are
+// not copied
+func copyXattrs(src, dst string) error {
+	return nil
+}
+
+// mknod is only supported on Linux; elsewhere special files cannot be
+// copied
+func mknod(path string, st *syscall.Stat_t) error {
+	return errors.New("special files cannot be copied on this system")
+}
+
+// setTimes gives path the modification time described by info, as its
+// access time too. Symlinks keep the times they were created with.
+func setTimes(path string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,81 @@
+package trash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// keyFile holds the secret key of hashed_names, in the state directory
+const keyFile = "trash-key"
+
+// hashedNameLength is the number of hex digits of a hashed trash name
+const hashedNameLength = 32
+
+// itemPath returns where absPath goes in the trash at trashBase: below its
+// original path, or with hashed_names directly below the host directory
+// under an opaque name
+func itemPath(cfg *config.Config, trashBase, host, absPath string) (string, error) {
+	if !cfg.HashedNames {
+		return trashPathFor(trashBase, host, absPath), nil
+	}
+	name, err := hashedName(absPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot name trash entry: %v", err)
+	}
+	return filepath.Join(trashBase, host, name), nil
+}
+
+// hashedName returns the opaque trash name of absPath: an HMAC of the path,
+// so the trash reveals nothing about the deleted paths to anyone without
+// the key, not even which entries came from the same directory. The
+// original path is kept only in the 0600 metadata.
+func hashedName(absPath string) (string, error) {
+	key, err := trashKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(absPath))
+	return hex.EncodeToString(mac.Sum(nil))[:hashedNameLength], nil
+}
+
+// trashKey returns the secret key of hashed_names, creating it on first use
+func trashKey() ([]byte, error) {
+	path := filepath.Join(config.StateDir(), keyFile)
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return nil, err
+	}
+	// Publish the complete key with a link, which fails if a concurrent
+	// invocation got there first; then both use the same key
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, key, MetadataMode); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	if err := os.Link(tmp, path); err != nil {
+		if os.IsExist(err) {
+			return os.ReadFile(path)
+		}
+		return nil, err
+	}
+	return key, nil
+}
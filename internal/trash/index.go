@@ -0,0 +1,408 @@
+package trash
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/user/safe-rm/internal/output"
+)
+
+// IndexFile names the index kept at the top of a trash directory: one JSON
+// record per line, appended as items are trashed, updated and removed, so
+// that list, restore and purge need neither walk the trash nor open the
+// metadata of every item. The last record of an item wins.
+const IndexFile = ".saferm-index"
+
+// compactSlack is how many superseded records an index may hold beyond its
+// live entries before reading it rewrites it
+const compactSlack = 1000
+
+// idBytes is the number of random bytes in an item ID
+const idBytes = 6
+
+// IndexEntry is the record of one trashed item in the trash index
+type IndexEntry struct {
+	ID           string    `json:"id,omitempty"`
+	Path         string    `json:"path"` // Relative to the trash directory in the file, absolute once read
+	OriginalPath string    `json:"original_path,omitempty"`
+	DeletedAt    time.Time `json:"deleted_at,omitzero"`
+	Size         int64     `json:"size,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Removed      bool      `json:"removed,omitempty"` // The item left the trash
+}
+
+// Indexed reports whether a trash directory keeps an index. XDG trashes are
+// listed from their info directory, and sibling trashes are small and
+// removed once empty.
+func Indexed(trashDir string) bool {
+	return !IsXDGTrash(trashDir) && filepath.Base(trashDir) != SiblingDirName
+}
+
+// newItemID returns a random ID for a trashed item
+func newItemID() string {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// derivedID returns the ID of an item whose metadata has none (written by
+// older releases, or only a .trashinfo): a hash of its trash path, so it
+// stays the same
+func derivedID(trashPath string) string {
+	sum := sha256.Sum256([]byte(trashPath))
+	return hex.EncodeToString(sum[:idBytes])
+}
+
+// indexOf returns the trash directory holding an index above trashPath
+func indexOf(trashPath string) (string, bool) {
+	for dir := filepath.Dir(trashPath); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(filepath.Join(dir, IndexFile)); err == nil {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+// indexItem records the metadata of a trashed item in the index of its
+// trash, if the trash has one. Without an index nothing is recorded: the
+// first listing builds it from the trash as it is.
+func indexItem(trashPath string, meta *Metadata) {
+	appendIndex(trashPath, IndexEntry{
+		ID:           meta.ID,
+		OriginalPath: meta.OriginalPath,
+		DeletedAt:    meta.DeletedAt,
+		Size:         meta.Size,
+		Namespace:    meta.Namespace,
+	})
+}
+
+// unindexItem records in the index of its trash that an item is gone
+func unindexItem(trashPath string) {
+	appendIndex(trashPath, IndexEntry{Removed: true})
+}
+
+// appendIndex appends the record of trashPath to the index of its trash
+func appendIndex(trashPath string, entry IndexEntry) {
+	trashDir, ok := indexOf(trashPath)
+	if !ok {
+		return
+	}
+	rel, err := filepath.Rel(trashDir, trashPath)
+	if err != nil {
+		return
+	}
+	entry.Path = rel
+	if err := appendRecord(trashDir, entry); err != nil {
+		output.Debugf("failed to update trash index of %s: %v", trashDir, err)
+	}
+}
+
+// appendRecord appends one record to the index of trashDir under its lock
+func appendRecord(trashDir string, entry IndexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := lockIndex(trashDir, os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// lockIndex opens the existing index of trashDir and takes its exclusive
+// lock. An index replaced by a rewrite while waiting is opened again.
+func lockIndex(trashDir string, flag int) (*os.File, error) {
+	path := filepath.Join(trashDir, IndexFile)
+	for {
+		f, err := os.OpenFile(path, flag, MetadataMode)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, err
+		}
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// ReadIndex returns the items recorded in the index of trashDir, by path,
+// with absolute paths. It fails with an error satisfying os.IsNotExist if
+// the trash has no index yet.
+func ReadIndex(trashDir string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(trashDir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	entries, records := parseIndex(data)
+	if records > len(entries)+compactSlack {
+		if err := compactIndex(trashDir); err != nil {
+			output.Debugf("failed to compact trash index of %s: %v", trashDir, err)
+		}
+	}
+	for i := range entries {
+		entries[i].Path = filepath.Join(trashDir, entries[i].Path)
+	}
+	return entries, nil
+}
+
+// parseIndex replays the records of an index, returning the live entries
+// sorted by path and the number of records read. Unreadable lines, as left
+// by an append cut short, are skipped.
+func parseIndex(data []byte) ([]IndexEntry, int) {
+	live := map[string]IndexEntry{}
+	records := 0
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry IndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Path == "" {
+			continue
+		}
+		records++
+		if entry.Removed {
+			delete(live, entry.Path)
+		} else {
+			live[entry.Path] = entry
+		}
+	}
+
+	entries := make([]IndexEntry, 0, len(live))
+	for _, entry := range live {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, records
+}
+
+// compactIndex rewrites the index of trashDir with only its live entries
+func compactIndex(trashDir string) error {
+	f, err := lockIndex(trashDir, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	entries, _ := parseIndex(data)
+	return writeIndex(trashDir, entries)
+}
+
+// writeIndex replaces the index of trashDir with entries, whose paths are
+// relative to it. The new index is renamed into place, so a reader sees the
+// old one or the new one, never a partial index.
+func writeIndex(trashDir string, entries []IndexEntry) error {
+	tmp, err := os.CreateTemp(trashDir, IndexFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(MetadataMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(trashDir, IndexFile))
+}
+
+// Reindex rebuilds the index of trashDir by walking it, and returns the
+// number of items indexed. Moves into the trash wait for the rebuild, so
+// none is left out.
+func Reindex(trashDir string) (int, error) {
+	if !Indexed(trashDir) {
+		return 0, fmt.Errorf("%s is not indexed", trashDir)
+	}
+	if f, err := lockIndex(trashDir, os.O_RDONLY); err == nil {
+		defer f.Close()
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var entries, tombstones []IndexEntry
+	err := walkTrash(trashDir, func(path string) {
+		meta, err := GetMetadata(path)
+		if err != nil {
+			return
+		}
+		rel, err := filepath.Rel(trashDir, path)
+		if err != nil {
+			return
+		}
+		entries = append(entries, IndexEntry{
+			ID:           meta.ID,
+			Path:         rel,
+			OriginalPath: meta.OriginalPath,
+			DeletedAt:    meta.DeletedAt,
+			Size:         meta.Size,
+			Namespace:    meta.Namespace,
+		})
+	}, func(path string) {
+		if rel, err := filepath.Rel(trashDir, path); err == nil {
+			tombstones = append(tombstones, IndexEntry{Path: rel})
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := writeIndex(trashDir, append(entries, tombstones...)); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// VisitTrash calls item for each trashed item of trashDir, in lexical order,
+// with its index entry, and tombstone for each tombstone left by an
+// interrupted purge (found by the index entry of the item, or recorded by
+// a rebuild). An indexed trash is read from its index, which is built on
+// first use; an XDG trash is read from its info directory, with no index
+// entries, and a sibling trash is walked.
+func VisitTrash(trashDir string, item func(path string, entry *IndexEntry), tombstone func(path string)) error {
+	if IsXDGTrash(trashDir) {
+		return VisitXDG(trashDir, func(path string) { item(path, nil) }, tombstone)
+	}
+	if !Indexed(trashDir) {
+		return visitWalked(trashDir, item, tombstone)
+	}
+
+	entries, err := ReadIndex(trashDir)
+	if os.IsNotExist(err) {
+		if _, err := Reindex(trashDir); err != nil {
+			// A trash we cannot write to is walked every time
+			output.Debugf("cannot index %s: %v", trashDir, err)
+			return visitWalked(trashDir, item, tombstone)
+		}
+		entries, err = ReadIndex(trashDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The index is written ahead of the items it records: metadata goes
+	// before the item it describes, and a purge renames the item before
+	// it is removed from the index
+	for i := range entries {
+		path := entries[i].Path
+		if isTombstone(path) {
+			// Recorded by a rebuild that found it
+			if _, err := os.Lstat(path); err == nil {
+				tombstone(path)
+			}
+			continue
+		}
+		if _, err := os.Lstat(path + TombstoneSuffix); err == nil && isTombstone(path+TombstoneSuffix) {
+			tombstone(path + TombstoneSuffix)
+		}
+		if _, err := os.Lstat(path); err == nil || snapshotOnly(path) {
+			if _, err := os.Stat(metadataPath(path)); err == nil {
+				item(path, &entries[i])
+			}
+		}
+	}
+	return nil
+}
+
+// visitWalked is VisitTrash for a trash without an index: the trash is
+// walked and the entries made up from the metadata
+func visitWalked(trashDir string, item func(path string, entry *IndexEntry), tombstone func(path string)) error {
+	return walkTrash(trashDir, func(path string) {
+		if meta, err := GetMetadata(path); err == nil {
+			item(path, &IndexEntry{ID: meta.ID, Path: path, OriginalPath: meta.OriginalPath,
+				DeletedAt: meta.DeletedAt, Size: meta.Size, Namespace: meta.Namespace})
+		}
+	}, tombstone)
+}
+
+// walkTrash walks a safe-rm trash directory in lexical order, calling item
+// for each trashed item (a file or directory with metadata next to it,
+// not descended into) and tombstone for each tombstone
+func walkTrash(trashDir string, item, tombstone func(path string)) error {
+	return filepath.Walk(trashDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip errors
+		}
+
+		// Skip the root trash directory itself, its index and sidecar
+		// files; an item whose payload is gone lives on in the inline
+		// snapshot in its metadata
+		if path == trashDir || strings.HasPrefix(filepath.Base(path), IndexFile) {
+			return nil
+		}
+		if IsSidecar(path) {
+			if trashPath, ok := SnapshotOnly(path); ok {
+				item(trashPath)
+			}
+			return nil
+		}
+		// Copies still in progress (or interrupted) are not items yet,
+		// and tombstones are no longer items, unless metadata of their
+		// own makes them trashed items
+		staging := strings.HasSuffix(path, PartialSuffix) && !isItem(path)
+		if staging || isTombstone(path) {
+			if !staging {
+				tombstone(path)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Check if there's a metadata file for this item
+		if _, err := os.Stat(metadataPath(path)); err == nil {
+			item(path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+
+		return nil
+	})
+}
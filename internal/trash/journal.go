@@ -0,0 +1,248 @@
+package trash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+)
+
+// journalDir is the directory under the state dir holding session journals
+const journalDir = "sessions"
+
+// JournalEntry records a copy into the trash that has started but not yet
+// completed. The copy is staged at TrashPath+PartialSuffix, so an interrupted
+// entry either still has its whole source at OriginalPath, or (interrupted
+// while removing the source) is already complete at TrashPath.
+type JournalEntry struct {
+	OriginalPath string    `json:"original_path"`
+	TrashPath    string    `json:"trash_path"`
+	TrashDir     string    `json:"trash_dir"`
+	IsDirectory  bool      `json:"is_directory"`
+	Namespace    string    `json:"namespace,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+
+	// Device and inode of the source: --resume leaves a source that is no
+	// longer the same file alone
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+}
+
+// Journal holds the interrupted removals of one session
+type Journal struct {
+	Session string         `json:"session"`
+	Pending []JournalEntry `json:"pending"`
+}
+
+// InterruptedError reports a removal that failed partway through and was
+// recorded in the session journal for --resume
+type InterruptedError struct {
+	Session string
+	Err     error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%v (progress saved; fix the problem and run with --resume=%s)", e.Err, e.Session)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Resumed describes an item whose removal was completed by Resume
+type Resumed struct {
+	OriginalPath string
+	TrashPath    string
+}
+
+// journalPath returns the journal file of a session; SAFERM_SESSION is user
+// supplied, so path separators are kept out of the file name
+func journalPath(session string) string {
+	name := strings.ReplaceAll(session, string(os.PathSeparator), "_")
+	return filepath.Join(config.StateDir(), journalDir, name+".json")
+}
+
+// ReadJournal loads the journal of a session; a missing journal is empty
+func ReadJournal(session string) (*Journal, error) {
+	journal := &Journal{Session: session}
+	data, err := os.ReadFile(journalPath(session))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return journal, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("corrupt session journal %s: %v", journalPath(session), err)
+	}
+	return journal, nil
+}
+
+// writeJournal saves the journal, removing its file once nothing is pending
+func writeJournal(journal *Journal) error {
+	path := journalPath(journal.Session)
+	if len(journal.Pending) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), DirMode); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, MetadataMode)
+}
+
+// startJournal records entry as pending for session
+func startJournal(session string, entry JournalEntry) error {
+	journal, err := ReadJournal(session)
+	if err != nil {
+		return err
+	}
+	journal.Pending = append(journal.Pending, entry)
+	return writeJournal(journal)
+}
+
+// finishJournal removes the pending entry for trashPath from session
+func finishJournal(session, trashPath string) error {
+	journal, err := ReadJournal(session)
+	if err != nil {
+		return err
+	}
+	pending := journal.Pending[:0]
+	for _, entry := range journal.Pending {
+		if entry.TrashPath != trashPath {
+			pending = append(pending, entry)
+		}
+	}
+	journal.Pending = pending
+	return writeJournal(journal)
+}
+
+// Resume completes the interrupted removals recorded for session. An item
+// already published in the trash only needs what remains of its source
+// removed; otherwise the copy starts over. Entries that fail again stay in
+// the journal.
+func Resume(cfg *config.Config, session string) ([]Resumed, error) {
+	journal, err := ReadJournal(session)
+	if err != nil {
+		return nil, err
+	}
+	if len(journal.Pending) == 0 {
+		return nil, fmt.Errorf("no interrupted removals recorded for session %s", session)
+	}
+
+	var resumed []Resumed
+	for _, entry := range journal.Pending {
+		if err := checkResumable(cfg, session, entry); err != nil {
+			return resumed, err
+		}
+
+		sum := ""
+		if _, err := os.Lstat(entry.TrashPath); err == nil {
+			if err := os.RemoveAll(entry.OriginalPath); err != nil {
+				return resumed, &InterruptedError{Session: session, Err: err}
+			}
+		} else if _, err := os.Lstat(entry.OriginalPath); err == nil {
+			integrity := copyIntegrity(cfg)
+			if _, critical := protect.IsCritical(cfg, entry.OriginalPath); critical {
+				integrity = IntegrityParanoid
+			}
+			if sum, err = copyAndDelete(entry.OriginalPath, entry.TrashPath, integrity, int64(cfg.ThrottleRate)); err != nil {
+				var cleanup *CleanupError
+				if !errors.As(err, &cleanup) {
+					err = checkUnavailable(entry.TrashDir, err)
+				}
+				return resumed, &InterruptedError{Session: session, Err: err}
+			}
+		} else if !os.IsNotExist(err) {
+			return resumed, err
+		}
+
+		// The metadata written before the interrupted copy describes the
+		// item; it is only made up if writing it failed then
+		metadata, err := GetMetadata(entry.TrashPath)
+		if err != nil {
+			metadata = &Metadata{
+				Version:      MetadataVersion,
+				OriginalPath: entry.OriginalPath,
+				DeletedAt:    cfg.Now(),
+				Hostname:     cfg.Host(),
+				IsDirectory:  entry.IsDirectory,
+				Session:      session,
+				Namespace:    entry.Namespace,
+				UID:          currentUID(),
+				ParentModes:  parentModes(entry.OriginalPath),
+			}
+		}
+		if sum != "" {
+			metadata.SHA256 = sum
+		}
+		if err := writeMetadata(metadataPath(entry.TrashPath), metadata); err != nil {
+			return resumed, fmt.Errorf("failed to write metadata: %v", err)
+		}
+		sealItem(cfg, entry.TrashPath, metadata)
+		if entry.IsDirectory {
+			if err := queueScan(entry.TrashPath); err != nil {
+				output.Debugf("failed to queue scan of %s: %v", entry.TrashPath, err)
+			}
+		}
+
+		if err := finishJournal(session, entry.TrashPath); err != nil {
+			return resumed, err
+		}
+		resumed = append(resumed, Resumed{OriginalPath: entry.OriginalPath, TrashPath: entry.TrashPath})
+	}
+
+	return resumed, nil
+}
+
+// checkResumable refuses to resume entry unless it is still the removal the
+// session started: a published item must have been trashed by the session,
+// and a source still present must be the same file (not one created at its
+// path since the interruption) and not blocked by a protection rule
+func checkResumable(cfg *config.Config, session string, entry JournalEntry) error {
+	if _, err := os.Lstat(entry.TrashPath); err == nil {
+		meta, err := GetMetadata(entry.TrashPath)
+		if err != nil || meta.Session != session {
+			return fmt.Errorf("%s was not trashed by session %s, leaving %s alone", entry.TrashPath, session, entry.OriginalPath)
+		}
+	}
+
+	info, err := os.Lstat(entry.OriginalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if id := identify(info); id == (fileID{}) || id != (fileID{entry.Device, entry.Inode}) {
+		return fmt.Errorf("%s has changed since session %s was interrupted, leaving it alone", entry.OriginalPath, session)
+	}
+	if status := protect.Check(cfg, entry.OriginalPath, entry.IsDirectory); status.Protected && status.Action == protect.ActionBlock {
+		return fmt.Errorf("%s is protected (%s), leaving it alone", entry.OriginalPath, status.Reason)
+	}
+	return nil
+}
+
+// identify returns the device and inode of a file, or zeros where the
+// platform reports none
+func identify(info os.FileInfo) fileID {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileID{uint64(st.Dev), uint64(st.Ino)}
+	}
+	return fileID{}
+}
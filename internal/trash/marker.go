@@ -0,0 +1,202 @@
+package trash
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+)
+
+// Files marking the top of a trash directory created by safe-rm: a note for
+// whoever comes across the directory, and the format of the trash. Only
+// directories holding the format file are listed, purged or emptied, so a
+// mistyped SAFERM_TRASH or --trash-dir pointing at real data is refused
+// instead of being cleaned up.
+const (
+	ReadmeFile = "README.safe-rm"
+	FormatFile = ".saferm-format"
+)
+
+// TrashFormat is the trash format version written by this build
+const TrashFormat = 1
+
+// readme is the contents of ReadmeFile
+const readme = `This directory is a safe-rm trash.
+
+Files and directories removed with safe-rm are kept here, below a directory
+named after the host that removed them, each with a .saferm-meta file
+recording where it came from. Use 'safe-rm list' and 'safe-rm restore PATH'
+(or rm --safe-list and rm --safe-restore=PATH) to get them back.
+
+Items are deleted for good by 'safe-rm purge' and 'safe-rm empty'. The
+.saferm-format file marks this directory as a trash for them; without it,
+safe-rm refuses to touch the directory.
+`
+
+// NotTrashError is returned for a trash directory without the format file
+// that does not look like a trash written by an older release either
+type NotTrashError struct {
+	TrashDir string
+}
+
+func (e *NotTrashError) Error() string {
+	return fmt.Sprintf("%s does not look like a safe-rm trash (it has no %s file); "+
+		"check SAFERM_TRASH, --trash-dir and trash_dir, or pass --assume-trash if it is one", e.TrashDir, FormatFile)
+}
+
+// InitRoot prepares trashDir for items to be moved into it: a missing
+// directory is created with DirMode and marked, and an existing one must
+// pass MarkRoot
+func InitRoot(cfg *config.Config, trashDir string) error {
+	if _, err := os.Lstat(trashDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(trashDir, DirMode); err != nil {
+			return err
+		}
+		// MkdirAll honours the umask
+		if err := os.Chmod(trashDir, DirMode); err != nil {
+			return err
+		}
+		return writeMarker(trashDir)
+	}
+	return MarkRoot(cfg, trashDir)
+}
+
+// CheckRoot verifies that trashDir, if it exists, is a safe-rm trash that
+// may be listed, purged or emptied. A directory without the format file is
+// accepted if it is empty or was evidently written by an older release (see
+// legacyTrash), or with cfg.AssumeTrash. CheckRoot only reads; commands that
+// change the trash mark it with MarkRoot.
+// XDG and sibling trashes are recognized by their names.
+func CheckRoot(cfg *config.Config, trashDir string) error {
+	if IsXDGTrash(trashDir) || filepath.Base(trashDir) == SiblingDirName {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(trashDir, FormatFile))
+	if err == nil {
+		var version int
+		if _, err := fmt.Sscanf(string(data), "safe-rm trash format %d", &version); err != nil {
+			return fmt.Errorf("%s: unrecognized %s", trashDir, FormatFile)
+		}
+		if version > TrashFormat {
+			return fmt.Errorf("%s uses trash format %d, newer than this safe-rm supports (%d); please upgrade", trashDir, version, TrashFormat)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if info, err := os.Stat(trashDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", trashDir)
+	}
+
+	if !cfg.AssumeTrash && !legacyTrash(cfg, trashDir) {
+		return &NotTrashError{TrashDir: trashDir}
+	}
+	return nil
+}
+
+// MarkRoot is CheckRoot for commands that change the trash: an accepted
+// directory without the format file is marked, so that later commands
+// recognize it without --assume-trash
+func MarkRoot(cfg *config.Config, trashDir string) error {
+	if err := CheckRoot(cfg, trashDir); err != nil {
+		return err
+	}
+	if IsXDGTrash(trashDir) || filepath.Base(trashDir) == SiblingDirName {
+		return nil
+	}
+	if _, err := os.Stat(trashDir); err != nil {
+		return nil
+	}
+	if _, err := os.Lstat(filepath.Join(trashDir, FormatFile)); !os.IsNotExist(err) {
+		return nil
+	}
+	// A trash we cannot write to (another user's, a read-only mount) is
+	// still accepted
+	if err := writeMarker(trashDir); err != nil {
+		output.Debugf("%v", err)
+	}
+	return nil
+}
+
+// ValidateRoot is MarkRoot for purging and emptying, which delete whatever
+// they find: it also refuses directories that no trash should be, marker or
+// not. These are the root directory, the home directory and the
+// directories above it, and mount points, where emptying the trash would
+// empty a whole filesystem. Symbolic links are resolved first.
+func ValidateRoot(cfg *config.Config, trashDir string) error {
+	resolved, err := filepath.EvalSymlinks(trashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		if real, err := filepath.EvalSymlinks(home); err == nil {
+			home = real
+		}
+	}
+
+	switch {
+	case resolved == filepath.Dir(resolved):
+		return fmt.Errorf("refusing to use %s as the trash: it is the root directory", trashDir)
+	case home != "" && resolved == home:
+		return fmt.Errorf("refusing to use %s as the trash: it is the home directory", trashDir)
+	case home != "" && isWithin(home, resolved):
+		return fmt.Errorf("refusing to use %s as the trash: it contains the home directory", trashDir)
+	case protect.IsMountPoint(resolved):
+		return fmt.Errorf("refusing to use %s as the trash: it is a mount point; use a directory below it", trashDir)
+	}
+	return MarkRoot(cfg, trashDir)
+}
+
+// legacyTrash reports whether trashDir may be taken for a trash without the
+// format file: it is empty, or it was written by a release from before the
+// format file, which kept an index or items with metadata below a host
+// directory. A directory that merely has a subdirectory named after the
+// host is not enough.
+func legacyTrash(cfg *config.Config, trashDir string) bool {
+	if entries, err := os.ReadDir(trashDir); err == nil && len(entries) == 0 {
+		return true
+	}
+	if _, err := os.Lstat(filepath.Join(trashDir, IndexFile)); err == nil {
+		return true
+	}
+	found := false
+	filepath.WalkDir(filepath.Join(trashDir, cfg.Host()), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() && strings.HasSuffix(path, ".saferm-meta") {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// writeMarker writes the readme and format file to the top of trashDir,
+// keeping a readme that is already there
+func writeMarker(trashDir string) error {
+	readmePath := filepath.Join(trashDir, ReadmeFile)
+	if _, err := os.Lstat(readmePath); os.IsNotExist(err) {
+		if err := os.WriteFile(readmePath, []byte(readme), MetadataMode); err != nil {
+			return fmt.Errorf("failed to mark trash directory: %v", err)
+		}
+	}
+	format := fmt.Sprintf("safe-rm trash format %d\n", TrashFormat)
+	if err := os.WriteFile(filepath.Join(trashDir, FormatFile), []byte(format), MetadataMode); err != nil {
+		return fmt.Errorf("failed to mark trash directory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// MigrateHost moves the items a trash directory holds for host oldHost to
+// newHost, for a trash carried over to a new machine (e.g. in a synced home
+// directory): the per-host directory is renamed, or merged into an existing
+// one, and the host name in the metadata of every item is rewritten. Sibling
+// trashes have no per-host directories and only get their metadata
+// rewritten; XDG trashes record no host and are left alone. Returns the
+// number of items migrated.
+func MigrateHost(cfg *config.Config, trashDir, oldHost, newHost string) (int, error) {
+	for _, host := range []string{oldHost, newHost} {
+		if host == "" || host == "." || host == ".." || strings.ContainsRune(host, filepath.Separator) {
+			return 0, fmt.Errorf("invalid host name: '%s'", host)
+		}
+	}
+	if oldHost == newHost {
+		return 0, fmt.Errorf("old and new host names are the same: %s", oldHost)
+	}
+	if IsXDGTrash(trashDir) {
+		return 0, nil
+	}
+
+	if Indexed(trashDir) {
+		if err := moveHostDir(cfg, trashDir, oldHost, newHost); err != nil {
+			return 0, err
+		}
+	}
+
+	migrated := 0
+	err := walkTrash(trashDir, func(path string) {
+		meta, err := GetMetadata(path)
+		if err != nil || meta.Hostname != oldHost {
+			return
+		}
+		meta.Hostname = newHost
+		if err := UpdateMetadata(path, meta); err != nil {
+			return
+		}
+		migrated++
+		// Scans queued under the old path would find nothing
+		if meta.IsDirectory && !meta.Scanned {
+			if err := queueScan(path); err != nil {
+				output.Debugf("failed to queue scan of %s: %v", path, err)
+			}
+		}
+	}, func(string) {})
+	if err != nil {
+		return migrated, err
+	}
+
+	if Indexed(trashDir) {
+		if _, err := Reindex(trashDir); err != nil {
+			return migrated, fmt.Errorf("failed to reindex %s: %v", trashDir, err)
+		}
+	}
+	return migrated, nil
+}
+
+// moveHostDir renames the directory of oldHost in trashDir to that of
+// newHost, or moves its items one by one into an existing one. Items whose
+// path is taken there, by an item or by a payload without metadata, get a
+// unique timestamped name, as conflicting removals do. Moves into the trash
+// wait for it to finish.
+func moveHostDir(cfg *config.Config, trashDir, oldHost, newHost string) error {
+	src := filepath.Join(trashDir, oldHost)
+	dst := filepath.Join(trashDir, newHost)
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	if f, err := lockIndex(trashDir, os.O_RDONLY); err == nil {
+		defer f.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("failed to move %s: %v", src, err)
+		}
+		return nil
+	}
+
+	var items []string
+	if err := walkTrash(src, func(path string) { items = append(items, path) }, func(string) {}); err != nil {
+		return err
+	}
+	for _, item := range items {
+		rel, err := filepath.Rel(src, item)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dst, rel)), DirMode); err != nil {
+			return fmt.Errorf("failed to create trash directory: %v", err)
+		}
+		// The name is reserved by a metadata placeholder, which the item's
+		// own metadata replaces
+		target, err := reserveItemPath(cfg, filepath.Join(dst, rel))
+		if err != nil {
+			return fmt.Errorf("failed to reserve a name for %s: %v", item, err)
+		}
+		if _, err := os.Lstat(metadataPath(item)); os.IsNotExist(err) {
+			os.Remove(metadataPath(target))
+		}
+		for _, suffix := range []string{"", FilesSuffix, ManifestSuffix, ModesSuffix, ".saferm-meta"} {
+			if err := os.Rename(item+suffix, target+suffix); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to move %s: %v", item, err)
+			}
+		}
+	}
+	removeEmptyDirs(src)
+	return nil
+}
+
+// removeEmptyDirs removes dir and the directories below it that are (or
+// become) empty
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, entry.Name()))
+		}
+	}
+	removeIfEmpty(dir)
+}
@@ -0,0 +1,226 @@
+package trash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Per-mount trash creation policies (mount_trash_create)
+const (
+	MountTrashAuto     = "auto"     // Create the per-mount trash when first needed
+	MountTrashExisting = "existing" // Only use per-mount trashes that already exist
+)
+
+// What happens to items on mounts excluded by mount_trash_exclude
+// (mount_trash_fallback)
+const (
+	MountFallbackCopy      = "copy"      // Copy them into trash_dir, as cross_device copy does
+	MountFallbackPermanent = "permanent" // Delete them without moving them to a trash
+)
+
+// ErrDeleteDirectly is returned by Move for items on a mount excluded from
+// per-mount trashes with mount_trash_fallback permanent, and on removable
+// media with removable_media permanent: the caller deletes them instead, as
+// with --permanent
+var ErrDeleteDirectly = errors.New("to be deleted without a trash")
+
+// mountTrashName returns the name of the trash kept at the top of other
+// filesystems with cross_device mount: .safe-rm-trash-$UID, or .Trash-$UID
+// as the freedesktop.org specification names it for the xdg backend
+func mountTrashName(cfg *config.Config) string {
+	if cfg.TrashBackend == BackendXDG {
+		return fmt.Sprintf(".Trash-%d", os.Getuid())
+	}
+	return fmt.Sprintf(".safe-rm-trash-%d", os.Getuid())
+}
+
+// MountTrashes returns the per-mount trashes of the configured backend
+// present on mounted filesystems; list, restore and purge include them
+func MountTrashes(cfg *config.Config) []string {
+	name := mountTrashName(cfg)
+
+	var dirs []string
+	for _, mountPoint := range mountPoints() {
+		dir := filepath.Join(mountPoint, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() && dir != cfg.GetTrashDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// deviceOf returns the device of path, or of its nearest existing ancestor
+func deviceOf(path string) (uint64, error) {
+	for {
+		var st syscall.Stat_t
+		err := syscall.Stat(path, &st)
+		if err == nil {
+			return uint64(st.Dev), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return 0, err
+		}
+		path = parent
+	}
+}
+
+// mountPointOf returns the top directory of the filesystem holding dir
+func mountPointOf(dir string) (string, error) {
+	dev, err := deviceOf(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		if parentDev, err := deviceOf(parent); err != nil || parentDev != dev {
+			return dir, err
+		}
+		dir = parent
+	}
+}
+
+// mountTrashFor returns the trash at the top of the filesystem holding
+// absPath when that is not the filesystem of the trash, so the item can be
+// renamed there rather than copied. The trash is created if needed, and
+// refused unless it is a private directory of the current user on that
+// filesystem: anyone can create .Trash-$UID on a shared filesystem.
+func mountTrashFor(cfg *config.Config, absPath string) (string, bool) {
+	itemDev, err := deviceOf(filepath.Dir(absPath))
+	if err != nil {
+		return "", false
+	}
+	if trashDev, err := deviceOf(cfg.GetTrashDir()); err != nil || trashDev == itemDev {
+		return "", false
+	}
+	top, err := mountPointOf(filepath.Dir(absPath))
+	if err != nil {
+		return "", false
+	}
+
+	dir := filepath.Join(top, mountTrashName(cfg))
+	if mountTrashCreate(cfg) == MountTrashExisting {
+		if _, err := os.Lstat(dir); err != nil {
+			output.Debugf("no trash %s and mount_trash_create is %s", dir, MountTrashExisting)
+			return "", false
+		}
+	} else if err := os.Mkdir(dir, DirMode); err != nil && !os.IsExist(err) {
+		output.Debugf("cannot create trash %s: %v", dir, err)
+		return "", false
+	}
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if int(st.Uid) != os.Getuid() || info.Mode().Perm()&0077 != 0 || uint64(st.Dev) != itemDev {
+		output.Warning("not using trash %s: not a private directory of yours on %s", dir, top)
+		return "", false
+	}
+	if cfg.TrashBackend == BackendXDG {
+		for _, sub := range []string{"files", "info"} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), DirMode); err != nil {
+				return "", false
+			}
+		}
+	}
+	return dir, true
+}
+
+// excludedMount reports whether absPath is on another filesystem than the
+// trash whose mount point, or filesystem type, is listed in
+// mount_trash_exclude, returning the mount point
+func excludedMount(cfg *config.Config, absPath string) (string, bool) {
+	if len(cfg.MountTrashExclude) == 0 {
+		return "", false
+	}
+	itemDev, err := deviceOf(filepath.Dir(absPath))
+	if err != nil {
+		return "", false
+	}
+	if trashDev, err := deviceOf(cfg.GetTrashDir()); err != nil || trashDev == itemDev {
+		return "", false
+	}
+	top, err := mountPointOf(filepath.Dir(absPath))
+	if err != nil {
+		return "", false
+	}
+
+	fsType := mountType(top)
+	for _, exclude := range cfg.MountTrashExclude {
+		if strings.HasPrefix(exclude, "/") || strings.HasPrefix(exclude, "~") {
+			if matched, _ := filepath.Match(filepath.Clean(config.ExpandHome(exclude)), top); matched {
+				return top, true
+			}
+		} else if fsType != "" && exclude == fsType {
+			return top, true
+		}
+	}
+	return top, false
+}
+
+// mountType returns the filesystem type mounted at mountPoint, or "" if it
+// is not known
+func mountType(mountPoint string) string {
+	_, fsType := mountEntry(mountPoint)
+	return fsType
+}
+
+// mountEntry returns the source (such as a device node) and the filesystem
+// type mounted at mountPoint, or "" for what is not known
+func mountEntry(mountPoint string) (source, fsType string) {
+	f, err := os.Open(mountsFile)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	// The last mount on a mount point hides earlier ones
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && unescapeMountField(fields[1]) == mountPoint {
+			source, fsType = unescapeMountField(fields[0]), fields[2]
+		}
+	}
+	return source, fsType
+}
+
+// mountTrashCreate returns the configured creation policy of per-mount
+// trashes, defaulting to auto
+func mountTrashCreate(cfg *config.Config) string {
+	switch cfg.MountTrashCreate {
+	case MountTrashAuto, MountTrashExisting:
+		return cfg.MountTrashCreate
+	case "":
+		return MountTrashAuto
+	default:
+		output.Warning("unknown mount_trash_create '%s', using '%s'", cfg.MountTrashCreate, MountTrashAuto)
+		return MountTrashAuto
+	}
+}
+
+// mountFallback returns what happens to items on excluded mounts,
+// defaulting to copy
+func mountFallback(cfg *config.Config) string {
+	switch cfg.MountTrashFallback {
+	case MountFallbackCopy, MountFallbackPermanent:
+		return cfg.MountTrashFallback
+	case "":
+		return MountFallbackCopy
+	default:
+		output.Warning("unknown mount_trash_fallback '%s', using '%s'", cfg.MountTrashFallback, MountFallbackCopy)
+		return MountFallbackCopy
+	}
+}
@@ -0,0 +1,67 @@
+package trash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// OperationFile records the last operation of the user that moved items to
+// the trash, for --safe-undo
+const OperationFile = "last-operation"
+
+// Operation is an invocation that moved items to the trash. Its items carry
+// its session in their metadata.
+type Operation struct {
+	Session string    `json:"session"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command,omitempty"` // Command line, for display
+}
+
+// OperationPath returns the location of the last operation file
+func OperationPath() string {
+	return filepath.Join(config.StateDir(), OperationFile)
+}
+
+// RecordOperation makes op the last operation
+func RecordOperation(op Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return err
+	}
+	tmp := OperationPath() + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), MetadataMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, OperationPath())
+}
+
+// LastOperation returns the last operation, or nil if there is none to undo
+func LastOperation() (*Operation, error) {
+	data, err := os.ReadFile(OperationPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var op Operation
+	if err := json.Unmarshal(data, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// ForgetOperation clears the last operation once it has been undone
+func ForgetOperation() error {
+	if err := os.Remove(OperationPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
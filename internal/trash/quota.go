@@ -0,0 +1,160 @@
+package trash
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/user/safe-rm/internal/audit"
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+	"github.com/user/safe-rm/internal/shred"
+)
+
+// quotaItem is a trashed item considered for eviction under max_trash_size
+type quotaItem struct {
+	path      string
+	size      int64
+	deletedAt time.Time
+}
+
+// QuotaError reports that an item does not fit under max_trash_size. Unlike
+// an UnavailableError, it does not send the item to fallback_trash_dir,
+// where it would escape the quota.
+type QuotaError struct {
+	TrashDir string
+	Reason   string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("trash %s is full: %s\n"+
+		"  Purge or unpin items, raise max_trash_size,\n"+
+		"  or use --permanent to delete without moving to trash.", e.TrashDir, e.Reason)
+}
+
+// reserveQuota makes room under max_trash_size for absPath, described by
+// info, before it is moved into trashBase, and returns its size. The quota
+// covers the configured trash only; with no quota, or for other trash
+// directories (sibling, per-mount and fallback trashes), it returns -1.
+func reserveQuota(cfg *config.Config, trashBase, absPath string, info os.FileInfo) (int64, error) {
+	quota := int64(cfg.MaxTrashSize)
+	if quota <= 0 || trashBase != cfg.GetTrashDir() {
+		return -1, nil
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		var err error
+		if size, err = Size(absPath); err != nil {
+			return -1, err
+		}
+	}
+	if size > quota {
+		return -1, &QuotaError{
+			TrashDir: trashBase,
+			Reason: fmt.Sprintf("%s (%s) is larger than max_trash_size (%s)",
+				absPath, output.FormatBytes(size), output.FormatBytes(quota)),
+		}
+	}
+
+	items, used, err := quotaUsage(trashBase)
+	if err != nil {
+		return -1, err
+	}
+	if used+size <= quota {
+		return size, nil
+	}
+
+	// Oldest first; pinned and important items are kept like they are by
+	// purging
+	sort.Slice(items, func(i, j int) bool { return items[i].deletedAt.Before(items[j].deletedAt) })
+	for _, item := range items {
+		if used+size <= quota {
+			break
+		}
+		meta, err := GetMetadata(item.path)
+		if err != nil || meta.Pinned {
+			continue
+		}
+		if _, important := protect.IsImportant(cfg, meta.OriginalPath); important {
+			continue
+		}
+		receipt := PurgeReceipt(cfg, item.path, meta.OriginalPath, DiscardMethod(cfg))
+		if err := DiscardItem(cfg, item.path); err != nil {
+			output.Debugf("failed to evict %s: %v", item.path, err)
+			continue
+		}
+		used -= item.size
+		entry := audit.Entry{Action: audit.ActionEvict, Path: meta.OriginalPath, TrashPath: item.path, Bytes: item.size, Receipt: receipt}
+		if err := audit.Record(cfg, entry); err != nil {
+			output.Warning("failed to write audit log: %v", err)
+		}
+		output.Verbosef("Evicted: %s (%s, deleted at %s) to stay within max_trash_size\n",
+			meta.OriginalPath, output.FormatBytes(item.size), meta.DeletedAt.Format("2006-01-02"))
+	}
+
+	if used+size > quota {
+		return -1, &QuotaError{
+			TrashDir: trashBase,
+			Reason: fmt.Sprintf("max_trash_size (%s) reached and only pinned or important items are left to evict",
+				output.FormatBytes(quota)),
+		}
+	}
+	return size, nil
+}
+
+// quotaUsage returns the items of trashDir with their sizes, and their
+// total. Directories the scanner has not measured yet are measured now.
+func quotaUsage(trashDir string) ([]quotaItem, int64, error) {
+	var items []quotaItem
+	var used int64
+	err := VisitTrash(trashDir, func(path string, entry *IndexEntry) {
+		item := quotaItem{path: path}
+		if entry != nil {
+			item.size, item.deletedAt = entry.Size, entry.DeletedAt
+		} else if meta, err := GetMetadata(path); err == nil {
+			item.size, item.deletedAt = meta.Size, meta.DeletedAt
+		}
+		if item.size == 0 {
+			item.size, _ = Size(path)
+		}
+		items = append(items, item)
+		used += item.size
+	}, func(string) {})
+	return items, used, err
+}
+
+// DiscardItem permanently deletes a trashed item for a purge, an empty or
+// to make room under max_trash_size, overwriting its contents first with
+// shred_on_empty (or --shred)
+func DiscardItem(cfg *config.Config, trashPath string) error {
+	if cfg.ShredOnEmpty {
+		return Shred(trashPath, shred.DefaultPasses)
+	}
+	return Discard(trashPath)
+}
+
+// DiscardMethod returns how DiscardItem destroys items, for their receipts
+func DiscardMethod(cfg *config.Config) string {
+	if cfg.ShredOnEmpty {
+		return audit.MethodShred
+	}
+	return audit.MethodDelete
+}
+
+// PurgeReceipt checksums a trashed item about to be destroyed with method,
+// for its receipt with purge_receipts. Without them, or if the item cannot
+// be read, there is none.
+func PurgeReceipt(cfg *config.Config, trashPath, originalPath, method string) *audit.Receipt {
+	if !cfg.PurgeReceipts {
+		return nil
+	}
+	receipt, err := audit.NewReceipt(originalPath, trashPath, method)
+	if err != nil {
+		output.Warning("cannot checksum %s for its purge receipt: %v", trashPath, err)
+		return nil
+	}
+	return receipt
+}
@@ -0,0 +1,215 @@
+package trash
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// ModesSuffix names the sidecar of an item made read-only (read_only_items)
+// recording the modes of the entries below it
+const ModesSuffix = ".saferm-modes"
+
+// ModeEntry is an entry below a trashed directory whose write bits were
+// removed, with the mode it had before
+type ModeEntry struct {
+	Path string      `json:"path"` // Relative to the trashed directory
+	Mode os.FileMode `json:"mode"`
+}
+
+// writeBits are removed from read-only items
+const writeBits = 0222
+
+// Seal makes a trashed item read-only, so that tools still using old paths
+// cannot change it in the trash: the write bits of the item and of every
+// entry below it are removed. The modes they had are recorded (the item's
+// in its metadata, the others in its modes sidecar) for Unseal. Symlinks
+// have no modes of their own and are left alone.
+func Seal(trashPath string, meta *Metadata) error {
+	var entries []ModeEntry
+	var paths []string
+	err := filepath.WalkDir(trashPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&writeBits == 0 {
+			return nil
+		}
+		if path != trashPath {
+			rel, _ := filepath.Rel(trashPath, path)
+			entries = append(entries, ModeEntry{Path: rel, Mode: fileMode(info.Mode())})
+		} else if meta.Mode == 0 {
+			meta.Mode = info.Mode()
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The modes are recorded before they change
+	if len(entries) > 0 {
+		if err := writeModes(sidecar(trashPath, ModesSuffix), entries); err != nil {
+			return err
+		}
+	}
+	meta.ReadOnly = true
+	if err := UpdateMetadata(trashPath, meta); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, fileMode(info.Mode())&^writeBits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sealItem makes a newly trashed item read-only with read_only_items
+func sealItem(cfg *config.Config, trashPath string, meta *Metadata) {
+	if !cfg.ReadOnlyItems {
+		return
+	}
+	if err := Seal(trashPath, meta); err != nil {
+		output.Warning("failed to make %s read-only in the trash: %v", meta.OriginalPath, err)
+	}
+}
+
+// Unseal gives a read-only item back the modes it and its entries had
+// before Seal, in place in the trash
+func Unseal(trashPath string, meta *Metadata) error {
+	if !meta.ReadOnly {
+		return nil
+	}
+	if err := UnsealCopy(trashPath, meta, ".", trashPath); err != nil {
+		return err
+	}
+	os.Remove(sidecar(trashPath, ModesSuffix))
+	meta.ReadOnly = false
+	return UpdateMetadata(trashPath, meta)
+}
+
+// UnsealCopy gives dst, a copy of the entry rel ("." for the whole item) of
+// the read-only item at trashPath, the modes that entry and the entries
+// below it had before Seal
+func UnsealCopy(trashPath string, meta *Metadata, rel, dst string) error {
+	modes, err := OriginalModes(trashPath, meta)
+	if err != nil {
+		return err
+	}
+	rel = filepath.Clean(rel)
+	for path, mode := range modes {
+		below := ""
+		switch {
+		case rel == ".":
+			below = path
+		case path == rel:
+			below = "."
+		case strings.HasPrefix(path, rel+"/"):
+			below = strings.TrimPrefix(path, rel+"/")
+		default:
+			continue
+		}
+		if err := os.Chmod(filepath.Join(dst, below), mode); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// OriginalModes returns the modes Seal removed write bits from, by path
+// relative to the trashed item ("." for the item itself); none unless the
+// item is read-only
+func OriginalModes(trashPath string, meta *Metadata) (map[string]os.FileMode, error) {
+	if !meta.ReadOnly {
+		return nil, nil
+	}
+	entries, err := readModes(sidecar(trashPath, ModesSuffix))
+	if err != nil {
+		return nil, err
+	}
+	modes := map[string]os.FileMode{}
+	for _, entry := range entries {
+		modes[entry.Path] = entry.Mode
+	}
+	if meta.Mode != 0 && meta.Mode&os.ModeSymlink == 0 {
+		modes["."] = fileMode(meta.Mode)
+	}
+	return modes, nil
+}
+
+// writeModes writes the modes sidecar at path, one JSON entry per line
+func writeModes(path string, entries []ModeEntry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, MetadataMode)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readModes reads the modes sidecar at path; a missing one records none
+func readModes(path string) ([]ModeEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ModeEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry ModeEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("corrupt modes file %s: %v", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// allowWrites makes the directories at and below root writable by their
+// owner, so that a purged read-only item can be removed; its sidecars, the
+// modes sidecar included, are gone by then
+func allowWrites(root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().Perm()&0700 != 0700 {
+			os.Chmod(path, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+}
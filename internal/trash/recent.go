@@ -0,0 +1,117 @@
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// RecentFile lists recently trashed original paths, one per line and newest
+// last. Shell completion reads it directly to complete --safe-restore
+// without walking the trash.
+const RecentFile = "recent"
+
+// maxRecentSize bounds the recent file; past it, the file is rotated down to
+// its newest recentKeep distinct paths, within half of maxRecentSize
+const (
+	maxRecentSize = 64 << 10
+	recentKeep    = 500
+)
+
+// RecentPath returns the location of the recently trashed paths file
+func RecentPath() string {
+	return filepath.Join(config.StateDir(), RecentFile)
+}
+
+// RecordRecent appends a trashed original path to the recent file, rotating
+// it once it grows past maxRecentSize
+func RecordRecent(absPath string) error {
+	if strings.Contains(absPath, "\n") {
+		return nil // Cannot be represented one per line
+	}
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(RecentPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, MetadataMode)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, absPath)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(RecentPath()); err == nil && info.Size() > maxRecentSize {
+		paths, size := RecentlyDeleted(recentKeep), 0
+		for i, path := range paths {
+			if size += len(path) + 1; size > maxRecentSize/2 {
+				paths = paths[:i]
+				break
+			}
+		}
+		return writeRecent(paths)
+	}
+	return nil
+}
+
+// ForgetRecent drops a restored path from the recent file
+func ForgetRecent(absPath string) error {
+	paths := RecentlyDeleted(0)
+	kept := paths[:0]
+	for _, path := range paths {
+		if path != absPath {
+			kept = append(kept, path)
+		}
+	}
+	if len(kept) == len(paths) {
+		return nil
+	}
+	return writeRecent(kept)
+}
+
+// RecentlyDeleted returns up to limit distinct recently trashed paths, newest
+// first; limit 0 returns all of them
+func RecentlyDeleted(limit int) []string {
+	data, err := os.ReadFile(RecentPath())
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	seen := map[string]bool{}
+	var paths []string
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		paths = append(paths, line)
+		if limit > 0 && len(paths) == limit {
+			break
+		}
+	}
+	return paths
+}
+
+// writeRecent replaces the recent file with paths (newest first), written
+// oldest first
+func writeRecent(paths []string) error {
+	var b strings.Builder
+	for i := len(paths) - 1; i >= 0; i-- {
+		b.WriteString(paths[i])
+		b.WriteByte('\n')
+	}
+
+	tmp := RecentPath() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), MetadataMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, RecentPath())
+}
@@ -0,0 +1,203 @@
+package trash
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// What happens to items on removable media (removable_media)
+const (
+	RemovableDevice    = "device"    // Trash them on the device, in its per-mount trash
+	RemovableHome      = "home"      // Copy them into trash_dir, as cross_device copy does
+	RemovablePermanent = "permanent" // Delete them without moving them to a trash
+)
+
+// Where removable devices and their labels are looked up (Linux); replaced
+// in tests
+var (
+	sysBlockDir = "/sys/class/block"
+	diskByDir   = "/dev/disk"
+)
+
+// Mount points where desktops mount removable media (udisks); drives there
+// count as removable even when the kernel does not flag them, as USB hard
+// disks are not
+var mediaMountPatterns = []string{"/media/*", "/media/*/*", "/run/media/*/*"}
+
+// Device is the removable device an item was deleted from, recorded so that
+// restoring it can name the device that must be attached
+type Device struct {
+	Label      string `json:"label,omitempty"`
+	UUID       string `json:"uuid,omitempty"`
+	Source     string `json:"source"`      // Device node, e.g. /dev/sdb1
+	MountPoint string `json:"mount_point"` // Where it was mounted
+}
+
+// String names the device by its label and UUID, or its device node
+func (d *Device) String() string {
+	switch {
+	case d.Label != "" && d.UUID != "":
+		return fmt.Sprintf("%q (UUID %s)", d.Label, d.UUID)
+	case d.Label != "":
+		return fmt.Sprintf("%q", d.Label)
+	case d.UUID != "":
+		return "UUID " + d.UUID
+	}
+	return d.Source
+}
+
+// removablePolicy returns the configured handling of removable media, or ""
+// to handle them like any other filesystem
+func removablePolicy(cfg *config.Config) string {
+	switch cfg.RemovableMedia {
+	case RemovableDevice, RemovableHome, RemovablePermanent, "":
+		return cfg.RemovableMedia
+	default:
+		output.Warning("unknown removable_media '%s', handling removable media like other filesystems", cfg.RemovableMedia)
+		return ""
+	}
+}
+
+// removableMedia returns the removable device holding absPath, or nil if
+// absPath is on the filesystem of the trash or not on removable media
+func removableMedia(cfg *config.Config, absPath string) *Device {
+	itemDev, err := deviceOf(filepath.Dir(absPath))
+	if err != nil {
+		return nil
+	}
+	if trashDev, err := deviceOf(cfg.GetTrashDir()); err != nil || trashDev == itemDev {
+		return nil
+	}
+	top, err := mountPointOf(filepath.Dir(absPath))
+	if err != nil {
+		return nil
+	}
+
+	source, _ := mountEntry(top)
+	if !strings.HasPrefix(source, "/dev/") {
+		return nil
+	}
+	node, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		node = source
+	}
+	if !removableBlock(filepath.Base(node)) && !mediaMountPoint(top) {
+		return nil
+	}
+	return &Device{
+		Label:      diskLink("by-label", node),
+		UUID:       diskLink("by-uuid", node),
+		Source:     node,
+		MountPoint: top,
+	}
+}
+
+// removableBlock reports whether the kernel flags the block device name, or
+// for a partition the disk holding it, as removable
+func removableBlock(name string) bool {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysBlockDir, name))
+	if err != nil {
+		return false
+	}
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if data, err := os.ReadFile(filepath.Join(d, "removable")); err == nil {
+			return strings.TrimSpace(string(data)) == "1"
+		}
+	}
+	return false
+}
+
+// mediaMountPoint reports whether mountPoint is where desktops mount
+// removable media
+func mediaMountPoint(mountPoint string) bool {
+	for _, pattern := range mediaMountPatterns {
+		if matched, _ := filepath.Match(pattern, mountPoint); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// diskLink returns the name of the link in /dev/disk/KIND (by-label or
+// by-uuid) that points to node, or "" if there is none
+func diskLink(kind, node string) string {
+	dir := filepath.Join(diskByDir, kind)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if target, err := filepath.EvalSymlinks(filepath.Join(dir, entry.Name())); err == nil && target == node {
+			return unescapeDiskLink(entry.Name())
+		}
+	}
+	return ""
+}
+
+// unescapeDiskLink decodes the \xNN escapes (e.g. \x20 for space) udev uses
+// in /dev/disk link names
+func unescapeDiskLink(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+3 < len(name) && name[i+1] == 'x' {
+			if n, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// DeviceMount returns where the removable device d is mounted now, or "" if
+// it is not. A device with a recorded UUID is recognized by it wherever it
+// is attached.
+func DeviceMount(d *Device) string {
+	node := d.Source
+	if d.UUID != "" {
+		var err error
+		if node, err = filepath.EvalSymlinks(filepath.Join(diskByDir, "by-uuid", d.UUID)); err != nil {
+			return ""
+		}
+	}
+
+	f, err := os.Open(mountsFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	mountPoint := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		source := unescapeMountField(fields[0])
+		if resolved, err := filepath.EvalSymlinks(source); err == nil {
+			source = resolved
+		}
+		if source != node {
+			continue
+		}
+		mountPoint = unescapeMountField(fields[1])
+		if mountPoint == d.MountPoint {
+			break
+		}
+	}
+	return mountPoint
+}
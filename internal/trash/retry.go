@@ -0,0 +1,63 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Transient errors are retried this many times in total, waiting
+// retryBackoff before the second attempt and doubling it each time after
+const (
+	retryAttempts = 4
+	retryBackoff  = 50 * time.Millisecond
+)
+
+// retrySleep waits between attempts; replaced in tests
+var retrySleep = time.Sleep
+
+// isTransient reports whether err is a hiccup worth retrying, as seen on
+// network filesystems: a stale NFS handle, a busy file or an interrupted call
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EINTR)
+}
+
+// retry runs fn until it succeeds, fails with a non-transient error or runs
+// out of attempts. The final transient error names the attempts made.
+func retry(op, path string, fn func() error) error {
+	backoff := retryBackoff
+	var err error
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		if err = fn(); err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt < retryAttempts {
+			output.Debugf("%s %s: %v, retrying in %v", op, path, err, backoff)
+			retrySleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("%s %s failed after %d attempts: %w", op, path, retryAttempts, err)
+}
+
+// Lstat is os.Lstat retried on transient errors
+func Lstat(path string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := retry("stat", path, func() error {
+		var err error
+		info, err = os.Lstat(path)
+		return err
+	})
+	return info, err
+}
+
+// Rename is os.Rename retried on transient errors
+func Rename(oldpath, newpath string) error {
+	return retry("rename", oldpath, func() error {
+		return os.Rename(oldpath, newpath)
+	})
+}
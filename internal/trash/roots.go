@@ -0,0 +1,199 @@
+package trash
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// mountsFile lists mounted filesystems (Linux); absent on other platforms
+var mountsFile = "/proc/self/mounts"
+
+// registryFile is the name of the trash root registry in the config directory
+const registryFile = "trash-roots"
+
+// Root describes a known trash root and where it was discovered
+type Root struct {
+	Path   string
+	Source string // "primary", "config", "registered", "sibling" or "mount"
+}
+
+// Roots returns the paths of all known trash roots (see RootSources)
+func Roots(cfg *config.Config) []string {
+	var roots []string
+	for _, root := range RootSources(cfg) {
+		roots = append(roots, root.Path)
+	}
+	return roots
+}
+
+// RootSources returns all known trash roots: the configured trash directory
+// first, followed by additional roots from config, the registry, indexed
+// sibling trashes, the XDG home trash and per-mount .Trash-$UID and
+// .safe-rm-trash-$UID directories.
+// Duplicates and non-existent directories (other than the primary trash) are
+// omitted.
+func RootSources(cfg *config.Config) []Root {
+	roots := []Root{{Path: cfg.GetTrashDir(), Source: "primary"}}
+	seen := map[string]bool{filepath.Clean(cfg.GetTrashDir()): true}
+
+	add := func(root, source string) {
+		root = filepath.Clean(config.ExpandHome(root))
+		if seen[root] {
+			return
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return
+		}
+		seen[root] = true
+		roots = append(roots, Root{Path: root, Source: source})
+	}
+
+	for _, root := range cfg.TrashRoots {
+		add(root, "config")
+	}
+	for _, root := range RegisteredRoots() {
+		add(root, "registered")
+	}
+	for _, root := range SiblingTrashes() {
+		add(root, "sibling")
+	}
+	add(config.XDGTrashDir(), "xdg")
+	for _, root := range MountTrashDirs() {
+		add(root, "mount")
+	}
+
+	return roots
+}
+
+// RegisteredRoots returns the trash roots recorded in the registry
+func RegisteredRoots() []string {
+	data, err := os.ReadFile(filepath.Join(config.Dir(), registryFile))
+	if err != nil {
+		return nil
+	}
+
+	var roots []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			roots = append(roots, line)
+		}
+	}
+	return roots
+}
+
+// RegisterRoot adds an existing directory to the trash root registry
+func RegisterRoot(path string) error {
+	absPath, err := filepath.Abs(config.ExpandHome(path))
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(absPath); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", absPath)
+	}
+
+	roots := RegisteredRoots()
+	for _, root := range roots {
+		if root == absPath {
+			return nil
+		}
+	}
+	return writeRegistry(append(roots, absPath))
+}
+
+// ForgetRoot removes a directory from the trash root registry. The directory
+// itself is left untouched.
+func ForgetRoot(path string) error {
+	absPath, err := filepath.Abs(config.ExpandHome(path))
+	if err != nil {
+		return err
+	}
+
+	roots := RegisteredRoots()
+	var kept []string
+	for _, root := range roots {
+		if root != absPath {
+			kept = append(kept, root)
+		}
+	}
+	if len(kept) == len(roots) {
+		return fmt.Errorf("trash root is not registered: %s", absPath)
+	}
+	return writeRegistry(kept)
+}
+
+func writeRegistry(roots []string) error {
+	if err := os.MkdirAll(config.Dir(), 0755); err != nil {
+		return err
+	}
+	var data string
+	for _, root := range roots {
+		data += root + "\n"
+	}
+	return os.WriteFile(filepath.Join(config.Dir(), registryFile), []byte(data), 0644)
+}
+
+// MountTrashDirs returns the .Trash-$UID and .safe-rm-trash-$UID
+// directories present at the top of currently mounted filesystems
+func MountTrashDirs() []string {
+	names := []string{fmt.Sprintf(".Trash-%d", os.Getuid()), fmt.Sprintf(".safe-rm-trash-%d", os.Getuid())}
+
+	var dirs []string
+	for _, mountPoint := range mountPoints() {
+		for _, name := range names {
+			dir := filepath.Join(mountPoint, name)
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// mountPoints reads the mount points of all mounted filesystems
+func mountPoints() []string {
+	f, err := os.Open(mountsFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var points []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		points = append(points, unescapeMountField(fields[1]))
+	}
+	return points
+}
+
+// unescapeMountField decodes the octal escapes (e.g. \040 for space) used in
+// /proc/self/mounts
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if n, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
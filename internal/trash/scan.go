@@ -0,0 +1,335 @@
+package trash
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// FilesSuffix names the per-item file index written by the scanner
+const FilesSuffix = ".saferm-files"
+
+// ManifestSuffix names the per-item manifest summarizing a trashed directory
+const ManifestSuffix = ".saferm-manifest"
+
+// maxManifestEntries bounds the top-level listing kept in a manifest
+const maxManifestEntries = 50
+
+// scanQueueFile lists trashed directories awaiting a scan, one per line
+const scanQueueFile = "scan-queue"
+
+// scanLockFile is held by the running scanner so that only one scans at a time
+const scanLockFile = "scan.lock"
+
+// FileEntry is one file of a trashed directory in its file index
+type FileEntry struct {
+	Path  string `json:"path"` // Relative to the trashed directory
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir,omitempty"`
+}
+
+// Manifest summarizes a trashed directory so it can be judged without
+// restoring or walking it
+type Manifest struct {
+	Entries     []ManifestEntry `json:"entries"`                // Top-level entries, largest first
+	MoreEntries int             `json:"more_entries,omitempty"` // Top-level entries left out of Entries
+	Extensions  map[string]int  `json:"extensions"`             // File count per extension ("" for none)
+	Files       int             `json:"files"`
+	Dirs        int             `json:"dirs"`
+	Size        int64           `json:"size"`
+}
+
+// ManifestEntry is a top-level entry of a trashed directory
+type ManifestEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir,omitempty"`
+	Size  int64  `json:"size"`            // Total size for directories
+	Files int    `json:"files,omitempty"` // Files below a directory
+}
+
+// RemoveSidecars removes the metadata, file index and manifest kept next to
+// a trashed item, and drops it from the trash index
+func RemoveSidecars(trashPath string) {
+	removeSidecarFiles(trashPath)
+	unindexItem(trashPath)
+}
+
+// removeSidecarFiles removes the sidecar files of a trashed item
+func removeSidecarFiles(trashPath string) {
+	os.Remove(metadataPath(trashPath))
+	os.Remove(sidecar(trashPath, FilesSuffix))
+	os.Remove(sidecar(trashPath, ManifestSuffix))
+	os.Remove(sidecar(trashPath, ModesSuffix))
+	if infoDir, ok := xdgInfoDir(trashPath); ok {
+		os.Remove(filepath.Join(infoDir, filepath.Base(trashPath)+InfoSuffix))
+	}
+}
+
+// IsSidecar reports whether path is a file safe-rm keeps next to a trashed
+// item rather than a trashed item
+func IsSidecar(path string) bool {
+	return strings.HasSuffix(path, ".saferm-meta") || strings.HasSuffix(path, FilesSuffix) || strings.HasSuffix(path, ManifestSuffix) ||
+		strings.HasSuffix(path, ModesSuffix)
+}
+
+// queueScan records a trashed directory for a later scan. Renaming a huge
+// directory is instant, walking it is not, so the walk is deferred.
+func queueScan(trashPath string) error {
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(config.StateDir(), scanQueueFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, MetadataMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, trashPath)
+	return err
+}
+
+// PendingScans returns the trashed directories awaiting a scan
+func PendingScans() []string {
+	data, err := os.ReadFile(filepath.Join(config.StateDir(), scanQueueFile))
+	if err != nil {
+		return nil
+	}
+
+	var pending []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pending = append(pending, line)
+		}
+	}
+	return pending
+}
+
+// ScanPending scans all queued directories, recording their size and file
+// count in the metadata and writing their file index. If another scanner is
+// already running it returns immediately. It returns the number of items
+// scanned.
+func ScanPending() (int, error) {
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return 0, err
+	}
+	lock, err := os.OpenFile(filepath.Join(config.StateDir(), scanLockFile), os.O_WRONLY|os.O_CREATE, MetadataMode)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		output.Debugf("another scan is running")
+		return 0, nil
+	}
+
+	scanned := 0
+	done := map[string]bool{}
+	for _, trashPath := range PendingScans() {
+		if done[trashPath] {
+			continue
+		}
+		if err := Scan(trashPath); err != nil && !os.IsNotExist(err) {
+			// Restored or purged meanwhile are dropped; other errors are retried
+			output.Debugf("scan of %s failed: %v", trashPath, err)
+			continue
+		}
+		done[trashPath] = true
+		scanned++
+	}
+
+	return scanned, dequeueScans(done)
+}
+
+// dequeueScans removes completed entries from the scan queue, keeping any
+// queued while the scan was running
+func dequeueScans(done map[string]bool) error {
+	f, err := os.OpenFile(filepath.Join(config.StateDir(), scanQueueFile), os.O_RDWR|os.O_CREATE, MetadataMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	var kept []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !done[line] {
+			kept = append(kept, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	for _, line := range kept {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scan walks a trashed item, records its size and file count in the
+// metadata, and writes its file index and manifest
+func Scan(trashPath string) error {
+	meta, err := GetMetadata(trashPath)
+	if err != nil {
+		return err
+	}
+
+	index, err := os.OpenFile(sidecar(trashPath, FilesSuffix), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, MetadataMode)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	writer := bufio.NewWriter(index)
+	encoder := json.NewEncoder(writer)
+
+	var size int64
+	files := 0
+	manifest := &Manifest{Extensions: map[string]int{}}
+	top := map[string]*ManifestEntry{}
+	err = filepath.WalkDir(trashPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		if path == trashPath {
+			return nil
+		}
+		rel, _ := filepath.Rel(trashPath, path)
+
+		name := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+		entry, ok := top[name]
+		if !ok {
+			entry = &ManifestEntry{Name: name, IsDir: d.IsDir()}
+			top[name] = entry
+		}
+		entry.Size += info.Size()
+		if d.IsDir() {
+			manifest.Dirs++
+		} else {
+			files++
+			manifest.Extensions[strings.ToLower(filepath.Ext(path))]++
+			if entry.IsDir {
+				entry.Files++
+			}
+		}
+
+		return encoder.Encode(FileEntry{Path: rel, Size: info.Size(), IsDir: d.IsDir()})
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if meta.IsDirectory {
+		for _, entry := range top {
+			manifest.Entries = append(manifest.Entries, *entry)
+		}
+		sort.Slice(manifest.Entries, func(i, j int) bool {
+			if manifest.Entries[i].Size != manifest.Entries[j].Size {
+				return manifest.Entries[i].Size > manifest.Entries[j].Size
+			}
+			return manifest.Entries[i].Name < manifest.Entries[j].Name
+		})
+		if len(manifest.Entries) > maxManifestEntries {
+			manifest.MoreEntries = len(manifest.Entries) - maxManifestEntries
+			manifest.Entries = manifest.Entries[:maxManifestEntries]
+		}
+		manifest.Files, manifest.Size = files, size
+		if err := writeManifest(trashPath, manifest); err != nil {
+			return err
+		}
+	}
+
+	meta.Size = size
+	meta.Files = files
+	meta.Scanned = true
+	return UpdateMetadata(trashPath, meta)
+}
+
+// writeManifest stores the manifest of a trashed directory
+func writeManifest(trashPath string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecar(trashPath, ManifestSuffix), data, MetadataMode)
+}
+
+// ReadManifest returns the manifest of a scanned trashed directory
+func ReadManifest(trashPath string) (*Manifest, error) {
+	data, err := os.ReadFile(sidecar(trashPath, ManifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("corrupt manifest %s: %v", sidecar(trashPath, ManifestSuffix), err)
+	}
+	return manifest, nil
+}
+
+// ReadFileIndex returns the file index of a scanned trashed directory
+func ReadFileIndex(trashPath string) ([]FileEntry, error) {
+	f, err := os.Open(sidecar(trashPath, FilesSuffix))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []FileEntry
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var entry FileEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("corrupt file index %s: %v", sidecar(trashPath, FilesSuffix), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// StartBackgroundScan starts a detached safe-rm process that scans the
+// queued directories, so the interactive removal does not wait for it
+func StartBackgroundScan() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "--safe-scan")
+	cmd.Args[0] = "rm" // The rm interface accepts --safe-scan whatever the binary is named
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,142 @@
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+)
+
+// Trash layouts selectable with trash_layout
+const (
+	LayoutCentral = "central" // One trash directory (trash_dir) for everything
+	LayoutSibling = "sibling" // A hidden .saferm-trash next to each removed item
+)
+
+// SiblingDirName is the hidden trash directory created next to removed items
+// in the sibling layout
+const SiblingDirName = ".saferm-trash"
+
+// indexFile lists the sibling trash directories in use, one per line, so
+// that list, restore and purge can find them without scanning the disk
+const indexFile = "index"
+
+// moveToSibling renames absPath into the sibling trash of its directory.
+// Being in the same directory, the rename stays on one filesystem and is
+// never replaced by a copy.
+func moveToSibling(cfg *config.Config, absPath string) (string, error) {
+	siblingDir := filepath.Join(filepath.Dir(absPath), SiblingDirName)
+	if filepath.Base(filepath.Dir(absPath)) == SiblingDirName || filepath.Base(absPath) == SiblingDirName {
+		return "", fmt.Errorf("cannot use a sibling trash for %s", absPath)
+	}
+
+	info, err := Lstat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(siblingDir, DirMode); err != nil {
+		return "", err
+	}
+
+	trashPath, err := reserveItemPath(cfg, filepath.Join(siblingDir, trashName(filepath.Base(absPath))))
+	if err != nil {
+		removeIfEmpty(siblingDir)
+		return "", err
+	}
+
+	// Metadata first, as in the central trash
+	metadata := Metadata{
+		Version:      MetadataVersion,
+		OriginalPath: absPath,
+		DeletedAt:    cfg.Now(),
+		Hostname:     cfg.Host(),
+		IsDirectory:  info.IsDir(),
+		Session:      cfg.Session,
+		Namespace:    cfg.Namespace,
+		UID:          currentUID(),
+	}
+	describe(&metadata, info)
+	if err := writeMetadata(metadataPath(trashPath), &metadata); err != nil {
+		output.Warning("failed to write metadata: %v", err)
+	}
+
+	if err := Rename(absPath, trashPath); err != nil {
+		os.Remove(metadataPath(trashPath))
+		removeIfEmpty(siblingDir)
+		return "", err
+	}
+	output.Debugf("renamed %s to %s", absPath, trashPath)
+
+	sealItem(cfg, trashPath, &metadata)
+	queueIfDir(trashPath, info)
+
+	if err := indexTrash(siblingDir); err != nil {
+		output.Warning("failed to update trash index: %v", err)
+	}
+
+	return trashPath, nil
+}
+
+// CleanSibling removes the sibling trash directory that held trashPath once
+// it is empty, so restored and purged items leave no hidden directories behind
+func CleanSibling(trashPath string) {
+	if dir := filepath.Dir(trashPath); filepath.Base(dir) == SiblingDirName {
+		removeIfEmpty(dir)
+	}
+}
+
+// removeIfEmpty removes dir if it has no entries
+func removeIfEmpty(dir string) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		os.Remove(dir)
+	}
+}
+
+// SiblingTrashes returns the indexed sibling trash directories that still
+// exist
+func SiblingTrashes() []string {
+	data, err := os.ReadFile(filepath.Join(config.StateDir(), indexFile))
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if info, err := os.Stat(line); err == nil && info.IsDir() {
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs
+}
+
+// indexTrash records a sibling trash directory in the index
+func indexTrash(dir string) error {
+	path := filepath.Join(config.StateDir(), indexFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == dir {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(config.StateDir(), DirMode); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, MetadataMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, dir)
+	return err
+}
@@ -0,0 +1,127 @@
+package trash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// Snapshot is a compressed copy of a small file kept in its metadata
+// (inline_snapshot_size), so that the file can be restored even when its
+// trashed payload is damaged or gone
+type Snapshot struct {
+	Data   []byte      `json:"data"`   // gzip-compressed content
+	SHA256 string      `json:"sha256"` // Checksum of the uncompressed content
+	Mode   os.FileMode `json:"mode"`
+}
+
+// takeSnapshot embeds the content of a trashed regular file in meta when it
+// is no larger than inline_snapshot_size
+func takeSnapshot(cfg *config.Config, meta *Metadata, trashPath string, info os.FileInfo) error {
+	limit := int64(cfg.InlineSnapshotSize)
+	if limit <= 0 || !info.Mode().IsRegular() || info.Size() > limit {
+		return nil
+	}
+
+	data, err := os.ReadFile(trashPath)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	meta.Snapshot = &Snapshot{Data: buf.Bytes(), SHA256: hex.EncodeToString(sum[:]), Mode: info.Mode().Perm()}
+	return nil
+}
+
+// content returns the uncompressed content of the snapshot, verified
+// against its checksum
+func (s *Snapshot) content() ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(s.Data))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != s.SHA256 {
+		return nil, fmt.Errorf("inline snapshot is damaged: checksum mismatch")
+	}
+	return data, nil
+}
+
+// NeedsSnapshot reports whether an item with an inline snapshot has to be
+// restored from it because its payload is missing or no longer matches
+func NeedsSnapshot(trashPath string, meta *Metadata) bool {
+	if meta.Snapshot == nil {
+		return false
+	}
+	data, err := os.ReadFile(trashPath)
+	if err != nil {
+		return true
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) != meta.Snapshot.SHA256
+}
+
+// RestoreSnapshot writes the inline snapshot of an item to dst, which must
+// not exist
+func RestoreSnapshot(meta *Metadata, dst string) error {
+	data, err := meta.Snapshot.content()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, meta.Snapshot.Mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, meta.Snapshot.Mode)
+}
+
+// SnapshotOnly returns the item of a metadata file whose payload is gone but
+// which holds an inline snapshot, so that the item can still be listed and
+// restored
+func SnapshotOnly(metaPath string) (string, bool) {
+	trashPath, ok := strings.CutSuffix(metaPath, ".saferm-meta")
+	if !ok || !snapshotOnly(trashPath) {
+		return "", false
+	}
+	return trashPath, true
+}
+
+// snapshotOnly reports whether the payload of a trashed item is gone while
+// its metadata holds an inline snapshot
+func snapshotOnly(trashPath string) bool {
+	if _, err := os.Lstat(trashPath); !os.IsNotExist(err) {
+		return false
+	}
+	// Being purged
+	if _, err := os.Lstat(trashPath + TombstoneSuffix); err == nil && isTombstone(trashPath+TombstoneSuffix) {
+		return false
+	}
+	meta, err := GetMetadata(trashPath)
+	return err == nil && meta.Snapshot != nil
+}
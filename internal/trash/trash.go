@@ -1,161 +1,974 @@
 package trash
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/protect"
+	"github.com/user/safe-rm/internal/throttle"
 )
 
+// Permissions for the trash hierarchy and metadata files. Trashed content is
+// private to its owner: other local users must not be able to read the names
+// or contents of "deleted" files.
+const (
+	DirMode      os.FileMode = 0700
+	MetadataMode os.FileMode = 0600
+)
+
+// MetadataVersion is the metadata format version written by this build.
+// Version 0 denotes metadata written before versioning was introduced.
+const MetadataVersion = 1
+
+// DirModes maps directories to their permission bits
+type DirModes map[string]os.FileMode
+
 // Metadata stores information about a trashed item
 type Metadata struct {
+	Version      int       `json:"version"`
+	ID           string    `json:"id,omitempty"` // Stable identifier of the item, also kept in the trash index
 	OriginalPath string    `json:"original_path"`
 	DeletedAt    time.Time `json:"deleted_at"`
 	Hostname     string    `json:"hostname"`
 	IsDirectory  bool      `json:"is_directory"`
+	Pinned       bool      `json:"pinned,omitempty"`    // Exempt from purging by age
+	Session      string    `json:"session,omitempty"`   // Session of the invocation that trashed the item
+	Process      string    `json:"process,omitempty"`   // Parent process chain of that invocation (process_chain)
+	Namespace    string    `json:"namespace,omitempty"` // Trash namespace (--namespace), empty for none
+	UID          *int      `json:"uid,omitempty"`       // User who trashed the item; unset in older metadata
+	ParentModes  DirModes  `json:"parents,omitempty"`   // Permissions of the original parent directories
+	Size         int64     `json:"size,omitempty"`      // Total size in bytes, once known
+	Files        int       `json:"files,omitempty"`     // Number of files, once known
+	Scanned      bool      `json:"scanned,omitempty"`   // Size and Files are set (directories are scanned later)
+	Note         string    `json:"note,omitempty"`      // Free-form note attached after the fact (--safe-annotate)
+	Tags         []string  `json:"tags,omitempty"`      // Tags attached after the fact (--safe-retag)
+	Snapshot     *Snapshot `json:"snapshot,omitempty"`  // Inline copy of a small file (inline_snapshot_size)
+	Device       *Device   `json:"device,omitempty"`    // Removable device the item was deleted from
+
+	// Attributes of the item itself, put back by RestoreAttrs
+	Mode     os.FileMode `json:"mode,omitempty"`      // Type and permission bits
+	OwnerUID *int        `json:"owner_uid,omitempty"` // Owner; unset in older metadata
+	OwnerGID *int        `json:"owner_gid,omitempty"` // Group; unset in older metadata
+	ReadOnly bool        `json:"read_only,omitempty"` // Write bits removed (read_only_items); see Seal
+
+	// SHA256 is the checksum of a file copied across devices with paranoid
+	// integrity, verified on the copy before the original was removed
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Extra holds fields unknown to this build (written by newer versions),
+	// preserved verbatim when the metadata is rewritten
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// metadataFields is an alias without the custom JSON methods
+type metadataFields Metadata
+
+// UnmarshalJSON decodes metadata, keeping any unknown fields in Extra
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*metadataFields)(m)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range knownMetadataFields() {
+		delete(fields, name)
+	}
+	m.Extra = nil
+	if len(fields) > 0 {
+		m.Extra = fields
+	}
+	return nil
+}
+
+// MarshalJSON encodes metadata, including preserved unknown fields
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(metadataFields(m))
+	if err != nil || len(m.Extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range m.Extra {
+		if _, known := fields[name]; !known {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// knownMetadataFields returns the JSON names of all Metadata fields
+func knownMetadataFields() []string {
+	var names []string
+	t := reflect.TypeOf(Metadata{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
-// Move moves a file or directory to the trash
+// metadataMigrations upgrade metadata from the keyed version to the next one
+var metadataMigrations = map[int]func(*Metadata){
+	// Version 0 -> 1: only the version field was added
+	0: func(m *Metadata) {},
+}
+
+// migrateMetadata upgrades metadata written by older versions to
+// MetadataVersion. Metadata from newer versions is left untouched.
+func migrateMetadata(meta *Metadata) {
+	for meta.Version < MetadataVersion {
+		if migrate, ok := metadataMigrations[meta.Version]; ok {
+			migrate(meta)
+		}
+		meta.Version++
+	}
+}
+
+// UnavailableError reports that the trash filesystem cannot accept new items
+// because it is read-only, full, or over quota
+type UnavailableError struct {
+	TrashDir string
+	Reason   string
+	Err      error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("trash %s is unavailable: %s\n"+
+		"  Free space or fix the trash filesystem, set fallback_trash_dir in the config,\n"+
+		"  or use --permanent to delete without moving to trash.", e.TrashDir, e.Reason)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// checkUnavailable wraps err in an UnavailableError if it indicates that the
+// trash filesystem is read-only or out of space, and returns it unchanged
+// otherwise. Errors about paths outside the trash (e.g. a read-only source
+// that cannot be unlinked) are not attributed to the trash.
+func checkUnavailable(trashDir string, err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) && !isWithin(pathErr.Path, trashDir) {
+		return err
+	}
+
+	var reason string
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		reason = "read-only filesystem"
+	case errors.Is(err, syscall.ENOSPC):
+		reason = "no space left on device"
+	case errors.Is(err, syscall.EDQUOT):
+		reason = "disk quota exceeded"
+	default:
+		return err
+	}
+	return &UnavailableError{TrashDir: trashDir, Reason: reason, Err: err}
+}
+
+// isWithin reports whether path is dir or located below it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Move moves a file or directory to the trash. If the trash is unavailable
+// and a fallback trash directory is configured, the item is moved there instead.
+// An item copied into the trash whose source could not be fully removed is
+// trashed all the same: its trash path is returned with a *CleanupError.
 func Move(cfg *config.Config, absPath string) (string, error) {
-	// Get file info
-	info, err := os.Lstat(absPath)
-	if err != nil {
-		return "", err
+	// Critical paths are never renamed: they are copied into the central
+	// trash and verified before the original is removed
+	rule, critical := protect.IsCritical(cfg, absPath)
+	if critical {
+		output.Debugf("%s (%s): copying and verifying instead of renaming", absPath, rule)
 	}
 
-	// Get hostname
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "unknown"
+	if cfg.TrashLayout == LayoutSibling && cfg.TrashBackend != BackendXDG && !critical {
+		trashPath, err := moveToSibling(cfg, absPath)
+		if err == nil {
+			return trashPath, nil
+		}
+		// Unwritable directories, mount points and the like use the central trash
+		output.Debugf("sibling trash for %s unavailable (%v), using %s", absPath, err, cfg.GetTrashDir())
 	}
 
-	// Create trash path preserving original structure
-	// Format: $TRASH/<hostname>/<original-path>
-	trashBase := cfg.GetTrashDir()
-	relativePath := absPath
-	if filepath.IsAbs(absPath) {
-		// Remove drive letter on Windows or leading / on Unix
-		relativePath = absPath
-		if len(absPath) > 0 && absPath[0] == '/' {
-			relativePath = absPath[1:]
-		} else if len(absPath) > 2 && absPath[1] == ':' {
-			// Windows: C:\path -> C/path
-			relativePath = string(absPath[0]) + absPath[2:]
+	// Items on removable media follow removable_media rather than
+	// cross_device
+	onRemovable := false
+	if policy := removablePolicy(cfg); policy != "" && !critical {
+		if dev := removableMedia(cfg, absPath); dev != nil {
+			onRemovable = true
+			switch policy {
+			case RemovablePermanent:
+				return "", fmt.Errorf("%s is on removable device %s (removable_media), %w", absPath, dev, ErrDeleteDirectly)
+			case RemovableDevice:
+				if dir, ok := mountTrashFor(cfg, absPath); ok {
+					output.Debugf("%s is on removable device %s, using %s", absPath, dev, dir)
+					if cfg.TrashBackend == BackendXDG {
+						return moveToXDG(cfg, dir, absPath, false)
+					}
+					return moveTo(cfg, dir, absPath, false)
+				}
+				output.Debugf("no trash on removable device %s, using %s", dev, cfg.GetTrashDir())
+			default:
+				output.Debugf("%s is on removable device %s, using %s", absPath, dev, cfg.GetTrashDir())
+			}
+		}
+	}
+
+	// Items on another filesystem than the trash are renamed into a trash
+	// at the top of their own filesystem instead of being copied
+	if crossDevice(cfg) == CrossDeviceMount && !critical && !onRemovable {
+		if top, excluded := excludedMount(cfg, absPath); excluded {
+			if mountFallback(cfg) == MountFallbackPermanent {
+				return "", fmt.Errorf("%s is on %s (mount_trash_exclude), %w", absPath, top, ErrDeleteDirectly)
+			}
+			output.Debugf("%s is excluded from per-mount trashes, using %s", top, cfg.GetTrashDir())
+		} else if dir, ok := mountTrashFor(cfg, absPath); ok {
+			output.Debugf("%s is on another filesystem, using %s", absPath, dir)
+			if cfg.TrashBackend == BackendXDG {
+				return moveToXDG(cfg, dir, absPath, false)
+			}
+			return moveTo(cfg, dir, absPath, false)
 		}
 	}
 
-	trashPath := filepath.Join(trashBase, hostname, relativePath)
+	if cfg.TrashBackend == BackendXDG {
+		return moveToXDG(cfg, cfg.GetTrashDir(), absPath, critical)
+	}
+
+	trashPath, err := moveTo(cfg, cfg.GetTrashDir(), absPath, critical)
 
-	// Handle conflicts by adding timestamp suffix
-	if _, err := os.Stat(trashPath); err == nil {
-		timestamp := time.Now().Format("20060102-150405")
-		trashPath = trashPath + "." + timestamp
+	// Part of an interrupted copy is already in this trash; finish it there
+	var interrupted *InterruptedError
+	var cleanup *CleanupError
+	if errors.As(err, &interrupted) || errors.As(err, &cleanup) {
+		return trashPath, err
+	}
+
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) && cfg.FallbackTrashDir != "" {
+		fallback := config.ExpandHome(cfg.FallbackTrashDir)
+		output.Warning("trash %s unavailable (%s), using fallback %s",
+			unavailable.TrashDir, unavailable.Reason, fallback)
+		return moveTo(cfg, fallback, absPath, critical)
+	}
+
+	return trashPath, err
+}
+
+// MoveBack moves a trashed item to dst, typically its original path. Like
+// Move, it renames when possible and otherwise (and only across filesystems)
+// stages a copy at dst+PartialSuffix, publishing it once complete before the
+// trashed item is removed.
+func MoveBack(cfg *config.Config, trashPath, dst string) error {
+	err := Rename(trashPath, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if crossDevice(cfg) == CrossDeviceFail {
+		return fmt.Errorf("%s is on a different filesystem than the trash and cross-device copying is disabled: %w", dst, err)
+	}
+
+	if _, err := os.Lstat(trashPath); err != nil {
+		return err
+	}
+	output.Debugf("rename %s failed (cross-device), falling back to copy and delete", trashPath)
+	_, err = copyAndDelete(trashPath, dst, copyIntegrity(cfg), 0)
+	return err
+}
+
+// errVerifiedCopy stands in for the rename that a verified move skips
+var errVerifiedCopy = errors.New("critical path requires a verified copy")
+
+// moveTo moves a file or directory into the given trash directory. A verified
+// move skips the rename and copies with checksum verification instead.
+func moveTo(cfg *config.Config, trashBase string, absPath string, verified bool) (string, error) {
+	// Get file info
+	info, err := Lstat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := InitRoot(cfg, trashBase); err != nil {
+		return "", checkUnavailable(trashBase, err)
+	}
+
+	trashPath, err := itemPath(cfg, trashBase, cfg.Host(), absPath)
+	if err != nil {
+		return "", err
 	}
 
 	// Create parent directories in trash
 	trashDir := filepath.Dir(trashPath)
-	if err := os.MkdirAll(trashDir, 0755); err != nil {
+	if err := os.MkdirAll(trashDir, DirMode); err != nil {
+		if uerr := checkUnavailable(trashBase, err); uerr != err {
+			return "", uerr
+		}
 		return "", fmt.Errorf("failed to create trash directory: %v", err)
 	}
 
-	// Move the file/directory
-	if err := os.Rename(absPath, trashPath); err != nil {
-		// If rename fails (cross-device), fall back to copy+delete
-		if err := copyAndDelete(absPath, trashPath, info.IsDir()); err != nil {
+	trashPath, err = reserveItemPath(cfg, trashPath)
+	if err != nil {
+		return "", checkUnavailable(trashBase, err)
+	}
+	return moveInto(cfg, trashBase, absPath, trashPath, info, verified)
+}
+
+// reserveItemPath reserves the name of a new item at trashPath: trashPath
+// itself or, on conflict, trashPath.<timestamp>, then trashPath.<timestamp>.2
+// and so on. A name is taken by an item or by metadata, which is created
+// exclusively here, so concurrent removals never pick the same name; the
+// caller writes the metadata over the empty placeholder, or removes it.
+func reserveItemPath(cfg *config.Config, trashPath string) (string, error) {
+	stamped := trashPath + "." + cfg.Now().Format("20060102-150405")
+	for n := 0; ; n++ {
+		candidate := trashPath
+		if n == 1 {
+			candidate = stamped
+		} else if n > 1 {
+			candidate = fmt.Sprintf("%s.%d", stamped, n)
+		}
+
+		if _, err := os.Lstat(candidate); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		f, err := os.OpenFile(metadataPath(candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, MetadataMode)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
 			return "", err
 		}
+		f.Close()
+		return candidate, nil
+	}
+}
+
+// moveInto moves absPath, described by info, to trashPath in the given
+// trash directory. Its metadata is written first: interrupted before the
+// move, metadata without an item is ignored and the original is intact;
+// interrupted after it, the item is complete.
+func moveInto(cfg *config.Config, trashBase, absPath, trashPath string, info os.FileInfo, verified bool) (_ string, err error) {
+	metaPath := metadataPath(trashPath)
+	defer func() {
+		// An interrupted copy keeps its metadata for --resume, and an item
+		// whose source was not fully removed is in the trash all the same
+		var interrupted *InterruptedError
+		var cleanup *CleanupError
+		if err != nil && !errors.As(err, &interrupted) && !errors.As(err, &cleanup) {
+			os.Remove(metaPath)
+		}
+	}()
+
+	// Older items are evicted first if the item would exceed max_trash_size
+	size, err := reserveQuota(cfg, trashBase, absPath, info)
+	if err != nil {
+		return "", err
 	}
 
-	// Write metadata file
 	metadata := Metadata{
+		Version:      MetadataVersion,
 		OriginalPath: absPath,
-		DeletedAt:    time.Now(),
-		Hostname:     hostname,
+		DeletedAt:    cfg.Now(),
+		Hostname:     cfg.Host(),
 		IsDirectory:  info.IsDir(),
+		Session:      cfg.Session,
+		Process:      cfg.Process,
+		Namespace:    cfg.Namespace,
+		UID:          currentUID(),
+	}
+	describe(&metadata, info)
+	metadata.Device = removableMedia(cfg, absPath)
+	if info.IsDir() && size >= 0 {
+		// Measured for the quota; the scanner still counts the files
+		metadata.Size = size
 	}
 
-	metadataPath := trashPath + ".saferm-meta"
-	if err := writeMetadata(metadataPath, &metadata); err != nil {
+	if err := writeMetadata(metaPath, &metadata); err != nil {
 		// Non-fatal: log warning but don't fail the operation
-		fmt.Fprintf(os.Stderr, "warning: failed to write metadata: %v\n", err)
+		output.Warning("failed to write metadata: %v", err)
+	}
+	if err := fault(FaultRename, absPath); err != nil {
+		return "", err
+	}
+
+	// Move the file/directory. A copy whose source could not be fully
+	// removed is still trashed, and reported once the item is complete.
+	var incomplete error
+	integrity := copyIntegrity(cfg)
+	renameErr := errVerifiedCopy
+	if verified {
+		integrity = IntegrityParanoid
+	} else {
+		renameErr = Rename(absPath, trashPath)
 	}
+	if err := renameErr; err != nil {
+		// Only a cross-device rename falls back to copy+delete; any other
+		// failure (permissions, busy mount point, ...) would fail the copy too
+		if err != errVerifiedCopy {
+			if !errors.Is(err, syscall.EXDEV) {
+				return "", checkUnavailable(trashBase, err)
+			}
+			if crossDevice(cfg) == CrossDeviceFail {
+				return "", fmt.Errorf("%s is on a different filesystem than the trash %s and cross-device copying is disabled: %w",
+					absPath, trashBase, err)
+			}
+		}
+		output.Debugf("rename %s failed (%v), falling back to copy and delete", absPath, err)
 
-	return trashPath, nil
+		// Journal the copy so an interruption can be resumed with --resume
+		journaled := false
+		if cfg.Session != "" {
+			entry := JournalEntry{
+				OriginalPath: absPath,
+				TrashPath:    trashPath,
+				TrashDir:     trashBase,
+				IsDirectory:  info.IsDir(),
+				Namespace:    cfg.Namespace,
+				StartedAt:    cfg.Now(),
+			}
+			id := identify(info)
+			entry.Device, entry.Inode = id.dev, id.ino
+			if err := startJournal(cfg.Session, entry); err != nil {
+				output.Warning("failed to write session journal: %v", err)
+			} else {
+				journaled = true
+			}
+		}
+
+		sum, err := copyAndDelete(absPath, trashPath, integrity, int64(cfg.ThrottleRate))
+		var cleanup *CleanupError
+		if errors.As(err, &cleanup) {
+			incomplete = err
+			if journaled {
+				// --resume removes the rest of the source
+				incomplete = &InterruptedError{Session: cfg.Session, Err: err}
+			}
+		} else if err != nil {
+			err = checkUnavailable(trashBase, err)
+			if journaled {
+				return "", &InterruptedError{Session: cfg.Session, Err: err}
+			}
+			return "", err
+		}
+		if sum != "" {
+			metadata.SHA256 = sum
+			if err := writeMetadata(metaPath, &metadata); err != nil {
+				output.Warning("failed to write metadata: %v", err)
+			}
+		}
+		if journaled && incomplete == nil {
+			defer func() {
+				if err := finishJournal(cfg.Session, trashPath); err != nil {
+					output.Warning("failed to update session journal: %v", err)
+				}
+			}()
+		}
+	} else {
+		output.Debugf("renamed %s to %s", absPath, trashPath)
+	}
+	if err := fault(FaultRenamed, trashPath); err != nil {
+		return "", err
+	}
+
+	// The snapshot is taken from the trashed item, so that metadata left by
+	// an interrupted move never holds one
+	if err := takeSnapshot(cfg, &metadata, trashPath, info); err != nil {
+		output.Warning("failed to snapshot %s: %v", absPath, err)
+	} else if metadata.Snapshot != nil {
+		if err := writeMetadata(metaPath, &metadata); err != nil {
+			output.Warning("failed to write metadata: %v", err)
+		}
+	}
+	sealItem(cfg, trashPath, &metadata)
+	queueIfDir(trashPath, info)
+
+	return trashPath, incomplete
+}
+
+// describe records the modes of the original parent directories and the
+// mode and owner of the item, and fills in the size of a trashed file, which
+// needs no walk; directories are left for the scanner
+func describe(meta *Metadata, info os.FileInfo) {
+	meta.ParentModes = parentModes(meta.OriginalPath)
+	meta.Mode = info.Mode()
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid := int(st.Uid), int(st.Gid)
+		meta.OwnerUID, meta.OwnerGID = &uid, &gid
+	}
+	if !info.IsDir() {
+		meta.Size = info.Size()
+		meta.Files = 1
+		meta.Scanned = true
+	}
 }
 
+// parentModes returns the permission bits of the directories above absPath,
+// so that restoring into a removed private directory does not recreate it
+// world-readable
+func parentModes(absPath string) DirModes {
+	modes := DirModes{}
+	for dir := filepath.Dir(absPath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil {
+			modes[dir] = info.Mode().Perm()
+		}
+	}
+	return modes
+}
+
+// queueIfDir queues a trashed directory for a background scan
+func queueIfDir(trashPath string, info os.FileInfo) {
+	if info.IsDir() {
+		if err := queueScan(trashPath); err != nil {
+			output.Debugf("failed to queue scan of %s: %v", trashPath, err)
+		}
+	}
+}
+
+// reservedSuffixes end the names safe-rm gives its own files in a trash:
+// tombstones, staged copies and sidecars
+var reservedSuffixes = []string{TombstoneSuffix, PartialSuffix, ".saferm-meta", FilesSuffix, ManifestSuffix, ModesSuffix}
+
+// trashName returns the name a file or directory called name gets in the
+// trash. A name ending in a reserved suffix gets a "~" appended, so that a
+// trashed item is never taken for a tombstone, a staged copy or a sidecar;
+// restores go by the original path in the metadata.
+func trashName(name string) string {
+	for _, suffix := range reservedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return name + "~"
+		}
+	}
+	return name
+}
+
+// trashPathFor returns the trash path for absPath, preserving the original
+// structure as $TRASH/<hostname>/<original-path>, with names ending in a
+// reserved suffix escaped (see trashName)
+func trashPathFor(trashBase, hostname, absPath string) string {
+	relativePath := absPath
+	if filepath.IsAbs(absPath) {
+		// Remove drive letter on Windows or leading / on Unix
+		if len(absPath) > 0 && absPath[0] == '/' {
+			relativePath = absPath[1:]
+		} else if len(absPath) > 2 && absPath[1] == ':' {
+			// Windows: C:\path -> C/path
+			relativePath = string(absPath[0]) + absPath[2:]
+		}
+	}
+	parts := strings.Split(relativePath, string(filepath.Separator))
+	for i, part := range parts {
+		parts[i] = trashName(part)
+	}
+	return filepath.Join(trashBase, hostname, filepath.Join(parts...))
+}
+
+// RecentlyTrashed reports whether absPath was moved to the trash by the
+// current session or within the configured idempotent window, returning the
+// trash path of the most recent such entry
+func RecentlyTrashed(cfg *config.Config, absPath string) (string, bool) {
+	// Conflicting entries sit next to each other as <name>.<timestamp>, in
+	// the central trash or, with the sibling layout, next to the original;
+	// in the XDG trash as <name>.<n>
+	candidates := []string{
+		filepath.Join(filepath.Dir(absPath), SiblingDirName, trashName(filepath.Base(absPath))),
+	}
+	trashDirs := []string{cfg.GetTrashDir()}
+	if crossDevice(cfg) == CrossDeviceMount {
+		if top, err := mountPointOf(filepath.Dir(absPath)); err == nil {
+			trashDirs = append(trashDirs, filepath.Join(top, mountTrashName(cfg)))
+		}
+	}
+	for _, trashDir := range trashDirs {
+		if cfg.TrashBackend == BackendXDG {
+			candidates = append(candidates, filepath.Join(trashDir, "files", trashName(filepath.Base(absPath))))
+		} else if central, err := itemPath(cfg, trashDir, cfg.Host(), absPath); err == nil {
+			candidates = append(candidates, central)
+		}
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, base := range candidates {
+		entries, err := os.ReadDir(filepath.Dir(base))
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(base)
+		for _, entry := range entries {
+			if entry.Name() != name && !strings.HasPrefix(entry.Name(), name+".") {
+				continue
+			}
+			if IsSidecar(entry.Name()) {
+				continue
+			}
+
+			trashPath := filepath.Join(filepath.Dir(base), entry.Name())
+			meta, err := GetMetadata(trashPath)
+			if err != nil || meta.OriginalPath != absPath {
+				continue
+			}
+
+			sameSession := cfg.Session != "" && meta.Session == cfg.Session
+			inWindow := cfg.IdempotentWindow > 0 && cfg.Now().Sub(meta.DeletedAt) <= cfg.IdempotentWindow
+			if (sameSession || inWindow) && meta.DeletedAt.After(latestTime) {
+				latest = trashPath
+				latestTime = meta.DeletedAt
+			}
+		}
+	}
+
+	return latest, latest != ""
+}
+
+// currentUID returns the user ID recorded in metadata
+func currentUID() *int {
+	uid := os.Getuid()
+	return &uid
+}
+
+// UpdateMetadata rewrites the metadata of a trashed item
+func UpdateMetadata(trashPath string, meta *Metadata) error {
+	return writeMetadata(metadataPath(trashPath), meta)
+}
+
+// writeMetadata writes the metadata of a trashed item, giving it an ID if it
+// has none, and records it in the trash index
 func writeMetadata(path string, meta *Metadata) error {
+	if meta.ID == "" {
+		meta.ID = newItemID()
+	}
+	if err := writeMetadataFile(path, meta); err != nil {
+		return err
+	}
+	if trashPath, ok := strings.CutSuffix(path, ".saferm-meta"); ok {
+		indexItem(trashPath, meta)
+	}
+	return nil
+}
+
+// writeMetadataFile writes a metadata file
+func writeMetadataFile(path string, meta *Metadata) error {
 	data, err := json.MarshalIndent(meta, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return os.WriteFile(path, data, MetadataMode)
 }
 
-func copyAndDelete(src, dst string, isDir bool) error {
-	if isDir {
-		return copyDirAndDelete(src, dst)
+// Copy integrity levels for the cross-device copy fallback
+const (
+	IntegrityFast     = "fast"     // Remove the source as soon as the copy is written
+	IntegritySafe     = "safe"     // First fsync the copy and its parent directory
+	IntegrityParanoid = "paranoid" // Also re-read the copy and compare checksums
+)
+
+// Cross-device strategies: what to do when the item and the trash are on
+// different filesystems and cannot be renamed
+const (
+	CrossDeviceCopy  = "copy"  // Copy into the trash, then delete the original
+	CrossDeviceFail  = "fail"  // Refuse, leaving the item in place
+	CrossDeviceMount = "mount" // Rename into a trash at the top of the item's filesystem, else copy
+)
+
+// crossDevice returns the configured cross-device strategy, defaulting to copy
+func crossDevice(cfg *config.Config) string {
+	switch cfg.CrossDevice {
+	case CrossDeviceCopy, CrossDeviceFail, CrossDeviceMount:
+		return cfg.CrossDevice
+	case "":
+		return CrossDeviceCopy
+	default:
+		output.Warning("unknown cross_device '%s', using '%s'", cfg.CrossDevice, CrossDeviceCopy)
+		return CrossDeviceCopy
 	}
-	return copyFileAndDelete(src, dst)
 }
 
-func copyFileAndDelete(src, dst string) error {
-	data, err := os.ReadFile(src)
+// copyIntegrity returns the configured integrity level, defaulting to safe
+func copyIntegrity(cfg *config.Config) string {
+	switch cfg.CopyIntegrity {
+	case IntegrityFast, IntegritySafe, IntegrityParanoid:
+		return cfg.CopyIntegrity
+	case "":
+		return IntegritySafe
+	default:
+		output.Warning("unknown copy_integrity '%s', using '%s'", cfg.CopyIntegrity, IntegritySafe)
+		return IntegritySafe
+	}
+}
+
+// PartialSuffix marks an item still being copied into the trash. It becomes
+// the trashed item with a rename only once the copy is complete and durable.
+const PartialSuffix = ".saferm-partial"
+
+// CleanupError reports a copy that was published at Dst while removing its
+// source failed afterwards: the move is done, but what remains at Path
+// still has to be removed
+type CleanupError struct {
+	Path string // The source, intact or partly removed
+	Dst  string
+	Err  error
+}
+
+func (e *CleanupError) Error() string {
+	return fmt.Sprintf("copied to %s, but %s could not be removed: %v", e.Dst, e.Path, e.Err)
+}
+
+func (e *CleanupError) Unwrap() error {
+	return e.Err
+}
+
+// copyAndDelete copies src into the trash under a temporary name, publishes
+// it at dst with a rename once complete, and only then removes src. An
+// interrupted copy leaves src intact and never a partial item at dst; once
+// the copy is published, failures are reported as a *CleanupError. A
+// positive rate limits the copy to that many bytes per second. With
+// paranoid integrity, a regular file's SHA-256 checksum is returned once the
+// copy is verified against it.
+func copyAndDelete(src, dst string, integrity string, rate int64) (string, error) {
+	partial := dst + PartialSuffix
+	// A trashed item of that name is not a leftover to clear away
+	if isItem(partial) {
+		return "", fmt.Errorf("cannot stage the copy at %s: a trashed item has that name", partial)
+	}
+	// Left over from an earlier interrupted copy
+	if err := os.RemoveAll(partial); err != nil {
+		return "", err
+	}
+
+	sum, err := copyTree(src, partial, integrity, rate)
 	if err != nil {
-		return err
+		os.RemoveAll(partial)
+		return "", err
+	}
+
+	if err := os.Rename(partial, dst); err != nil {
+		os.RemoveAll(partial)
+		return "", err
+	}
+	if integrity != IntegrityFast {
+		// The published item must be durable before the source goes away
+		if err := syncDir(filepath.Dir(dst)); err != nil {
+			return sum, &CleanupError{Path: src, Dst: dst, Err: err}
+		}
+	}
+	if err := fault(FaultPublished, dst); err != nil {
+		return sum, &CleanupError{Path: src, Dst: dst, Err: err}
 	}
+	if err := os.RemoveAll(src); err != nil {
+		return sum, &CleanupError{Path: src, Dst: dst, Err: err}
+	}
+	return sum, nil
+}
 
-	info, err := os.Stat(src)
+// Extract copies a file or directory out of the trash to dst, leaving the
+// trashed item in place
+func Extract(cfg *config.Config, src, dst string) error {
+	_, err := copyTree(src, dst, copyIntegrity(cfg), 0)
+	return err
+}
+
+// copyFile streams the contents of the regular file src to dst with the
+// given integrity level, at most rate bytes per second when rate is
+// positive. copyTree gives it the attributes of src. With paranoid
+// integrity the contents are checksummed while they are copied, and the
+// SHA-256 checksum is returned once the copy is read back and matches it.
+func copyFile(src, dst string, integrity string, rate int64) (string, error) {
+	f, err := os.Open(src)
 	if err != nil {
-		return err
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
 	}
 
-	if err := os.WriteFile(dst, data, info.Mode()); err != nil {
-		return err
+	var r io.Reader = f
+	var h hash.Hash
+	if integrity == IntegrityParanoid {
+		h = sha256.New()
+		r = io.TeeReader(f, h)
+	}
+	if err := writeFileSync(dst, r, info.Mode(), integrity != IntegrityFast, rate); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return "", err
 	}
 
-	return os.Remove(src)
+	sum := ""
+	if h != nil {
+		sum = hex.EncodeToString(h.Sum(nil))
+		if err := verifyCopy(dst, sum); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+	}
+	if integrity != IntegrityFast {
+		// The new directory entry must be durable before it is published
+		if err := syncDir(filepath.Dir(dst)); err != nil {
+			return "", err
+		}
+	}
+
+	return sum, nil
 }
 
-func copyDirAndDelete(src, dst string) error {
-	srcInfo, err := os.Stat(src)
+// writeFileSync streams r to path at most rate bytes per second (when
+// positive), flushing it to stable storage when sync is set
+func writeFileSync(path string, r io.Reader, mode os.FileMode, sync bool, rate int64) error {
+	if err := fault(FaultWrite, path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
+	if _, err := io.Copy(throttle.Writer(f, rate), r); err != nil {
+		f.Close()
+		return err
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
 
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
+// syncDir flushes a directory's entries to stable storage
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
 		return err
 	}
+	defer d.Close()
+	return d.Sync()
+}
 
-	entries, err := os.ReadDir(src)
+// verifyCopy re-reads the copy at path and compares its SHA-256 checksum
+// with sum, in hex
+func verifyCopy(path string, sum string) error {
+	copied, err := fileSHA256(path)
 	if err != nil {
 		return err
 	}
+	if copied != sum {
+		return fmt.Errorf("verification of %s failed: checksum mismatch", path)
+	}
+	return nil
+}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+// fileSHA256 returns the SHA-256 checksum of the file at path in hex, read
+// as a stream
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-		if entry.IsDir() {
-			if err := copyDirAndDelete(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := copyFileAndDelete(srcPath, dstPath); err != nil {
-				return err
-			}
+// Size returns the total size in bytes of a file or directory tree.
+// Symlinks are counted by their own size and not followed.
+func Size(path string) (int64, error) {
+	var total int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
-	}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
 
-	return os.RemoveAll(src)
+// Record is the --json representation of a trashed or removed item
+type Record struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	Size         int64     `json:"size"`
+	Pending      bool      `json:"pending,omitempty"`    // Directory not measured yet; size is 0
+	Namespace    string    `json:"namespace,omitempty"`  // Trash namespace, empty for none
+	Pinned       bool      `json:"pinned,omitempty"`     // Exempt from purging by age
+	TrashPath    string    `json:"trash_path,omitempty"` // Empty when deleted without the trash
+	Action       string    `json:"action,omitempty"`     // What was done to the item (audit action)
 }
 
-// GetMetadata reads metadata for a trashed item
+// NewRecord describes the item at trashPath with metadata meta
+func NewRecord(meta *Metadata, trashPath string) Record {
+	return Record{
+		ID:           meta.ID,
+		OriginalPath: meta.OriginalPath,
+		DeletedAt:    meta.DeletedAt,
+		Size:         meta.Size,
+		Pending:      !meta.Scanned,
+		Namespace:    meta.Namespace,
+		Pinned:       meta.Pinned,
+		TrashPath:    trashPath,
+	}
+}
+
+// GetMetadata reads metadata for a trashed item; malformed metadata, or
+// metadata without an original path, is an error. Items without an ID get
+// one derived from their trash path.
 func GetMetadata(trashPath string) (*Metadata, error) {
-	metadataPath := trashPath + ".saferm-meta"
+	meta, err := readMetadata(trashPath)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ID == "" {
+		meta.ID = derivedID(trashPath)
+	}
+	return meta, nil
+}
+
+// readMetadata reads the metadata of a trashed item, or its .trashinfo
+func readMetadata(trashPath string) (*Metadata, error) {
+	metadataPath := metadataPath(trashPath)
 	data, err := os.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		// Trashed by a file manager, described only by its .trashinfo
+		if meta, infoErr := readTrashInfo(trashPath); infoErr == nil {
+			return meta, nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -164,6 +977,60 @@ func GetMetadata(trashPath string) (*Metadata, error) {
 	if err := json.Unmarshal(data, &meta); err != nil {
 		return nil, err
 	}
+	// Valid JSON such as null or {} does not describe an item
+	if meta.OriginalPath == "" {
+		return nil, fmt.Errorf("%s: no original_path", metadataPath)
+	}
+	migrateMetadata(&meta)
+
+	// Metadata left behind by an item that a file manager restored does not
+	// describe a later item reusing its name
+	if info, err := readTrashInfo(trashPath); err == nil && info.OriginalPath != meta.OriginalPath {
+		return info, nil
+	}
 
 	return &meta, nil
 }
+
+// Harden fixes permissions of an existing trash: the trash root and all
+// directories leading to trashed items are set to DirMode, and metadata files
+// to MetadataMode. Trashed payloads keep their original modes. It returns the
+// number of entries whose permissions were changed.
+func Harden(trashDir string) (int, error) {
+	fixed := 0
+	fix := func(path string, info os.FileInfo, mode os.FileMode) error {
+		if info.Mode().Perm() == mode {
+			return nil
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+		fixed++
+		return nil
+	}
+
+	err := filepath.Walk(trashDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if IsSidecar(path) {
+			return fix(path, info, MetadataMode)
+		}
+
+		// Trashed items are left as they are
+		if isItem(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return fix(path, info, DirMode)
+		}
+		return nil
+	})
+
+	return fixed, err
+}
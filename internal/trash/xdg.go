@@ -0,0 +1,254 @@
+package trash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// Trash backends selectable with trash_backend
+const (
+	BackendSafeRM = "saferm" // safe-rm's own trash layout (trash_layout)
+	BackendXDG    = "xdg"    // The freedesktop.org trash shared with file managers
+)
+
+// InfoSuffix names the .trashinfo file describing an item of an XDG trash
+const InfoSuffix = ".trashinfo"
+
+// trashInfoTime is the format of DeletionDate, in local time
+const trashInfoTime = "2006-01-02T15:04:05"
+
+// IsXDGTrash reports whether dir is a freedesktop.org trash directory: the
+// home trash ($XDG_DATA_HOME/Trash) or a per-mount .Trash/$UID or
+// .Trash-$UID, with its files and info subdirectories
+func IsXDGTrash(dir string) bool {
+	base := filepath.Base(dir)
+	if base != "Trash" && !strings.HasPrefix(base, ".Trash-") && filepath.Base(filepath.Dir(dir)) != ".Trash" {
+		return false
+	}
+	for _, sub := range []string{"files", "info"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// xdgInfoDir returns the info directory holding the .trashinfo of an item
+// of an XDG trash, and false for items of other trashes
+func xdgInfoDir(trashPath string) (string, bool) {
+	files := filepath.Dir(trashPath)
+	if filepath.Base(files) != "files" || !IsXDGTrash(filepath.Dir(files)) {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(files), "info"), true
+}
+
+// sidecar returns the path of the sidecar file of a trashed item with the
+// given suffix. Sidecars sit next to the item, except in an XDG trash where
+// they go to the info directory: file managers show everything in files.
+func sidecar(trashPath, suffix string) string {
+	if infoDir, ok := xdgInfoDir(trashPath); ok {
+		return filepath.Join(infoDir, filepath.Base(trashPath)+suffix)
+	}
+	return trashPath + suffix
+}
+
+// metadataPath returns the path of the metadata file of a trashed item
+func metadataPath(trashPath string) string {
+	return sidecar(trashPath, ".saferm-meta")
+}
+
+// isItem reports whether path is a trashed item: it has metadata, or it is
+// described by a .trashinfo in an XDG trash
+func isItem(path string) bool {
+	if _, err := os.Stat(metadataPath(path)); err == nil {
+		return true
+	}
+	if infoDir, ok := xdgInfoDir(path); ok {
+		_, err := os.Stat(filepath.Join(infoDir, filepath.Base(path)+InfoSuffix))
+		return err == nil
+	}
+	return false
+}
+
+// moveToXDG moves absPath into the XDG trash trashBase. As the specification
+// requires, the .trashinfo is created (exclusively, which also reserves the
+// name) before the item is moved, and removed again if the move fails.
+func moveToXDG(cfg *config.Config, trashBase, absPath string, verified bool) (trashPath string, err error) {
+	info, err := Lstat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashBase, sub), DirMode); err != nil {
+			if uerr := checkUnavailable(trashBase, err); uerr != err {
+				return "", uerr
+			}
+			return "", fmt.Errorf("failed to create trash directory: %v", err)
+		}
+	}
+
+	infoPath, err := reserveTrashInfo(cfg, trashBase, absPath)
+	if err != nil {
+		return "", checkUnavailable(trashBase, err)
+	}
+	defer func() {
+		// An interrupted copy keeps its name for --resume
+		var interrupted *InterruptedError
+		if err != nil && !errors.As(err, &interrupted) {
+			os.Remove(infoPath)
+		}
+	}()
+
+	name := strings.TrimSuffix(filepath.Base(infoPath), InfoSuffix)
+	return moveInto(cfg, trashBase, absPath, filepath.Join(trashBase, "files", name), info, verified)
+}
+
+// reserveTrashInfo writes the .trashinfo of absPath under the first free
+// name (the base name, then name.2, name.3, ...) and returns its path
+func reserveTrashInfo(cfg *config.Config, trashBase, absPath string) (string, error) {
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: absPath}).EscapedPath(), cfg.Now().Format(trashInfoTime))
+
+	base := trashName(filepath.Base(absPath))
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s.%d", base, n)
+		}
+		infoPath := filepath.Join(trashBase, "info", name+InfoSuffix)
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, MetadataMode)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// A leftover payload without its .trashinfo still takes the name
+		if _, err := os.Lstat(filepath.Join(trashBase, "files", name)); err == nil {
+			f.Close()
+			os.Remove(infoPath)
+			continue
+		}
+		// Sidecars left behind when a file manager restored an earlier
+		// item of this name do not describe the new one
+		for _, suffix := range []string{".saferm-meta", FilesSuffix, ManifestSuffix, ModesSuffix} {
+			os.Remove(filepath.Join(trashBase, "info", name+suffix))
+		}
+
+		if _, err := f.WriteString(content); err != nil {
+			f.Close()
+			os.Remove(infoPath)
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		return infoPath, nil
+	}
+}
+
+// readTrashInfo returns the metadata of an item of an XDG trash from its
+// .trashinfo, for items trashed by file managers and other tools
+func readTrashInfo(trashPath string) (*Metadata, error) {
+	infoDir, ok := xdgInfoDir(trashPath)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	infoPath := filepath.Join(infoDir, filepath.Base(trashPath)+InfoSuffix)
+	f, err := os.Open(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta := Metadata{Version: MetadataVersion}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			path, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid Path: %v", infoPath, err)
+			}
+			meta.OriginalPath = path
+		case "DeletionDate":
+			deletedAt, err := time.ParseInLocation(trashInfoTime, value, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid DeletionDate: %v", infoPath, err)
+			}
+			meta.DeletedAt = deletedAt
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if meta.OriginalPath == "" {
+		return nil, fmt.Errorf("%s: no Path", infoPath)
+	}
+
+	// Paths in the trash of a mount are relative to its top directory
+	if !filepath.IsAbs(meta.OriginalPath) {
+		top := filepath.Dir(filepath.Dir(infoDir))
+		if filepath.Base(top) == ".Trash" {
+			top = filepath.Dir(top)
+		}
+		meta.OriginalPath = filepath.Join(top, meta.OriginalPath)
+	}
+	if info, err := os.Lstat(trashPath); err == nil {
+		meta.IsDirectory = info.IsDir()
+		if !info.IsDir() {
+			meta.Size, meta.Files, meta.Scanned = info.Size(), 1, true
+		}
+	}
+	return &meta, nil
+}
+
+// VisitXDG calls item for each item of an XDG trash, in lexical order, and
+// tombstone for each tombstone left by an interrupted purge. The .trashinfo
+// files decide what is an item, as long as its payload is in place.
+func VisitXDG(trashDir string, item, tombstone func(path string)) error {
+	files := filepath.Join(trashDir, "files")
+	entries, err := os.ReadDir(filepath.Join(trashDir, "info"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), InfoSuffix)
+		if !ok {
+			continue
+		}
+		trashPath := filepath.Join(files, name)
+		if _, err := os.Lstat(trashPath); err == nil {
+			item(trashPath)
+		} else if snapshotOnly(trashPath) {
+			item(trashPath)
+		}
+	}
+
+	entries, err = os.ReadDir(files)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if path := filepath.Join(files, entry.Name()); isTombstone(path) {
+			tombstone(path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/safe-rm/internal/output"
+	"github.com/user/safe-rm/internal/restore"
+)
+
+// Actions requested by a key
+const (
+	actionNone = iota
+	actionQuit
+	actionRestore
+	actionDelete
+)
+
+// previewLines is the height of the metadata preview below the list
+const previewLines = 8
+
+// helpLine is shown in the status line when there is nothing else to say
+const helpLine = "up/down move  space select  a all  / filter  r restore  D delete  q quit"
+
+// model is the state of the browser: the trashed items, the filter and
+// selection applied to them, and the cursor. It does no I/O, so that key
+// handling and rendering can be tested without a terminal.
+type model struct {
+	entries   []restore.Entry
+	visible   []int           // Indices into entries matching the filter
+	selected  map[string]bool // Trash paths of selected items
+	cursor    int             // Index into visible
+	top       int             // First visible item shown
+	rows      int             // List rows shown by the last render
+	filter    string
+	filtering bool // Typing the filter
+	confirm   bool // Waiting for the confirmation of a permanent delete
+	status    string
+}
+
+// newModel returns a model showing entries
+func newModel(entries []restore.Entry) *model {
+	m := &model{entries: entries, selected: make(map[string]bool), rows: 10}
+	m.applyFilter()
+	return m
+}
+
+// applyFilter recomputes the visible items. Every word of the filter must
+// appear (ignoring case) in the ID, original path, namespace, note or tags
+// of an item.
+func (m *model) applyFilter() {
+	words := strings.Fields(strings.ToLower(m.filter))
+	m.visible = m.visible[:0]
+	for i, entry := range m.entries {
+		meta := entry.Meta
+		haystack := strings.ToLower(strings.Join(append([]string{meta.ID, meta.OriginalPath, meta.Namespace, meta.Note}, meta.Tags...), " "))
+		matches := true
+		for _, word := range words {
+			if !strings.Contains(haystack, word) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.moveTo(m.cursor)
+}
+
+// moveTo moves the cursor to a visible item, keeping it on screen
+func (m *model) moveTo(cursor int) {
+	if cursor >= len(m.visible) {
+		cursor = len(m.visible) - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+	m.cursor = cursor
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+m.rows {
+		m.top = m.cursor - m.rows + 1
+	}
+}
+
+// current returns the item under the cursor, if any
+func (m *model) current() (restore.Entry, bool) {
+	if len(m.visible) == 0 {
+		return restore.Entry{}, false
+	}
+	return m.entries[m.visible[m.cursor]], true
+}
+
+// targets returns the items an action applies to: the selected items the
+// filter shows, or else the item under the cursor. Selected items hidden by
+// the filter are left alone.
+func (m *model) targets() []restore.Entry {
+	var targets []restore.Entry
+	for _, i := range m.visible {
+		if m.selected[m.entries[i].Path] {
+			targets = append(targets, m.entries[i])
+		}
+	}
+	if len(targets) == 0 {
+		if entry, ok := m.current(); ok {
+			targets = append(targets, entry)
+		}
+	}
+	return targets
+}
+
+// handle applies a key and returns the action it requests
+func (m *model) handle(key string) int {
+	if key == "ctrl-c" {
+		return actionQuit
+	}
+	if m.confirm {
+		m.confirm = false
+		if key == "y" || key == "Y" {
+			return actionDelete
+		}
+		m.status = "Delete cancelled."
+		return actionNone
+	}
+	m.status = ""
+
+	if m.filtering {
+		switch key {
+		case "enter":
+			m.filtering = false
+		case "esc":
+			m.filtering = false
+			m.filter = ""
+			m.applyFilter()
+		case "backspace":
+			if m.filter != "" {
+				_, size := utf8.DecodeLastRuneInString(m.filter)
+				m.filter = m.filter[:len(m.filter)-size]
+				m.applyFilter()
+			}
+		case "space":
+			m.filter += " "
+			m.applyFilter()
+		case "up", "down", "pgup", "pgdn", "home", "end":
+			m.move(key)
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.filter += key
+				m.applyFilter()
+			}
+		}
+		return actionNone
+	}
+
+	switch key {
+	case "q":
+		return actionQuit
+	case "up", "k", "down", "j", "pgup", "pgdn", "home", "g", "end", "G":
+		m.move(key)
+	case "space":
+		if entry, ok := m.current(); ok {
+			if m.selected[entry.Path] {
+				delete(m.selected, entry.Path)
+			} else {
+				m.selected[entry.Path] = true
+			}
+			m.moveTo(m.cursor + 1)
+		}
+	case "a":
+		all := true
+		for _, i := range m.visible {
+			all = all && m.selected[m.entries[i].Path]
+		}
+		for _, i := range m.visible {
+			if all {
+				delete(m.selected, m.entries[i].Path)
+			} else {
+				m.selected[m.entries[i].Path] = true
+			}
+		}
+	case "/":
+		m.filtering = true
+	case "esc":
+		if m.filter != "" {
+			m.filter = ""
+			m.applyFilter()
+		} else {
+			m.selected = make(map[string]bool)
+		}
+	case "r":
+		if len(m.targets()) > 0 {
+			return actionRestore
+		}
+		m.status = "Nothing to restore."
+	case "D":
+		if len(m.targets()) > 0 {
+			m.confirm = true
+		} else {
+			m.status = "Nothing to delete."
+		}
+	}
+	return actionNone
+}
+
+// move moves the cursor for a navigation key
+func (m *model) move(key string) {
+	switch key {
+	case "up", "k":
+		m.moveTo(m.cursor - 1)
+	case "down", "j":
+		m.moveTo(m.cursor + 1)
+	case "pgup":
+		m.moveTo(m.cursor - m.rows)
+	case "pgdn":
+		m.moveTo(m.cursor + m.rows)
+	case "home", "g":
+		m.moveTo(0)
+	case "end", "G":
+		m.moveTo(len(m.visible) - 1)
+	}
+}
+
+// run applies action (restore.RestoreID or restore.DeleteID) to the target
+// items by ID, drops the items it succeeded on and reports the outcome in
+// the status line. What the action prints is captured, as it would
+// otherwise land in the middle of the screen.
+func (m *model) run(verb string, action func(id string) error) {
+	var captured bytes.Buffer
+	oldStdout, oldStderr := output.Stdout, output.Stderr
+	output.Stdout, output.Stderr = &captured, &captured
+	defer func() { output.Stdout, output.Stderr = oldStdout, oldStderr }()
+
+	done := make(map[string]bool)
+	var failed int
+	var lastErr error
+	for _, entry := range m.targets() {
+		if err := action(entry.Meta.ID); err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		done[entry.Path] = true
+	}
+
+	var kept []restore.Entry
+	for _, entry := range m.entries {
+		if done[entry.Path] {
+			delete(m.selected, entry.Path)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	m.entries = kept
+	m.applyFilter()
+
+	m.status = fmt.Sprintf("%s %d item(s).", verb, len(done))
+	if failed > 0 {
+		message, _, _ := strings.Cut(lastErr.Error(), "\n")
+		m.status = fmt.Sprintf("%s %d item(s), %d failed: %s", verb, len(done), failed, message)
+	}
+}
+
+// render returns the lines of the screen for a terminal of the given size:
+// a title, the list, a preview of the metadata of the current item and a
+// status line
+func (m *model) render(width, height int) []string {
+	m.rows = height - 4 - previewLines
+	if m.rows < 1 {
+		m.rows = 1
+	}
+	m.moveTo(m.cursor)
+
+	title := fmt.Sprintf("safe-rm browse: %d item(s), %d shown, %d selected", len(m.entries), len(m.visible), len(m.selected))
+	if m.filter != "" {
+		title += "  filter: " + m.filter
+	}
+	lines := []string{
+		truncate(title, width),
+		truncate(fmt.Sprintf("  %-12s  %-16s  %9s  %s", "ID", "DELETED AT", "SIZE", "ORIGINAL PATH"), width),
+	}
+
+	for row := 0; row < m.rows; row++ {
+		i := m.top + row
+		if i >= len(m.visible) {
+			lines = append(lines, "")
+			continue
+		}
+		entry := m.entries[m.visible[i]]
+		mark := "  "
+		if m.selected[entry.Path] {
+			mark = "* "
+		}
+		line := truncate(fmt.Sprintf("%s%-12s  %-16s  %9s  %s", mark, entry.Meta.ID,
+			entry.Meta.DeletedAt.Format("2006-01-02 15:04"), size(entry), entry.Meta.OriginalPath), width)
+		if i == m.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, strings.Repeat("-", width))
+	preview := m.preview()
+	for i := 0; i < previewLines; i++ {
+		if i < len(preview) {
+			lines = append(lines, truncate(preview[i], width))
+		} else {
+			lines = append(lines, "")
+		}
+	}
+
+	status := m.status
+	switch {
+	case m.filtering:
+		status = "Filter: " + m.filter + "_"
+	case m.confirm:
+		status = fmt.Sprintf("Permanently delete %d item(s)? This cannot be undone. [y/N]", len(m.targets()))
+	case status == "":
+		status = helpLine
+	}
+	return append(lines, truncate(status, width))
+}
+
+// preview returns the metadata of the current item
+func (m *model) preview() []string {
+	entry, ok := m.current()
+	if !ok {
+		if len(m.entries) == 0 {
+			return []string{"The trash is empty."}
+		}
+		return []string{"No item matches the filter."}
+	}
+	meta := entry.Meta
+
+	lines := []string{
+		"ID:            " + meta.ID,
+		"Original path: " + meta.OriginalPath,
+		"Trash path:    " + entry.Path,
+		fmt.Sprintf("Deleted at:    %s on %s", meta.DeletedAt.Format("2006-01-02 15:04:05"), meta.Hostname),
+	}
+	details := "Size:          " + size(entry)
+	if meta.IsDirectory && meta.Scanned {
+		details += fmt.Sprintf(" (%d files)", meta.Files)
+	}
+	if meta.Pinned {
+		details += ", pinned"
+	}
+	lines = append(lines, details)
+	if meta.Namespace != "" || meta.Session != "" {
+		lines = append(lines, fmt.Sprintf("Namespace:     %s  Session: %s", orDash(meta.Namespace), orDash(meta.Session)))
+	}
+	if meta.Note != "" {
+		lines = append(lines, "Note:          "+meta.Note)
+	}
+	if len(meta.Tags) > 0 {
+		lines = append(lines, "Tags:          "+strings.Join(meta.Tags, ", "))
+	}
+	return lines
+}
+
+// size formats the size of an item; directories show "pending" until the
+// background scan has measured them
+func size(entry restore.Entry) string {
+	if !entry.Meta.Scanned {
+		return "pending"
+	}
+	return output.FormatBytes(entry.Meta.Size)
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate cuts s to at most width characters
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
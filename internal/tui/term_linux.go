@@ -0,0 +1,9 @@
+package tui
+
+import "syscall"
+
+// Requests getting and setting the terminal mode
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import "errors"
+
+// errNoTerminal is returned where raw terminal mode is not supported
+var errNoTerminal = errors.New("the browser is not supported on this platform")
+
+// makeRaw is not supported on this platform
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errNoTerminal
+}
+
+// windowSize is not supported on this platform
+func windowSize(fd uintptr) (int, int, error) {
+	return 0, 0, errNoTerminal
+}
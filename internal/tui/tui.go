@@ -0,0 +1,156 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/restore"
+)
+
+// Escape sequences switching to the alternate screen (so the browser leaves
+// the scrollback untouched) and back
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// Browse opens the interactive trash browser on the terminal: a list of the
+// trashed items, most recent first, that can be filtered, with a preview of
+// the metadata of the current item. Selected items (or the current one) are
+// restored with restore.RestoreID or permanently deleted with
+// restore.DeleteID. Standard input and output must be a terminal.
+func Browse(cfg *config.Config, opts restore.RestoreOptions) error {
+	entries, err := restore.Entries(cfg, opts.AllRoots)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("Trash is empty.")
+		return nil
+	}
+
+	in, out := os.Stdin, os.Stdout
+	reset, err := makeRaw(in.Fd())
+	if err != nil {
+		return fmt.Errorf("cannot set up the terminal: %v", err)
+	}
+	defer reset()
+	fmt.Fprint(out, enterScreen)
+	defer fmt.Fprint(out, leaveScreen)
+
+	m := newModel(entries)
+	buf := make([]byte, 256)
+	for {
+		width, height, err := windowSize(out.Fd())
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		draw(out, m.render(width, height))
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			switch m.handle(key) {
+			case actionQuit:
+				return nil
+			case actionRestore:
+				m.run("Restored", func(id string) error { return restore.RestoreID(cfg, id, opts) })
+			case actionDelete:
+				m.run("Deleted", func(id string) error { return restore.DeleteID(cfg, id, opts) })
+			}
+		}
+	}
+}
+
+// draw redraws the whole screen with lines
+func draw(w io.Writer, lines []string) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	io.WriteString(w, b.String())
+}
+
+// escapeKeys maps the escape sequences of special keys to key names
+var escapeKeys = map[string]string{
+	"[A": "up", "OA": "up",
+	"[B": "down", "OB": "down",
+	"[5~": "pgup", "[6~": "pgdn",
+	"[H": "home", "OH": "home", "[1~": "home", "[7~": "home",
+	"[F": "end", "OF": "end", "[4~": "end", "[8~": "end",
+}
+
+// parseKeys splits terminal input into key names: "up", "down", "pgup",
+// "pgdn", "home", "end", "enter", "esc", "backspace", "space", "ctrl-c", or
+// the character typed. Unknown escape sequences are dropped.
+func parseKeys(input []byte) []string {
+	var keys []string
+	s := string(input)
+	for len(s) > 0 {
+		switch c := s[0]; {
+		case c == 0x1b:
+			if len(s) == 1 {
+				keys = append(keys, "esc")
+				s = ""
+				continue
+			}
+			seq, rest := escapeSequence(s[1:])
+			if seq == "" {
+				keys = append(keys, "esc")
+			} else if key, ok := escapeKeys[seq]; ok {
+				keys = append(keys, key)
+			}
+			s = rest
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, "enter")
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, "backspace")
+		case c == 0x03:
+			keys = append(keys, "ctrl-c")
+		case c == ' ':
+			keys = append(keys, "space")
+		case c < 0x20:
+			// Other control characters are ignored
+		default:
+			r := []rune(s)[0]
+			keys = append(keys, string(r))
+			s = s[len(string(r)):]
+			continue
+		}
+		s = s[1:]
+	}
+	return keys
+}
+
+// escapeSequence splits the CSI ("[...") or SS3 ("O.") sequence following
+// an escape from the rest of the input. A sequence of neither kind is a
+// plain escape, returned as "".
+func escapeSequence(s string) (string, string) {
+	switch s[0] {
+	case 'O':
+		if len(s) < 2 {
+			return s, ""
+		}
+		return s[:2], s[2:]
+	case '[':
+		for i := 1; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return s[:i+1], s[i+1:]
+			}
+		}
+		return s, ""
+	}
+	return "", s
+}
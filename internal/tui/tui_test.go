@@ -0,0 +1,213 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/safe-rm/internal/restore"
+	"github.com/user/safe-rm/internal/trash"
+)
+
+// testEntries returns trashed items, most recent first
+func testEntries() []restore.Entry {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	items := []struct {
+		id, path, note string
+	}{
+		{"aaa111", "/home/user/report.pdf", ""},
+		{"bbb222", "/home/user/src/main.go", "old prototype"},
+		{"ccc333", "/home/user/src/util.go", ""},
+		{"ddd444", "/tmp/scratch.txt", ""},
+	}
+	var entries []restore.Entry
+	for i, item := range items {
+		entries = append(entries, restore.Entry{
+			Root: "/trash",
+			Path: "/trash/" + item.id,
+			Meta: &trash.Metadata{
+				ID:           item.id,
+				OriginalPath: item.path,
+				DeletedAt:    now.Add(-time.Duration(i) * time.Hour),
+				Note:         item.note,
+				Size:         int64(100 * (i + 1)),
+				Scanned:      true,
+			},
+		})
+	}
+	return entries
+}
+
+// ids returns the IDs of entries
+func ids(entries []restore.Entry) []string {
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.Meta.ID)
+	}
+	return ids
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"jk", []string{"j", "k"}},
+		{"\x1b[A\x1b[B", []string{"up", "down"}},
+		{"\x1bOA", []string{"up"}},
+		{"\x1b[5~\x1b[6~\x1b[H\x1b[4~", []string{"pgup", "pgdn", "home", "end"}},
+		{"\x1b", []string{"esc"}},
+		{"\x1bq", []string{"esc", "q"}},
+		{"\x1b[1;5C", nil},
+		{"a b\r\x7f\x03", []string{"a", "space", "b", "enter", "backspace", "ctrl-c"}},
+		{"é", []string{"é"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{"aaa111", "bbb222", "ccc333", "ddd444"}},
+		{"src", []string{"bbb222", "ccc333"}},
+		{"SRC util", []string{"ccc333"}},
+		{"prototype", []string{"bbb222"}},
+		{"ddd", []string{"ddd444"}},
+		{"nothing", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			m := newModel(testEntries())
+			m.handle("/")
+			for _, key := range parseKeys([]byte(tt.filter)) {
+				m.handle(key)
+			}
+			m.handle("enter")
+			var got []string
+			for _, i := range m.visible {
+				got = append(got, m.entries[i].Meta.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter %q shows %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	m := newModel(testEntries())
+
+	// Without a selection, actions apply to the current item
+	m.handle("down")
+	if got := ids(m.targets()); !reflect.DeepEqual(got, []string{"bbb222"}) {
+		t.Errorf("targets = %v, want the current item", got)
+	}
+
+	// Space selects and moves on
+	m.handle("space")
+	m.handle("down")
+	m.handle("space")
+	if got := ids(m.targets()); !reflect.DeepEqual(got, []string{"bbb222", "ddd444"}) {
+		t.Errorf("targets = %v, want the selected items", got)
+	}
+
+	// Selected items hidden by the filter are left alone
+	for _, key := range []string{"/", "s", "r", "c", "enter"} {
+		m.handle(key)
+	}
+	if got := ids(m.targets()); !reflect.DeepEqual(got, []string{"bbb222"}) {
+		t.Errorf("filtered targets = %v, want only the visible selection", got)
+	}
+
+	// "a" selects every visible item, then none
+	m.handle("a")
+	if got := ids(m.targets()); !reflect.DeepEqual(got, []string{"bbb222", "ccc333"}) {
+		t.Errorf("targets after a = %v, want all visible items", got)
+	}
+	m.handle("a")
+	if len(m.selected) != 1 {
+		t.Errorf("%d item(s) selected after a second a, want only the hidden one", len(m.selected))
+	}
+}
+
+func TestActions(t *testing.T) {
+	m := newModel(testEntries())
+	if m.handle("r") != actionRestore {
+		t.Fatal("r did not request a restore")
+	}
+
+	// Permanent deletion asks first
+	if m.handle("D") != actionNone || !m.confirm {
+		t.Fatal("D did not ask for confirmation")
+	}
+	if m.handle("n") != actionNone || m.confirm {
+		t.Error("declining did not cancel the delete")
+	}
+	m.handle("D")
+	if m.handle("y") != actionDelete {
+		t.Error("confirming did not request the delete")
+	}
+
+	// Succeeded items leave the list, failed ones stay
+	m.handle("space")
+	m.handle("space")
+	m.handle("space")
+	var got []string
+	m.run("Restored", func(id string) error {
+		got = append(got, id)
+		if id == "bbb222" {
+			return errors.New("destination already exists: /home/user/src/main.go")
+		}
+		return nil
+	})
+	if !reflect.DeepEqual(got, []string{"aaa111", "bbb222", "ccc333"}) {
+		t.Errorf("action ran on %v, want the selected items", got)
+	}
+	if left := ids(m.entries); !reflect.DeepEqual(left, []string{"bbb222", "ddd444"}) {
+		t.Errorf("items left = %v, want the failed and unselected ones", left)
+	}
+	if !strings.Contains(m.status, "Restored 2 item(s), 1 failed: destination already exists") {
+		t.Errorf("status = %q", m.status)
+	}
+
+	if m.handle("q") != actionQuit || m.handle("ctrl-c") != actionQuit {
+		t.Error("q and Ctrl-C should quit")
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := newModel(testEntries())
+	m.handle("end")
+
+	// A short terminal scrolls the list to keep the cursor on screen
+	lines := m.render(60, 4+previewLines+2)
+	if len(lines) != 4+previewLines+2 {
+		t.Fatalf("render() returned %d lines, want %d", len(lines), 4+previewLines+2)
+	}
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{"4 item(s), 4 shown", "\x1b[7m  ddd444", "ID:            ddd444", "Original path: /tmp/scratch.txt", helpLine[:40]} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen lacks %q:\n%s", want, screen)
+		}
+	}
+	if strings.Contains(screen, "aaa111") {
+		t.Errorf("screen shows an item scrolled out of view:\n%s", screen)
+	}
+	for _, line := range lines {
+		if n := len([]rune(strings.NewReplacer("\x1b[7m", "", "\x1b[0m", "").Replace(line))); n > 60 {
+			t.Errorf("line of %d characters is wider than the terminal: %q", n, line)
+		}
+	}
+}
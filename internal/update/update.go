@@ -0,0 +1,298 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release channels
+const (
+	ChannelStable = "stable" // Releases only
+	ChannelBeta   = "beta"   // Releases and pre-releases
+)
+
+// ReleasesURL lists the releases of safe-rm; tests point it elsewhere
+var ReleasesURL = "https://api.github.com/repos/Ruisi-Lu/safe-rm/releases"
+
+// checksumsAsset is the release asset holding the SHA-256 of every binary,
+// and signatureAsset its Ed25519 signature by the release key
+const (
+	checksumsAsset = "checksums.txt"
+	signatureAsset = "checksums.txt.sig"
+)
+
+// ReleaseKey is the hex Ed25519 public key that signs the checksums of
+// releases. The release workflow pins it into the binary with
+// -ldflags "-X github.com/user/safe-rm/internal/update.ReleaseKey=..."; a
+// build without it cannot verify, and so never installs, an update.
+var ReleaseKey = ""
+
+// maxBinarySize bounds the download of a binary
+const maxBinarySize = 256 << 20
+
+// client fetches releases and assets
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// Release is a published release of safe-rm
+type Release struct {
+	Tag        string  `json:"tag_name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Version returns the version of the release, without the leading "v"
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+// asset returns the asset of the release with the given name
+func (r *Release) asset(name string) (*Asset, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
+
+// AssetName returns the name of the release binary for this platform, as
+// built by the release workflow
+func AssetName() string {
+	return fmt.Sprintf("rm-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// Latest returns the newest release of the channel that has a binary for
+// this platform
+func Latest(channel string) (*Release, error) {
+	if channel != ChannelStable && channel != ChannelBeta {
+		return nil, fmt.Errorf("invalid channel '%s' (expected '%s' or '%s')", channel, ChannelStable, ChannelBeta)
+	}
+
+	data, err := fetch(ReleasesURL, 16<<20)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list releases: %v", err)
+	}
+	var releases []Release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("cannot list releases: %v", err)
+	}
+
+	var latest *Release
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft || (release.Prerelease && channel != ChannelBeta) {
+			continue
+		}
+		if _, ok := release.asset(AssetName()); !ok {
+			continue
+		}
+		if latest == nil || Compare(release.Version(), latest.Version()) > 0 {
+			latest = release
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %s release has a binary for %s/%s", channel, runtime.GOOS, runtime.GOARCH)
+	}
+	return latest, nil
+}
+
+// Download fetches the binary of a release for this platform and checks it
+// against the SHA-256 listed in the checksums of the release, which must be
+// signed with ReleaseKey: whoever can publish a binary can publish its
+// checksum too, but not sign it. A release without signed checksums, or
+// whose checksums do not list the binary, is refused.
+func Download(release *Release) ([]byte, error) {
+	key, err := releaseKey()
+	if err != nil {
+		return nil, err
+	}
+	name := AssetName()
+	binary, _ := release.asset(name)
+	sums, ok := release.asset(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s to verify the binary against", release.Tag, checksumsAsset)
+	}
+	sig, ok := release.asset(signatureAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s: its checksums are not signed", release.Tag, signatureAsset)
+	}
+
+	data, err := fetch(sums.URL, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %v", checksumsAsset, err)
+	}
+	signature, err := fetch(sig.URL, ed25519.SignatureSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %v", signatureAsset, err)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return nil, fmt.Errorf("%s of release %s is not signed by the release key", checksumsAsset, release.Tag)
+	}
+	want, ok := checksumOf(data, name)
+	if !ok {
+		return nil, fmt.Errorf("%s of release %s does not list %s", checksumsAsset, release.Tag, name)
+	}
+
+	data, err = fetch(binary.URL, maxBinarySize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %v", name, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	return data, nil
+}
+
+// releaseKey decodes ReleaseKey
+func releaseKey() (ed25519.PublicKey, error) {
+	if ReleaseKey == "" {
+		return nil, fmt.Errorf("this build has no release key to verify updates with; update it by installing a release")
+	}
+	key, err := hex.DecodeString(ReleaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release key %q built into this binary", ReleaseKey)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// checksumOf returns the SHA-256 of name in sha256sum output
+func checksumOf(sums []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// fetch returns the body of a successful GET of url, up to limit bytes
+func fetch(url string, limit int64) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// Replace atomically replaces the binary at path (following symlinks, so
+// the safe-rm link keeps pointing at the rm it names) with data: the new
+// binary is written next to it with the same mode, synced, then renamed
+// over it. A running rm sees either the old binary or the new one.
+func Replace(path string, data []byte) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Compare compares two versions (1.2.3, 1.3.0-beta.1), returning -1, 0 or
+// +1. A pre-release sorts before the release of the same version.
+func Compare(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	if c := compareFields(strings.Split(aCore, "."), strings.Split(bCore, ".")); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareFields(strings.Split(aPre, "."), strings.Split(bPre, "."))
+}
+
+// compareFields compares dot-separated version fields, numerically where
+// both are numbers
+func compareFields(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := "0", "0"
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
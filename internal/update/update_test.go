@@ -0,0 +1,202 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"1.0.1", "1.0.0", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "10.0.0", -1},
+		{"1.1.0-beta.1", "1.1.0", -1},
+		{"1.1.0-beta.2", "1.1.0-beta.10", -1},
+		{"1.1.0-beta.1", "1.0.9", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := Compare(tt.a, tt.b); got != tt.want {
+				t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// serveReleases serves a release list, in which SERVER stands for the
+// address of the server, and release files by path
+func serveReleases(t *testing.T, releases string, files map[string]string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/releases" {
+			fmt.Fprint(w, strings.ReplaceAll(releases, "SERVER", "http://"+r.Host))
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	oldURL := ReleasesURL
+	ReleasesURL = server.URL + "/releases"
+	t.Cleanup(func() {
+		ReleasesURL = oldURL
+		server.Close()
+	})
+}
+
+func TestLatest(t *testing.T) {
+	name := AssetName()
+	releases := fmt.Sprintf(`[
+		{"tag_name": "v1.3.0-beta.1", "prerelease": true, "assets": [{"name": %[1]q, "browser_download_url": "SERVER/b"}]},
+		{"tag_name": "v1.4.0", "draft": true, "assets": [{"name": %[1]q, "browser_download_url": "SERVER/d"}]},
+		{"tag_name": "v1.2.5", "assets": [{"name": "rm-plan9-mips", "browser_download_url": "SERVER/p"}]},
+		{"tag_name": "v1.2.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/s"}]},
+		{"tag_name": "v1.1.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/o"}]}
+	]`, name)
+	serveReleases(t, releases, nil)
+
+	tests := []struct {
+		channel string
+		want    string
+	}{
+		{ChannelStable, "1.2.0"},
+		{ChannelBeta, "1.3.0-beta.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			release, err := Latest(tt.channel)
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+			if release.Version() != tt.want {
+				t.Errorf("Latest(%s) = %s, want %s", tt.channel, release.Version(), tt.want)
+			}
+		})
+	}
+
+	if _, err := Latest("nightly"); err == nil {
+		t.Error("Latest() accepted an unknown channel")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	name := AssetName()
+	binary := "#!/bin/sh\necho new\n"
+	sum := sha256.Sum256([]byte(binary))
+	good := hex.EncodeToString(sum[:]) + "  " + name + "\n"
+	bad := strings.Repeat("0", 64) + "  " + name + "\n"
+	other := hex.EncodeToString(sum[:]) + "  rm-other-arch\n"
+
+	// Checksums are signed by the release key pinned in the binary, or
+	// by a key of the attacker's
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, forger, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := ReleaseKey
+	ReleaseKey = hex.EncodeToString(public)
+	defer func() { ReleaseKey = oldKey }()
+
+	tests := []struct {
+		name     string
+		releases string
+		key      string // Pinned release key; default the signing one
+		wantErr  bool
+	}{
+		{"verified", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/good"}, {"name": "checksums.txt.sig", "browser_download_url": "SERVER/good.sig"}]}]`, "", false},
+		{"checksum mismatch", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/bad"}, {"name": "checksums.txt.sig", "browser_download_url": "SERVER/bad.sig"}]}]`, "", true},
+		{"not listed", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/other"}, {"name": "checksums.txt.sig", "browser_download_url": "SERVER/other.sig"}]}]`, "", true},
+		{"no checksums", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}]}]`, "", true},
+		{"no signature", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/good"}]}]`, "", true},
+		{"forged signature", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/good"}, {"name": "checksums.txt.sig", "browser_download_url": "SERVER/forged.sig"}]}]`, "", true},
+		{"no pinned key", `[{"tag_name": "v2.0.0", "assets": [{"name": %[1]q, "browser_download_url": "SERVER/bin"}, {"name": "checksums.txt", "browser_download_url": "SERVER/good"}, {"name": "checksums.txt.sig", "browser_download_url": "SERVER/good.sig"}]}]`, "none", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ReleaseKey = hex.EncodeToString(public)
+			if tt.key == "none" {
+				ReleaseKey = ""
+			}
+			serveReleases(t, fmt.Sprintf(tt.releases, name), map[string]string{
+				"/bin":        binary,
+				"/good":       good,
+				"/good.sig":   string(ed25519.Sign(private, []byte(good))),
+				"/forged.sig": string(ed25519.Sign(forger, []byte(good))),
+				"/bad":        bad,
+				"/bad.sig":    string(ed25519.Sign(private, []byte(bad))),
+				"/other":      other,
+				"/other.sig":  string(ed25519.Sign(private, []byte(other))),
+			})
+			release, err := Latest(ChannelStable)
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+			data, err := Download(release)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(data) != binary {
+				t.Errorf("Download() = %q, want %q", data, binary)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-update-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	binary := filepath.Join(tempDir, "rm")
+	if err := os.WriteFile(binary, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tempDir, "safe-rm")
+	if err := os.Symlink("rm", link); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updating through the safe-rm link replaces the rm it points to
+	if err := Replace(link, []byte("new")); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if data, err := os.ReadFile(binary); err != nil || string(data) != "new" {
+		t.Errorf("binary = %q, %v, want the new content", data, err)
+	}
+	if info, err := os.Stat(binary); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("binary mode = %v, %v, want 0755", info.Mode(), err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "rm" {
+		t.Errorf("safe-rm link = %q, %v, want it untouched", target, err)
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("directory holds %d entries, want no leftover temporary file", len(entries))
+	}
+}
@@ -0,0 +1,240 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+// Events counted in the usage statistics
+const (
+	EventBlock   = "block"   // Removal of a protected path refused
+	EventConfirm = "confirm" // Removal of a protected path confirmed at the prompt
+	EventAbort   = "abort"   // Confirmation of a protected path declined
+	EventBypass  = "bypass"  // Protected path removed without asking (log-only rule, observe mode)
+)
+
+// events lists the events in display order, with their labels
+var events = []struct{ name, label string }{
+	{EventBlock, "Blocked"},
+	{EventConfirm, "Confirmed"},
+	{EventAbort, "Aborted"},
+	{EventBypass, "Bypassed"},
+}
+
+// maxPaths bounds the paths tracked; the least hit are dropped first
+const maxPaths = 1000
+
+// Stats are the local usage statistics: how often protection rules were
+// hit, how users responded, and which protected paths they hit most
+type Stats struct {
+	Since  time.Time             `json:"since"`
+	Events map[string]int        `json:"events"`
+	Rules  map[string]int        `json:"rules"` // Hits by rule_actions key
+	Paths  map[string]*PathStats `json:"paths"`
+}
+
+// PathStats counts the events of one protected path
+type PathStats struct {
+	Events  map[string]int `json:"events"`
+	LastHit time.Time      `json:"last_hit"`
+}
+
+// Hits returns the number of events recorded for the path
+func (p *PathStats) Hits() int {
+	hits := 0
+	for _, n := range p.Events {
+		hits += n
+	}
+	return hits
+}
+
+// Path returns the location of the statistics file
+func Path() string {
+	return filepath.Join(config.StateDir(), "stats.json")
+}
+
+// Record counts an event for a protected path if usage_stats is enabled.
+// The statistics never leave the machine.
+func Record(cfg *config.Config, event, rule, path string) error {
+	if !cfg.UsageStats {
+		return nil
+	}
+
+	if err := os.MkdirAll(config.StateDir(), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Concurrent invocations update the file one at a time
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	stats, err := decode(f)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if stats.Since.IsZero() {
+		stats.Since = now
+	}
+	stats.Events[event]++
+	if rule != "" {
+		stats.Rules[rule]++
+	}
+	p, ok := stats.Paths[path]
+	if !ok {
+		p = &PathStats{Events: make(map[string]int)}
+		stats.Paths[path] = p
+	}
+	p.Events[event]++
+	p.LastHit = now
+	stats.trim()
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(append(data, '\n'), 0)
+	return err
+}
+
+// Read returns the statistics recorded so far; none if there is no file
+func Read() (*Stats, error) {
+	f, err := os.Open(Path())
+	if os.IsNotExist(err) {
+		return decode(strings.NewReader(""))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decode(f)
+}
+
+// decode reads statistics, treating empty input as none
+func decode(r io.Reader) (*Stats, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, fmt.Errorf("invalid statistics file %s: %v", Path(), err)
+		}
+	}
+	if stats.Events == nil {
+		stats.Events = make(map[string]int)
+	}
+	if stats.Rules == nil {
+		stats.Rules = make(map[string]int)
+	}
+	if stats.Paths == nil {
+		stats.Paths = make(map[string]*PathStats)
+	}
+	for _, p := range stats.Paths {
+		if p.Events == nil {
+			p.Events = make(map[string]int)
+		}
+	}
+	return stats, nil
+}
+
+// trim drops the least hit paths (the least recently hit first among
+// equals) beyond maxPaths
+func (s *Stats) trim() {
+	if len(s.Paths) <= maxPaths {
+		return
+	}
+	for _, path := range s.TopPaths(0)[maxPaths:] {
+		delete(s.Paths, path)
+	}
+}
+
+// TopPaths returns the paths hit most often, at most limit of them (all
+// if limit is zero)
+func (s *Stats) TopPaths(limit int) []string {
+	var paths []string
+	for path := range s.Paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := s.Paths[paths[i]], s.Paths[paths[j]]
+		if a.Hits() != b.Hits() {
+			return a.Hits() > b.Hits()
+		}
+		if !a.LastHit.Equal(b.LastHit) {
+			return a.LastHit.After(b.LastHit)
+		}
+		return paths[i] < paths[j]
+	})
+	if limit > 0 && len(paths) > limit {
+		paths = paths[:limit]
+	}
+	return paths
+}
+
+// Show prints the statistics: the totals per event, the hits per rule and
+// the limit protected paths hit most often
+func Show(cfg *config.Config, limit int) error {
+	stats, err := Read()
+	if err != nil {
+		return err
+	}
+	if !cfg.UsageStats {
+		fmt.Println("Usage statistics are disabled; set usage_stats: true in the configuration to collect them.")
+		if len(stats.Paths) == 0 {
+			return nil
+		}
+		fmt.Println()
+	}
+	if len(stats.Paths) == 0 {
+		fmt.Println("No protected paths hit yet.")
+		return nil
+	}
+
+	fmt.Printf("Usage statistics since %s (%s):\n\n", stats.Since.Format("2006-01-02 15:04:05"), Path())
+	for _, event := range events {
+		fmt.Printf("  %-10s %d\n", event.label+":", stats.Events[event.name])
+	}
+
+	var rules []string
+	for rule := range stats.Rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if stats.Rules[rules[i]] != stats.Rules[rules[j]] {
+			return stats.Rules[rules[i]] > stats.Rules[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	fmt.Printf("\nHits by rule:\n")
+	for _, rule := range rules {
+		fmt.Printf("  %-30s %d\n", rule, stats.Rules[rule])
+	}
+
+	fmt.Printf("\nMost frequently hit protected paths:\n")
+	fmt.Printf("  %-6s %-6s %-8s %-6s %-7s %-20s %s\n", "HITS", "BLOCK", "CONFIRM", "ABORT", "BYPASS", "LAST HIT", "PATH")
+	for _, path := range stats.TopPaths(limit) {
+		p := stats.Paths[path]
+		fmt.Printf("  %-6d %-6d %-8d %-6d %-7d %-20s %s\n", p.Hits(), p.Events[EventBlock], p.Events[EventConfirm],
+			p.Events[EventAbort], p.Events[EventBypass], p.LastHit.Format("2006-01-02 15:04:05"), path)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package usage
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+)
+
+func TestRecord(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-usage-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	oldState := os.Getenv("XDG_STATE_HOME")
+	os.Setenv("XDG_STATE_HOME", tempDir)
+	defer os.Setenv("XDG_STATE_HOME", oldState)
+
+	// Nothing is recorded unless enabled
+	if err := Record(&config.Config{}, EventBlock, "system", "/etc"); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if _, err := os.Stat(Path()); !os.IsNotExist(err) {
+		t.Fatalf("statistics file written while disabled: %v", err)
+	}
+
+	cfg := &config.Config{UsageStats: true}
+	hits := []struct {
+		event, rule, path string
+	}{
+		{EventBlock, "system", "/etc"},
+		{EventBlock, "system", "/etc"},
+		{EventConfirm, "git", "/src/app/.git"},
+		{EventAbort, "git", "/src/app/.git"},
+		{EventConfirm, "git", "/src/app/.git"},
+		{EventBypass, "/data/*", "/data/old"},
+	}
+	for _, hit := range hits {
+		if err := Record(cfg, hit.event, hit.rule, hit.path); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	stats, err := Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if time.Since(stats.Since) > time.Minute {
+		t.Errorf("Since = %v, want the first hit", stats.Since)
+	}
+	wantEvents := map[string]int{EventBlock: 2, EventConfirm: 2, EventAbort: 1, EventBypass: 1}
+	if !reflect.DeepEqual(stats.Events, wantEvents) {
+		t.Errorf("Events = %v, want %v", stats.Events, wantEvents)
+	}
+	wantRules := map[string]int{"system": 2, "git": 3, "/data/*": 1}
+	if !reflect.DeepEqual(stats.Rules, wantRules) {
+		t.Errorf("Rules = %v, want %v", stats.Rules, wantRules)
+	}
+	if got, want := stats.TopPaths(2), []string{"/src/app/.git", "/etc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TopPaths(2) = %v, want %v", got, want)
+	}
+	if p := stats.Paths["/src/app/.git"]; p.Events[EventConfirm] != 2 || p.Events[EventAbort] != 1 || p.Hits() != 3 {
+		t.Errorf("/src/app/.git events = %v, want 2 confirms and 1 abort", p.Events)
+	}
+	if info, err := os.Stat(Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("statistics file mode = %v, %v, want 0600", info.Mode(), err)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	stats := &Stats{Paths: make(map[string]*PathStats)}
+	now := time.Now()
+	for i := 0; i < maxPaths+10; i++ {
+		hits := 1
+		if i < 5 {
+			hits = 2
+		}
+		stats.Paths[fmt.Sprintf("/p%d", i)] = &PathStats{Events: map[string]int{EventBlock: hits}, LastHit: now.Add(time.Duration(i) * time.Second)}
+	}
+	stats.trim()
+
+	if len(stats.Paths) != maxPaths {
+		t.Fatalf("%d paths kept, want %d", len(stats.Paths), maxPaths)
+	}
+	// The most hit are kept, then the most recently hit
+	for _, path := range []string{"/p0", "/p4", fmt.Sprintf("/p%d", maxPaths+9)} {
+		if _, ok := stats.Paths[path]; !ok {
+			t.Errorf("%s was dropped", path)
+		}
+	}
+	if _, ok := stats.Paths["/p5"]; ok {
+		t.Error("/p5, the least recently hit of the least hit, was kept")
+	}
+}
@@ -0,0 +1,116 @@
+// Package guard lets other Go programs gate their own destructive
+// operations (a --force cleanup, a prune command) with the protection rules
+// and configuration files used by safe-rm. Evaluating a path never modifies
+// anything: it only stats the path, and for recursive operations reads the
+// tree below it as the rule packs require.
+//
+//	decision := guard.Evaluate("/srv/app/releases", guard.Options{Recursive: true, Force: true})
+//	if !decision.Allowed() {
+//		return fmt.Errorf("refusing to remove %s: %s", decision.Path, decision.Reason)
+//	}
+package guard
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/safe-rm/internal/config"
+	"github.com/user/safe-rm/internal/protect"
+)
+
+// Actions of a Decision
+const (
+	Allow   = "allow"   // Not protected; go ahead
+	Warn    = "warn"    // Protected by a log-only rule; go ahead, but say so
+	Confirm = "confirm" // Protected; ask the user for explicit confirmation first
+	Block   = "block"   // Protected; refuse
+	Skip    = "skip"    // Nonexistent and ignored with Force
+	Error   = "error"   // The operation would fail before any rule applies
+)
+
+// Options describe the operation being gated, as the equivalent rm options
+type Options struct {
+	Recursive bool // The operation removes directories with their contents
+	Force     bool // No prompt can be shown, so confirmations become blocks
+}
+
+// Decision is the outcome of evaluating a path
+type Decision struct {
+	Path   string
+	Action string // One of Allow, Warn, Confirm, Block, Skip or Error
+	Reason string // The rule or condition deciding it
+}
+
+// Allowed reports whether the operation may go ahead without asking
+func (d Decision) Allowed() bool {
+	return d.Action == Allow || d.Action == Warn || d.Action == Skip
+}
+
+// Guard evaluates paths under one safe-rm configuration
+type Guard struct {
+	cfg *config.Config
+}
+
+// New returns a Guard using the safe-rm configuration of the current user
+// (~/.config/safe-rm/config.yml and SAFERM_* environment variables)
+func New() (*Guard, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{cfg: cfg}, nil
+}
+
+// SetClock makes the Guard evaluate time_policies at the times returned by
+// clock instead of the current time, for tests of programs using it. It is
+// the only injection point: a Guard never trashes anything, so no trash
+// path or host name depends on it.
+func (g *Guard) SetClock(clock func() time.Time) {
+	g.cfg.Clock = clock
+}
+
+// Evaluate reports what safe-rm's rules decide about removing path
+func (g *Guard) Evaluate(path string, opts Options) Decision {
+	decision := protect.Simulate(g.cfg, path, protect.SimulateOptions{
+		Recursive: opts.Recursive,
+		Force:     opts.Force,
+	})
+	return Decision{Path: decision.Path, Action: action(decision.Action), Reason: decision.Rule}
+}
+
+var (
+	defaultGuard    *Guard
+	defaultGuardErr error
+	defaultOnce     sync.Once
+)
+
+// Evaluate reports what safe-rm's rules decide about removing path, using
+// the configuration of the current user, loaded once. If the configuration
+// cannot be loaded every path is blocked.
+func Evaluate(path string, opts Options) Decision {
+	defaultOnce.Do(func() {
+		defaultGuard, defaultGuardErr = New()
+	})
+	if defaultGuardErr != nil {
+		return Decision{Path: path, Action: Block, Reason: "safe-rm configuration: " + defaultGuardErr.Error()}
+	}
+	return defaultGuard.Evaluate(path, opts)
+}
+
+// action maps a simulated rm action to a Decision action
+func action(simulated string) string {
+	switch simulated {
+	case protect.ActionTrash, protect.ActionDelete:
+		return Allow
+	case protect.ActionLogOnly:
+		return Warn
+	case protect.ActionConfirm:
+		return Confirm
+	case protect.ActionBlock:
+		return Block
+	case protect.ActionSkip:
+		return Skip
+	default:
+		return Error
+	}
+}
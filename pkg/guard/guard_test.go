@@ -0,0 +1,77 @@
+package guard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "saferm-guard-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	keys := filepath.Join(tempDir, "keys")
+	build := filepath.Join(tempDir, "build")
+	releases := filepath.Join(tempDir, "releases")
+	notes := filepath.Join(tempDir, "notes.txt")
+	for _, dir := range []string{keys, build, releases} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(notes, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldConfig := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, "config"))
+	defer os.Setenv("XDG_CONFIG_HOME", oldConfig)
+	configFile := filepath.Join(tempDir, "config", "safe-rm", "config.yml")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "protected_paths:\n  - " + keys + "\n  - " + notes + "\nrule_actions:\n  " + notes + ": log-only\n" +
+		"time_policies:\n  - paths: [" + releases + "]\n    window: \"02:00-04:00\"\n    timezone: UTC\n    inside: confirm\n    outside: log-only\n"
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g.SetClock(func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) })
+	tests := []struct {
+		name        string
+		path        string
+		opts        Options
+		want        string
+		wantAllowed bool
+	}{
+		{"unprotected", build, Options{Recursive: true}, Allow, true},
+		{"protected", keys, Options{Recursive: true}, Confirm, false},
+		{"protected with force", keys, Options{Recursive: true, Force: true}, Block, false},
+		{"log-only", notes, Options{}, Warn, true},
+		{"time policy", releases, Options{Recursive: true}, Warn, true},
+		{"directory without recursive", build, Options{}, Error, false},
+		{"missing with force", filepath.Join(tempDir, "gone"), Options{Force: true}, Skip, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := g.Evaluate(tt.path, tt.opts)
+			if decision.Action != tt.want || decision.Allowed() != tt.wantAllowed {
+				t.Errorf("Evaluate(%q) = %+v, want %s (allowed %v)", tt.path, decision, tt.want, tt.wantAllowed)
+			}
+		})
+	}
+
+	// Inside the window of the time policy
+	g.SetClock(func() time.Time { return time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC) })
+	if decision := g.Evaluate(releases, Options{Recursive: true}); decision.Action != Confirm {
+		t.Errorf("Evaluate(%q) with a fake clock = %+v, want %s", releases, decision, Confirm)
+	}
+}